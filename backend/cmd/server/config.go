@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/ayush/accountability-app/backend/internal/config"
+)
+
+// runConfig implements the config subcommands and returns the process exit code
+func runConfig(cfg *config.Config, args []string) int {
+	if len(args) == 0 {
+		usage()
+		return 2
+	}
+
+	switch args[0] {
+	case "print":
+		out, err := cfg.YAML()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if cfg.Path() != "" {
+			fmt.Printf("# loaded from %s\n", cfg.Path())
+		} else {
+			fmt.Println("# no config file found, using defaults and environment")
+		}
+		os.Stdout.Write(out)
+
+		// Still show problems so the printed config is not mistaken for a working one
+		if err := cfg.Validate(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	case "validate":
+		if err := cfg.Validate(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Println("configuration is valid")
+	default:
+		fmt.Fprintf(os.Stderr, "unknown config command %q\n\n", args[0])
+		usage()
+		return 2
+	}
+	return 0
+}
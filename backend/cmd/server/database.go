@@ -0,0 +1,35 @@
+package main
+
+import (
+	"github.com/ayush/accountability-app/backend/internal/config"
+	"github.com/ayush/accountability-app/backend/internal/metrics"
+	"github.com/ayush/accountability-app/backend/internal/ratelimit"
+	"github.com/ayush/accountability-app/backend/internal/tracing"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// openDatabase connects to Postgres and registers the metrics and tracing plugins.
+// Driver errors are translated so repositories can detect uniqueness violations.
+func openDatabase(cfg *config.Config) (*gorm.DB, error) {
+	db, err := gorm.Open(postgres.Open(cfg.GetDSN()), &gorm.Config{TranslateError: true})
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Use(metrics.GormPlugin{}); err != nil {
+		return nil, err
+	}
+	if err := db.Use(tracing.GormPlugin{}); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// newRateLimitStore returns the store selected by rate_limit.store
+func newRateLimitStore(cfg *config.Config, db *gorm.DB) ratelimit.Store {
+	if cfg.RateLimit.Store == "memory" {
+		return ratelimit.NewMemoryStore()
+	}
+	return ratelimit.NewPostgresStore(db)
+}
@@ -1,19 +1,15 @@
 package main
 
 import (
-	"log"
+	"flag"
+	"fmt"
+	"os"
 
-	"github.com/ayush/accountability-app/backend/docs"
-	"github.com/ayush/accountability-app/backend/internal/api"
+	"github.com/ayush/accountability-app/backend/internal/auth"
 	"github.com/ayush/accountability-app/backend/internal/config"
-	"github.com/ayush/accountability-app/backend/internal/middleware"
-	"github.com/ayush/accountability-app/backend/internal/models"
-
-	"github.com/gin-gonic/gin"
-	swaggerFiles "github.com/swaggo/files"
-	ginSwagger "github.com/swaggo/gin-swagger"
-	"gorm.io/driver/postgres"
-	"gorm.io/gorm"
+	"github.com/ayush/accountability-app/backend/internal/logger"
+
+	"go.uber.org/zap"
 )
 
 // @title           Accountability App API
@@ -36,65 +32,79 @@ import (
 // @name Authorization
 // @description Type "Bearer" followed by a space and JWT token.
 func main() {
-	// Load configuration
-	cfg, err := config.LoadConfig()
+	flags := flag.NewFlagSet("server", flag.ExitOnError)
+	configPath := flags.String("config", os.Getenv("APP_CONFIG"), "path to the config file (default: search for config.yaml)")
+	flags.Usage = func() {
+		usage()
+		flags.PrintDefaults()
+	}
+	flags.Parse(os.Args[1:])
+
+	cfg, err := config.Load(*configPath)
 	if err != nil {
-		log.Fatalf("Failed to load configuration: %v", err)
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
 
-	// Set Gin mode based on environment
-	if cfg.Server.Environment == "production" {
-		gin.SetMode(gin.ReleaseMode)
+	args := flags.Args()
+	command := "serve"
+	if len(args) > 0 {
+		command, args = args[0], args[1:]
 	}
 
-	// Initialize database
-	db, err := gorm.Open(postgres.Open(cfg.GetDSN()), &gorm.Config{})
-	if err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
+	// These inspect the configuration, so they must work even when it is invalid
+	switch command {
+	case "config":
+		os.Exit(runConfig(cfg, args))
+	case "help":
+		usage()
+		return
 	}
 
-	// Auto migrate database schemas
-	err = db.AutoMigrate(&models.User{}, &models.Call{}, &models.CallParticipant{})
-	if err != nil {
-		log.Fatalf("Failed to migrate database: %v", err)
+	if err := cfg.Validate(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
 
-	// Initialize handlers
-	userHandler := api.NewUserHandler(db)
-	callHandler := api.NewVideoCallHandler(db)
-	wsHandler := api.NewWSHandler(cfg.GetWebSocketConfig())
-
-	// Initialize Gin router
-	router := gin.Default()
-
-	// Initialize Swagger docs
-	docs.SwaggerInfo.BasePath = "/api"
-	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
-
-	// Public routes
-	router.POST("/api/users/register", userHandler.Register)
-	router.POST("/api/users/login", userHandler.Login)
-
-	// Protected routes
-	protected := router.Group("/api")
-	protected.Use(middleware.AuthMiddleware())
-	{
-		// User routes
-		protected.GET("/users/:id", userHandler.GetUser)
-
-		// Call routes
-		protected.POST("/calls", callHandler.CreateCall)
-		protected.POST("/calls/join", callHandler.JoinCall)
-		protected.POST("/calls/:room_id/leave", callHandler.LeaveCall)
-		protected.GET("/calls", callHandler.ListActiveCalls)
-
-		// WebSocket route
-		protected.GET("/ws", wsHandler.HandleWebSocket)
-		protected.GET("/rooms/:room_id/participants", wsHandler.GetRoomParticipants)
+	logger.Initialize(cfg.Server.Environment)
+	defer logger.Sync()
+	if err := logger.SetLevel(cfg.Server.LogLevel); err != nil {
+		logger.Fatal("Failed to set log level", zap.Error(err))
 	}
 
-	// Start the server
-	if err := router.Run(cfg.GetServerAddress()); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+	auth.Configure(cfg.JWT.Secret, cfg.GetTokenTTL())
+
+	switch command {
+	case "serve":
+		runServer(cfg, *configPath)
+	case "migrate":
+		os.Exit(runMigrate(cfg, args))
+	case "user":
+		os.Exit(runUser(cfg, args))
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", command)
+		usage()
+		os.Exit(2)
 	}
 }
+
+func usage() {
+	fmt.Fprint(os.Stderr, `Usage: server [--config path] [command]
+
+Commands:
+  serve                 Run the HTTP and WebSocket server (default)
+  migrate up            Apply all pending database migrations
+  migrate down [steps]  Revert the last applied migration, or the given number of them
+  migrate status        List migrations and whether they have been applied
+  user set-role <email> <role>
+                        Make an account a user, moderator or admin
+  user set-email <id> <email>
+                        Change an account's email address, marking it unverified
+  config print          Show the effective configuration with secrets redacted
+  config validate       Check the configuration and list every problem
+
+Every setting can be overridden with an APP_<SECTION>_<FIELD> environment
+variable, e.g. APP_SERVER_PORT=9090 or APP_WEBSOCKET_ALLOWED_ORIGINS=a,b.
+
+`)
+}
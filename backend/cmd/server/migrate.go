@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ayush/accountability-app/backend/internal/config"
+	"github.com/ayush/accountability-app/backend/internal/migrations"
+)
+
+// runMigrate implements the migrate subcommands and returns the process exit code
+func runMigrate(cfg *config.Config, args []string) int {
+	if len(args) == 0 {
+		usage()
+		return 2
+	}
+
+	db, err := openDatabase(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to connect to database: %v\n", err)
+		return 1
+	}
+
+	migrator, err := migrations.New(db)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to load migrations: %v\n", err)
+		return 1
+	}
+
+	ctx := context.Background()
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		for _, m := range applied {
+			fmt.Printf("applied  %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if len(applied) == 0 {
+			fmt.Println("database is up to date")
+		}
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				fmt.Fprintf(os.Stderr, "invalid number of steps %q\n", args[1])
+				return 2
+			}
+		}
+		reverted, err := migrator.Down(ctx, steps)
+		for _, m := range reverted {
+			fmt.Printf("reverted %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if len(reverted) == 0 {
+			fmt.Println("no migrations to revert")
+		}
+
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+		for _, s := range statuses {
+			state, appliedAt := "pending", ""
+			if s.Applied {
+				state = "applied"
+				appliedAt = s.AppliedAt.Format(time.RFC3339)
+			}
+			if s.Unknown {
+				state = "applied (unknown to this binary)"
+			}
+			fmt.Fprintf(w, "%04d\t%s\t%s\t%s\n", s.Version, s.Name, state, appliedAt)
+		}
+		w.Flush()
+
+	default:
+		fmt.Fprintf(os.Stderr, "unknown migrate command %q\n\n", args[0])
+		usage()
+		return 2
+	}
+
+	return 0
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/ayush/accountability-app/backend/internal/api"
+	"github.com/ayush/accountability-app/backend/internal/config"
+	"github.com/ayush/accountability-app/backend/internal/logger"
+	"github.com/ayush/accountability-app/backend/internal/origin"
+	"github.com/ayush/accountability-app/backend/internal/ratelimit"
+
+	"go.uber.org/zap"
+)
+
+// reloader re-reads the configuration and applies the settings that can
+// change without a restart: the log level, the cors section, the websocket
+// section (room capacity and message rate limits) and the rate limits
+type reloader struct {
+	// path is the --config value; empty searches the default locations again
+	path string
+
+	// started is the configuration the server was started with
+	started *config.Config
+
+	wsHandler *api.WSHandler
+	origins   *origin.Policy
+	limiter   *ratelimit.Limiter
+}
+
+// reload applies the current configuration file. An invalid file is logged
+// and ignored so a typo never takes down a running server.
+func (r *reloader) reload() {
+	cfg, err := config.Load(r.path)
+	if err == nil {
+		err = cfg.Validate()
+	}
+	if err != nil {
+		logger.Error("Failed to reload configuration, keeping the current one", zap.Error(err))
+		return
+	}
+
+	if err := logger.SetLevel(cfg.Server.LogLevel); err != nil {
+		logger.Error("Failed to change log level", zap.Error(err))
+	}
+	if err := r.origins.Update(cfg.GetCORSConfig()); err != nil {
+		logger.Error("Failed to update origin policy", zap.Error(err))
+	}
+	r.wsHandler.SetConfig(cfg.GetWebSocketConfig())
+	r.limiter.Update(cfg.RateLimit)
+
+	for _, section := range restartRequired(r.started, cfg) {
+		logger.Warn("Configuration change needs a restart to take effect", zap.String("section", section))
+	}
+
+	logger.Info("Configuration reloaded",
+		zap.String("path", cfg.Path()),
+		zap.Stringer("log_level", logger.Level()),
+		zap.Strings("allowed_origins", cfg.GetCORSConfig().AllowedOrigins),
+		zap.Int("max_clients_per_room", cfg.WebSocket.MaxClientsPerRoom),
+		zap.Float64("message_rate_limit", cfg.WebSocket.MessageRateLimit))
+}
+
+// restartRequired returns the sections whose changes are only read at startup
+func restartRequired(old, updated *config.Config) []string {
+	a, b := *old, *updated
+	a.Server.LogLevel, b.Server.LogLevel = "", ""
+	a.WebSocket, b.WebSocket = config.WebSocketConfig{}, config.WebSocketConfig{}
+	a.CORS, b.CORS = config.CORSConfig{}, config.CORSConfig{}
+	a.RateLimit, b.RateLimit = config.RateLimitConfig{Store: a.RateLimit.Store}, config.RateLimitConfig{Store: b.RateLimit.Store}
+
+	var sections []string
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	for i := 0; i < va.NumField(); i++ {
+		field := va.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		if !reflect.DeepEqual(va.Field(i).Interface(), vb.Field(i).Interface()) {
+			sections = append(sections, strings.Split(field.Tag.Get("yaml"), ",")[0])
+		}
+	}
+	return sections
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/ayush/accountability-app/backend/docs"
+	"github.com/ayush/accountability-app/backend/internal/api"
+	"github.com/ayush/accountability-app/backend/internal/config"
+	"github.com/ayush/accountability-app/backend/internal/logger"
+	"github.com/ayush/accountability-app/backend/internal/mail"
+	"github.com/ayush/accountability-app/backend/internal/metrics"
+	"github.com/ayush/accountability-app/backend/internal/middleware"
+	"github.com/ayush/accountability-app/backend/internal/migrations"
+	"github.com/ayush/accountability-app/backend/internal/origin"
+	"github.com/ayush/accountability-app/backend/internal/ratelimit"
+	"github.com/ayush/accountability-app/backend/internal/repository"
+	"github.com/ayush/accountability-app/backend/internal/sso"
+	"github.com/ayush/accountability-app/backend/internal/storage"
+	"github.com/ayush/accountability-app/backend/internal/tracing"
+	ws "github.com/ayush/accountability-app/backend/internal/websocket"
+
+	"github.com/gin-gonic/gin"
+	swaggerFiles "github.com/swaggo/files"
+	ginSwagger "github.com/swaggo/gin-swagger"
+	"go.uber.org/zap"
+)
+
+// runServer serves the API until SIGINT or SIGTERM, then shuts down gracefully.
+// SIGHUP or an edit to the config file reloads the settings that allow it.
+func runServer(cfg *config.Config, configPath string) {
+	// Set Gin mode based on environment
+	if cfg.Server.Environment == "production" {
+		gin.SetMode(gin.ReleaseMode)
+	}
+
+	// Initialize tracing
+	shutdownTracing, err := tracing.Init(context.Background(), cfg.Tracing)
+	if err != nil {
+		logger.Fatal("Failed to initialize tracing", zap.Error(err))
+	}
+
+	// Initialize database
+	db, err := openDatabase(cfg)
+	if err != nil {
+		logger.Fatal("Failed to connect to database", zap.Error(err))
+	}
+
+	// Apply pending migrations; the advisory lock keeps concurrent replicas safe
+	if cfg.Database.MigrateOnStart {
+		migrator, err := migrations.New(db)
+		if err != nil {
+			logger.Fatal("Failed to load migrations", zap.Error(err))
+		}
+		if _, err := migrator.Up(context.Background()); err != nil {
+			logger.Fatal("Failed to migrate database", zap.Error(err))
+		}
+	}
+
+	// Initialize handlers
+	repos := repository.NewGormRepositories(db)
+	promoteAdmins(context.Background(), repos.Users, cfg.Server.AdminEmails)
+	limiter := ratelimit.New(newRateLimitStore(cfg, db), cfg.RateLimit)
+	mailer, err := mail.New(cfg.Mail)
+	if err != nil {
+		logger.Fatal("Failed to configure mail", zap.Error(err))
+	}
+	origins, err := origin.NewPolicy(cfg.GetCORSConfig())
+	if err != nil {
+		logger.Fatal("Failed to build origin policy", zap.Error(err))
+	}
+	store, err := storage.New(cfg.Storage)
+	if err != nil {
+		logger.Fatal("Failed to configure storage", zap.Error(err))
+	}
+	hub := ws.NewHub()
+	go hub.Run()
+	sessionHandler := api.NewSessionHandler(repos.Sessions, hub)
+	verificationHandler := api.NewEmailVerificationHandler(repos.Users, mailer, cfg.EmailVerification.URL, cfg.GetEmailVerificationTTL())
+	twoFactorHandler := api.NewTwoFactorHandler(repos.Users, repos.RecoveryCodes, limiter, sessionHandler, cfg.TwoFactor.Issuer, cfg.GetTwoFactorChallengeTTL())
+	avatarHandler := api.NewAvatarHandler(repos.Users, store, cfg.Storage.MaxAvatarBytes)
+	wsHandler := api.NewWSHandler(hub, cfg.GetWebSocketConfig(), origins, repos.Calls)
+	handlers := api.Handlers{
+		Users:          api.NewUserHandler(repos.Users, limiter, verificationHandler, twoFactorHandler, sessionHandler, avatarHandler),
+		Accounts:       api.NewAccountHandler(repos, limiter, sessionHandler, avatarHandler, twoFactorHandler),
+		Avatars:        avatarHandler,
+		Verification:   verificationHandler,
+		TwoFactor:      twoFactorHandler,
+		PasswordResets: api.NewPasswordResetHandler(repos.Users, repos.PasswordResets, sessionHandler, mailer, cfg.PasswordReset.URL, cfg.GetPasswordResetTTL()),
+		OIDC:           api.NewOIDCHandler(sso.NewRegistry(cfg.OIDC, cfg.GetOIDCStateTTL()), repos.Users, repos.Identities, verificationHandler, twoFactorHandler, sessionHandler, cfg.OIDC.FrontendURL),
+		Sessions:       sessionHandler,
+		APIKeys:        api.NewAPIKeyHandler(repos.APIKeys, hub),
+		Calls:          api.NewVideoCallHandler(repos.Calls, repos.Participants, hub),
+		Attendance:     api.NewAttendanceHandler(repos.Calls, repos.Participants, repos.Users),
+		WebSocket:      wsHandler,
+		Health:         api.NewHealthHandler(db, hub),
+		Admin:          api.NewAdminHandler(repos.Users, repos.Calls, repos.Participants, hub),
+	}
+
+	// Initialize Gin router
+	router := gin.New()
+	if err := router.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		logger.Fatal("Invalid trusted proxies", zap.Error(err))
+	}
+	router.Use(
+		tracing.GinMiddleware(),
+		middleware.RequestLogger(),
+		middleware.Recovery(),
+		metrics.GinMiddleware(),
+		middleware.CORS(origins),
+	)
+
+	// Initialize Swagger docs
+	docs.SwaggerInfo.BasePath = "/api"
+	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
+
+	// Uploaded media, when kept on local disk
+	if cfg.Storage.Driver == "local" {
+		router.Static("/media", cfg.Storage.Dir)
+	}
+
+	api.RegisterRoutes(router, handlers, api.RouteDeps{
+		Repos:                repos,
+		Limiter:              limiter,
+		RequireVerifiedEmail: cfg.EmailVerification.Required,
+	})
+
+	srv := &http.Server{
+		Addr:    cfg.GetServerAddress(),
+		Handler: router,
+	}
+
+	// Start the server
+	go func() {
+		logger.Info("Listening", zap.String("addr", srv.Addr))
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Fatal("Failed to start server", zap.Error(err))
+		}
+	}()
+
+	// Metrics are served on their own port so they are not public with the API
+	var metricsSrv *http.Server
+	if addr := cfg.GetMetricsAddress(); addr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics.Handler())
+		metricsSrv = &http.Server{Addr: addr, Handler: mux}
+		go func() {
+			logger.Info("Serving metrics", zap.String("addr", metricsSrv.Addr))
+			if err := metricsSrv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logger.Fatal("Failed to start metrics server", zap.Error(err))
+			}
+		}()
+	}
+
+	// Wait for a termination signal
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	go limiter.RunCleanup(ctx, time.Minute)
+
+	reload := &reloader{path: configPath, started: cfg, wsHandler: wsHandler, origins: origins, limiter: limiter}
+	if err := config.Watch(ctx, cfg.Path(), reload.reload); err != nil {
+		logger.Warn("Config file changes will not be picked up, send SIGHUP to reload", zap.Error(err))
+	}
+
+	<-ctx.Done()
+	stop()
+
+	logger.Info("Shutting down server", zap.Duration("timeout", cfg.GetShutdownTimeout()))
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.GetShutdownTimeout())
+	defer cancel()
+
+	// WebSocket connections are hijacked and not tracked by http.Server, so
+	// close them through the hub before shutting down the HTTP server
+	if err := wsHandler.Shutdown(shutdownCtx); err != nil {
+		logger.Warn("WebSocket shutdown incomplete", zap.Error(err))
+	}
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		logger.Warn("HTTP server shutdown incomplete", zap.Error(err))
+	}
+	if metricsSrv != nil {
+		if err := metricsSrv.Shutdown(shutdownCtx); err != nil {
+			logger.Warn("Metrics server shutdown incomplete", zap.Error(err))
+		}
+	}
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		logger.Warn("Failed to flush traces", zap.Error(err))
+	}
+
+	logger.Info("Server stopped")
+}
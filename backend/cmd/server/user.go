@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/mail"
+	"os"
+	"strconv"
+
+	"github.com/ayush/accountability-app/backend/internal/api"
+	"github.com/ayush/accountability-app/backend/internal/auth"
+	"github.com/ayush/accountability-app/backend/internal/config"
+	"github.com/ayush/accountability-app/backend/internal/logger"
+	"github.com/ayush/accountability-app/backend/internal/repository"
+
+	"go.uber.org/zap"
+)
+
+// runUser implements the user subcommands and returns the process exit code
+func runUser(cfg *config.Config, args []string) int {
+	if len(args) == 0 {
+		usage()
+		return 2
+	}
+
+	switch args[0] {
+	case "set-role":
+		if len(args) != 3 {
+			fmt.Fprintln(os.Stderr, "usage: server user set-role <email> <role>")
+			return 2
+		}
+		role, ok := auth.ParseRole(args[2])
+		if !ok {
+			fmt.Fprintf(os.Stderr, "unknown role %q, expected user, moderator or admin\n", args[2])
+			return 2
+		}
+
+		db, err := openDatabase(cfg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to connect to database: %v\n", err)
+			return 1
+		}
+		users := repository.NewGormRepositories(db).Users
+
+		ctx := context.Background()
+		user, err := users.GetByEmail(ctx, api.NormalizeEmail(args[1]))
+		if errors.Is(err, repository.ErrNotFound) {
+			fmt.Fprintf(os.Stderr, "no user with email %q\n", args[1])
+			return 1
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to look up user: %v\n", err)
+			return 1
+		}
+		if err := users.SetRole(ctx, user.ID, string(role)); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to set role: %v\n", err)
+			return 1
+		}
+		fmt.Printf("%s is now %s\n", user.Email, role)
+
+	case "set-email":
+		// Accounts are picked by ID because the ones that need this, such as
+		// those given a duplicate:<id>@duplicate.invalid placeholder by
+		// migration 0010, cannot be found by a usable address
+		if len(args) != 3 {
+			fmt.Fprintln(os.Stderr, "usage: server user set-email <id> <email>")
+			return 2
+		}
+		id, err := strconv.ParseUint(args[1], 10, 32)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid user ID %q\n", args[1])
+			return 2
+		}
+		email := api.NormalizeEmail(args[2])
+		if addr, err := mail.ParseAddress(email); err != nil || addr.Address != email {
+			fmt.Fprintf(os.Stderr, "invalid email address %q\n", args[2])
+			return 2
+		}
+
+		db, err := openDatabase(cfg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to connect to database: %v\n", err)
+			return 1
+		}
+		users := repository.NewGormRepositories(db).Users
+
+		ctx := context.Background()
+		user, err := users.GetByID(ctx, uint(id))
+		if errors.Is(err, repository.ErrNotFound) {
+			fmt.Fprintf(os.Stderr, "no user with ID %d\n", id)
+			return 1
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to look up user: %v\n", err)
+			return 1
+		}
+		err = users.UpdateEmail(ctx, user.ID, email)
+		if errors.Is(err, repository.ErrDuplicate) {
+			fmt.Fprintf(os.Stderr, "%s already belongs to another account\n", email)
+			return 1
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to set email: %v\n", err)
+			return 1
+		}
+		fmt.Printf("%s now has email %s, unverified until the user verifies it\n", user.Username, email)
+
+	default:
+		fmt.Fprintf(os.Stderr, "unknown user command %q\n\n", args[0])
+		usage()
+		return 2
+	}
+
+	return 0
+}
+
+// promoteAdmins gives the accounts listed in the deprecated
+// server.admin_emails setting the admin role. Removing an address from the
+// list does not demote the account. Anyone can register or change to an
+// address, so only accounts that verified it are promoted. Entries are
+// normalized as registration normalizes addresses.
+func promoteAdmins(ctx context.Context, users repository.UserRepository, emails []string) {
+	if len(emails) > 0 {
+		logger.Warn("server.admin_emails is deprecated, use `server user set-role <email> admin` instead")
+	}
+	for _, email := range emails {
+		email = api.NormalizeEmail(email)
+		user, err := users.GetByEmail(ctx, email)
+		if errors.Is(err, repository.ErrNotFound) {
+			logger.Warn("Account in server.admin_emails does not exist", zap.String("email", email))
+			continue
+		}
+		if err != nil {
+			logger.Error("Failed to look up admin account", zap.Error(err), zap.String("email", email))
+			continue
+		}
+		if auth.Role(user.Role) == auth.RoleAdmin {
+			continue
+		}
+		if !user.IsEmailVerified() {
+			logger.Warn("Not promoting account in server.admin_emails, its email is not verified",
+				zap.String("email", email), zap.Uint("user_id", user.ID))
+			continue
+		}
+		if err := users.SetRole(ctx, user.ID, string(auth.RoleAdmin)); err != nil {
+			logger.Error("Failed to promote admin account", zap.Error(err), zap.String("email", email))
+			continue
+		}
+		logger.Info("Promoted account from server.admin_emails to admin", zap.Uint("user_id", user.ID))
+	}
+}
@@ -0,0 +1,352 @@
+package api
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/ayush/accountability-app/backend/internal/logger"
+	"github.com/ayush/accountability-app/backend/internal/models"
+	"github.com/ayush/accountability-app/backend/internal/ratelimit"
+	"github.com/ayush/accountability-app/backend/internal/repository"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// recentLoginWindow is how soon after logging in an account with neither a
+// password nor two-factor authentication can be deleted, so a leaked token
+// alone is not enough
+const recentLoginWindow = 10 * time.Minute
+
+// AccountHandler lets users export their personal data and delete their
+// account
+type AccountHandler struct {
+	repos     *repository.Repositories
+	limiter   *ratelimit.Limiter
+	sessions  *SessionHandler
+	avatars   *AvatarHandler
+	twoFactor *TwoFactorHandler
+}
+
+// DeleteAccountRequest confirms deleting the account
+type DeleteAccountRequest struct {
+	// Password is the current password; accounts created through OpenID
+	// Connect that never set one leave it empty
+	Password string `json:"password" example:"secret123"`
+
+	// Code is a TOTP or recovery code, required when two-factor
+	// authentication is enabled
+	Code string `json:"code" example:"123456"`
+}
+
+// ExportProfile is the account as stored, including fields the API does not
+// otherwise show
+type ExportProfile struct {
+	UserResponse
+
+	Role             string     `json:"role" example:"user"`
+	EmailVerifiedAt  *time.Time `json:"email_verified_at"`
+	TwoFactorEnabled bool       `json:"two_factor_enabled" example:"false"`
+	DisabledAt       *time.Time `json:"disabled_at"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+}
+
+// ExportCall is a call the user created or joined
+type ExportCall struct {
+	ID          uint      `json:"id" example:"1"`
+	Title       string    `json:"title" example:"Morning writing sprint"`
+	Description string    `json:"description" example:"Two hours, cameras on"`
+	Status      string    `json:"status" example:"active"`
+	CreatedAt   time.Time `json:"created_at"`
+
+	// Creator is set on calls the user created
+	Creator bool `json:"creator" example:"true"`
+
+	// Attendance lists each time the user joined the call and left it
+	Attendance []AttendanceSession `json:"attendance"`
+}
+
+// ExportIdentity is an OpenID Connect account linked to the user
+type ExportIdentity struct {
+	Provider    string     `json:"provider" example:"google"`
+	Subject     string     `json:"subject" example:"10769150350006150715113082367"`
+	Email       string     `json:"email" example:"john@example.com"`
+	LastLoginAt *time.Time `json:"last_login_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// DataExport is everything stored about a user
+type DataExport struct {
+	ExportedAt time.Time         `json:"exported_at"`
+	Profile    ExportProfile     `json:"profile"`
+	Calls      []ExportCall      `json:"calls"`
+	Sessions   []SessionResponse `json:"sessions"`
+	APIKeys    []APIKeyResponse  `json:"api_keys"`
+	Identities []ExportIdentity  `json:"identities"`
+}
+
+// NewAccountHandler creates an account handler; limiter throttles wrong
+// passwords and codes, sessions logs the deleted account out everywhere,
+// avatars deletes its uploaded avatar and twoFactor checks second factors
+func NewAccountHandler(repos *repository.Repositories, limiter *ratelimit.Limiter, sessions *SessionHandler, avatars *AvatarHandler, twoFactor *TwoFactorHandler) *AccountHandler {
+	return &AccountHandler{repos: repos, limiter: limiter, sessions: sessions, avatars: avatars, twoFactor: twoFactor}
+}
+
+// Export godoc
+// @Summary Export personal data
+// @Description Download everything stored about the current user: the profile, calls created or joined, sessions with their IP addresses, API keys (without secrets) and linked OpenID Connect accounts. By default the archive is a ZIP with one JSON file per section; format=json returns a single JSON document instead.
+// @Tags users
+// @Produce application/zip
+// @Produce json
+// @Param format query string false "zip (default) or json"
+// @Success 200 {object} DataExport
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /users/me/export [get]
+func (h *AccountHandler) Export(c *gin.Context) {
+	log := logger.FromContext(c.Request.Context())
+
+	format := c.DefaultQuery("format", "zip")
+	if format != "zip" && format != "json" {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: `format must be "zip" or "json"`})
+		return
+	}
+
+	user, ok := currentUser(c, h.repos.Users)
+	if !ok {
+		return
+	}
+	export, err := h.collect(c, user)
+	if err != nil {
+		log.Error("Failed to export personal data", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to export personal data"})
+		return
+	}
+
+	name := fmt.Sprintf("accountability-export-%d-%s", user.ID, export.ExportedAt.Format("20060102"))
+	log.Info("Personal data exported", zap.Uint("user_id", user.ID), zap.String("format", format))
+
+	if format == "json" {
+		c.Header("Content-Disposition", `attachment; filename="`+name+`.json"`)
+		c.JSON(http.StatusOK, export)
+		return
+	}
+
+	c.Header("Content-Disposition", `attachment; filename="`+name+`.zip"`)
+	c.Header("Content-Type", "application/zip")
+	c.Status(http.StatusOK)
+	archive := zip.NewWriter(c.Writer)
+	for _, file := range []struct {
+		name    string
+		content interface{}
+	}{
+		{"profile.json", export.Profile},
+		{"calls.json", export.Calls},
+		{"sessions.json", export.Sessions},
+		{"api_keys.json", export.APIKeys},
+		{"identities.json", export.Identities},
+	} {
+		w, err := archive.CreateHeader(&zip.FileHeader{Name: file.name, Method: zip.Deflate, Modified: export.ExportedAt})
+		if err == nil {
+			enc := json.NewEncoder(w)
+			enc.SetIndent("", "  ")
+			err = enc.Encode(file.content)
+		}
+		if err != nil {
+			// The status is already sent; the client sees a broken archive
+			log.Error("Failed to write export archive", zap.Error(err))
+			return
+		}
+	}
+	if err := archive.Close(); err != nil {
+		log.Error("Failed to write export archive", zap.Error(err))
+	}
+}
+
+// collect gathers the personal data stored about user
+func (h *AccountHandler) collect(c *gin.Context, user *models.User) (*DataExport, error) {
+	ctx := c.Request.Context()
+
+	export := &DataExport{
+		ExportedAt: time.Now().UTC(),
+		Profile: ExportProfile{
+			UserResponse:     newUserResponse(user),
+			Role:             user.Role,
+			EmailVerifiedAt:  user.EmailVerifiedAt,
+			TwoFactorEnabled: user.IsTwoFactorEnabled(),
+			DisabledAt:       user.DisabledAt,
+			CreatedAt:        user.CreatedAt,
+			UpdatedAt:        user.UpdatedAt,
+		},
+	}
+
+	calls, err := h.repos.Calls.ListByUser(ctx, user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list calls: %w", err)
+	}
+	participants, err := h.repos.Participants.ListByUser(ctx, user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list call participation: %w", err)
+	}
+	byCall := make(map[uint][]models.CallParticipant, len(participants))
+	for _, p := range participants {
+		byCall[p.CallID] = append(byCall[p.CallID], p)
+	}
+	now := time.Now()
+	export.Calls = make([]ExportCall, 0, len(calls))
+	for _, call := range calls {
+		attendance, _, _ := summarizeAttendance(byCall[call.ID], now)
+		entry := ExportCall{
+			ID:          call.ID,
+			Title:       call.Title,
+			Description: call.Description,
+			Status:      call.Status,
+			CreatedAt:   call.CreatedAt,
+			Creator:     call.CreatorID == user.ID,
+			Attendance:  attendance,
+		}
+		export.Calls = append(export.Calls, entry)
+	}
+
+	sessions, err := h.repos.Sessions.ListByUser(ctx, user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	export.Sessions = make([]SessionResponse, 0, len(sessions))
+	for i := range sessions {
+		export.Sessions = append(export.Sessions, newSessionResponse(&sessions[i], c.GetUint("session_id")))
+	}
+
+	keys, err := h.repos.APIKeys.ListByUser(ctx, user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list API keys: %w", err)
+	}
+	export.APIKeys = make([]APIKeyResponse, 0, len(keys))
+	for i := range keys {
+		export.APIKeys = append(export.APIKeys, newAPIKeyResponse(&keys[i]))
+	}
+
+	identities, err := h.repos.Identities.ListByUser(ctx, user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list linked accounts: %w", err)
+	}
+	export.Identities = make([]ExportIdentity, 0, len(identities))
+	for _, identity := range identities {
+		export.Identities = append(export.Identities, ExportIdentity{
+			Provider:    identity.Provider,
+			Subject:     identity.Subject,
+			Email:       identity.Email,
+			LastLoginAt: identity.LastLoginAt,
+			CreatedAt:   identity.CreatedAt,
+		})
+	}
+
+	return export, nil
+}
+
+// Delete godoc
+// @Summary Delete the account
+// @Description Delete the current user's account. The username, email address, password, profile, avatar and two-factor settings are erased, every session is logged out and its WebSocket connections closed, and API keys, linked OpenID Connect accounts and session records are removed. Calls the user created or joined keep referring to the anonymized account. Requires the current password unless the account never had one, and a TOTP or recovery code when two-factor authentication is enabled. Accounts with neither, such as those created through OpenID Connect, can only be deleted with a token from a login in the last 10 minutes; otherwise the response is 403 and the user has to log in with their provider again.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param request body DeleteAccountRequest false "Current password and two-factor code"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 429 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /users/me [delete]
+func (h *AccountHandler) Delete(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := logger.FromContext(ctx)
+
+	var req DeleteAccountRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+	}
+
+	user, ok := currentUser(c, h.repos.Users)
+	if !ok {
+		return
+	}
+	now := time.Now()
+	if user.Password != "" || user.IsTwoFactorEnabled() {
+		if !checkLoginAllowed(c, h.limiter, user.Email) {
+			return
+		}
+	}
+	if user.Password != "" && bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)) != nil {
+		loginFailed(c, h.limiter, user.Email, http.StatusForbidden, "Invalid password")
+		return
+	}
+	if user.IsTwoFactorEnabled() {
+		valid, err := h.twoFactor.checkSecondFactor(ctx, user, req.Code)
+		if err != nil {
+			log.Error("Failed to check second factor", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to delete account"})
+			return
+		}
+		if !valid {
+			loginFailed(c, h.limiter, user.Email, http.StatusForbidden, "Invalid two-factor code")
+			return
+		}
+	}
+	if user.Password == "" && !user.IsTwoFactorEnabled() {
+		// Nothing but the token vouches for the user, so the token must come
+		// from a login through the provider moments ago
+		session, err := h.repos.Sessions.GetActive(ctx, c.GetUint("session_id"), now)
+		if err != nil && !errors.Is(err, repository.ErrNotFound) {
+			log.Error("Failed to look up session", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to delete account"})
+			return
+		}
+		if err != nil || now.Sub(session.CreatedAt) > recentLoginWindow {
+			c.JSON(http.StatusForbidden, ErrorResponse{Error: "Log in again to delete the account"})
+			return
+		}
+	}
+
+	if err := h.repos.Users.Anonymize(ctx, user.ID, now); err != nil {
+		log.Error("Failed to delete account", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to delete account"})
+		return
+	}
+
+	// The account is gone once anonymized: its tokens are refused and nobody
+	// can log in to it. What follows removes the remaining records, so
+	// failures are logged rather than reported.
+	disconnected, err := h.sessions.revokeAll(ctx, user.ID, "account deleted")
+	if err != nil {
+		log.Error("Failed to revoke sessions of deleted account", zap.Error(err))
+	}
+	for what, cleanup := range map[string]func() error{
+		"sessions":        func() error { return h.repos.Sessions.DeleteForUser(ctx, user.ID) },
+		"API keys":        func() error { return h.repos.APIKeys.DeleteForUser(ctx, user.ID) },
+		"identities":      func() error { return h.repos.Identities.DeleteForUser(ctx, user.ID) },
+		"recovery codes":  func() error { return h.repos.RecoveryCodes.DeleteForUser(ctx, user.ID) },
+		"password resets": func() error { return h.repos.PasswordResets.InvalidateForUser(ctx, user.ID, now) },
+	} {
+		if err := cleanup(); err != nil {
+			log.Error("Failed to remove "+what+" of deleted account", zap.Error(err))
+		}
+	}
+	h.avatars.deleteObjects(ctx, user.AvatarKeyList())
+
+	log.Info("Account deleted", zap.Uint("user_id", user.ID), zap.Int("disconnected", disconnected))
+	c.JSON(http.StatusOK, SuccessResponse{Message: "Account deleted"})
+}
@@ -0,0 +1,208 @@
+package api
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ayush/accountability-app/backend/internal/auth"
+	"github.com/ayush/accountability-app/backend/internal/models"
+	"github.com/ayush/accountability-app/backend/internal/repository"
+	"github.com/ayush/accountability-app/backend/internal/storage"
+	"github.com/ayush/accountability-app/backend/internal/testutil/imagetest"
+)
+
+func TestExportPersonalData(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	router := newTestRouter(repos)
+	user, token := createTestUser(t, repos, "john@example.com", "johndoe", "secret123")
+	other, _ := createTestUser(t, repos, "jane@example.com", "janedoe", "secret123")
+
+	created := models.Call{Title: "Morning sprint", CreatorID: user.ID, Status: "active"}
+	joined := models.Call{Title: "Jane's call", CreatorID: other.ID, Status: "active"}
+	unrelated := models.Call{Title: "Private", CreatorID: other.ID, Status: "active"}
+	for _, call := range []*models.Call{&created, &joined, &unrelated} {
+		repos.Calls.Create(t.Context(), call)
+	}
+	repos.Participants.Create(t.Context(), &models.CallParticipant{CallID: joined.ID, UserID: user.ID, JoinedAt: time.Now()})
+	repos.Identities.Create(t.Context(), &models.UserIdentity{UserID: user.ID, Provider: "google", Subject: "123", Email: "john@gmail.com"})
+	createAPIKey(t, router, token, "calls:read")
+
+	t.Run("json", func(t *testing.T) {
+		rec := doRequest(t, router, http.MethodGet, "/api/users/me/export?format=json", nil, token)
+		expectStatus(t, rec, http.StatusOK)
+		var export DataExport
+		decodeResponse(t, rec, &export)
+
+		if export.Profile.Email != "john@example.com" || export.Profile.Role != "user" {
+			t.Fatalf("unexpected profile: %+v", export.Profile)
+		}
+		if len(export.Calls) != 2 || export.Calls[0].ID != joined.ID || len(export.Calls[0].Attendance) != 1 || export.Calls[0].Creator ||
+			export.Calls[1].ID != created.ID || !export.Calls[1].Creator {
+			t.Fatalf("unexpected calls: %+v", export.Calls)
+		}
+		if len(export.Sessions) != 1 || !export.Sessions[0].Current {
+			t.Fatalf("unexpected sessions: %+v", export.Sessions)
+		}
+		if len(export.APIKeys) != 1 || len(export.Identities) != 1 || export.Identities[0].Email != "john@gmail.com" {
+			t.Fatalf("unexpected keys or identities: %+v, %+v", export.APIKeys, export.Identities)
+		}
+		if strings.Contains(rec.Body.String(), "$2a$") {
+			t.Fatal("the password hash must not be exported")
+		}
+	})
+
+	t.Run("zip", func(t *testing.T) {
+		rec := doRequest(t, router, http.MethodGet, "/api/users/me/export", nil, token)
+		expectStatus(t, rec, http.StatusOK)
+		if got := rec.Header().Get("Content-Type"); got != "application/zip" {
+			t.Fatalf("unexpected content type %q", got)
+		}
+		if !strings.Contains(rec.Header().Get("Content-Disposition"), ".zip") {
+			t.Fatalf("unexpected Content-Disposition %q", rec.Header().Get("Content-Disposition"))
+		}
+
+		archive, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+		if err != nil {
+			t.Fatalf("not a ZIP archive: %v", err)
+		}
+		var names []string
+		for _, file := range archive.File {
+			names = append(names, file.Name)
+		}
+		if strings.Join(names, " ") != "profile.json calls.json sessions.json api_keys.json identities.json" {
+			t.Fatalf("unexpected files %v", names)
+		}
+
+		f, _ := archive.File[0].Open()
+		data, _ := io.ReadAll(f)
+		var profile ExportProfile
+		if err := json.Unmarshal(data, &profile); err != nil || profile.Username != "johndoe" {
+			t.Fatalf("unexpected profile.json: %s, %v", data, err)
+		}
+	})
+
+	t.Run("unknown format", func(t *testing.T) {
+		rec := doRequest(t, router, http.MethodGet, "/api/users/me/export?format=csv", nil, token)
+		expectStatus(t, rec, http.StatusBadRequest)
+	})
+}
+
+func TestDeleteAccount(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	store := storage.NewMemory("https://media.example.com")
+	router := newTestRouterWith(repos, testDeps{storage: store})
+	user, token := createTestUser(t, repos, "john@example.com", "johndoe", "secret123")
+	otherToken := tokenFor(t, repos, user)
+	key := createAPIKey(t, router, token, "calls:read")
+	expectStatus(t, uploadAvatar(t, router, token, imagetest.Encode(t, 64, 64, "png")), http.StatusOK)
+	repos.Identities.Create(t.Context(), &models.UserIdentity{UserID: user.ID, Provider: "google", Subject: "123"})
+
+	rec := doRequest(t, router, http.MethodDelete, "/api/users/me", DeleteAccountRequest{Password: "wrong"}, token)
+	expectStatus(t, rec, http.StatusForbidden)
+
+	rec = doRequest(t, router, http.MethodDelete, "/api/users/me", DeleteAccountRequest{Password: "secret123"}, token)
+	expectStatus(t, rec, http.StatusOK)
+
+	stored, err := repos.Users.GetByID(t.Context(), user.ID)
+	if err != nil || !stored.IsDeleted() {
+		t.Fatalf("expected the account to be marked deleted, got %+v, %v", stored, err)
+	}
+	if strings.Contains(stored.Email, "john") || strings.Contains(stored.Username, "john") || stored.Password != "" || stored.AvatarURL != "" {
+		t.Fatalf("expected personal data to be erased, got %+v", stored)
+	}
+	if keys := store.Keys(); len(keys) != 0 {
+		t.Fatalf("expected the avatar to be deleted, got %v", keys)
+	}
+	sessions, _ := repos.Sessions.ListByUser(t.Context(), user.ID)
+	identities, _ := repos.Identities.ListByUser(t.Context(), user.ID)
+	if len(sessions) != 0 || len(identities) != 0 {
+		t.Fatalf("expected sessions and linked accounts to be removed, got %v, %v", sessions, identities)
+	}
+
+	for _, credential := range []string{token, otherToken, key.Key} {
+		rec := doRequest(t, router, http.MethodGet, "/api/users/me", nil, credential)
+		expectStatus(t, rec, http.StatusUnauthorized)
+	}
+
+	rec = doRequest(t, router, http.MethodPost, "/api/users/login", LoginRequest{Email: "john@example.com", Password: "secret123"}, "")
+	expectStatus(t, rec, http.StatusUnauthorized)
+
+	t.Run("the address and username can be used again", func(t *testing.T) {
+		rec := doRequest(t, router, http.MethodPost, "/api/users/register", CreateUserRequest{Email: "john@example.com", Username: "johndoe", Password: "secret123"}, "")
+		expectStatus(t, rec, http.StatusAccepted)
+		created, err := repos.Users.GetByEmail(t.Context(), "john@example.com")
+		if err != nil || created.ID == user.ID {
+			t.Fatalf("expected a new account for the address, got %+v, %v", created, err)
+		}
+	})
+}
+
+func TestDeleteAccountWithoutPassword(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	router := newTestRouter(repos)
+
+	// Accounts created through OpenID Connect have no password
+	user := &models.User{Email: "sso@example.com", Username: "sso"}
+	repos.Users.Create(t.Context(), user)
+
+	t.Run("token from an old login", func(t *testing.T) {
+		loggedInAt := time.Now().Add(-time.Hour)
+		session := &models.Session{UserID: user.ID, CreatedAt: loggedInAt, LastSeenAt: loggedInAt, ExpiresAt: loggedInAt.Add(auth.TokenTTL())}
+		repos.Sessions.Create(t.Context(), session)
+		token, err := auth.GenerateToken(user.ID, user.Email, auth.RoleUser, session.ID)
+		if err != nil {
+			t.Fatalf("failed to generate token: %v", err)
+		}
+
+		rec := doRequest(t, router, http.MethodDelete, "/api/users/me", nil, token)
+		expectStatus(t, rec, http.StatusForbidden)
+	})
+
+	rec := doRequest(t, router, http.MethodDelete, "/api/users/me", nil, tokenFor(t, repos, user))
+	expectStatus(t, rec, http.StatusOK)
+}
+
+func TestDeleteAccountWithTwoFactor(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	router := newTestRouter(repos)
+	_, token := createTestUser(t, repos, "john@example.com", "johndoe", "secret123")
+	_, _, recoveryCodes := enableTwoFactor(t, router, token)
+
+	rec := doRequest(t, router, http.MethodDelete, "/api/users/me", DeleteAccountRequest{Password: "secret123"}, token)
+	expectStatus(t, rec, http.StatusForbidden)
+
+	rec = doRequest(t, router, http.MethodDelete, "/api/users/me", DeleteAccountRequest{Password: "secret123", Code: recoveryCodes[0]}, token)
+	expectStatus(t, rec, http.StatusOK)
+}
+
+func TestDeleteAccountPlaceholderUsername(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	router := newTestRouter(repos)
+	user, token := createTestUser(t, repos, "john@example.com", "johndoe", "secret123")
+
+	// The names deleted accounts used to get were free to register
+	for _, req := range []CreateUserRequest{
+		{Email: "squatter@example.com", Username: fmt.Sprintf("deleted-%d", user.ID), Password: "secret123"},
+		{Email: fmt.Sprintf("deleted-%d@deleted.invalid", user.ID), Username: "squatter2", Password: "secret123"},
+	} {
+		rec := doRequest(t, router, http.MethodPost, "/api/users/register", req, "")
+		expectStatus(t, rec, http.StatusAccepted)
+	}
+	for _, req := range []CreateUserRequest{
+		{Email: "squatter3@example.com", Username: repository.DeletedUsername(user.ID + 10), Password: "secret123"},
+		{Email: repository.DeletedEmail(user.ID + 10), Username: "squatter3", Password: "secret123"},
+	} {
+		rec := doRequest(t, router, http.MethodPost, "/api/users/register", req, "")
+		expectStatus(t, rec, http.StatusBadRequest)
+	}
+
+	rec := doRequest(t, router, http.MethodDelete, "/api/users/me", DeleteAccountRequest{Password: "secret123"}, token)
+	expectStatus(t, rec, http.StatusOK)
+}
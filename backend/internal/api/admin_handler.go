@@ -0,0 +1,341 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ayush/accountability-app/backend/internal/auth"
+	"github.com/ayush/accountability-app/backend/internal/logger"
+	"github.com/ayush/accountability-app/backend/internal/models"
+	"github.com/ayush/accountability-app/backend/internal/repository"
+	ws "github.com/ayush/accountability-app/backend/internal/websocket"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const (
+	// defaultAdminPageSize is the number of users listed when no limit is given
+	defaultAdminPageSize = 50
+
+	// maxAdminPageSize caps the limit query parameter
+	maxAdminPageSize = 100
+)
+
+// AdminHandler serves the moderation and administration endpoints. Each
+// route is guarded by middleware.RequirePermission.
+type AdminHandler struct {
+	users        repository.UserRepository
+	calls        repository.CallRepository
+	participants repository.ParticipantRepository
+	hub          *ws.Hub
+}
+
+// AdminUserResponse is a user as seen by moderators and administrators
+type AdminUserResponse struct {
+	ID            uint       `json:"id" example:"1"`
+	Email         string     `json:"email" example:"john@example.com"`
+	Username      string     `json:"username" example:"johndoe"`
+	Role          string     `json:"role" example:"user"`
+	EmailVerified bool       `json:"email_verified" example:"true"`
+	DisabledAt    *time.Time `json:"disabled_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// AdminUserListResponse is one page of users
+type AdminUserListResponse struct {
+	Users  []AdminUserResponse `json:"users"`
+	Total  int64               `json:"total" example:"120"`
+	Offset int                 `json:"offset" example:"0"`
+	Limit  int                 `json:"limit" example:"50"`
+}
+
+// SetRoleRequest changes a user's role
+type SetRoleRequest struct {
+	Role string `json:"role" binding:"required" example:"moderator"`
+}
+
+// EndCallResponse reports how many WebSocket clients were disconnected when a call was ended
+type EndCallResponse struct {
+	CallID       uint `json:"call_id" example:"1"`
+	Disconnected int  `json:"disconnected" example:"3"`
+}
+
+func newAdminUserResponse(user *models.User) AdminUserResponse {
+	return AdminUserResponse{
+		ID:            user.ID,
+		Email:         user.Email,
+		Username:      user.Username,
+		Role:          user.Role,
+		EmailVerified: user.IsEmailVerified(),
+		DisabledAt:    user.DisabledAt,
+		CreatedAt:     user.CreatedAt,
+	}
+}
+
+// NewAdminHandler creates an admin handler; hub is used to disconnect
+// disabled users and close the rooms of ended calls
+func NewAdminHandler(users repository.UserRepository, calls repository.CallRepository, participants repository.ParticipantRepository, hub *ws.Hub) *AdminHandler {
+	return &AdminHandler{users: users, calls: calls, participants: participants, hub: hub}
+}
+
+// ListUsers godoc
+// @Summary List users
+// @Description List every account, ordered by ID. Requires the users:read permission.
+// @Tags admin
+// @Produce json
+// @Param offset query int false "Number of users to skip" default(0)
+// @Param limit query int false "Maximum number of users to return (at most 100)" default(50)
+// @Success 200 {object} AdminUserListResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /admin/users [get]
+func (h *AdminHandler) ListUsers(c *gin.Context) {
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "offset must be a non-negative integer"})
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultAdminPageSize)))
+	if err != nil || limit < 1 {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "limit must be a positive integer"})
+		return
+	}
+	limit = min(limit, maxAdminPageSize)
+
+	users, total, err := h.users.List(c.Request.Context(), offset, limit)
+	if err != nil {
+		logger.FromContext(c.Request.Context()).Error("Failed to list users", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to list users"})
+		return
+	}
+
+	resp := AdminUserListResponse{
+		Users:  make([]AdminUserResponse, 0, len(users)),
+		Total:  total,
+		Offset: offset,
+		Limit:  limit,
+	}
+	for i := range users {
+		resp.Users = append(resp.Users, newAdminUserResponse(&users[i]))
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// DisableUser godoc
+// @Summary Disable a user
+// @Description Disable an account. The user can no longer log in, existing tokens are refused and open WebSocket connections are closed. Requires the users:write permission.
+// @Tags admin
+// @Produce json
+// @Param id path string true "User ID"
+// @Success 200 {object} AdminUserResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /admin/users/{id}/disable [post]
+func (h *AdminHandler) DisableUser(c *gin.Context) {
+	now := time.Now()
+	user, ok := h.setDisabled(c, &now)
+	if !ok {
+		return
+	}
+
+	disconnected := h.hub.DisconnectUser(user.ID, "account disabled")
+	logger.FromContext(c.Request.Context()).Info("User disabled",
+		zap.Uint("target_user_id", user.ID),
+		zap.Int("disconnected", disconnected))
+	c.JSON(http.StatusOK, newAdminUserResponse(user))
+}
+
+// EnableUser godoc
+// @Summary Enable a user
+// @Description Re-enable a disabled account. Requires the users:write permission.
+// @Tags admin
+// @Produce json
+// @Param id path string true "User ID"
+// @Success 200 {object} AdminUserResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /admin/users/{id}/enable [post]
+func (h *AdminHandler) EnableUser(c *gin.Context) {
+	user, ok := h.setDisabled(c, nil)
+	if !ok {
+		return
+	}
+
+	logger.FromContext(c.Request.Context()).Info("User enabled", zap.Uint("target_user_id", user.ID))
+	c.JSON(http.StatusOK, newAdminUserResponse(user))
+}
+
+// SetRole godoc
+// @Summary Change a user's role
+// @Description Set a user's role to user, moderator or admin. The change applies to the user's next request. Requires the users:write permission.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path string true "User ID"
+// @Param request body SetRoleRequest true "New role"
+// @Success 200 {object} AdminUserResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /admin/users/{id}/role [put]
+func (h *AdminHandler) SetRole(c *gin.Context) {
+	var req SetRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	role, ok := auth.ParseRole(req.Role)
+	if !ok {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "role must be user, moderator or admin"})
+		return
+	}
+
+	user, ok := h.targetUser(c)
+	if !ok {
+		return
+	}
+
+	if err := h.users.SetRole(c.Request.Context(), user.ID, string(role)); err != nil {
+		logger.FromContext(c.Request.Context()).Error("Failed to set role", zap.Error(err), zap.Uint("target_user_id", user.ID))
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to update user"})
+		return
+	}
+	user.Role = string(role)
+
+	logger.FromContext(c.Request.Context()).Info("User role changed",
+		zap.Uint("target_user_id", user.ID),
+		zap.String("role", user.Role))
+	c.JSON(http.StatusOK, newAdminUserResponse(user))
+}
+
+// EndCall godoc
+// @Summary Force-end a call
+// @Description End an active call and disconnect everyone in its WebSocket room. Requires the calls:moderate permission.
+// @Tags admin
+// @Produce json
+// @Param id path string true "Call ID"
+// @Success 200 {object} EndCallResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /admin/calls/{id}/end [post]
+func (h *AdminHandler) EndCall(c *gin.Context) {
+	log := logger.FromContext(c.Request.Context())
+
+	callID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Call not found"})
+		return
+	}
+
+	disconnected, err := endCall(c.Request.Context(), h.calls, h.participants, h.hub, uint(callID), "call ended by a moderator")
+	if errors.Is(err, repository.ErrNotFound) {
+		// Tell a missing call apart from one that has already ended
+		if _, err := h.calls.GetByID(c.Request.Context(), uint(callID)); errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "Call not found"})
+			return
+		}
+		c.JSON(http.StatusConflict, ErrorResponse{Error: "Call is not active"})
+		return
+	}
+	if err != nil {
+		log.Error("Failed to end call", zap.Error(err), zap.Uint64("call_id", callID))
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to end call"})
+		return
+	}
+
+	log.Info("Call ended by moderator",
+		zap.Uint64("call_id", callID),
+		zap.Int("disconnected", disconnected))
+	c.JSON(http.StatusOK, EndCallResponse{CallID: uint(callID), Disconnected: disconnected})
+}
+
+// ListRooms godoc
+// @Summary List WebSocket rooms
+// @Description List every open WebSocket room with its clients and message rates. Requires the rooms:read permission.
+// @Tags admin
+// @Produce json
+// @Success 200 {object} websocket.HubStats
+// @Failure 403 {object} ErrorResponse
+// @Security Bearer
+// @Router /admin/rooms [get]
+func (h *AdminHandler) ListRooms(c *gin.Context) {
+	c.JSON(http.StatusOK, h.hub.Stats())
+}
+
+// GetRoom godoc
+// @Summary Inspect a WebSocket room
+// @Description Show the clients and message rates of any room, whether or not the caller is in it. Requires the rooms:read permission.
+// @Tags admin
+// @Produce json
+// @Param room_id path string true "Room ID"
+// @Success 200 {object} websocket.RoomStats
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Security Bearer
+// @Router /admin/rooms/{room_id} [get]
+func (h *AdminHandler) GetRoom(c *gin.Context) {
+	room, ok := h.hub.RoomStats(c.Param("room_id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Room not found"})
+		return
+	}
+	c.JSON(http.StatusOK, room)
+}
+
+// targetUser loads the user named by the id path parameter, refusing the
+// caller's own account so an administrator cannot lock themselves out
+func (h *AdminHandler) targetUser(c *gin.Context) (*models.User, bool) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "User not found"})
+		return nil, false
+	}
+	if uint(userID) == c.GetUint("user_id") {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "You cannot change your own account"})
+		return nil, false
+	}
+
+	user, err := h.users.GetByID(c.Request.Context(), uint(userID))
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "User not found"})
+		return nil, false
+	}
+	if err != nil {
+		logger.FromContext(c.Request.Context()).Error("Failed to fetch user", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch user"})
+		return nil, false
+	}
+	return user, true
+}
+
+// setDisabled disables or enables the target user and returns it updated
+func (h *AdminHandler) setDisabled(c *gin.Context, disabledAt *time.Time) (*models.User, bool) {
+	user, ok := h.targetUser(c)
+	if !ok {
+		return nil, false
+	}
+
+	if err := h.users.SetDisabled(c.Request.Context(), user.ID, disabledAt); err != nil {
+		logger.FromContext(c.Request.Context()).Error("Failed to update user", zap.Error(err), zap.Uint("target_user_id", user.ID))
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to update user"})
+		return nil, false
+	}
+	user.DisabledAt = disabledAt
+	return user, true
+}
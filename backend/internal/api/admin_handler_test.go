@@ -0,0 +1,189 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/ayush/accountability-app/backend/internal/auth"
+	"github.com/ayush/accountability-app/backend/internal/models"
+	"github.com/ayush/accountability-app/backend/internal/repository"
+)
+
+// createTestUserWithRole is createTestUser for a user with the given role
+func createTestUserWithRole(t *testing.T, repos *repository.Repositories, email, username string, role auth.Role) (*models.User, string) {
+	t.Helper()
+
+	user, _ := createTestUser(t, repos, email, username, "secret123")
+	if err := repos.Users.SetRole(t.Context(), user.ID, string(role)); err != nil {
+		t.Fatalf("failed to set role: %v", err)
+	}
+	user.Role = string(role)
+
+	return user, tokenFor(t, repos, user)
+}
+
+func TestAdminPermissions(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	router := newTestRouter(repos)
+	target, userToken := createTestUser(t, repos, "john@example.com", "johndoe", "secret123")
+	_, moderatorToken := createTestUserWithRole(t, repos, "mod@example.com", "mod", auth.RoleModerator)
+	_, adminToken := createTestUserWithRole(t, repos, "admin@example.com", "admin", auth.RoleAdmin)
+
+	disable := fmt.Sprintf("/api/admin/users/%d/disable", target.ID)
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		status int
+	}{
+		{"user cannot list users", http.MethodGet, "/api/admin/users", userToken, http.StatusForbidden},
+		{"moderator lists users", http.MethodGet, "/api/admin/users", moderatorToken, http.StatusOK},
+		{"user cannot view rooms", http.MethodGet, "/api/admin/rooms", userToken, http.StatusForbidden},
+		{"moderator views rooms", http.MethodGet, "/api/admin/rooms", moderatorToken, http.StatusOK},
+		{"moderator cannot disable users", http.MethodPost, disable, moderatorToken, http.StatusForbidden},
+		{"admin disables users", http.MethodPost, disable, adminToken, http.StatusOK},
+		{"no token", http.MethodGet, "/api/admin/users", "", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expectStatus(t, doRequest(t, router, tt.method, tt.path, nil, tt.token), tt.status)
+		})
+	}
+
+	t.Run("role is read from the database, not the token", func(t *testing.T) {
+		demoted, token := createTestUserWithRole(t, repos, "former@example.com", "former", auth.RoleAdmin)
+		if err := repos.Users.SetRole(t.Context(), demoted.ID, string(auth.RoleUser)); err != nil {
+			t.Fatalf("SetRole: %v", err)
+		}
+		expectStatus(t, doRequest(t, router, http.MethodGet, "/api/admin/users", nil, token), http.StatusForbidden)
+	})
+}
+
+func TestAdminListUsers(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	router := newTestRouter(repos)
+	_, token := createTestUserWithRole(t, repos, "admin@example.com", "admin", auth.RoleAdmin)
+	for i := range 4 {
+		createTestUser(t, repos, fmt.Sprintf("user%d@example.com", i), fmt.Sprintf("user%d", i), "secret123")
+	}
+
+	rec := doRequest(t, router, http.MethodGet, "/api/admin/users?offset=1&limit=2", nil, token)
+	expectStatus(t, rec, http.StatusOK)
+	var resp AdminUserListResponse
+	decodeResponse(t, rec, &resp)
+	if resp.Total != 5 || len(resp.Users) != 2 || resp.Users[0].Email != "user0@example.com" || resp.Users[0].Role != "user" {
+		t.Fatalf("unexpected page: %+v", resp)
+	}
+
+	rec = doRequest(t, router, http.MethodGet, "/api/admin/users?limit=0", nil, token)
+	expectStatus(t, rec, http.StatusBadRequest)
+}
+
+func TestAdminDisableUser(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	router := newTestRouter(repos)
+	admin, adminToken := createTestUserWithRole(t, repos, "admin@example.com", "admin", auth.RoleAdmin)
+	target, targetToken := createTestUser(t, repos, "john@example.com", "johndoe", "secret123")
+
+	rec := doRequest(t, router, http.MethodPost, fmt.Sprintf("/api/admin/users/%d/disable", target.ID), nil, adminToken)
+	expectStatus(t, rec, http.StatusOK)
+	var resp AdminUserResponse
+	decodeResponse(t, rec, &resp)
+	if resp.DisabledAt == nil {
+		t.Fatalf("expected the user to be disabled: %+v", resp)
+	}
+
+	t.Run("existing tokens are refused", func(t *testing.T) {
+		rec := doRequest(t, router, http.MethodGet, fmt.Sprintf("/api/users/%d", target.ID), nil, targetToken)
+		expectStatus(t, rec, http.StatusForbidden)
+	})
+
+	t.Run("login is refused", func(t *testing.T) {
+		rec := doRequest(t, router, http.MethodPost, "/api/users/login", LoginRequest{Email: target.Email, Password: "secret123"}, "")
+		expectStatus(t, rec, http.StatusForbidden)
+
+		rec = doRequest(t, router, http.MethodPost, "/api/users/login", LoginRequest{Email: target.Email, Password: "wrong"}, "")
+		expectStatus(t, rec, http.StatusUnauthorized)
+	})
+
+	t.Run("cannot disable yourself", func(t *testing.T) {
+		rec := doRequest(t, router, http.MethodPost, fmt.Sprintf("/api/admin/users/%d/disable", admin.ID), nil, adminToken)
+		expectStatus(t, rec, http.StatusBadRequest)
+	})
+
+	t.Run("enable", func(t *testing.T) {
+		rec := doRequest(t, router, http.MethodPost, fmt.Sprintf("/api/admin/users/%d/enable", target.ID), nil, adminToken)
+		expectStatus(t, rec, http.StatusOK)
+
+		rec = doRequest(t, router, http.MethodPost, "/api/users/login", LoginRequest{Email: target.Email, Password: "secret123"}, "")
+		expectStatus(t, rec, http.StatusOK)
+	})
+
+	t.Run("unknown user", func(t *testing.T) {
+		rec := doRequest(t, router, http.MethodPost, "/api/admin/users/999/disable", nil, adminToken)
+		expectStatus(t, rec, http.StatusNotFound)
+	})
+}
+
+func TestAdminSetRole(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	router := newTestRouter(repos)
+	_, adminToken := createTestUserWithRole(t, repos, "admin@example.com", "admin", auth.RoleAdmin)
+	target, targetToken := createTestUser(t, repos, "john@example.com", "johndoe", "secret123")
+	path := fmt.Sprintf("/api/admin/users/%d/role", target.ID)
+
+	rec := doRequest(t, router, http.MethodPut, path, SetRoleRequest{Role: "superuser"}, adminToken)
+	expectStatus(t, rec, http.StatusBadRequest)
+
+	rec = doRequest(t, router, http.MethodPut, path, SetRoleRequest{Role: "moderator"}, adminToken)
+	expectStatus(t, rec, http.StatusOK)
+
+	// The role applies to the token the user already holds
+	rec = doRequest(t, router, http.MethodGet, "/api/admin/users", nil, targetToken)
+	expectStatus(t, rec, http.StatusOK)
+
+	rec = doRequest(t, router, http.MethodPost, "/api/users/login", LoginRequest{Email: target.Email, Password: "secret123"}, "")
+	expectStatus(t, rec, http.StatusOK)
+	var login LoginResponse
+	decodeResponse(t, rec, &login)
+	claims, err := auth.ValidateToken(login.Token)
+	if err != nil || claims.Role != auth.RoleModerator {
+		t.Fatalf("expected a moderator token, got %+v (%v)", claims, err)
+	}
+}
+
+func TestAdminEndCall(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	router := newTestRouter(repos)
+	host, _ := createTestUser(t, repos, "john@example.com", "johndoe", "secret123")
+	_, moderatorToken := createTestUserWithRole(t, repos, "mod@example.com", "mod", auth.RoleModerator)
+
+	call := &models.Call{Title: "Active", CreatorID: host.ID, Status: "active"}
+	if err := repos.Calls.Create(t.Context(), call); err != nil {
+		t.Fatalf("failed to create call: %v", err)
+	}
+	path := fmt.Sprintf("/api/admin/calls/%d/end", call.ID)
+
+	rec := doRequest(t, router, http.MethodPost, path, nil, moderatorToken)
+	expectStatus(t, rec, http.StatusOK)
+	if ended, _ := repos.Calls.GetByID(t.Context(), call.ID); ended.Status != "ended" {
+		t.Fatalf("expected the call to be ended, got %q", ended.Status)
+	}
+
+	rec = doRequest(t, router, http.MethodPost, path, nil, moderatorToken)
+	expectStatus(t, rec, http.StatusConflict)
+
+	rec = doRequest(t, router, http.MethodPost, "/api/admin/calls/999/end", nil, moderatorToken)
+	expectStatus(t, rec, http.StatusNotFound)
+}
+
+func TestAdminGetRoom(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	router := newTestRouter(repos)
+	_, token := createTestUserWithRole(t, repos, "mod@example.com", "mod", auth.RoleModerator)
+
+	rec := doRequest(t, router, http.MethodGet, "/api/admin/rooms/room-1", nil, token)
+	expectStatus(t, rec, http.StatusNotFound)
+}
@@ -0,0 +1,233 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ayush/accountability-app/backend/internal/auth"
+	"github.com/ayush/accountability-app/backend/internal/logger"
+	"github.com/ayush/accountability-app/backend/internal/models"
+	"github.com/ayush/accountability-app/backend/internal/repository"
+	ws "github.com/ayush/accountability-app/backend/internal/websocket"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// maxAPIKeysPerUser caps the number of active keys a user may hold
+const maxAPIKeysPerUser = 25
+
+// APIKeyHandler lets users manage API keys for scripts and integrations
+type APIKeyHandler struct {
+	keys repository.APIKeyRepository
+	hub  *ws.Hub
+}
+
+// CreateAPIKeyRequest describes a new API key
+type CreateAPIKeyRequest struct {
+	Name   string   `json:"name" binding:"required,max=100" example:"nightly session cron"`
+	Scopes []string `json:"scopes" binding:"required,min=1" example:"calls:read,calls:write"`
+
+	// ExpiresInDays is how long the key is valid; 0 means it never expires
+	ExpiresInDays int `json:"expires_in_days" binding:"min=0,max=365" example:"90"`
+}
+
+// APIKeyResponse describes an API key without its secret
+type APIKeyResponse struct {
+	ID         uint       `json:"id" example:"1"`
+	Name       string     `json:"name" example:"nightly session cron"`
+	Prefix     string     `json:"prefix" example:"aak_3fQx9a"`
+	Scopes     []string   `json:"scopes" example:"calls:read,calls:write"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	LastUsedIP string     `json:"last_used_ip" example:"203.0.113.7"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// CreateAPIKeyResponse carries the new key, which is only ever shown once
+type CreateAPIKeyResponse struct {
+	Key    string         `json:"key" example:"aak_3fQx9a..."`
+	APIKey APIKeyResponse `json:"api_key"`
+}
+
+// APIKeyListResponse lists a user's API keys, newest first
+type APIKeyListResponse struct {
+	APIKeys []APIKeyResponse `json:"api_keys"`
+}
+
+func newAPIKeyResponse(key *models.APIKey) APIKeyResponse {
+	return APIKeyResponse{
+		ID:         key.ID,
+		Name:       key.Name,
+		Prefix:     key.Prefix,
+		Scopes:     key.ScopeList(),
+		ExpiresAt:  key.ExpiresAt,
+		LastUsedAt: key.LastUsedAt,
+		LastUsedIP: key.LastUsedIP,
+		RevokedAt:  key.RevokedAt,
+		CreatedAt:  key.CreatedAt,
+	}
+}
+
+// NewAPIKeyHandler creates an API key handler. hub is used to close the
+// WebSocket connections of revoked keys.
+func NewAPIKeyHandler(keys repository.APIKeyRepository, hub *ws.Hub) *APIKeyHandler {
+	return &APIKeyHandler{keys: keys, hub: hub}
+}
+
+// Create godoc
+// @Summary Create an API key
+// @Description Create an API key limited to the given scopes (profile:read, calls:read, calls:write, admin). Send it as "Authorization: Bearer <key>" or "X-API-Key: <key>". The key is only returned in this response.
+// @Tags api-keys
+// @Accept json
+// @Produce json
+// @Param request body CreateAPIKeyRequest true "Key name, scopes and lifetime"
+// @Success 201 {object} CreateAPIKeyResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /users/me/api-keys [post]
+func (h *APIKeyHandler) Create(c *gin.Context) {
+	log := logger.FromContext(c.Request.Context())
+	userID := c.GetUint("user_id")
+
+	var req CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	var scopes []string
+	for _, s := range req.Scopes {
+		scope, ok := auth.ParseScope(s)
+		if !ok {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "unknown scope " + strconv.Quote(s)})
+			return
+		}
+		if role, _ := c.Get("user_role"); scope == auth.ScopeAdmin && len(asRole(role).Permissions()) == 0 {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "the admin scope requires a moderator or admin account"})
+			return
+		}
+		if !slices.Contains(scopes, s) {
+			scopes = append(scopes, s)
+		}
+	}
+
+	now := time.Now()
+	count, err := h.keys.CountActive(c.Request.Context(), userID, now)
+	if err != nil {
+		log.Error("Failed to count API keys", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to create API key"})
+		return
+	}
+	if count >= maxAPIKeysPerUser {
+		c.JSON(http.StatusConflict, ErrorResponse{Error: "Too many API keys, revoke one first"})
+		return
+	}
+
+	secret, hash, prefix, err := auth.NewAPIKey()
+	if err != nil {
+		log.Error("Failed to generate API key", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to create API key"})
+		return
+	}
+
+	key := models.APIKey{
+		UserID:    userID,
+		Name:      strings.TrimSpace(req.Name),
+		KeyHash:   hash,
+		Prefix:    prefix,
+		Scopes:    strings.Join(scopes, " "),
+		CreatedAt: now,
+	}
+	if req.ExpiresInDays > 0 {
+		expiresAt := now.AddDate(0, 0, req.ExpiresInDays)
+		key.ExpiresAt = &expiresAt
+	}
+	if err := h.keys.Create(c.Request.Context(), &key); err != nil {
+		log.Error("Failed to store API key", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to create API key"})
+		return
+	}
+
+	log.Info("API key created", zap.Uint("api_key_id", key.ID), zap.Strings("scopes", scopes))
+	c.JSON(http.StatusCreated, CreateAPIKeyResponse{Key: secret, APIKey: newAPIKeyResponse(&key)})
+}
+
+// List godoc
+// @Summary List API keys
+// @Description List the current user's API keys, including revoked and expired ones, newest first
+// @Tags api-keys
+// @Produce json
+// @Success 200 {object} APIKeyListResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /users/me/api-keys [get]
+func (h *APIKeyHandler) List(c *gin.Context) {
+	keys, err := h.keys.ListByUser(c.Request.Context(), c.GetUint("user_id"))
+	if err != nil {
+		logger.FromContext(c.Request.Context()).Error("Failed to list API keys", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to list API keys"})
+		return
+	}
+
+	resp := APIKeyListResponse{APIKeys: make([]APIKeyResponse, 0, len(keys))}
+	for i := range keys {
+		resp.APIKeys = append(resp.APIKeys, newAPIKeyResponse(&keys[i]))
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// Revoke godoc
+// @Summary Revoke an API key
+// @Description Revoke one of the current user's API keys. It stops working immediately and its WebSocket connections are closed.
+// @Tags api-keys
+// @Produce json
+// @Param id path string true "API key ID"
+// @Success 200 {object} SuccessResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /users/me/api-keys/{id} [delete]
+func (h *APIKeyHandler) Revoke(c *gin.Context) {
+	log := logger.FromContext(c.Request.Context())
+
+	keyID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "API key not found"})
+		return
+	}
+
+	err = h.keys.Revoke(c.Request.Context(), c.GetUint("user_id"), uint(keyID), time.Now())
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "API key not found"})
+		return
+	}
+	if err != nil {
+		log.Error("Failed to revoke API key", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to revoke API key"})
+		return
+	}
+
+	disconnected := h.hub.DisconnectAPIKey(uint(keyID), "API key revoked")
+	log.Info("API key revoked", zap.Uint64("api_key_id", keyID), zap.Int("disconnected", disconnected))
+	c.JSON(http.StatusOK, SuccessResponse{Message: "API key revoked"})
+}
+
+// asRole returns the role set by the auth middleware, or no role
+func asRole(value interface{}) auth.Role {
+	role, _ := value.(auth.Role)
+	return role
+}
@@ -0,0 +1,184 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ayush/accountability-app/backend/internal/auth"
+	"github.com/ayush/accountability-app/backend/internal/models"
+	"github.com/ayush/accountability-app/backend/internal/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+// createAPIKey creates an API key with the given scopes and returns it
+func createAPIKey(t *testing.T, router *gin.Engine, token string, scopes ...string) CreateAPIKeyResponse {
+	t.Helper()
+
+	rec := doRequest(t, router, http.MethodPost, "/api/users/me/api-keys", CreateAPIKeyRequest{Name: "cron", Scopes: scopes}, token)
+	expectStatus(t, rec, http.StatusCreated)
+	var resp CreateAPIKeyResponse
+	decodeResponse(t, rec, &resp)
+	return resp
+}
+
+func TestCreateAPIKey(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	router := newTestRouter(repos)
+	user, token := createTestUser(t, repos, "john@example.com", "johndoe", "secret123")
+
+	created := createAPIKey(t, router, token, "calls:read", "calls:write", "calls:read")
+	if !auth.IsAPIKey(created.Key) || created.APIKey.Prefix != created.Key[:len(created.APIKey.Prefix)] {
+		t.Fatalf("unexpected key %q with prefix %q", created.Key, created.APIKey.Prefix)
+	}
+	if len(created.APIKey.Scopes) != 2 || created.APIKey.ExpiresAt != nil {
+		t.Fatalf("unexpected key: %+v", created.APIKey)
+	}
+
+	keys, _ := repos.APIKeys.ListByUser(t.Context(), user.ID)
+	if len(keys) != 1 || keys[0].KeyHash != auth.HashOpaqueToken(created.Key) {
+		t.Fatalf("expected only the hash to be stored, got %+v", keys)
+	}
+
+	tests := []struct {
+		name string
+		req  CreateAPIKeyRequest
+	}{
+		{"unknown scope", CreateAPIKeyRequest{Name: "cron", Scopes: []string{"everything"}}},
+		{"no scopes", CreateAPIKeyRequest{Name: "cron"}},
+		{"admin scope for an ordinary user", CreateAPIKeyRequest{Name: "cron", Scopes: []string{"admin"}}},
+		{"lifetime too long", CreateAPIKeyRequest{Name: "cron", Scopes: []string{"calls:read"}, ExpiresInDays: 1000}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := doRequest(t, router, http.MethodPost, "/api/users/me/api-keys", tt.req, token)
+			expectStatus(t, rec, http.StatusBadRequest)
+		})
+	}
+
+	t.Run("keys cannot create keys", func(t *testing.T) {
+		rec := doRequest(t, router, http.MethodPost, "/api/users/me/api-keys", CreateAPIKeyRequest{Name: "more", Scopes: []string{"calls:read"}}, created.Key)
+		expectStatus(t, rec, http.StatusForbidden)
+	})
+}
+
+func TestAPIKeyAuthentication(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	router := newTestRouter(repos)
+	user, token := createTestUser(t, repos, "john@example.com", "johndoe", "secret123")
+	readOnly := createAPIKey(t, router, token, "calls:read")
+
+	t.Run("bearer", func(t *testing.T) {
+		rec := doRequest(t, router, http.MethodGet, "/api/calls", nil, readOnly.Key)
+		expectStatus(t, rec, http.StatusOK)
+	})
+
+	t.Run("X-API-Key header", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/calls", nil)
+		req.Header.Set("X-API-Key", readOnly.Key)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		expectStatus(t, rec, http.StatusOK)
+	})
+
+	t.Run("missing scope", func(t *testing.T) {
+		rec := doRequest(t, router, http.MethodPost, "/api/calls", models.CallCreate{Title: "Standup", CreatorID: user.ID}, readOnly.Key)
+		expectStatus(t, rec, http.StatusForbidden)
+		rec = doRequest(t, router, http.MethodGet, fmt.Sprintf("/api/users/%d", user.ID), nil, readOnly.Key)
+		expectStatus(t, rec, http.StatusForbidden)
+	})
+
+	t.Run("account routes refuse keys", func(t *testing.T) {
+		rec := doRequest(t, router, http.MethodGet, "/api/users/me/2fa", nil, readOnly.Key)
+		expectStatus(t, rec, http.StatusForbidden)
+	})
+
+	t.Run("unknown key", func(t *testing.T) {
+		rec := doRequest(t, router, http.MethodGet, "/api/calls", nil, auth.APIKeyPrefix+"unknown")
+		expectStatus(t, rec, http.StatusUnauthorized)
+	})
+
+	t.Run("last use is recorded", func(t *testing.T) {
+		keys, _ := repos.APIKeys.ListByUser(t.Context(), user.ID)
+		if keys[0].LastUsedAt == nil || keys[0].LastUsedIP == "" {
+			t.Fatalf("expected the last use to be recorded, got %+v", keys[0])
+		}
+	})
+
+	t.Run("disabled owner", func(t *testing.T) {
+		now := time.Now()
+		if err := repos.Users.SetDisabled(t.Context(), user.ID, &now); err != nil {
+			t.Fatalf("SetDisabled: %v", err)
+		}
+		defer repos.Users.SetDisabled(t.Context(), user.ID, nil)
+
+		rec := doRequest(t, router, http.MethodGet, "/api/calls", nil, readOnly.Key)
+		expectStatus(t, rec, http.StatusForbidden)
+	})
+}
+
+func TestAPIKeyAdminScope(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	router := newTestRouter(repos)
+	_, token := createTestUserWithRole(t, repos, "mod@example.com", "mod", auth.RoleModerator)
+	scoped := createAPIKey(t, router, token, "admin")
+	unscoped := createAPIKey(t, router, token, "calls:read")
+
+	expectStatus(t, doRequest(t, router, http.MethodGet, "/api/admin/users", nil, scoped.Key), http.StatusOK)
+	expectStatus(t, doRequest(t, router, http.MethodGet, "/api/admin/users", nil, unscoped.Key), http.StatusForbidden)
+
+	// The scope does not grant more than the owner's role
+	expectStatus(t, doRequest(t, router, http.MethodPost, "/api/admin/users/1/disable", nil, scoped.Key), http.StatusForbidden)
+}
+
+func TestRevokeAPIKey(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	router := newTestRouter(repos)
+	_, token := createTestUser(t, repos, "john@example.com", "johndoe", "secret123")
+	_, otherToken := createTestUser(t, repos, "jane@example.com", "janedoe", "secret123")
+	created := createAPIKey(t, router, token, "calls:read")
+	path := fmt.Sprintf("/api/users/me/api-keys/%d", created.APIKey.ID)
+
+	rec := doRequest(t, router, http.MethodDelete, path, nil, otherToken)
+	expectStatus(t, rec, http.StatusNotFound)
+
+	rec = doRequest(t, router, http.MethodDelete, path, nil, token)
+	expectStatus(t, rec, http.StatusOK)
+
+	rec = doRequest(t, router, http.MethodGet, "/api/calls", nil, created.Key)
+	expectStatus(t, rec, http.StatusUnauthorized)
+
+	rec = doRequest(t, router, http.MethodDelete, path, nil, token)
+	expectStatus(t, rec, http.StatusNotFound)
+
+	rec = doRequest(t, router, http.MethodGet, "/api/users/me/api-keys", nil, token)
+	expectStatus(t, rec, http.StatusOK)
+	var list APIKeyListResponse
+	decodeResponse(t, rec, &list)
+	if len(list.APIKeys) != 1 || list.APIKeys[0].RevokedAt == nil {
+		t.Fatalf("expected the revoked key to be listed, got %+v", list)
+	}
+}
+
+func TestExpiredAPIKey(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	router := newTestRouter(repos)
+	user, _ := createTestUser(t, repos, "john@example.com", "johndoe", "secret123")
+
+	key, hash, prefix, err := auth.NewAPIKey()
+	if err != nil {
+		t.Fatalf("NewAPIKey: %v", err)
+	}
+	expired := time.Now().Add(-time.Minute)
+	if err := repos.APIKeys.Create(t.Context(), &models.APIKey{
+		UserID: user.ID, Name: "old", KeyHash: hash, Prefix: prefix, Scopes: "calls:read", ExpiresAt: &expired,
+	}); err != nil {
+		t.Fatalf("failed to create key: %v", err)
+	}
+
+	rec := doRequest(t, router, http.MethodGet, "/api/calls", nil, key)
+	expectStatus(t, rec, http.StatusUnauthorized)
+}
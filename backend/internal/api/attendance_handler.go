@@ -0,0 +1,304 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/ayush/accountability-app/backend/internal/logger"
+	"github.com/ayush/accountability-app/backend/internal/models"
+	"github.com/ayush/accountability-app/backend/internal/repository"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// defaultHistoryPageSize is the number of calls in a history page when no
+// limit is given
+const defaultHistoryPageSize = 20
+
+// AttendanceHandler reports who attended calls and for how long, computed
+// from participant records
+type AttendanceHandler struct {
+	calls        repository.CallRepository
+	participants repository.ParticipantRepository
+	users        repository.UserRepository
+}
+
+// AttendanceSession is one stretch of time a user spent in a call
+type AttendanceSession struct {
+	JoinedAt time.Time `json:"joined_at"`
+
+	// LeftAt is unset while the user is still in the call
+	LeftAt          *time.Time `json:"left_at"`
+	DurationSeconds int64      `json:"duration_seconds" example:"1800"`
+}
+
+// CallHistoryEntry is a call the user attended with their time in it
+type CallHistoryEntry struct {
+	Call     models.Call         `json:"call"`
+	Sessions []AttendanceSession `json:"sessions"`
+
+	// TotalSeconds is the time spent in the call; overlapping sessions are
+	// only counted once
+	TotalSeconds int64 `json:"total_seconds" example:"3600"`
+	InCall       bool  `json:"in_call" example:"false"`
+	Host         bool  `json:"host" example:"false"`
+}
+
+// CallHistoryResponse is a page of the user's call history. NextCursor is
+// empty on the last page.
+type CallHistoryResponse struct {
+	Calls      []CallHistoryEntry `json:"calls"`
+	NextCursor string             `json:"next_cursor,omitempty" example:"eyJzIjoibmV3ZXN0IiwicCI6ey4uLn19"`
+}
+
+// AttendeeReport is one user's attendance of a call
+type AttendeeReport struct {
+	UserID       uint                `json:"user_id" example:"2"`
+	Username     string              `json:"username" example:"janedoe"`
+	DisplayName  string              `json:"display_name" example:"Jane Doe"`
+	Sessions     []AttendanceSession `json:"sessions"`
+	TotalSeconds int64               `json:"total_seconds" example:"3600"`
+	InCall       bool                `json:"in_call" example:"false"`
+}
+
+// AttendanceReport lists everyone who joined a call, in the order they
+// first joined
+type AttendanceReport struct {
+	CallID    uint             `json:"call_id" example:"1"`
+	Title     string           `json:"title" example:"Morning writing sprint"`
+	Status    string           `json:"status" example:"ended"`
+	CreatedAt time.Time        `json:"created_at"`
+	Attendees []AttendeeReport `json:"attendees"`
+}
+
+// NewAttendanceHandler creates an attendance handler
+func NewAttendanceHandler(calls repository.CallRepository, participants repository.ParticipantRepository, users repository.UserRepository) *AttendanceHandler {
+	return &AttendanceHandler{calls: calls, participants: participants, users: users}
+}
+
+// History godoc
+// @Summary List the calls I attended
+// @Description List the past calls the current user joined, newest first, with every join and leave time and the total time spent in each. status=active or status=all also lists calls still in progress, whose open sessions count up to now. Follow next_cursor, or the Link header's rel="next" URL, for the following page.
+// @Tags calls
+// @Produce json
+// @Param status query string false "Call status: ended, active or all" default(ended)
+// @Param limit query int false "Maximum number of calls to return (at most 100)" default(20)
+// @Param cursor query string false "Cursor from a previous page"
+// @Success 200 {object} CallHistoryResponse
+// @Header 200 {string} Link "URL of the next page"
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /users/me/calls [get]
+func (h *AttendanceHandler) History(c *gin.Context) {
+	log := logger.FromContext(c.Request.Context())
+	userID := c.GetUint("user_id")
+
+	page, ok := parsePageRequest(c, defaultHistoryPageSize, maxCallPageSize)
+	if !ok {
+		return
+	}
+
+	opts := repository.CallListOptions{ParticipantID: userID, Sort: repository.CallSortNewest}
+	switch status := c.DefaultQuery("status", "ended"); status {
+	case "active", "ended":
+		opts.Status = status
+	case "all":
+	default:
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "status must be active, ended or all"})
+		return
+	}
+	if page.Cursor != "" {
+		var after repository.CallCursor
+		if err := decodeCursor(page.Cursor, string(opts.Sort), &after); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+		opts.After = &after
+	}
+	opts.Limit = page.Limit + 1
+
+	calls, err := h.calls.List(c.Request.Context(), opts)
+	if err != nil {
+		log.Error("Failed to list calls", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to list calls"})
+		return
+	}
+	calls, more := trimPage(calls, page.Limit)
+
+	callIDs := make([]uint, len(calls))
+	for i := range calls {
+		callIDs[i] = calls[i].ID
+	}
+	records, err := h.participants.ListByUserInCalls(c.Request.Context(), userID, callIDs)
+	if err != nil {
+		log.Error("Failed to list call participation", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to list calls"})
+		return
+	}
+	byCall := make(map[uint][]models.CallParticipant, len(calls))
+	for _, record := range records {
+		byCall[record.CallID] = append(byCall[record.CallID], record)
+	}
+
+	now := time.Now()
+	resp := CallHistoryResponse{Calls: make([]CallHistoryEntry, 0, len(calls))}
+	for _, call := range calls {
+		sessions, total, present := summarizeAttendance(byCall[call.ID], now)
+		resp.Calls = append(resp.Calls, CallHistoryEntry{
+			Call:         call,
+			Sessions:     sessions,
+			TotalSeconds: int64(total / time.Second),
+			InCall:       present,
+			Host:         call.CreatorID == userID,
+		})
+	}
+	if more {
+		last := calls[len(calls)-1]
+		resp.NextCursor, err = encodeCursor(string(opts.Sort), repository.CallCursor{CreatedAt: last.CreatedAt, Title: last.Title, ID: last.ID})
+		if err != nil {
+			log.Error("Failed to encode cursor", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to list calls"})
+			return
+		}
+		setNextLink(c, resp.NextCursor)
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// Report godoc
+// @Summary Get a call's attendance
+// @Description Report everyone who joined a call with their join and leave times and total time in it, in the order they first joined. Sessions still open count up to now. Only the call's host can see it.
+// @Tags calls
+// @Produce json
+// @Param room_id path string true "Call ID"
+// @Success 200 {object} AttendanceReport
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /calls/{room_id}/attendance [get]
+func (h *AttendanceHandler) Report(c *gin.Context) {
+	log := logger.FromContext(c.Request.Context())
+
+	callID, err := strconv.ParseUint(c.Param("room_id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid room_id format"})
+		return
+	}
+
+	call, err := h.calls.GetByID(c.Request.Context(), uint(callID))
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Call not found"})
+		return
+	}
+	if err != nil {
+		log.Error("Failed to fetch call", zap.Error(err), zap.Uint64("call_id", callID))
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch attendance"})
+		return
+	}
+	if call.CreatorID != c.GetUint("user_id") {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: "Only the host can see the attendance of a call"})
+		return
+	}
+
+	records, err := h.participants.ListByCall(c.Request.Context(), call.ID)
+	if err != nil {
+		log.Error("Failed to list call participants", zap.Error(err), zap.Uint64("call_id", callID))
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch attendance"})
+		return
+	}
+
+	// Records come in join order, so users are met in the order they first joined
+	var order []uint
+	byUser := make(map[uint][]models.CallParticipant)
+	for _, record := range records {
+		if _, seen := byUser[record.UserID]; !seen {
+			order = append(order, record.UserID)
+		}
+		byUser[record.UserID] = append(byUser[record.UserID], record)
+	}
+
+	users, err := h.users.GetByIDs(c.Request.Context(), order)
+	if err != nil {
+		log.Error("Failed to look up attendees", zap.Error(err), zap.Uint64("call_id", callID))
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch attendance"})
+		return
+	}
+	usersByID := make(map[uint]*models.User, len(users))
+	for i := range users {
+		usersByID[users[i].ID] = &users[i]
+	}
+
+	now := time.Now()
+	report := AttendanceReport{
+		CallID:    call.ID,
+		Title:     call.Title,
+		Status:    call.Status,
+		CreatedAt: call.CreatedAt,
+		Attendees: make([]AttendeeReport, 0, len(order)),
+	}
+	for _, userID := range order {
+		sessions, total, present := summarizeAttendance(byUser[userID], now)
+		attendee := AttendeeReport{
+			UserID:       userID,
+			Sessions:     sessions,
+			TotalSeconds: int64(total / time.Second),
+			InCall:       present,
+		}
+		if user, ok := usersByID[userID]; ok {
+			attendee.Username = user.Username
+			attendee.DisplayName = user.DisplayName
+		}
+		report.Attendees = append(report.Attendees, attendee)
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// summarizeAttendance turns one user's participant records in a call into
+// sessions in join order. The total counts time covered by overlapping
+// sessions once, and open sessions count up to now. present reports whether
+// a session is still open.
+func summarizeAttendance(records []models.CallParticipant, now time.Time) (sessions []AttendanceSession, total time.Duration, present bool) {
+	records = slices.Clone(records)
+	slices.SortStableFunc(records, func(a, b models.CallParticipant) int {
+		return a.JoinedAt.Compare(b.JoinedAt)
+	})
+
+	sessions = make([]AttendanceSession, 0, len(records))
+	var coveredUntil time.Time
+	for _, record := range records {
+		end := now
+		if record.LeftAt != nil {
+			end = *record.LeftAt
+		} else {
+			present = true
+		}
+		if end.Before(record.JoinedAt) {
+			end = record.JoinedAt
+		}
+		sessions = append(sessions, AttendanceSession{
+			JoinedAt:        record.JoinedAt,
+			LeftAt:          record.LeftAt,
+			DurationSeconds: int64(end.Sub(record.JoinedAt) / time.Second),
+		})
+
+		start := record.JoinedAt
+		if start.Before(coveredUntil) {
+			start = coveredUntil
+		}
+		if end.After(start) {
+			total += end.Sub(start)
+			coveredUntil = end
+		}
+	}
+	return sessions, total, present
+}
@@ -0,0 +1,186 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ayush/accountability-app/backend/internal/auth"
+	"github.com/ayush/accountability-app/backend/internal/models"
+	"github.com/ayush/accountability-app/backend/internal/repository"
+)
+
+// addAttendance records a user's stretch in a call; a zero leftAfter leaves
+// it open
+func addAttendance(t *testing.T, repos *repository.Repositories, callID, userID uint, joinedAt time.Time, leftAfter time.Duration) {
+	t.Helper()
+
+	record := models.CallParticipant{CallID: callID, UserID: userID, JoinedAt: joinedAt}
+	if leftAfter > 0 {
+		leftAt := joinedAt.Add(leftAfter)
+		record.LeftAt = &leftAt
+	}
+	if err := repos.Participants.Create(t.Context(), &record); err != nil {
+		t.Fatalf("failed to add participant: %v", err)
+	}
+}
+
+func TestSummarizeAttendance(t *testing.T) {
+	start := time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC)
+	at := func(minutes int) *time.Time {
+		t := start.Add(time.Duration(minutes) * time.Minute)
+		return &t
+	}
+
+	records := []models.CallParticipant{
+		{JoinedAt: *at(60), LeftAt: at(90)},
+		// Joined from a second device while still in the call
+		{JoinedAt: *at(0), LeftAt: at(30)},
+		{JoinedAt: *at(20), LeftAt: at(40)},
+		{JoinedAt: *at(100)},
+	}
+	sessions, total, present := summarizeAttendance(records, *at(110))
+
+	if len(sessions) != 4 || !sessions[0].JoinedAt.Equal(start) || sessions[3].LeftAt != nil {
+		t.Fatalf("expected sessions in join order, got %+v", sessions)
+	}
+	if sessions[1].DurationSeconds != 20*60 || sessions[3].DurationSeconds != 10*60 {
+		t.Fatalf("unexpected durations: %+v", sessions)
+	}
+	// 0-40 with the overlap counted once, 60-90 and 100-110
+	if total != 80*time.Minute || !present {
+		t.Fatalf("expected 80 minutes and still present, got %v and %v", total, present)
+	}
+}
+
+func TestCallHistory(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	router := newTestRouter(repos)
+	user, token := createTestUser(t, repos, "john@example.com", "johndoe", "secret123")
+	host, _ := createTestUser(t, repos, "jane@example.com", "janedoe", "secret123")
+
+	start := time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC)
+	var calls []*models.Call
+	for i, title := range []string{"Morning pages", "Deep work", "Not attended"} {
+		call := &models.Call{Title: title, CreatorID: host.ID, Status: "ended", CreatedAt: start.Add(time.Duration(i) * time.Hour)}
+		if err := repos.Calls.Create(t.Context(), call); err != nil {
+			t.Fatalf("failed to create call: %v", err)
+		}
+		calls = append(calls, call)
+	}
+	addAttendance(t, repos, calls[0].ID, user.ID, start, 25*time.Minute)
+	addAttendance(t, repos, calls[0].ID, user.ID, start.Add(30*time.Minute), 20*time.Minute)
+	addAttendance(t, repos, calls[1].ID, user.ID, start.Add(time.Hour), time.Hour)
+	addAttendance(t, repos, calls[2].ID, host.ID, start.Add(2*time.Hour), time.Hour)
+
+	rec := doRequest(t, router, http.MethodGet, "/api/users/me/calls?limit=1", nil, token)
+	expectStatus(t, rec, http.StatusOK)
+	var first CallHistoryResponse
+	decodeResponse(t, rec, &first)
+	if len(first.Calls) != 1 || first.Calls[0].Call.ID != calls[1].ID || first.Calls[0].TotalSeconds != 3600 || first.NextCursor == "" {
+		t.Fatalf("unexpected first page: %+v", first)
+	}
+
+	rec = doRequest(t, router, http.MethodGet, "/api/users/me/calls?limit=1&cursor="+first.NextCursor, nil, token)
+	expectStatus(t, rec, http.StatusOK)
+	var second CallHistoryResponse
+	decodeResponse(t, rec, &second)
+	if len(second.Calls) != 1 || second.NextCursor != "" {
+		t.Fatalf("unexpected second page: %+v", second)
+	}
+	entry := second.Calls[0]
+	if entry.Call.ID != calls[0].ID || len(entry.Sessions) != 2 || entry.TotalSeconds != 45*60 || entry.InCall || entry.Host {
+		t.Fatalf("unexpected history entry: %+v", entry)
+	}
+
+	t.Run("join and leave", func(t *testing.T) {
+		call := &models.Call{Title: "Live", CreatorID: user.ID, Status: "active", CreatedAt: time.Now()}
+		if err := repos.Calls.Create(t.Context(), call); err != nil {
+			t.Fatalf("failed to create call: %v", err)
+		}
+		for range 2 {
+			rec := doRequest(t, router, http.MethodPost, "/api/calls/join", models.CallJoin{CallID: call.ID, UserID: user.ID}, token)
+			expectStatus(t, rec, http.StatusOK)
+			rec = doRequest(t, router, http.MethodPost, fmt.Sprintf("/api/calls/%d/leave", call.ID), nil, token)
+			expectStatus(t, rec, http.StatusOK)
+		}
+
+		rec := doRequest(t, router, http.MethodGet, "/api/users/me/calls?status=active", nil, token)
+		expectStatus(t, rec, http.StatusOK)
+		var resp CallHistoryResponse
+		decodeResponse(t, rec, &resp)
+		if len(resp.Calls) != 1 || !resp.Calls[0].Host || resp.Calls[0].InCall || len(resp.Calls[0].Sessions) != 2 {
+			t.Fatalf("expected two closed sessions in the live call, got %+v", resp.Calls)
+		}
+		for _, session := range resp.Calls[0].Sessions {
+			if session.LeftAt == nil {
+				t.Fatalf("expected the session to be closed: %+v", session)
+			}
+		}
+	})
+
+	t.Run("only past calls by default", func(t *testing.T) {
+		rec := doRequest(t, router, http.MethodGet, "/api/users/me/calls", nil, token)
+		expectStatus(t, rec, http.StatusOK)
+		var resp CallHistoryResponse
+		decodeResponse(t, rec, &resp)
+		if len(resp.Calls) != 2 {
+			t.Fatalf("expected the 2 ended calls, got %+v", resp.Calls)
+		}
+		for _, entry := range resp.Calls {
+			if entry.Call.Status != "ended" {
+				t.Fatalf("listed a call in progress: %+v", entry.Call)
+			}
+		}
+	})
+
+	rec = doRequest(t, router, http.MethodGet, "/api/users/me/calls?status=paused", nil, token)
+	expectStatus(t, rec, http.StatusBadRequest)
+}
+
+func TestAttendanceReport(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	router := newTestRouter(repos)
+	host, hostToken := createTestUser(t, repos, "john@example.com", "johndoe", "secret123")
+	guest, guestToken := createTestUser(t, repos, "jane@example.com", "janedoe", "secret123")
+	_, moderatorToken := createTestUserWithRole(t, repos, "mod@example.com", "mod", auth.RoleModerator)
+
+	start := time.Now().Add(-2 * time.Hour).Truncate(time.Second)
+	call := &models.Call{Title: "Morning pages", CreatorID: host.ID, Status: "active", CreatedAt: start}
+	if err := repos.Calls.Create(t.Context(), call); err != nil {
+		t.Fatalf("failed to create call: %v", err)
+	}
+	addAttendance(t, repos, call.ID, host.ID, start, 0)
+	addAttendance(t, repos, call.ID, guest.ID, start.Add(10*time.Minute), 20*time.Minute)
+	addAttendance(t, repos, call.ID, guest.ID, start.Add(time.Hour), 30*time.Minute)
+	path := fmt.Sprintf("/api/calls/%d/attendance", call.ID)
+
+	rec := doRequest(t, router, http.MethodGet, path, nil, hostToken)
+	expectStatus(t, rec, http.StatusOK)
+	var report AttendanceReport
+	decodeResponse(t, rec, &report)
+	if len(report.Attendees) != 2 || report.Attendees[0].UserID != host.ID || !report.Attendees[0].InCall {
+		t.Fatalf("unexpected attendees: %+v", report.Attendees)
+	}
+	if attendee := report.Attendees[1]; attendee.Username != "janedoe" || len(attendee.Sessions) != 2 || attendee.TotalSeconds != 50*60 || attendee.InCall {
+		t.Fatalf("unexpected guest attendance: %+v", attendee)
+	}
+
+	expectStatus(t, doRequest(t, router, http.MethodGet, path, nil, guestToken), http.StatusForbidden)
+	expectStatus(t, doRequest(t, router, http.MethodGet, "/api/calls/999/attendance", nil, hostToken), http.StatusNotFound)
+	expectStatus(t, doRequest(t, router, http.MethodGet, "/api/calls/abc/attendance", nil, hostToken), http.StatusBadRequest)
+
+	t.Run("ending the call closes open sessions", func(t *testing.T) {
+		rec := doRequest(t, router, http.MethodPost, fmt.Sprintf("/api/admin/calls/%d/end", call.ID), nil, moderatorToken)
+		expectStatus(t, rec, http.StatusOK)
+
+		rec = doRequest(t, router, http.MethodGet, path, nil, hostToken)
+		expectStatus(t, rec, http.StatusOK)
+		var report AttendanceReport
+		decodeResponse(t, rec, &report)
+		if report.Status != "ended" || report.Attendees[0].InCall || report.Attendees[0].Sessions[0].LeftAt == nil {
+			t.Fatalf("expected the host's session to be closed, got %+v", report.Attendees[0])
+		}
+	})
+}
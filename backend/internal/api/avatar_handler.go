@@ -0,0 +1,187 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/ayush/accountability-app/backend/internal/logger"
+	"github.com/ayush/accountability-app/backend/internal/media"
+	"github.com/ayush/accountability-app/backend/internal/models"
+	"github.com/ayush/accountability-app/backend/internal/repository"
+	"github.com/ayush/accountability-app/backend/internal/storage"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// multipartOverhead is allowed on top of the file size for the multipart
+// boundaries and headers of an upload
+const multipartOverhead = 64 << 10
+
+// AvatarHandler stores uploaded avatars as square thumbnails
+type AvatarHandler struct {
+	users    repository.UserRepository
+	storage  storage.Storage
+	maxBytes int64
+}
+
+// NewAvatarHandler creates an avatar handler that keeps images in store and
+// accepts uploads of up to maxBytes
+func NewAvatarHandler(users repository.UserRepository, store storage.Storage, maxBytes int64) *AvatarHandler {
+	return &AvatarHandler{users: users, storage: store, maxBytes: maxBytes}
+}
+
+// Upload godoc
+// @Summary Upload an avatar
+// @Description Upload a PNG, JPEG, GIF or WebP image as the current user's avatar, as the "avatar" field of a multipart form. The image is cropped to a centred square and stored as 64, 128 and 256 pixel PNG thumbnails; avatar_url points at the largest. Images may be at most 4096 pixels on either side.
+// @Tags users
+// @Accept multipart/form-data
+// @Produce json
+// @Param avatar formData file true "Image file"
+// @Success 200 {object} UserResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 413 {object} ErrorResponse
+// @Failure 415 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /users/me/avatar [put]
+func (h *AvatarHandler) Upload(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := logger.FromContext(ctx)
+	tooLarge := ErrorResponse{Error: fmt.Sprintf("Avatar must be at most %d bytes", h.maxBytes)}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, h.maxBytes+multipartOverhead)
+	header, err := c.FormFile("avatar")
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		c.JSON(http.StatusRequestEntityTooLarge, tooLarge)
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Expected an image in the avatar field of a multipart form"})
+		return
+	}
+	if header.Size > h.maxBytes {
+		c.JSON(http.StatusRequestEntityTooLarge, tooLarge)
+		return
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		log.Error("Failed to open upload", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to upload avatar"})
+		return
+	}
+	data, err := io.ReadAll(file)
+	file.Close()
+	if err != nil {
+		log.Error("Failed to read upload", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to upload avatar"})
+		return
+	}
+
+	if contentType, ok := media.DetectType(data); !ok {
+		c.JSON(http.StatusUnsupportedMediaType, ErrorResponse{Error: "Avatar must be a PNG, JPEG, GIF or WebP image, got " + contentType})
+		return
+	}
+	thumbnails, err := media.Thumbnails(data, media.ThumbnailSizes)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	user, ok := currentUser(c, h.users)
+	if !ok {
+		return
+	}
+
+	// A fresh name for every upload, so caches never serve an old avatar
+	suffix := make([]byte, 8)
+	if _, err := rand.Read(suffix); err != nil {
+		log.Error("Failed to name avatar", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to upload avatar"})
+		return
+	}
+	prefix := fmt.Sprintf("avatars/%d/%s", user.ID, hex.EncodeToString(suffix))
+
+	avatar := models.Avatar{Thumbnails: make(map[string]string, len(thumbnails))}
+	for _, thumb := range thumbnails {
+		key := fmt.Sprintf("%s-%d.png", prefix, thumb.Size)
+		if err := h.storage.Put(ctx, key, bytes.NewReader(thumb.Data), int64(len(thumb.Data)), media.ThumbnailContentType); err != nil {
+			log.Error("Failed to store avatar", zap.String("key", key), zap.Error(err))
+			h.deleteObjects(ctx, avatar.Keys)
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to upload avatar"})
+			return
+		}
+		avatar.Keys = append(avatar.Keys, key)
+		avatar.Thumbnails[strconv.Itoa(thumb.Size)] = h.storage.URL(key)
+		avatar.URL = h.storage.URL(key)
+	}
+
+	if err := h.users.SetAvatar(ctx, user.ID, avatar); err != nil {
+		log.Error("Failed to save avatar", zap.Error(err))
+		h.deleteObjects(ctx, avatar.Keys)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to upload avatar"})
+		return
+	}
+	h.deleteObjects(ctx, user.AvatarKeyList())
+
+	user, ok = currentUser(c, h.users)
+	if !ok {
+		return
+	}
+	log.Info("Avatar uploaded", zap.Uint("user_id", user.ID), zap.Int("bytes", len(data)))
+	c.JSON(http.StatusOK, newUserResponse(user))
+}
+
+// Delete godoc
+// @Summary Remove the avatar
+// @Description Remove the current user's avatar, whether uploaded or set as a URL. Uploaded images are deleted.
+// @Tags users
+// @Produce json
+// @Success 200 {object} UserResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /users/me/avatar [delete]
+func (h *AvatarHandler) Delete(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	user, ok := currentUser(c, h.users)
+	if !ok {
+		return
+	}
+	if err := h.users.SetAvatar(ctx, user.ID, models.Avatar{}); err != nil {
+		logger.FromContext(ctx).Error("Failed to remove avatar", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to remove avatar"})
+		return
+	}
+	h.deleteObjects(ctx, user.AvatarKeyList())
+
+	user, ok = currentUser(c, h.users)
+	if !ok {
+		return
+	}
+	logger.FromContext(ctx).Info("Avatar removed", zap.Uint("user_id", user.ID))
+	c.JSON(http.StatusOK, newUserResponse(user))
+}
+
+// deleteObjects removes the images of a replaced avatar. Failures only
+// leave orphaned files behind, so they are logged rather than returned.
+func (h *AvatarHandler) deleteObjects(ctx context.Context, keys []string) {
+	for _, key := range keys {
+		if err := h.storage.Delete(ctx, key); err != nil {
+			logger.FromContext(ctx).Warn("Failed to delete avatar image", zap.String("key", key), zap.Error(err))
+		}
+	}
+}
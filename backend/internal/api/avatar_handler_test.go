@@ -0,0 +1,146 @@
+package api
+
+import (
+	"bytes"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ayush/accountability-app/backend/internal/repository"
+	"github.com/ayush/accountability-app/backend/internal/storage"
+	"github.com/ayush/accountability-app/backend/internal/testutil/imagetest"
+
+	"github.com/gin-gonic/gin"
+)
+
+// uploadAvatar sends data as the avatar field of a multipart form
+func uploadAvatar(t *testing.T, router *gin.Engine, token string, data []byte) *httptest.ResponseRecorder {
+	t.Helper()
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, _ := form.CreateFormFile("avatar", "me.png")
+	part.Write(data)
+	form.Close()
+
+	req := httptest.NewRequest(http.MethodPut, "/api/users/me/avatar", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestUploadAvatar(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	store := storage.NewMemory("https://media.example.com")
+	router := newTestRouterWith(repos, testDeps{storage: store})
+	user, token := createTestUser(t, repos, "john@example.com", "johndoe", "secret123")
+
+	rec := uploadAvatar(t, router, token, imagetest.Encode(t, 400, 300, "png"))
+	expectStatus(t, rec, http.StatusOK)
+	var resp UserResponse
+	decodeResponse(t, rec, &resp)
+
+	if len(resp.AvatarThumbnails) != 3 || resp.AvatarURL != resp.AvatarThumbnails["256"] {
+		t.Fatalf("unexpected avatar: %q, %v", resp.AvatarURL, resp.AvatarThumbnails)
+	}
+	keys := store.Keys()
+	if len(keys) != 3 {
+		t.Fatalf("expected three stored thumbnails, got %v", keys)
+	}
+	for _, key := range keys {
+		if !strings.HasPrefix(key, "avatars/1/") {
+			t.Fatalf("unexpected key %q", key)
+		}
+		obj, _ := store.Get(key)
+		img, err := png.Decode(bytes.NewReader(obj.Data))
+		if err != nil || obj.ContentType != "image/png" {
+			t.Fatalf("thumbnail %q is not a PNG: %v", key, err)
+		}
+		if img.Bounds().Dx() != img.Bounds().Dy() {
+			t.Fatalf("thumbnail %q is not square: %v", key, img.Bounds())
+		}
+	}
+
+	t.Run("replacing deletes the old images", func(t *testing.T) {
+		rec := uploadAvatar(t, router, token, imagetest.Encode(t, 64, 64, "png"))
+		expectStatus(t, rec, http.StatusOK)
+		stored, _ := repos.Users.GetByID(t.Context(), user.ID)
+		if got := store.Keys(); len(got) != 3 || strings.Join(got, " ") == strings.Join(keys, " ") {
+			t.Fatalf("expected only the new thumbnails to be stored, got %v", got)
+		}
+		if len(stored.AvatarKeyList()) != 3 {
+			t.Fatalf("unexpected stored keys %q", stored.AvatarKeys)
+		}
+	})
+
+	t.Run("setting a URL deletes the uploaded images", func(t *testing.T) {
+		rec := doRequest(t, router, http.MethodPatch, "/api/users/me", map[string]string{"avatar_url": "https://cdn.example.com/john.png"}, token)
+		expectStatus(t, rec, http.StatusOK)
+		var resp UserResponse
+		decodeResponse(t, rec, &resp)
+		if resp.AvatarURL != "https://cdn.example.com/john.png" || len(resp.AvatarThumbnails) != 0 {
+			t.Fatalf("unexpected avatar: %q, %v", resp.AvatarURL, resp.AvatarThumbnails)
+		}
+		if got := store.Keys(); len(got) != 0 {
+			t.Fatalf("expected the uploaded images to be deleted, got %v", got)
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		expectStatus(t, uploadAvatar(t, router, token, imagetest.Encode(t, 64, 64, "png")), http.StatusOK)
+
+		rec := doRequest(t, router, http.MethodDelete, "/api/users/me/avatar", nil, token)
+		expectStatus(t, rec, http.StatusOK)
+		var resp UserResponse
+		decodeResponse(t, rec, &resp)
+		if resp.AvatarURL != "" || len(resp.AvatarThumbnails) != 0 {
+			t.Fatalf("expected no avatar, got %q, %v", resp.AvatarURL, resp.AvatarThumbnails)
+		}
+		if got := store.Keys(); len(got) != 0 {
+			t.Fatalf("expected the uploaded images to be deleted, got %v", got)
+		}
+	})
+}
+
+func TestUploadAvatarRejects(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	store := storage.NewMemory("https://media.example.com")
+	router := newTestRouterWith(repos, testDeps{storage: store})
+	_, token := createTestUser(t, repos, "john@example.com", "johndoe", "secret123")
+
+	t.Run("not an image", func(t *testing.T) {
+		rec := uploadAvatar(t, router, token, []byte("<svg xmlns=\"http://www.w3.org/2000/svg\"></svg>"))
+		expectStatus(t, rec, http.StatusUnsupportedMediaType)
+	})
+
+	t.Run("corrupt image", func(t *testing.T) {
+		rec := uploadAvatar(t, router, token, imagetest.Encode(t, 50, 50, "png")[:60])
+		expectStatus(t, rec, http.StatusBadRequest)
+	})
+
+	t.Run("too large", func(t *testing.T) {
+		data := append(imagetest.Encode(t, 10, 10, "png"), make([]byte, 1<<20)...)
+		rec := uploadAvatar(t, router, token, data)
+		expectStatus(t, rec, http.StatusRequestEntityTooLarge)
+	})
+
+	t.Run("no file", func(t *testing.T) {
+		rec := doRequest(t, router, http.MethodPut, "/api/users/me/avatar", map[string]string{"avatar": "x"}, token)
+		expectStatus(t, rec, http.StatusBadRequest)
+	})
+
+	t.Run("API keys are refused", func(t *testing.T) {
+		key := createAPIKey(t, router, token, "profile:read")
+		rec := uploadAvatar(t, router, key.Key, imagetest.Encode(t, 10, 10, "png"))
+		expectStatus(t, rec, http.StatusForbidden)
+	})
+
+	if keys := store.Keys(); len(keys) != 0 {
+		t.Fatalf("expected nothing to be stored, got %v", keys)
+	}
+}
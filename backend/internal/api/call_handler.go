@@ -1,34 +1,72 @@
 package api
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/ayush/accountability-app/backend/internal/logger"
 	"github.com/ayush/accountability-app/backend/internal/models"
+	"github.com/ayush/accountability-app/backend/internal/repository"
+	ws "github.com/ayush/accountability-app/backend/internal/websocket"
 
 	"github.com/gin-gonic/gin"
-	"gorm.io/gorm"
+	"go.uber.org/zap"
+)
+
+const (
+	// defaultCallPageSize is the number of calls listed when no limit is given
+	defaultCallPageSize = 20
+
+	// maxCallPageSize caps the limit query parameter
+	maxCallPageSize = 100
+
+	// maxTagLength bounds the length of a call tag
+	maxTagLength = 30
 )
 
 // VideoCallHandler handles video call-related HTTP endpoints
 type VideoCallHandler struct {
-	db *gorm.DB
+	calls        repository.CallRepository
+	participants repository.ParticipantRepository
+	hub          *ws.Hub
+
+	// Serializes syncAttendance so its check of who is connected and the
+	// update that follows are not interleaved with another's
+	attendanceMu sync.Mutex
+}
+
+// CallListResponse is a page of calls. NextCursor is empty on the last page.
+type CallListResponse struct {
+	Calls      []models.Call `json:"calls"`
+	NextCursor string        `json:"next_cursor,omitempty" example:"eyJzIjoibmV3ZXN0IiwicCI6ey4uLn19"`
 }
 
-// NewVideoCallHandler creates a new video call handler
-func NewVideoCallHandler(db *gorm.DB) *VideoCallHandler {
-	return &VideoCallHandler{db: db}
+// NewVideoCallHandler creates a new video call handler. hub is used to close
+// the rooms of calls their host ends, and users connecting to and
+// disconnecting from a call's room are recorded as joining and leaving it.
+func NewVideoCallHandler(calls repository.CallRepository, participants repository.ParticipantRepository, hub *ws.Hub) *VideoCallHandler {
+	h := &VideoCallHandler{calls: calls, participants: participants, hub: hub}
+	hub.OnPresence(h.syncAttendance)
+	return h
 }
 
 // CreateCall godoc
 // @Summary Create a new call
-// @Description Create a new video call session
+// @Description Create a new video call session hosted by the current user. creator_id may be omitted; any ID other than the caller's is refused.
 // @Tags calls
 // @Accept json
 // @Produce json
 // @Param call body models.CallCreate true "Call details"
 // @Success 201 {object} models.Call
 // @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
 // @Security Bearer
 // @Router /calls [post]
@@ -39,32 +77,49 @@ func (h *VideoCallHandler) CreateCall(c *gin.Context) {
 		return
 	}
 
+	userID := c.GetUint("user_id")
+	if input.CreatorID != 0 && input.CreatorID != userID {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: "Calls can only be created for yourself"})
+		return
+	}
+
+	tags, err := normalizeTags(input.Tags)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
 	call := models.Call{
 		Title:       input.Title,
 		Description: input.Description,
-		CreatorID:   input.CreatorID,
+		CreatorID:   userID,
+		Tags:        tags,
 		Status:      "active",
 		CreatedAt:   time.Now(),
 		UpdatedAt:   time.Now(),
 	}
 
-	if err := h.db.Create(&call).Error; err != nil {
+	if err := h.calls.Create(c.Request.Context(), &call); err != nil {
+		logger.FromContext(c.Request.Context()).Error("Failed to create call", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to create call"})
 		return
 	}
 
+	logger.FromContext(c.Request.Context()).Info("Call created", zap.Uint("call_id", call.ID))
+
 	c.JSON(http.StatusCreated, call)
 }
 
 // JoinCall godoc
 // @Summary Join an existing call
-// @Description Join an active video call session
+// @Description Join an active video call session as the current user. user_id may be omitted; any ID other than the caller's is refused. Joining a call the user is already in returns their current record.
 // @Tags calls
 // @Accept json
 // @Produce json
 // @Param join body models.CallJoin true "Join call details"
 // @Success 200 {object} models.CallParticipant
 // @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
 // @Failure 404 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
 // @Security Bearer
@@ -76,25 +131,35 @@ func (h *VideoCallHandler) JoinCall(c *gin.Context) {
 		return
 	}
 
-	var call models.Call
-	if err := h.db.First(&call, input.CallID).Error; err != nil {
+	userID := c.GetUint("user_id")
+	if input.UserID != 0 && input.UserID != userID {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: "Calls can only be joined as yourself"})
+		return
+	}
+
+	call, err := h.calls.GetByID(c.Request.Context(), input.CallID)
+	if errors.Is(err, repository.ErrNotFound) {
 		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Call not found"})
 		return
 	}
+	if err != nil {
+		logger.FromContext(c.Request.Context()).Error("Failed to fetch call",
+			zap.Error(err),
+			zap.Uint("call_id", input.CallID))
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to join call"})
+		return
+	}
 
 	if call.Status != "active" {
 		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Call is not active"})
 		return
 	}
 
-	participant := models.CallParticipant{
-		CallID:    input.CallID,
-		UserID:    input.UserID,
-		JoinedAt:  time.Now(),
-		UpdatedAt: time.Now(),
-	}
-
-	if err := h.db.Create(&participant).Error; err != nil {
+	participant, err := joinCall(c.Request.Context(), h.participants, input.CallID, userID)
+	if err != nil {
+		logger.FromContext(c.Request.Context()).Error("Failed to join call",
+			zap.Error(err),
+			zap.Uint("call_id", input.CallID))
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to join call"})
 		return
 	}
@@ -102,6 +167,28 @@ func (h *VideoCallHandler) JoinCall(c *gin.Context) {
 	c.JSON(http.StatusOK, participant)
 }
 
+// joinCall returns the user's open participant record in a call, starting
+// one if they are not in it. Joining twice, e.g. from a second device or
+// while the WebSocket connecting has already done so, keeps one record.
+func joinCall(ctx context.Context, participants repository.ParticipantRepository, callID, userID uint) (*models.CallParticipant, error) {
+	participant, err := participants.GetOpen(ctx, callID, userID)
+	if !errors.Is(err, repository.ErrNotFound) {
+		return participant, err
+	}
+
+	now := time.Now()
+	participant = &models.CallParticipant{CallID: callID, UserID: userID, JoinedAt: now, UpdatedAt: now}
+	err = participants.Create(ctx, participant)
+	if errors.Is(err, repository.ErrDuplicate) {
+		// Joined concurrently
+		return participants.GetOpen(ctx, callID, userID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return participant, nil
+}
+
 // LeaveCall godoc
 // @Summary Leave a call
 // @Description Leave a video call session
@@ -117,9 +204,18 @@ func (h *VideoCallHandler) JoinCall(c *gin.Context) {
 // @Router /calls/{room_id}/leave [post]
 func (h *VideoCallHandler) LeaveCall(c *gin.Context) {
 	roomID := c.Param("room_id")
-	userID := c.GetString("user_id")
+	userID := c.GetUint("user_id")
+
+	callID, err := strconv.ParseUint(roomID, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid room_id format"})
+		return
+	}
 
-	if err := h.db.Where("call_id = ? AND user_id = ?", roomID, userID).Delete(&models.CallParticipant{}).Error; err != nil {
+	if err := h.participants.Leave(c.Request.Context(), uint(callID), userID, time.Now()); err != nil {
+		logger.FromContext(c.Request.Context()).Error("Failed to leave call",
+			zap.Error(err),
+			zap.String("room_id", roomID))
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to leave call"})
 		return
 	}
@@ -127,22 +223,284 @@ func (h *VideoCallHandler) LeaveCall(c *gin.Context) {
 	c.JSON(http.StatusOK, SuccessResponse{Message: "Successfully left the call"})
 }
 
-// ListActiveCalls godoc
-// @Summary List all active calls
-// @Description Get a list of all active video call sessions
+// EndCall godoc
+// @Summary End a call
+// @Description End a call the current user hosts. Everyone still in the call leaves it, which closes their attendance, and its WebSocket room is closed.
+// @Tags calls
+// @Produce json
+// @Param room_id path string true "Room ID"
+// @Success 200 {object} EndCallResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /calls/{room_id}/end [post]
+func (h *VideoCallHandler) EndCall(c *gin.Context) {
+	log := logger.FromContext(c.Request.Context())
+
+	callID, err := strconv.ParseUint(c.Param("room_id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid room_id format"})
+		return
+	}
+
+	call, err := h.calls.GetByID(c.Request.Context(), uint(callID))
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Call not found"})
+		return
+	}
+	if err != nil {
+		log.Error("Failed to get call", zap.Error(err), zap.Uint64("call_id", callID))
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to end call"})
+		return
+	}
+	if call.CreatorID != c.GetUint("user_id") {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: "Only the host can end a call"})
+		return
+	}
+
+	disconnected, err := endCall(c.Request.Context(), h.calls, h.participants, h.hub, call.ID, "call ended by the host")
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusConflict, ErrorResponse{Error: "Call is not active"})
+		return
+	}
+	if err != nil {
+		log.Error("Failed to end call", zap.Error(err), zap.Uint64("call_id", callID))
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to end call"})
+		return
+	}
+
+	log.Info("Call ended by host",
+		zap.Uint64("call_id", callID),
+		zap.Int("disconnected", disconnected))
+	c.JSON(http.StatusOK, EndCallResponse{CallID: call.ID, Disconnected: disconnected})
+}
+
+// endCall moves an active call to ended, closes the attendance of everyone
+// still in it and disconnects its WebSocket room with reason. It returns the
+// number of clients disconnected, or repository.ErrNotFound if the call does
+// not exist or is not active.
+func endCall(ctx context.Context, calls repository.CallRepository, participants repository.ParticipantRepository, hub *ws.Hub, callID uint, reason string) (int, error) {
+	if err := calls.UpdateStatus(ctx, callID, "active", "ended"); err != nil {
+		return 0, err
+	}
+
+	// Everyone still in the call leaves it now, which closes their attendance
+	if err := participants.LeaveAll(ctx, callID, time.Now()); err != nil {
+		logger.FromContext(ctx).Error("Failed to close call attendance", zap.Error(err), zap.Uint("call_id", callID))
+	}
+
+	// A call's WebSocket room is named after its ID
+	return hub.CloseRoom(strconv.FormatUint(uint64(callID), 10), reason), nil
+}
+
+// syncAttendance is called by the hub when a user's first connection to a
+// room opens or their last one goes away. Being connected to a call's room
+// counts as being in the call: reconnecting after a dropped connection
+// rejoins it, and closing the last connection leaves it, so attendance
+// neither stops early nor runs on after the user has gone. The hub is asked
+// who is connected rather than trusting the event, since events for the
+// same user can arrive out of order. The hub only knows this server's
+// connections, so a user's connections to a call must all reach one replica.
+func (h *VideoCallHandler) syncAttendance(roomID string, userID uint) {
+	callID, err := strconv.ParseUint(roomID, 10, 32)
+	if err != nil {
+		// Not a call's room
+		return
+	}
+
+	h.attendanceMu.Lock()
+	defer h.attendanceMu.Unlock()
+
+	ctx := context.Background()
+	if !h.hub.HasUser(roomID, userID) {
+		if err := h.participants.Leave(ctx, uint(callID), userID, time.Now()); err != nil {
+			logger.Error("Failed to record leaving a call on disconnect",
+				zap.Error(err),
+				zap.String("room_id", roomID),
+				zap.Uint("user_id", userID))
+		}
+		return
+	}
+
+	call, err := h.calls.GetByID(ctx, uint(callID))
+	if errors.Is(err, repository.ErrNotFound) {
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to fetch call on connect",
+			zap.Error(err),
+			zap.String("room_id", roomID))
+		return
+	}
+	if call.Status != "active" {
+		return
+	}
+	if _, err := joinCall(ctx, h.participants, call.ID, userID); err != nil {
+		logger.Error("Failed to record joining a call on connect",
+			zap.Error(err),
+			zap.String("room_id", roomID),
+			zap.Uint("user_id", userID))
+	}
+}
+
+// ListCalls godoc
+// @Summary List calls
+// @Description List calls a page at a time, active calls newest first by default. Follow next_cursor, or the Link header's rel="next" URL, for the following page; it is absent on the last page. A cursor only works with the sort it was issued for.
 // @Tags calls
 // @Accept json
 // @Produce json
-// @Success 200 {array} models.Call
+// @Param status query string false "Call status: active, ended or all" default(active)
+// @Param creator_id query int false "Only calls created by this user"
+// @Param created_after query string false "Only calls created at or after this time (RFC 3339)"
+// @Param created_before query string false "Only calls created before this time (RFC 3339)"
+// @Param mine query bool false "Only calls the current user has joined"
+// @Param tag query string false "Only calls with this tag"
+// @Param sort query string false "Order: newest, oldest or title" default(newest)
+// @Param limit query int false "Maximum number of calls to return (at most 100)" default(20)
+// @Param cursor query string false "Cursor from a previous page"
+// @Success 200 {object} CallListResponse
+// @Header 200 {string} Link "URL of the next page"
+// @Failure 400 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
 // @Security Bearer
 // @Router /calls [get]
-func (h *VideoCallHandler) ListActiveCalls(c *gin.Context) {
-	var calls []models.Call
-	if err := h.db.Where("status = ?", "active").Find(&calls).Error; err != nil {
+func (h *VideoCallHandler) ListCalls(c *gin.Context) {
+	page, ok := parsePageRequest(c, defaultCallPageSize, maxCallPageSize)
+	if !ok {
+		return
+	}
+
+	opts := repository.CallListOptions{Sort: repository.CallSort(c.DefaultQuery("sort", string(repository.CallSortNewest)))}
+	switch opts.Sort {
+	case repository.CallSortNewest, repository.CallSortOldest, repository.CallSortTitle:
+	default:
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "sort must be newest, oldest or title"})
+		return
+	}
+
+	switch status := c.DefaultQuery("status", "active"); status {
+	case "active", "ended":
+		opts.Status = status
+	case "all":
+	default:
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "status must be active, ended or all"})
+		return
+	}
+
+	if raw := c.Query("creator_id"); raw != "" {
+		creatorID, err := strconv.ParseUint(raw, 10, 32)
+		if err != nil || creatorID == 0 {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "creator_id must be a user ID"})
+			return
+		}
+		opts.CreatorID = uint(creatorID)
+	}
+
+	for _, bound := range []struct {
+		param string
+		dst   **time.Time
+	}{
+		{"created_after", &opts.CreatedAfter},
+		{"created_before", &opts.CreatedBefore},
+	} {
+		raw := c.Query(bound.param)
+		if raw == "" {
+			continue
+		}
+		at, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: bound.param + " must be an RFC 3339 time"})
+			return
+		}
+		*bound.dst = &at
+	}
+
+	if raw := c.Query("mine"); raw != "" {
+		mine, err := strconv.ParseBool(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "mine must be true or false"})
+			return
+		}
+		if mine {
+			// JoinCall only records the authenticated user, so nobody else
+			// can add calls to this list
+			opts.ParticipantID = c.GetUint("user_id")
+		}
+	}
+
+	if raw := c.Query("tag"); raw != "" {
+		tags, err := normalizeTags([]string{raw})
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+		opts.Tag = tags[0]
+	}
+
+	if page.Cursor != "" {
+		var after repository.CallCursor
+		if err := decodeCursor(page.Cursor, string(opts.Sort), &after); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+		opts.After = &after
+	}
+	opts.Limit = page.Limit + 1
+
+	calls, err := h.calls.List(c.Request.Context(), opts)
+	if err != nil {
+		logger.FromContext(c.Request.Context()).Error("Failed to fetch calls", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch calls"})
 		return
 	}
 
-	c.JSON(http.StatusOK, calls)
+	calls, more := trimPage(calls, page.Limit)
+	resp := CallListResponse{Calls: calls}
+	if more {
+		last := calls[len(calls)-1]
+		resp.NextCursor, err = encodeCursor(string(opts.Sort), repository.CallCursor{
+			CreatedAt: last.CreatedAt,
+			Title:     last.Title,
+			ID:        last.ID,
+		})
+		if err != nil {
+			logger.FromContext(c.Request.Context()).Error("Failed to encode cursor", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch calls"})
+			return
+		}
+		setNextLink(c, resp.NextCursor)
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// normalizeTags lowercases and validates tags, dropping duplicates. The
+// result is sorted.
+func normalizeTags(tags []string) ([]string, error) {
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if !validTag(tag) {
+			return nil, fmt.Errorf("tag %q must be 1 to %d letters, digits or dashes", tag, maxTagLength)
+		}
+		if !slices.Contains(normalized, tag) {
+			normalized = append(normalized, tag)
+		}
+	}
+	slices.Sort(normalized)
+	return normalized, nil
+}
+
+func validTag(tag string) bool {
+	if tag == "" || len(tag) > maxTagLength {
+		return false
+	}
+	for _, r := range tag {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '-' {
+			return false
+		}
+	}
+	return true
 }
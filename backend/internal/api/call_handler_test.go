@@ -0,0 +1,391 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ayush/accountability-app/backend/internal/models"
+	"github.com/ayush/accountability-app/backend/internal/repository"
+)
+
+func TestCreateCall(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	router := newTestRouter(repos)
+	user, token := createTestUser(t, repos, "john@example.com", "johndoe", "secret123")
+
+	rec := doRequest(t, router, http.MethodPost, "/api/calls", models.CallCreate{
+		Title:       "Team Meeting",
+		Description: "Weekly sync",
+		CreatorID:   user.ID,
+	}, token)
+	expectStatus(t, rec, http.StatusCreated)
+
+	var call models.Call
+	decodeResponse(t, rec, &call)
+	if call.ID == 0 || call.Status != "active" || call.CreatorID != user.ID {
+		t.Fatalf("unexpected call: %+v", call)
+	}
+
+	rec = doRequest(t, router, http.MethodPost, "/api/calls", models.CallCreate{
+		Title:     "Writing sprint",
+		CreatorID: user.ID,
+		Tags:      []string{"Writing", "morning", "writing"},
+	}, token)
+	expectStatus(t, rec, http.StatusCreated)
+	decodeResponse(t, rec, &call)
+	if !slices.Equal(call.Tags, []string{"morning", "writing"}) {
+		t.Fatalf("expected normalized tags, got %v", call.Tags)
+	}
+
+	rec = doRequest(t, router, http.MethodPost, "/api/calls", models.CallCreate{CreatorID: user.ID}, token)
+	expectStatus(t, rec, http.StatusBadRequest)
+
+	rec = doRequest(t, router, http.MethodPost, "/api/calls", models.CallCreate{Title: "Sprint", CreatorID: user.ID, Tags: []string{"two words"}}, token)
+	expectStatus(t, rec, http.StatusBadRequest)
+
+	t.Run("creator defaults to the caller", func(t *testing.T) {
+		rec := doRequest(t, router, http.MethodPost, "/api/calls", models.CallCreate{Title: "Sprint"}, token)
+		expectStatus(t, rec, http.StatusCreated)
+		var call models.Call
+		decodeResponse(t, rec, &call)
+		if call.CreatorID != user.ID {
+			t.Fatalf("expected the caller to host the call, got %+v", call)
+		}
+	})
+
+	t.Run("for another user", func(t *testing.T) {
+		other, otherToken := createTestUser(t, repos, "jane@example.com", "janedoe", "secret123")
+		rec := doRequest(t, router, http.MethodPost, "/api/calls", models.CallCreate{Title: "Forged", CreatorID: other.ID}, token)
+		expectStatus(t, rec, http.StatusForbidden)
+
+		rec = doRequest(t, router, http.MethodGet, fmt.Sprintf("/api/calls?status=all&creator_id=%d", other.ID), nil, otherToken)
+		expectStatus(t, rec, http.StatusOK)
+		var resp CallListResponse
+		decodeResponse(t, rec, &resp)
+		if len(resp.Calls) != 0 {
+			t.Fatalf("expected no calls hosted by the other user, got %+v", resp.Calls)
+		}
+	})
+}
+
+func TestJoinCall(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	router := newTestRouter(repos)
+	user, token := createTestUser(t, repos, "john@example.com", "johndoe", "secret123")
+
+	active := &models.Call{Title: "Active", CreatorID: user.ID, Status: "active"}
+	ended := &models.Call{Title: "Ended", CreatorID: user.ID, Status: "ended"}
+	for _, call := range []*models.Call{active, ended} {
+		if err := repos.Calls.Create(t.Context(), call); err != nil {
+			t.Fatalf("failed to create call: %v", err)
+		}
+	}
+
+	t.Run("active call", func(t *testing.T) {
+		rec := doRequest(t, router, http.MethodPost, "/api/calls/join", models.CallJoin{CallID: active.ID, UserID: user.ID}, token)
+		expectStatus(t, rec, http.StatusOK)
+
+		var participant models.CallParticipant
+		decodeResponse(t, rec, &participant)
+		if participant.CallID != active.ID || participant.UserID != user.ID {
+			t.Fatalf("unexpected participant: %+v", participant)
+		}
+
+		// Joining again, e.g. from another device, keeps the same record
+		rec = doRequest(t, router, http.MethodPost, "/api/calls/join", models.CallJoin{CallID: active.ID}, token)
+		expectStatus(t, rec, http.StatusOK)
+		var again models.CallParticipant
+		decodeResponse(t, rec, &again)
+		if again.ID != participant.ID {
+			t.Fatalf("expected rejoining to return record %d, got %+v", participant.ID, again)
+		}
+		records, _ := repos.Participants.ListByCall(t.Context(), active.ID)
+		if len(records) != 1 {
+			t.Fatalf("expected one participant record, got %+v", records)
+		}
+	})
+
+	t.Run("ended call", func(t *testing.T) {
+		rec := doRequest(t, router, http.MethodPost, "/api/calls/join", models.CallJoin{CallID: ended.ID, UserID: user.ID}, token)
+		expectStatus(t, rec, http.StatusBadRequest)
+	})
+
+	t.Run("unknown call", func(t *testing.T) {
+		rec := doRequest(t, router, http.MethodPost, "/api/calls/join", models.CallJoin{CallID: 999, UserID: user.ID}, token)
+		expectStatus(t, rec, http.StatusNotFound)
+	})
+
+	t.Run("as another user", func(t *testing.T) {
+		other, otherToken := createTestUser(t, repos, "jane@example.com", "janedoe", "secret123")
+		rec := doRequest(t, router, http.MethodPost, "/api/calls/join", models.CallJoin{CallID: active.ID, UserID: other.ID}, token)
+		expectStatus(t, rec, http.StatusForbidden)
+
+		rec = doRequest(t, router, http.MethodGet, "/api/calls?mine=true", nil, otherToken)
+		expectStatus(t, rec, http.StatusOK)
+		var resp CallListResponse
+		decodeResponse(t, rec, &resp)
+		if len(resp.Calls) != 0 {
+			t.Fatalf("expected no calls joined by the other user, got %+v", resp.Calls)
+		}
+
+		rec = doRequest(t, router, http.MethodGet, "/api/users/me/calls?status=all", nil, otherToken)
+		expectStatus(t, rec, http.StatusOK)
+		var history CallHistoryResponse
+		decodeResponse(t, rec, &history)
+		if len(history.Calls) != 0 {
+			t.Fatalf("expected no attended calls for the other user, got %+v", history.Calls)
+		}
+
+		rec = doRequest(t, router, http.MethodGet, fmt.Sprintf("/api/calls/%d/attendance", active.ID), nil, token)
+		expectStatus(t, rec, http.StatusOK)
+		var report AttendanceReport
+		decodeResponse(t, rec, &report)
+		for _, attendee := range report.Attendees {
+			if attendee.UserID == other.ID {
+				t.Fatalf("forged join recorded attendance: %+v", report.Attendees)
+			}
+		}
+	})
+}
+
+func TestLeaveCall(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	router := newTestRouter(repos)
+	user, token := createTestUser(t, repos, "john@example.com", "johndoe", "secret123")
+
+	call := &models.Call{Title: "Active", CreatorID: user.ID, Status: "active"}
+	if err := repos.Calls.Create(t.Context(), call); err != nil {
+		t.Fatalf("failed to create call: %v", err)
+	}
+
+	rec := doRequest(t, router, http.MethodPost, "/api/calls/join", models.CallJoin{CallID: call.ID, UserID: user.ID}, token)
+	expectStatus(t, rec, http.StatusOK)
+
+	rec = doRequest(t, router, http.MethodPost, fmt.Sprintf("/api/calls/%d/leave", call.ID), nil, token)
+	expectStatus(t, rec, http.StatusOK)
+
+	rec = doRequest(t, router, http.MethodPost, "/api/calls/abc/leave", nil, token)
+	expectStatus(t, rec, http.StatusBadRequest)
+}
+
+func TestEndCall(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	router := newTestRouter(repos)
+	host, hostToken := createTestUser(t, repos, "john@example.com", "johndoe", "secret123")
+	_, guestToken := createTestUser(t, repos, "jane@example.com", "janedoe", "secret123")
+
+	call := &models.Call{Title: "Active", CreatorID: host.ID, Status: "active"}
+	if err := repos.Calls.Create(t.Context(), call); err != nil {
+		t.Fatalf("failed to create call: %v", err)
+	}
+	for _, token := range []string{hostToken, guestToken} {
+		rec := doRequest(t, router, http.MethodPost, "/api/calls/join", models.CallJoin{CallID: call.ID}, token)
+		expectStatus(t, rec, http.StatusOK)
+	}
+	path := fmt.Sprintf("/api/calls/%d/end", call.ID)
+
+	t.Run("by a guest", func(t *testing.T) {
+		rec := doRequest(t, router, http.MethodPost, path, nil, guestToken)
+		expectStatus(t, rec, http.StatusForbidden)
+	})
+
+	rec := doRequest(t, router, http.MethodPost, path, nil, hostToken)
+	expectStatus(t, rec, http.StatusOK)
+	if ended, _ := repos.Calls.GetByID(t.Context(), call.ID); ended.Status != "ended" {
+		t.Fatalf("expected the call to be ended, got %q", ended.Status)
+	}
+
+	// The call now shows up in the guest's history, with their attendance closed
+	rec = doRequest(t, router, http.MethodGet, "/api/users/me/calls", nil, guestToken)
+	expectStatus(t, rec, http.StatusOK)
+	var history CallHistoryResponse
+	decodeResponse(t, rec, &history)
+	if len(history.Calls) != 1 || history.Calls[0].Call.ID != call.ID || history.Calls[0].InCall {
+		t.Fatalf("expected the ended call in the history, got %+v", history.Calls)
+	}
+
+	rec = doRequest(t, router, http.MethodPost, path, nil, hostToken)
+	expectStatus(t, rec, http.StatusConflict)
+
+	rec = doRequest(t, router, http.MethodPost, "/api/calls/999/end", nil, hostToken)
+	expectStatus(t, rec, http.StatusNotFound)
+
+	rec = doRequest(t, router, http.MethodPost, "/api/calls/abc/end", nil, hostToken)
+	expectStatus(t, rec, http.StatusBadRequest)
+}
+
+func TestListCalls(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	router := newTestRouter(repos)
+	user, token := createTestUser(t, repos, "john@example.com", "johndoe", "secret123")
+
+	for _, status := range []string{"active", "ended", "active"} {
+		call := &models.Call{Title: status, CreatorID: user.ID, Status: status}
+		if err := repos.Calls.Create(t.Context(), call); err != nil {
+			t.Fatalf("failed to create call: %v", err)
+		}
+	}
+
+	rec := doRequest(t, router, http.MethodGet, "/api/calls", nil, token)
+	expectStatus(t, rec, http.StatusOK)
+
+	var resp CallListResponse
+	decodeResponse(t, rec, &resp)
+	if len(resp.Calls) != 2 || resp.NextCursor != "" || rec.Header().Get("Link") != "" {
+		t.Fatalf("expected a single page of 2 active calls, got %+v", resp)
+	}
+	for _, call := range resp.Calls {
+		if call.Status != "active" {
+			t.Fatalf("listed call with status %q", call.Status)
+		}
+	}
+}
+
+func TestListCallsPagination(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	router := newTestRouter(repos)
+	user, token := createTestUser(t, repos, "john@example.com", "johndoe", "secret123")
+
+	start := time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC)
+	for i, title := range []string{"delta", "Alpha", "charlie", "bravo", "echo"} {
+		// Two calls share a creation time so the ID has to break the tie
+		createdAt := start.Add(time.Duration(i/2*2) * time.Hour)
+		call := &models.Call{Title: title, CreatorID: user.ID, Status: "active", CreatedAt: createdAt}
+		if err := repos.Calls.Create(t.Context(), call); err != nil {
+			t.Fatalf("failed to create call: %v", err)
+		}
+	}
+
+	listAll := func(t *testing.T, query string) []string {
+		t.Helper()
+
+		var titles []string
+		path := "/api/calls?limit=2&" + query
+		for pages := 0; path != ""; pages++ {
+			if pages > 5 {
+				t.Fatal("pagination did not end")
+			}
+			rec := doRequest(t, router, http.MethodGet, path, nil, token)
+			expectStatus(t, rec, http.StatusOK)
+			var resp CallListResponse
+			decodeResponse(t, rec, &resp)
+			for _, call := range resp.Calls {
+				titles = append(titles, call.Title)
+			}
+
+			link := rec.Header().Get("Link")
+			if (resp.NextCursor == "") != (link == "") {
+				t.Fatalf("next_cursor %q and Link %q disagree", resp.NextCursor, link)
+			}
+			path = ""
+			if link != "" {
+				path = strings.TrimSuffix(strings.TrimPrefix(link, "<"), `>; rel="next"`)
+			}
+		}
+		return titles
+	}
+
+	tests := []struct {
+		sort string
+		want []string
+	}{
+		{"newest", []string{"echo", "bravo", "charlie", "Alpha", "delta"}},
+		{"oldest", []string{"delta", "Alpha", "charlie", "bravo", "echo"}},
+		{"title", []string{"Alpha", "bravo", "charlie", "delta", "echo"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.sort, func(t *testing.T) {
+			if got := listAll(t, "sort="+tt.sort); !slices.Equal(got, tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+
+	t.Run("cursor for another sort", func(t *testing.T) {
+		rec := doRequest(t, router, http.MethodGet, "/api/calls?limit=2", nil, token)
+		var resp CallListResponse
+		decodeResponse(t, rec, &resp)
+
+		rec = doRequest(t, router, http.MethodGet, "/api/calls?sort=title&cursor="+resp.NextCursor, nil, token)
+		expectStatus(t, rec, http.StatusBadRequest)
+	})
+
+	for _, query := range []string{"limit=0", "cursor=garbage", "sort=random", "status=paused"} {
+		t.Run(query, func(t *testing.T) {
+			rec := doRequest(t, router, http.MethodGet, "/api/calls?"+query, nil, token)
+			expectStatus(t, rec, http.StatusBadRequest)
+		})
+	}
+}
+
+func TestListCallsFilters(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	router := newTestRouter(repos)
+	user, token := createTestUser(t, repos, "john@example.com", "johndoe", "secret123")
+	other, otherToken := createTestUser(t, repos, "jane@example.com", "janedoe", "secret123")
+
+	start := time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC)
+	calls := []*models.Call{
+		{Title: "Morning pages", CreatorID: user.ID, Status: "active", CreatedAt: start, Tags: []string{"morning", "writing"}},
+		{Title: "Deep work", CreatorID: other.ID, Status: "active", CreatedAt: start.Add(time.Hour), Tags: []string{"focus"}},
+		{Title: "Retro", CreatorID: other.ID, Status: "ended", CreatedAt: start.Add(2 * time.Hour)},
+	}
+	for _, call := range calls {
+		if err := repos.Calls.Create(t.Context(), call); err != nil {
+			t.Fatalf("failed to create call: %v", err)
+		}
+	}
+	rec := doRequest(t, router, http.MethodPost, "/api/calls/join", models.CallJoin{CallID: calls[1].ID, UserID: other.ID}, otherToken)
+	expectStatus(t, rec, http.StatusOK)
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"Deep work", "Morning pages"}},
+		{"status=ended", []string{"Retro"}},
+		{"status=all", []string{"Retro", "Deep work", "Morning pages"}},
+		{fmt.Sprintf("status=all&creator_id=%d", other.ID), []string{"Retro", "Deep work"}},
+		{"status=all&created_after=2026-01-01T10:00:00Z", []string{"Retro", "Deep work"}},
+		{"status=all&created_before=2026-01-01T10:00:00Z", []string{"Morning pages"}},
+		{"tag=Writing", []string{"Morning pages"}},
+		{"mine=true", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			rec := doRequest(t, router, http.MethodGet, "/api/calls?"+tt.query, nil, token)
+			expectStatus(t, rec, http.StatusOK)
+			var resp CallListResponse
+			decodeResponse(t, rec, &resp)
+
+			var got []string
+			for _, call := range resp.Calls {
+				got = append(got, call.Title)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+
+	t.Run("mine", func(t *testing.T) {
+		rec := doRequest(t, router, http.MethodGet, "/api/calls?mine=true", nil, otherToken)
+		expectStatus(t, rec, http.StatusOK)
+		var resp CallListResponse
+		decodeResponse(t, rec, &resp)
+		if len(resp.Calls) != 1 || resp.Calls[0].ID != calls[1].ID || !slices.Equal(resp.Calls[0].Tags, []string{"focus"}) {
+			t.Fatalf("expected the joined call, got %+v", resp.Calls)
+		}
+	})
+
+	for _, query := range []string{"creator_id=abc", "created_after=yesterday", "mine=maybe", "tag=no_underscores"} {
+		t.Run(query, func(t *testing.T) {
+			rec := doRequest(t, router, http.MethodGet, "/api/calls?"+query, nil, token)
+			expectStatus(t, rec, http.StatusBadRequest)
+		})
+	}
+}
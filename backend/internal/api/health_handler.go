@@ -0,0 +1,91 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/ayush/accountability-app/backend/internal/logger"
+	ws "github.com/ayush/accountability-app/backend/internal/websocket"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// readinessTimeout bounds how long a readiness check may wait on dependencies
+const readinessTimeout = 2 * time.Second
+
+// HealthHandler serves liveness, readiness and diagnostics endpoints
+type HealthHandler struct {
+	db  *gorm.DB
+	hub *ws.Hub
+}
+
+// HealthResponse represents the result of a health or readiness check
+type HealthResponse struct {
+	Status string            `json:"status" example:"ok"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// NewHealthHandler creates a new health handler
+func NewHealthHandler(db *gorm.DB, hub *ws.Hub) *HealthHandler {
+	return &HealthHandler{db: db, hub: hub}
+}
+
+// Healthz reports that the process is alive. It is served outside /api so it
+// does not appear in the Swagger docs.
+func (h *HealthHandler) Healthz(c *gin.Context) {
+	c.JSON(http.StatusOK, HealthResponse{Status: "ok"})
+}
+
+// Readyz reports whether the database is reachable and the WebSocket hub is
+// running, responding with 503 otherwise
+func (h *HealthHandler) Readyz(c *gin.Context) {
+	ready := true
+	checks := map[string]string{}
+
+	if err := h.pingDatabase(c.Request.Context()); err != nil {
+		logger.Warn("Readiness check failed: database unreachable", zap.Error(err))
+		// The error can name hosts and driver details, so it only goes to the log
+		checks["database"] = "unavailable"
+		ready = false
+	} else {
+		checks["database"] = "ok"
+	}
+
+	switch {
+	case h.hub.IsClosing():
+		checks["websocket_hub"] = "shutting down"
+		ready = false
+	case !h.hub.IsRunning():
+		checks["websocket_hub"] = "not running"
+		ready = false
+	default:
+		checks["websocket_hub"] = "ok"
+	}
+
+	if !ready {
+		c.JSON(http.StatusServiceUnavailable, HealthResponse{Status: "unavailable", Checks: checks})
+		return
+	}
+
+	c.JSON(http.StatusOK, HealthResponse{Status: "ok", Checks: checks})
+}
+
+// DebugHub lists rooms, client counts, send buffer depths and per-room
+// message rates for on-call diagnostics
+func (h *HealthHandler) DebugHub(c *gin.Context) {
+	c.JSON(http.StatusOK, h.hub.Stats())
+}
+
+func (h *HealthHandler) pingDatabase(ctx context.Context) error {
+	sqlDB, err := h.db.DB()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, readinessTimeout)
+	defer cancel()
+	return sqlDB.PingContext(ctx)
+}
@@ -0,0 +1,238 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ayush/accountability-app/backend/internal/auth"
+	"github.com/ayush/accountability-app/backend/internal/config"
+	"github.com/ayush/accountability-app/backend/internal/mail"
+	"github.com/ayush/accountability-app/backend/internal/models"
+	"github.com/ayush/accountability-app/backend/internal/origin"
+	"github.com/ayush/accountability-app/backend/internal/ratelimit"
+	"github.com/ayush/accountability-app/backend/internal/repository"
+	"github.com/ayush/accountability-app/backend/internal/sso"
+	"github.com/ayush/accountability-app/backend/internal/storage"
+	ws "github.com/ayush/accountability-app/backend/internal/websocket"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	os.Exit(m.Run())
+}
+
+// testDeps overrides the collaborators of the test router; zero fields get defaults
+type testDeps struct {
+	limiter *ratelimit.Limiter
+	mailer  mail.Mailer
+
+	// oidc holds the identity providers; none are configured by default
+	oidc *sso.Registry
+
+	// hub is the WebSocket hub the admin endpoints act on; by default a hub
+	// that is not running
+	hub *ws.Hub
+
+	// storage keeps uploaded avatars; in memory by default
+	storage storage.Storage
+
+	// requireVerified blocks creating and joining calls for unverified users
+	requireVerified bool
+}
+
+// newTestRouter wires the handlers to in-memory repositories using the same
+// routes as the server, the default rate limits and a mailer that drops mail
+func newTestRouter(repos *repository.Repositories) *gin.Engine {
+	return newTestRouterWith(repos, testDeps{})
+}
+
+// newTestRouterWith is newTestRouter with some collaborators replaced
+func newTestRouterWith(repos *repository.Repositories, deps testDeps) *gin.Engine {
+	limiter := deps.limiter
+	if limiter == nil {
+		limiter = ratelimit.New(ratelimit.NewMemoryStore(), config.DefaultRateLimitConfig())
+	}
+	mailer := deps.mailer
+	if mailer == nil {
+		mailer = &outbox{}
+	}
+	registry := deps.oidc
+	if registry == nil {
+		registry = sso.NewRegistry(config.OIDCConfig{}, 10*time.Minute)
+	}
+
+	hub := deps.hub
+	if hub == nil {
+		hub = ws.NewHub()
+	}
+
+	store := deps.storage
+	if store == nil {
+		store = storage.NewMemory("https://media.example.com")
+	}
+
+	origins, err := origin.NewPolicy(config.DefaultCORSConfig())
+	if err != nil {
+		panic(err)
+	}
+
+	sessionHandler := NewSessionHandler(repos.Sessions, hub)
+	verificationHandler := NewEmailVerificationHandler(repos.Users, mailer, "https://api.example.com/api/users/verify", 48*time.Hour)
+	twoFactorHandler := NewTwoFactorHandler(repos.Users, repos.RecoveryCodes, limiter, sessionHandler, "Accountability App", 5*time.Minute)
+	avatarHandler := NewAvatarHandler(repos.Users, store, 1<<20)
+	handlers := Handlers{
+		Users:          NewUserHandler(repos.Users, limiter, verificationHandler, twoFactorHandler, sessionHandler, avatarHandler),
+		Accounts:       NewAccountHandler(repos, limiter, sessionHandler, avatarHandler, twoFactorHandler),
+		Avatars:        avatarHandler,
+		Verification:   verificationHandler,
+		TwoFactor:      twoFactorHandler,
+		PasswordResets: NewPasswordResetHandler(repos.Users, repos.PasswordResets, sessionHandler, mailer, "https://app.example.com/reset", time.Hour),
+		OIDC:           NewOIDCHandler(registry, repos.Users, repos.Identities, verificationHandler, twoFactorHandler, sessionHandler, "https://app.example.com/login/callback"),
+		Sessions:       sessionHandler,
+		APIKeys:        NewAPIKeyHandler(repos.APIKeys, hub),
+		Calls:          NewVideoCallHandler(repos.Calls, repos.Participants, hub),
+		Attendance:     NewAttendanceHandler(repos.Calls, repos.Participants, repos.Users),
+		WebSocket:      NewWSHandler(hub, config.DefaultWebSocketConfig(), origins, repos.Calls),
+		// No database; /readyz is not exercised through this router
+		Health: NewHealthHandler(nil, hub),
+		Admin:  NewAdminHandler(repos.Users, repos.Calls, repos.Participants, hub),
+	}
+
+	router := gin.New()
+	RegisterRoutes(router, handlers, RouteDeps{
+		Repos:                repos,
+		Limiter:              limiter,
+		RequireVerifiedEmail: deps.requireVerified,
+	})
+	return router
+}
+
+// doRequest sends a JSON request through the router, authenticating with
+// token when it is not empty
+func doRequest(t *testing.T, router http.Handler, method, path string, body interface{}, token string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	var payload bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			t.Fatalf("failed to encode request body: %v", err)
+		}
+	}
+
+	req := httptest.NewRequest(method, path, &payload)
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+// decodeResponse unmarshals the recorded JSON response into v
+func decodeResponse(t *testing.T, rec *httptest.ResponseRecorder, v interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+		t.Fatalf("failed to decode response %q: %v", rec.Body.String(), err)
+	}
+}
+
+// expectStatus fails the test if the response does not have the given status
+func expectStatus(t *testing.T, rec *httptest.ResponseRecorder, status int) {
+	t.Helper()
+	if rec.Code != status {
+		t.Fatalf("expected status %d, got %d: %s", status, rec.Code, rec.Body.String())
+	}
+}
+
+// createTestUser stores a user with the given password and returns it
+// together with a valid token
+func createTestUser(t *testing.T, repos *repository.Repositories, email, username, password string) (*models.User, string) {
+	t.Helper()
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("failed to hash password: %v", err)
+	}
+
+	user := &models.User{Email: email, Username: username, Password: string(hash)}
+	if err := repos.Users.Create(context.Background(), user); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+
+	return user, tokenFor(t, repos, user)
+}
+
+// tokenFor starts a session for user and returns a token for it
+func tokenFor(t *testing.T, repos *repository.Repositories, user *models.User) string {
+	t.Helper()
+
+	now := time.Now()
+	session := &models.Session{UserID: user.ID, DeviceName: "test", CreatedAt: now, LastSeenAt: now, ExpiresAt: now.Add(auth.TokenTTL())}
+	if err := repos.Sessions.Create(context.Background(), session); err != nil {
+		t.Fatalf("failed to create session: %v", err)
+	}
+
+	token, err := auth.GenerateToken(user.ID, user.Email, auth.Role(user.Role), session.ID)
+	if err != nil {
+		t.Fatalf("failed to generate token: %v", err)
+	}
+	return token
+}
+
+// outbox is a mailer that keeps sent messages in memory
+type outbox struct {
+	mu       sync.Mutex
+	messages []mail.Message
+}
+
+func (o *outbox) Send(_ context.Context, msg mail.Message) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.messages = append(o.messages, msg)
+	return nil
+}
+
+// sent returns a copy of the messages sent so far
+func (o *outbox) sent() []mail.Message {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return append([]mail.Message(nil), o.messages...)
+}
+
+// waitForSent waits until n messages have been sent, for mail that handlers
+// send in the background, and returns them
+func (o *outbox) waitForSent(t *testing.T, n int) []mail.Message {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		sent := o.sent()
+		if len(sent) >= n {
+			return sent
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d emails, got %d", n, len(sent))
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// failingMailer is a mailer whose every send fails
+type failingMailer struct{}
+
+func (failingMailer) Send(context.Context, mail.Message) error {
+	return errors.New("smtp: connection refused")
+}
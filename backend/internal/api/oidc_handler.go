@@ -0,0 +1,368 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/ayush/accountability-app/backend/internal/logger"
+	"github.com/ayush/accountability-app/backend/internal/models"
+	"github.com/ayush/accountability-app/backend/internal/repository"
+	"github.com/ayush/accountability-app/backend/internal/sso"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const (
+	// oidcFlowCookie holds the signed state of a login in progress
+	oidcFlowCookie = "oidc_flow"
+	oidcCookiePath = "/api/auth/oidc/"
+)
+
+var (
+	errIdentityWithoutEmail = errors.New("identity provider did not share an email address")
+	errIdentityEmailTaken   = errors.New("email belongs to an account that cannot be linked automatically")
+)
+
+// OIDCHandler logs users in through external OpenID Connect providers
+type OIDCHandler struct {
+	registry    *sso.Registry
+	users       repository.UserRepository
+	identities  repository.IdentityRepository
+	verifier    *EmailVerificationHandler
+	twoFactor   *TwoFactorHandler
+	sessions    *SessionHandler
+	frontendURL string
+}
+
+// OIDCProviderResponse describes an identity provider users can log in with
+type OIDCProviderResponse struct {
+	Name        string `json:"name" example:"google"`
+	DisplayName string `json:"display_name" example:"Google"`
+	LoginURL    string `json:"login_url" example:"/api/auth/oidc/google/login"`
+}
+
+// OIDCProvidersResponse lists the configured identity providers
+type OIDCProvidersResponse struct {
+	Providers []OIDCProviderResponse `json:"providers"`
+}
+
+// NewOIDCHandler creates an OpenID Connect login handler. After logging in
+// the browser is sent to frontendURL with the result in the URL fragment;
+// verifier emails new users whose address the provider has not verified,
+// twoFactor challenges users with two-factor authentication and sessions
+// issues the access token.
+func NewOIDCHandler(registry *sso.Registry, users repository.UserRepository, identities repository.IdentityRepository, verifier *EmailVerificationHandler, twoFactor *TwoFactorHandler, sessions *SessionHandler, frontendURL string) *OIDCHandler {
+	return &OIDCHandler{
+		registry:    registry,
+		users:       users,
+		identities:  identities,
+		verifier:    verifier,
+		twoFactor:   twoFactor,
+		sessions:    sessions,
+		frontendURL: frontendURL,
+	}
+}
+
+// ListProviders godoc
+// @Summary List identity providers
+// @Description List the OpenID Connect providers users can log in with
+// @Tags auth
+// @Produce json
+// @Success 200 {object} OIDCProvidersResponse
+// @Failure 429 {object} ErrorResponse
+// @Router /auth/oidc/providers [get]
+func (h *OIDCHandler) ListProviders(c *gin.Context) {
+	resp := OIDCProvidersResponse{Providers: []OIDCProviderResponse{}}
+	for _, p := range h.registry.Providers() {
+		resp.Providers = append(resp.Providers, OIDCProviderResponse{
+			Name:        p.Name,
+			DisplayName: p.DisplayName,
+			LoginURL:    "/api/auth/oidc/" + url.PathEscape(p.Name) + "/login",
+		})
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// Login godoc
+// @Summary Log in with an identity provider
+// @Description Redirect the browser to the provider's login page using the authorization code flow with PKCE
+// @Tags auth
+// @Param provider path string true "Provider name"
+// @Success 302
+// @Failure 404 {object} ErrorResponse
+// @Failure 429 {object} ErrorResponse
+// @Failure 502 {object} ErrorResponse
+// @Router /auth/oidc/{provider}/login [get]
+func (h *OIDCHandler) Login(c *gin.Context) {
+	log := logger.FromContext(c.Request.Context())
+	provider := c.Param("provider")
+
+	redirect, flow, err := h.registry.Start(c.Request.Context(), provider)
+	if errors.Is(err, sso.ErrUnknownProvider) {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Unknown identity provider"})
+		return
+	}
+	if err != nil {
+		log.Error("Failed to start OIDC login", zap.Error(err), zap.String("provider", provider))
+		c.JSON(http.StatusBadGateway, ErrorResponse{Error: "Identity provider is unavailable"})
+		return
+	}
+
+	h.setFlowCookie(c, flow, int(h.registry.StateTTL()/time.Second))
+	c.Redirect(http.StatusFound, redirect)
+}
+
+// Callback godoc
+// @Summary Finish logging in with an identity provider
+// @Description The provider redirects here after the user logs in. The account is matched by the linked identity, then by verified email address, and created if neither exists. The browser is redirected to the frontend with token, or two_factor_required, challenge_token and expires_in, or error in the URL fragment.
+// @Tags auth
+// @Param provider path string true "Provider name"
+// @Param code query string false "Authorization code"
+// @Param state query string false "State from the login redirect"
+// @Success 302
+// @Failure 404 {object} ErrorResponse
+// @Failure 429 {object} ErrorResponse
+// @Router /auth/oidc/{provider}/callback [get]
+func (h *OIDCHandler) Callback(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := logger.FromContext(ctx)
+	provider := c.Param("provider")
+
+	if _, err := h.registry.Get(provider); err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Unknown identity provider"})
+		return
+	}
+
+	// The flow state is single use whatever the outcome
+	flow, _ := c.Cookie(oidcFlowCookie)
+	h.setFlowCookie(c, "", -1)
+
+	if refused := c.Query("error"); refused != "" {
+		log.Info("OIDC login refused by provider", zap.String("provider", provider), zap.String("error", refused))
+		h.redirect(c, url.Values{"error": {"Login was cancelled or refused by the identity provider"}})
+		return
+	}
+
+	identity, err := h.registry.Finish(ctx, provider, flow, c.Query("state"), c.Query("code"))
+	if errors.Is(err, sso.ErrInvalidState) {
+		log.Info("OIDC callback with invalid or expired state", zap.String("provider", provider))
+		h.redirect(c, url.Values{"error": {"Login expired or was started in another browser, please try again"}})
+		return
+	}
+	if err != nil {
+		log.Warn("OIDC login failed", zap.Error(err), zap.String("provider", provider))
+		h.redirect(c, url.Values{"error": {"Could not log in with the identity provider"}})
+		return
+	}
+
+	user, err := h.resolveUser(ctx, identity)
+	switch {
+	case errors.Is(err, errIdentityWithoutEmail):
+		log.Info("OIDC login without an email address", zap.String("provider", provider))
+		h.redirect(c, url.Values{"error": {"The identity provider did not share your email address"}})
+		return
+	case errors.Is(err, errIdentityEmailTaken):
+		log.Info("OIDC login for an email that belongs to an unlinked account", zap.String("provider", provider))
+		h.redirect(c, url.Values{"error": {"An account with this email address already exists, log in with your password"}})
+		return
+	case err != nil:
+		log.Error("Failed to find or create user for identity", zap.Error(err), zap.String("provider", provider))
+		h.redirect(c, url.Values{"error": {"Failed to log in"}})
+		return
+	}
+
+	// Deleting an account removes its identities, but the link may have
+	// survived if that cleanup failed
+	if user.IsDeleted() {
+		log.Info("OIDC login refused: account is deleted", zap.Uint("user_id", user.ID), zap.String("provider", provider))
+		h.redirect(c, url.Values{"error": {"Account no longer exists"}})
+		return
+	}
+
+	if user.IsDisabled() {
+		log.Info("OIDC login refused: account is disabled", zap.Uint("user_id", user.ID), zap.String("provider", provider))
+		h.redirect(c, url.Values{"error": {"Account is disabled"}})
+		return
+	}
+
+	if user.IsTwoFactorEnabled() {
+		challenge, err := h.twoFactor.newChallenge(user)
+		if err != nil {
+			log.Error("Failed to create two-factor challenge", zap.Error(err), zap.Uint("user_id", user.ID))
+			h.redirect(c, url.Values{"error": {"Failed to log in"}})
+			return
+		}
+		log.Info("Identity accepted, two-factor code required", zap.Uint("user_id", user.ID), zap.String("provider", provider))
+		h.redirect(c, url.Values{
+			"two_factor_required": {"true"},
+			"challenge_token":     {challenge.ChallengeToken},
+			"expires_in":          {strconv.Itoa(challenge.ExpiresIn)},
+		})
+		return
+	}
+
+	token, err := h.sessions.issueToken(c, user, "")
+	if err != nil {
+		log.Error("Failed to generate token", zap.Error(err), zap.Uint("user_id", user.ID))
+		h.redirect(c, url.Values{"error": {"Failed to log in"}})
+		return
+	}
+
+	log.Info("User logged in", zap.Uint("user_id", user.ID), zap.String("provider", provider))
+	h.redirect(c, url.Values{"token": {token}})
+}
+
+// resolveUser returns the user linked to identity, linking an existing
+// account or creating one the first time the identity logs in
+func (h *OIDCHandler) resolveUser(ctx context.Context, identity *sso.Identity) (*models.User, error) {
+	identity.Email = NormalizeEmail(identity.Email)
+
+	linked, err := h.identities.GetBySubject(ctx, identity.Provider, identity.Subject)
+	if err == nil {
+		user, err := h.users.GetByID(ctx, linked.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if err := h.identities.RecordLogin(ctx, linked.ID, identity.Email, time.Now()); err != nil {
+			return nil, err
+		}
+		return user, nil
+	}
+	if !errors.Is(err, repository.ErrNotFound) {
+		return nil, err
+	}
+
+	if identity.Email == "" {
+		return nil, errIdentityWithoutEmail
+	}
+
+	user, err := h.users.GetByEmail(ctx, identity.Email)
+	switch {
+	case err == nil:
+		// Linking hands the account to whoever controls the address at the
+		// provider, so both sides must have verified it. Otherwise someone
+		// could register an address first and share the account with its owner.
+		if !identity.EmailVerified || !user.IsEmailVerified() {
+			return nil, errIdentityEmailTaken
+		}
+	case errors.Is(err, repository.ErrNotFound):
+		if user, err = h.createUser(ctx, identity); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, err
+	}
+
+	now := time.Now()
+	err = h.identities.Create(ctx, &models.UserIdentity{
+		UserID:      user.ID,
+		Provider:    identity.Provider,
+		Subject:     identity.Subject,
+		Email:       identity.Email,
+		LastLoginAt: &now,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to link identity: %v", err)
+	}
+
+	logger.FromContext(ctx).Info("Identity linked", zap.Uint("user_id", user.ID), zap.String("provider", identity.Provider))
+	return user, nil
+}
+
+// createUser registers a user for an identity seen for the first time. The
+// account has no password until the user sets one through a password reset.
+func (h *OIDCHandler) createUser(ctx context.Context, identity *sso.Identity) (*models.User, error) {
+	log := logger.FromContext(ctx)
+
+	user := &models.User{Email: identity.Email}
+	if identity.EmailVerified {
+		now := time.Now()
+		user.EmailVerifiedAt = &now
+	}
+
+	// Usernames are unique, so add a number when the preferred one is taken,
+	// shortening it so the result still fits the username rules
+	base := usernameFor(identity)
+	for attempt := 0; ; attempt++ {
+		user.Username = base
+		if attempt > 0 {
+			user.Username = fmt.Sprintf("%s%d", base[:min(len(base), maxUsernameLength-4)], 1000+rand.IntN(9000))
+		}
+		taken, err := usernameTaken(ctx, h.users, user.Username, 0)
+		if err == nil && taken {
+			err = repository.ErrDuplicate
+		}
+		if err == nil {
+			err = h.users.Create(ctx, user)
+		}
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, repository.ErrDuplicate) || attempt == 5 {
+			return nil, fmt.Errorf("failed to create user: %v", err)
+		}
+	}
+
+	log.Info("User registered", zap.Uint("user_id", user.ID), zap.String("provider", identity.Provider))
+
+	if !user.IsEmailVerified() {
+		if err := h.verifier.sendVerification(ctx, user); err != nil {
+			log.Error("Failed to send verification email", zap.Error(err), zap.Uint("user_id", user.ID))
+		}
+	}
+	return user, nil
+}
+
+// usernameFor derives a username that follows the username rules from the
+// provider's preferred username or the email address
+func usernameFor(identity *sso.Identity) string {
+	candidate := identity.PreferredUsername
+	if candidate == "" {
+		candidate, _, _ = strings.Cut(identity.Email, "@")
+	}
+
+	var b strings.Builder
+	for _, r := range strings.ToLower(candidate) {
+		if b.Len() >= maxUsernameLength {
+			break
+		}
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("._-", r)) {
+			b.WriteRune(r)
+		}
+	}
+	// Usernames must start with a letter or digit and be long enough
+	username := strings.TrimLeft(b.String(), "._-")
+	if len(username) < minUsernameLength {
+		return "user"
+	}
+	return username
+}
+
+// setFlowCookie stores the login state for the callback, or deletes it when
+// maxAge is negative. Lax lets the cookie through on the provider's redirect.
+func (h *OIDCHandler) setFlowCookie(c *gin.Context, value string, maxAge int) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     oidcFlowCookie,
+		Value:    value,
+		Path:     oidcCookiePath,
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https",
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// redirect sends the browser to the frontend with the login result in the
+// URL fragment, which is not sent to servers or written to access logs
+func (h *OIDCHandler) redirect(c *gin.Context, result url.Values) {
+	c.Redirect(http.StatusFound, strings.SplitN(h.frontendURL, "#", 2)[0]+"#"+result.Encode())
+}
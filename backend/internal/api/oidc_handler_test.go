@@ -0,0 +1,281 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ayush/accountability-app/backend/internal/auth"
+	"github.com/ayush/accountability-app/backend/internal/config"
+	"github.com/ayush/accountability-app/backend/internal/repository"
+	"github.com/ayush/accountability-app/backend/internal/sso"
+	"github.com/ayush/accountability-app/backend/internal/testutil/oidctest"
+	"github.com/ayush/accountability-app/backend/internal/testutil/totptest"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newOIDCTestServer serves the test router over HTTP with a mock identity
+// provider configured under the name "mock"
+func newOIDCTestServer(t *testing.T, repos *repository.Repositories) (*oidctest.Provider, *httptest.Server, *gin.Engine) {
+	t.Helper()
+
+	idp := oidctest.New(t, "accountability", "client-secret")
+
+	// The callback URL depends on the server's address, so the router is
+	// built once the server is listening
+	var router *gin.Engine
+	app := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		router.ServeHTTP(w, r)
+	}))
+	t.Cleanup(app.Close)
+
+	registry := sso.NewRegistry(config.OIDCConfig{
+		CallbackBaseURL: app.URL,
+		Providers: []config.OIDCProviderConfig{{
+			Name:         "mock",
+			DisplayName:  "Mock SSO",
+			Issuer:       idp.URL,
+			ClientID:     idp.ClientID,
+			ClientSecret: idp.ClientSecret,
+		}},
+	}, time.Minute)
+	router = newTestRouterWith(repos, testDeps{oidc: registry})
+	return idp, app, router
+}
+
+// newBrowser returns a client that keeps cookies and follows redirects
+// until it is sent to the frontend
+func newBrowser(t *testing.T) *http.Client {
+	t.Helper()
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatalf("failed to create cookie jar: %v", err)
+	}
+	return &http.Client{
+		Jar: jar,
+		CheckRedirect: func(req *http.Request, _ []*http.Request) error {
+			if req.URL.Host == "app.example.com" {
+				return http.ErrUseLastResponse
+			}
+			return nil
+		},
+	}
+}
+
+// frontendResult follows path in browser and returns the login result the
+// frontend receives in the URL fragment
+func frontendResult(t *testing.T, browser *http.Client, path string) url.Values {
+	t.Helper()
+
+	resp, err := browser.Get(path)
+	if err != nil {
+		t.Fatalf("GET %s: %v", path, err)
+	}
+	defer resp.Body.Close()
+
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if resp.StatusCode != http.StatusFound || err != nil || location.Host != "app.example.com" {
+		body, _ := io.ReadAll(resp.Body)
+		t.Fatalf("expected a redirect to the frontend, got %d to %q: %s", resp.StatusCode, resp.Header.Get("Location"), body)
+	}
+	result, err := url.ParseQuery(location.Fragment)
+	if err != nil {
+		t.Fatalf("invalid fragment %q: %v", location.Fragment, err)
+	}
+	return result
+}
+
+// oidcLogin logs in with the mock provider in a new browser
+func oidcLogin(t *testing.T, app *httptest.Server) url.Values {
+	t.Helper()
+	return frontendResult(t, newBrowser(t), app.URL+"/api/auth/oidc/mock/login")
+}
+
+// tokenUserID returns the user an access token from a login result belongs to
+func tokenUserID(t *testing.T, result url.Values) uint {
+	t.Helper()
+
+	claims, err := auth.ValidateToken(result.Get("token"))
+	if err != nil {
+		t.Fatalf("expected an access token, got %v", result)
+	}
+	return claims.UserID
+}
+
+func TestOIDCLoginCreatesUser(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	idp, app, _ := newOIDCTestServer(t, repos)
+	idp.SetUser(oidctest.User{Subject: "sub-1", Email: "jane@example.com", EmailVerified: true, PreferredUsername: "Jane Doe"})
+
+	userID := tokenUserID(t, oidcLogin(t, app))
+
+	user, err := repos.Users.GetByID(t.Context(), userID)
+	if err != nil {
+		t.Fatalf("user was not created: %v", err)
+	}
+	if user.Email != "jane@example.com" || user.Username != "janedoe" || !user.IsEmailVerified() {
+		t.Fatalf("unexpected user: %+v", user)
+	}
+
+	t.Run("identity is matched by subject, not email", func(t *testing.T) {
+		idp.SetUser(oidctest.User{Subject: "sub-1", Email: "jane.doe@example.com", EmailVerified: true})
+		if got := tokenUserID(t, oidcLogin(t, app)); got != userID {
+			t.Fatalf("expected user %d, got %d", userID, got)
+		}
+	})
+
+	t.Run("taken username gets a suffix", func(t *testing.T) {
+		idp.SetUser(oidctest.User{Subject: "sub-2", Email: "janedoe@example.org", EmailVerified: true})
+		other, err := repos.Users.GetByID(t.Context(), tokenUserID(t, oidcLogin(t, app)))
+		if err != nil || other.ID == userID || other.Username == "janedoe" {
+			t.Fatalf("expected a second user with another username, got %+v (%v)", other, err)
+		}
+	})
+
+	t.Run("suffix keeps long usernames within the limit", func(t *testing.T) {
+		long := strings.Repeat("a", maxUsernameLength)
+		idp.SetUser(oidctest.User{Subject: "sub-3", Email: "long@example.com", EmailVerified: true, PreferredUsername: long})
+		first, err := repos.Users.GetByID(t.Context(), tokenUserID(t, oidcLogin(t, app)))
+		if err != nil || first.Username != long {
+			t.Fatalf("expected username %q, got %+v (%v)", long, first, err)
+		}
+
+		idp.SetUser(oidctest.User{Subject: "sub-4", Email: "long@example.org", EmailVerified: true, PreferredUsername: long})
+		second, err := repos.Users.GetByID(t.Context(), tokenUserID(t, oidcLogin(t, app)))
+		if err != nil {
+			t.Fatalf("user was not created: %v", err)
+		}
+		if second.Username == long || len(second.Username) > maxUsernameLength {
+			t.Fatalf("expected a valid username with a suffix, got %q", second.Username)
+		}
+	})
+}
+
+func TestOIDCLoginLinksVerifiedAccount(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	idp, app, _ := newOIDCTestServer(t, repos)
+	verified, _ := createTestUser(t, repos, "john@example.com", "johndoe", "secret123")
+	if err := repos.Users.MarkEmailVerified(t.Context(), verified.ID, verified.Email, time.Now()); err != nil {
+		t.Fatalf("MarkEmailVerified: %v", err)
+	}
+	createTestUser(t, repos, "mallory@example.com", "mallory", "secret123")
+
+	t.Run("address not verified by the provider", func(t *testing.T) {
+		idp.SetUser(oidctest.User{Subject: "sub-1", Email: "john@example.com"})
+		if result := oidcLogin(t, app); result.Get("error") == "" || result.Get("token") != "" {
+			t.Fatalf("expected an error, got %v", result)
+		}
+	})
+
+	t.Run("address not verified on the account", func(t *testing.T) {
+		idp.SetUser(oidctest.User{Subject: "sub-2", Email: "mallory@example.com", EmailVerified: true})
+		if result := oidcLogin(t, app); result.Get("error") == "" || result.Get("token") != "" {
+			t.Fatalf("expected an error, got %v", result)
+		}
+	})
+
+	t.Run("address verified on both sides", func(t *testing.T) {
+		idp.SetUser(oidctest.User{Subject: "sub-3", Email: "john@example.com", EmailVerified: true})
+		if got := tokenUserID(t, oidcLogin(t, app)); got != verified.ID {
+			t.Fatalf("expected user %d, got %d", verified.ID, got)
+		}
+		identity, err := repos.Identities.GetBySubject(t.Context(), "mock", "sub-3")
+		if err != nil || identity.UserID != verified.ID {
+			t.Fatalf("identity was not linked: %+v (%v)", identity, err)
+		}
+	})
+}
+
+func TestOIDCLoginRefusesDeletedAccount(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	idp, app, _ := newOIDCTestServer(t, repos)
+	idp.SetUser(oidctest.User{Subject: "sub-1", Email: "jane@example.com", EmailVerified: true})
+
+	userID := tokenUserID(t, oidcLogin(t, app))
+
+	// Anonymize without removing the identity, as when deletion's cleanup fails
+	if err := repos.Users.Anonymize(t.Context(), userID, time.Now()); err != nil {
+		t.Fatalf("Anonymize: %v", err)
+	}
+	sessions, _ := repos.Sessions.ListByUser(t.Context(), userID)
+
+	result := oidcLogin(t, app)
+	if result.Get("token") != "" || result.Get("error") == "" {
+		t.Fatalf("expected the login to be refused, got %v", result)
+	}
+	if after, _ := repos.Sessions.ListByUser(t.Context(), userID); len(after) != len(sessions) {
+		t.Fatalf("expected no new session, had %d and now %d", len(sessions), len(after))
+	}
+}
+
+func TestOIDCCallbackRequiresLoginFromSameBrowser(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	idp, app, _ := newOIDCTestServer(t, repos)
+	idp.SetUser(oidctest.User{Subject: "sub-1", Email: "jane@example.com", EmailVerified: true})
+
+	// The attacker starts a login but stops before the provider redirects back
+	attacker := newBrowser(t)
+	attacker.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	resp, err := attacker.Get(app.URL + "/api/auth/oidc/mock/login")
+	if err != nil {
+		t.Fatalf("GET login: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("expected a redirect to the provider, got %d", resp.StatusCode)
+	}
+
+	// and gets the victim to follow the link, which has no flow cookie
+	if result := frontendResult(t, newBrowser(t), resp.Header.Get("Location")); result.Get("error") == "" || result.Get("token") != "" {
+		t.Fatalf("expected an error, got %v", result)
+	}
+
+	result := frontendResult(t, newBrowser(t), app.URL+"/api/auth/oidc/mock/callback?code=forged&state=forged")
+	if result.Get("error") == "" {
+		t.Fatalf("expected an error, got %v", result)
+	}
+}
+
+func TestOIDCLoginWithTwoFactor(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	idp, app, router := newOIDCTestServer(t, repos)
+	idp.SetUser(oidctest.User{Subject: "sub-1", Email: "jane@example.com", EmailVerified: true})
+
+	userID := tokenUserID(t, oidcLogin(t, app))
+	user, _ := repos.Users.GetByID(t.Context(), userID)
+	token := tokenFor(t, repos, user)
+	secret, confirmedAt, _ := enableTwoFactor(t, router, token)
+
+	result := oidcLogin(t, app)
+	if result.Get("two_factor_required") != "true" || result.Get("token") != "" {
+		t.Fatalf("expected a two-factor challenge, got %v", result)
+	}
+
+	rec := doRequest(t, router, http.MethodPost, "/api/users/login/2fa", TwoFactorLoginRequest{
+		ChallengeToken: result.Get("challenge_token"),
+		Code:           totptest.Code(t, secret, confirmedAt.Add(30*time.Second)),
+	}, "")
+	expectStatus(t, rec, http.StatusOK)
+}
+
+func TestOIDCProviders(t *testing.T) {
+	_, _, router := newOIDCTestServer(t, repository.NewMemoryRepositories())
+
+	rec := doRequest(t, router, http.MethodGet, "/api/auth/oidc/providers", nil, "")
+	expectStatus(t, rec, http.StatusOK)
+	var resp OIDCProvidersResponse
+	decodeResponse(t, rec, &resp)
+	if len(resp.Providers) != 1 || resp.Providers[0].Name != "mock" || resp.Providers[0].LoginURL != "/api/auth/oidc/mock/login" {
+		t.Fatalf("unexpected providers: %+v", resp)
+	}
+
+	rec = doRequest(t, router, http.MethodGet, "/api/auth/oidc/unknown/login", nil, "")
+	expectStatus(t, rec, http.StatusNotFound)
+}
@@ -0,0 +1,93 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// errInvalidCursor is returned for cursors that were not issued for the
+// listing they are sent to
+var errInvalidCursor = errors.New("cursor is invalid")
+
+// PageRequest is a cursor-paginated listing request: at most Limit items,
+// starting after the item Cursor points at. An empty Cursor starts at the
+// beginning.
+type PageRequest struct {
+	Limit  int
+	Cursor string
+}
+
+// cursorEnvelope is the content of an opaque cursor. Sort records the order
+// the cursor was issued for so a cursor cannot be replayed against another.
+type cursorEnvelope struct {
+	Sort     string          `json:"s"`
+	Position json.RawMessage `json:"p"`
+}
+
+// parsePageRequest reads the limit and cursor query parameters. Limits above
+// maxLimit are lowered to it. On failure it writes a 400 response and
+// returns false.
+func parsePageRequest(c *gin.Context, defaultLimit, maxLimit int) (PageRequest, bool) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultLimit)))
+	if err != nil || limit < 1 {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "limit must be a positive integer"})
+		return PageRequest{}, false
+	}
+	return PageRequest{Limit: min(limit, maxLimit), Cursor: c.Query("cursor")}, true
+}
+
+// encodeCursor returns an opaque cursor for the position of the last item of
+// a page listed in the given sort order
+func encodeCursor(sort string, position any) (string, error) {
+	raw, err := json.Marshal(position)
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(cursorEnvelope{Sort: sort, Position: raw})
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// decodeCursor reads a cursor made by encodeCursor into position. It returns
+// errInvalidCursor if the cursor is malformed or was issued for another sort
+// order.
+func decodeCursor(cursor, sort string, position any) error {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return errInvalidCursor
+	}
+	var envelope cursorEnvelope
+	if err := json.Unmarshal(data, &envelope); err != nil || envelope.Sort != sort {
+		return errInvalidCursor
+	}
+	if err := json.Unmarshal(envelope.Position, position); err != nil {
+		return errInvalidCursor
+	}
+	return nil
+}
+
+// trimPage drops the extra item a repository was asked for to find out
+// whether another page follows. Repositories are queried with limit+1.
+func trimPage[T any](items []T, limit int) ([]T, bool) {
+	if len(items) > limit {
+		return items[:limit], true
+	}
+	return items, false
+}
+
+// setNextLink points the Link header at the next page: the request URL with
+// its cursor parameter replaced
+func setNextLink(c *gin.Context, cursor string) {
+	query := c.Request.URL.Query()
+	query.Set("cursor", cursor)
+	next := *c.Request.URL
+	next.RawQuery = query.Encode()
+	c.Header("Link", "<"+next.RequestURI()+`>; rel="next"`)
+}
@@ -0,0 +1,228 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/ayush/accountability-app/backend/internal/auth"
+	"github.com/ayush/accountability-app/backend/internal/logger"
+	"github.com/ayush/accountability-app/backend/internal/mail"
+	"github.com/ayush/accountability-app/backend/internal/models"
+	"github.com/ayush/accountability-app/backend/internal/repository"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// PasswordResetHandler lets users who forgot their password set a new one
+// through a single-use link sent by email
+type PasswordResetHandler struct {
+	users    repository.UserRepository
+	resets   repository.PasswordResetRepository
+	sessions *SessionHandler
+	mailer   mail.Mailer
+	resetURL string
+	ttl      time.Duration
+}
+
+// ForgotPasswordRequest represents the request to send a password reset link
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email" example:"john@example.com"`
+}
+
+// ResetPasswordRequest represents the request to set a new password
+type ResetPasswordRequest struct {
+	Token    string `json:"token" binding:"required" example:"q5cW0y3..."`
+	Password string `json:"password" binding:"required,min=6" example:"newsecret123"`
+}
+
+// NewPasswordResetHandler creates a password reset handler. Links point to
+// resetURL with the token as a query parameter and expire after ttl; a reset
+// logs the user out of every session.
+func NewPasswordResetHandler(users repository.UserRepository, resets repository.PasswordResetRepository, sessions *SessionHandler, mailer mail.Mailer, resetURL string, ttl time.Duration) *PasswordResetHandler {
+	return &PasswordResetHandler{
+		users:    users,
+		resets:   resets,
+		sessions: sessions,
+		mailer:   mailer,
+		resetURL: resetURL,
+		ttl:      ttl,
+	}
+}
+
+// ForgotPassword godoc
+// @Summary Request a password reset
+// @Description Email a single-use password reset link. The response is the same, and as quick, whether or not the account exists; the link is sent in the background.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param request body ForgotPasswordRequest true "Account email"
+// @Success 202 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 429 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /users/password/forgot [post]
+func (h *PasswordResetHandler) ForgotPassword(c *gin.Context) {
+	log := logger.FromContext(c.Request.Context())
+
+	var req ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	req.Email = NormalizeEmail(req.Email)
+
+	accepted := SuccessResponse{Message: "If an account exists for that email, a reset link has been sent"}
+
+	user, err := h.users.GetByEmail(c.Request.Context(), req.Email)
+	if errors.Is(err, repository.ErrNotFound) {
+		log.Info("Password reset requested for unknown email")
+		c.JSON(http.StatusAccepted, accepted)
+		return
+	}
+	if err != nil {
+		log.Error("Failed to look up user", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to request password reset"})
+		return
+	}
+
+	// Creating and mailing the link takes long enough to tell registered
+	// addresses apart by the response time, so it happens after responding.
+	// The request's logger goes along, the cancellation does not.
+	go h.sendResetLink(context.WithoutCancel(c.Request.Context()), user)
+	c.JSON(http.StatusAccepted, accepted)
+}
+
+// sendResetLink replaces the user's reset tokens with a new one and emails
+// them the link. Failures can no longer be reported to the client, so they
+// are logged.
+func (h *PasswordResetHandler) sendResetLink(ctx context.Context, user *models.User) {
+	log := logger.FromContext(ctx)
+
+	token, hash, err := auth.NewOpaqueToken()
+	if err != nil {
+		log.Error("Failed to generate reset token", zap.Error(err))
+		return
+	}
+
+	// Only the most recent link works
+	now := time.Now()
+	if err := h.resets.InvalidateForUser(ctx, user.ID, now); err != nil {
+		log.Error("Failed to invalidate previous reset tokens", zap.Error(err), zap.Uint("user_id", user.ID))
+		return
+	}
+	reset := &models.PasswordResetToken{UserID: user.ID, TokenHash: hash, ExpiresAt: now.Add(h.ttl)}
+	if err := h.resets.Create(ctx, reset); err != nil {
+		log.Error("Failed to store reset token", zap.Error(err), zap.Uint("user_id", user.ID))
+		return
+	}
+
+	if err := h.mailer.Send(ctx, h.resetMessage(user, token)); err != nil {
+		log.Error("Failed to send reset email", zap.Error(err), zap.Uint("user_id", user.ID))
+		return
+	}
+
+	log.Info("Password reset link sent", zap.Uint("user_id", user.ID))
+}
+
+// ResetPassword godoc
+// @Summary Reset password
+// @Description Set a new password using the token from a password reset link. Each token works once. Every session of the account is logged out.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param request body ResetPasswordRequest true "Reset token and new password"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 429 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /users/password/reset [post]
+func (h *PasswordResetHandler) ResetPassword(c *gin.Context) {
+	log := logger.FromContext(c.Request.Context())
+
+	var req ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	now := time.Now()
+	reset, err := h.resets.Consume(c.Request.Context(), auth.HashOpaqueToken(req.Token), now)
+	if errors.Is(err, repository.ErrNotFound) {
+		log.Info("Password reset with invalid, used or expired token")
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid or expired reset token"})
+		return
+	}
+	if err != nil {
+		log.Error("Failed to redeem reset token", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to reset password"})
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		log.Error("Failed to hash password", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to reset password"})
+		return
+	}
+
+	if err := h.users.UpdatePassword(c.Request.Context(), reset.UserID, string(hashedPassword)); err != nil {
+		log.Error("Failed to update password", zap.Error(err), zap.Uint("user_id", reset.UserID))
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to reset password"})
+		return
+	}
+
+	if err := h.resets.InvalidateForUser(c.Request.Context(), reset.UserID, now); err != nil {
+		log.Warn("Failed to invalidate remaining reset tokens", zap.Error(err), zap.Uint("user_id", reset.UserID))
+	}
+
+	// Whoever knew the old password may still be logged in
+	disconnected, err := h.sessions.revokeAll(c.Request.Context(), reset.UserID, "password changed")
+	if err != nil {
+		log.Error("Failed to revoke sessions", zap.Error(err), zap.Uint("user_id", reset.UserID))
+	}
+
+	log.Info("Password reset", zap.Uint("user_id", reset.UserID), zap.Int("disconnected", disconnected))
+	c.JSON(http.StatusOK, SuccessResponse{Message: "Password has been reset"})
+}
+
+// resetMessage builds the email carrying the reset link
+func (h *PasswordResetHandler) resetMessage(user *models.User, token string) mail.Message {
+	link, err := url.Parse(h.resetURL)
+	if err != nil {
+		// The URL is validated with the configuration
+		link = &url.URL{}
+	}
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+
+	return mail.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\n"+
+			"We received a request to reset your password. Open the link below to choose a new one:\n\n"+
+			"%s\n\n"+
+			"The link expires in %s and can only be used once. If you did not ask for this, you can ignore this email.\n",
+			user.Username, link, formatDuration(h.ttl)),
+	}
+}
+
+// formatDuration renders whole hours and minutes for email text, e.g. "1 hour" or "30 minutes"
+func formatDuration(d time.Duration) string {
+	plural := func(n int, unit string) string {
+		if n == 1 {
+			return fmt.Sprintf("1 %s", unit)
+		}
+		return fmt.Sprintf("%d %ss", n, unit)
+	}
+	if d >= time.Hour && d%time.Hour == 0 {
+		return plural(int(d/time.Hour), "hour")
+	}
+	return plural(int(d/time.Minute), "minute")
+}
@@ -0,0 +1,142 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/ayush/accountability-app/backend/internal/auth"
+	"github.com/ayush/accountability-app/backend/internal/models"
+	"github.com/ayush/accountability-app/backend/internal/repository"
+)
+
+var resetLinkPattern = regexp.MustCompile(`https://app\.example\.com/reset\?token=\S+`)
+
+// resetTokenFrom extracts the token from the reset link in a message body
+func resetTokenFrom(t *testing.T, body string) string {
+	t.Helper()
+
+	link, err := url.Parse(resetLinkPattern.FindString(body))
+	if err != nil || link.Query().Get("token") == "" {
+		t.Fatalf("no reset link in message:\n%s", body)
+	}
+	return link.Query().Get("token")
+}
+
+func TestPasswordReset(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	mailer := &outbox{}
+	router := newTestRouterWith(repos, testDeps{mailer: mailer})
+	user, sessionToken := createTestUser(t, repos, "john@example.com", "johndoe", "secret123")
+
+	rec := doRequest(t, router, http.MethodPost, "/api/users/password/forgot", ForgotPasswordRequest{Email: "john@example.com"}, "")
+	expectStatus(t, rec, http.StatusAccepted)
+
+	sent := mailer.waitForSent(t, 1)
+	if len(sent) != 1 || sent[0].To != "john@example.com" {
+		t.Fatalf("expected one email to john@example.com, got %+v", sent)
+	}
+	token := resetTokenFrom(t, sent[0].Body)
+
+	rec = doRequest(t, router, http.MethodPost, "/api/users/password/reset", ResetPasswordRequest{Token: token, Password: "newsecret"}, "")
+	expectStatus(t, rec, http.StatusOK)
+
+	rec = doRequest(t, router, http.MethodPost, "/api/users/login", LoginRequest{Email: "john@example.com", Password: "secret123"}, "")
+	expectStatus(t, rec, http.StatusUnauthorized)
+	rec = doRequest(t, router, http.MethodPost, "/api/users/login", LoginRequest{Email: "john@example.com", Password: "newsecret"}, "")
+	expectStatus(t, rec, http.StatusOK)
+
+	t.Run("existing sessions are logged out", func(t *testing.T) {
+		rec := doRequest(t, router, http.MethodGet, fmt.Sprintf("/api/users/%d", user.ID), nil, sessionToken)
+		expectStatus(t, rec, http.StatusUnauthorized)
+	})
+
+	t.Run("token is single use", func(t *testing.T) {
+		rec := doRequest(t, router, http.MethodPost, "/api/users/password/reset", ResetPasswordRequest{Token: token, Password: "another1"}, "")
+		expectStatus(t, rec, http.StatusBadRequest)
+	})
+}
+
+func TestForgotPasswordUnknownEmail(t *testing.T) {
+	mailer := &outbox{}
+	router := newTestRouterWith(repository.NewMemoryRepositories(), testDeps{mailer: mailer})
+
+	rec := doRequest(t, router, http.MethodPost, "/api/users/password/forgot", ForgotPasswordRequest{Email: "nobody@example.com"}, "")
+	expectStatus(t, rec, http.StatusAccepted)
+	if sent := mailer.sent(); len(sent) != 0 {
+		t.Fatalf("expected no email, got %+v", sent)
+	}
+}
+
+func TestForgotPasswordMailFailure(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	router := newTestRouterWith(repos, testDeps{mailer: failingMailer{}})
+	createTestUser(t, repos, "john@example.com", "johndoe", "secret123")
+
+	// A failed send must not tell registered addresses apart
+	rec := doRequest(t, router, http.MethodPost, "/api/users/password/forgot", ForgotPasswordRequest{Email: "john@example.com"}, "")
+	expectStatus(t, rec, http.StatusAccepted)
+}
+
+func TestForgotPasswordSupersedesEarlierLinks(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	mailer := &outbox{}
+	router := newTestRouterWith(repos, testDeps{mailer: mailer})
+	createTestUser(t, repos, "john@example.com", "johndoe", "secret123")
+
+	for i := 1; i <= 2; i++ {
+		rec := doRequest(t, router, http.MethodPost, "/api/users/password/forgot", ForgotPasswordRequest{Email: "john@example.com"}, "")
+		expectStatus(t, rec, http.StatusAccepted)
+		// Wait for each link so they are created in order
+		mailer.waitForSent(t, i)
+	}
+	sent := mailer.sent()
+	first, second := resetTokenFrom(t, sent[0].Body), resetTokenFrom(t, sent[1].Body)
+
+	rec := doRequest(t, router, http.MethodPost, "/api/users/password/reset", ResetPasswordRequest{Token: first, Password: "newsecret"}, "")
+	expectStatus(t, rec, http.StatusBadRequest)
+	rec = doRequest(t, router, http.MethodPost, "/api/users/password/reset", ResetPasswordRequest{Token: second, Password: "newsecret"}, "")
+	expectStatus(t, rec, http.StatusOK)
+}
+
+func TestResetPasswordRejectsBadTokens(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	router := newTestRouter(repos)
+	user, _ := createTestUser(t, repos, "john@example.com", "johndoe", "secret123")
+
+	expired, hash, err := auth.NewOpaqueToken()
+	if err != nil {
+		t.Fatalf("NewOpaqueToken: %v", err)
+	}
+	err = repos.PasswordResets.Create(t.Context(), &models.PasswordResetToken{
+		UserID:    user.ID,
+		TokenHash: hash,
+		ExpiresAt: time.Now().Add(-time.Minute),
+	})
+	if err != nil {
+		t.Fatalf("failed to store token: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		req    ResetPasswordRequest
+		status int
+	}{
+		{"expired token", ResetPasswordRequest{Token: expired, Password: "newsecret"}, http.StatusBadRequest},
+		{"unknown token", ResetPasswordRequest{Token: "not-a-token", Password: "newsecret"}, http.StatusBadRequest},
+		{"missing token", ResetPasswordRequest{Password: "newsecret"}, http.StatusBadRequest},
+		{"short password", ResetPasswordRequest{Token: "not-a-token", Password: "123"}, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := doRequest(t, router, http.MethodPost, "/api/users/password/reset", tt.req, "")
+			expectStatus(t, rec, tt.status)
+		})
+	}
+
+	rec := doRequest(t, router, http.MethodPost, "/api/users/login", LoginRequest{Email: "john@example.com", Password: "secret123"}, "")
+	expectStatus(t, rec, http.StatusOK)
+}
@@ -0,0 +1,122 @@
+package api
+
+import (
+	"github.com/ayush/accountability-app/backend/internal/auth"
+	"github.com/ayush/accountability-app/backend/internal/middleware"
+	"github.com/ayush/accountability-app/backend/internal/ratelimit"
+	"github.com/ayush/accountability-app/backend/internal/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Handlers are the endpoint handlers RegisterRoutes dispatches to
+type Handlers struct {
+	Users          *UserHandler
+	Accounts       *AccountHandler
+	Avatars        *AvatarHandler
+	Verification   *EmailVerificationHandler
+	TwoFactor      *TwoFactorHandler
+	PasswordResets *PasswordResetHandler
+	OIDC           *OIDCHandler
+	Sessions       *SessionHandler
+	APIKeys        *APIKeyHandler
+	Calls          *VideoCallHandler
+	Attendance     *AttendanceHandler
+	WebSocket      *WSHandler
+	Health         *HealthHandler
+	Admin          *AdminHandler
+}
+
+// RouteDeps are what the route middleware needs besides the handlers
+type RouteDeps struct {
+	// Repos are used to authenticate requests and check account state
+	Repos   *repository.Repositories
+	Limiter *ratelimit.Limiter
+
+	// RequireVerifiedEmail blocks creating and joining calls, and opening
+	// WebSockets, until the user's email address is verified
+	RequireVerifiedEmail bool
+}
+
+// RegisterRoutes adds the health checks and the /api routes with their
+// middleware to router. The server and the handler tests both use it, so
+// the tests exercise the production route table.
+func RegisterRoutes(router gin.IRouter, h Handlers, deps RouteDeps) {
+	repos := deps.Repos
+
+	// Health routes
+	router.GET("/healthz", h.Health.Healthz)
+	router.GET("/readyz", h.Health.Readyz)
+	router.GET("/debug/hub",
+		middleware.AuthMiddleware(repos.Sessions, nil),
+		middleware.RequireActiveUser(repos.Users),
+		middleware.RequirePermission(auth.PermissionViewDiagnostics),
+		h.Health.DebugHub)
+
+	// Public routes
+	public := router.Group("/api")
+	public.Use(middleware.RateLimitByIP(deps.Limiter))
+	public.POST("/users/register", h.Users.Register)
+	public.POST("/users/login", h.Users.Login)
+	public.POST("/users/login/2fa", h.TwoFactor.CompleteLogin)
+	public.POST("/users/password/forgot", h.PasswordResets.ForgotPassword)
+	public.POST("/users/password/reset", h.PasswordResets.ResetPassword)
+	public.GET("/users/verify", h.Verification.VerifyEmail)
+	public.GET("/auth/oidc/providers", h.OIDC.ListProviders)
+	public.GET("/auth/oidc/:provider/login", h.OIDC.Login)
+	public.GET("/auth/oidc/:provider/callback", h.OIDC.Callback)
+
+	// Protected routes. API keys are accepted here, so every route must
+	// either require a scope or be in the account group that refuses keys.
+	protected := public.Group("")
+	protected.Use(middleware.AuthMiddleware(repos.Sessions, repos.APIKeys), middleware.RequireActiveUser(repos.Users), middleware.RateLimitByAccount(deps.Limiter))
+	account := protected.Group("", middleware.RejectAPIKeys())
+	verified := middleware.RequireVerifiedEmail(repos.Users, deps.RequireVerifiedEmail)
+	{
+		// User routes
+		protected.GET("/users/me", middleware.RequireScope(auth.ScopeProfileRead), h.Users.GetMe)
+		protected.GET("/users/search", middleware.RequireScope(auth.ScopeProfileRead), h.Users.SearchUsers)
+		protected.GET("/users/me/calls", middleware.RequireScope(auth.ScopeCallsRead), h.Attendance.History)
+		protected.GET("/users/:id", middleware.RequireScope(auth.ScopeProfileRead), h.Users.GetUser)
+		account.PATCH("/users/me", h.Users.UpdateMe)
+		account.DELETE("/users/me", h.Accounts.Delete)
+		account.GET("/users/me/export", h.Accounts.Export)
+		account.PUT("/users/me/avatar", h.Avatars.Upload)
+		account.DELETE("/users/me/avatar", h.Avatars.Delete)
+		account.POST("/users/me/email", h.Users.ChangeEmail)
+		account.POST("/users/me/password", h.Users.ChangePassword)
+		account.POST("/users/verify/resend", h.Verification.ResendVerification)
+		account.GET("/users/me/2fa", h.TwoFactor.Status)
+		account.POST("/users/me/2fa/enroll", h.TwoFactor.Enroll)
+		account.POST("/users/me/2fa/confirm", h.TwoFactor.Confirm)
+		account.POST("/users/me/2fa/disable", h.TwoFactor.Disable)
+		account.POST("/users/me/2fa/recovery-codes", h.TwoFactor.RegenerateRecoveryCodes)
+		account.POST("/users/me/api-keys", h.APIKeys.Create)
+		account.GET("/users/me/api-keys", h.APIKeys.List)
+		account.DELETE("/users/me/api-keys/:id", h.APIKeys.Revoke)
+		account.GET("/users/me/sessions", h.Sessions.List)
+		account.DELETE("/users/me/sessions/:id", h.Sessions.Revoke)
+
+		// Call routes
+		protected.POST("/calls", middleware.RequireScope(auth.ScopeCallsWrite), verified, h.Calls.CreateCall)
+		protected.POST("/calls/join", middleware.RequireScope(auth.ScopeCallsWrite), verified, h.Calls.JoinCall)
+		protected.POST("/calls/:room_id/leave", middleware.RequireScope(auth.ScopeCallsWrite), h.Calls.LeaveCall)
+		protected.POST("/calls/:room_id/end", middleware.RequireScope(auth.ScopeCallsWrite), h.Calls.EndCall)
+		protected.GET("/calls/:room_id/attendance", middleware.RequireScope(auth.ScopeCallsRead), h.Attendance.Report)
+		protected.GET("/calls", middleware.RequireScope(auth.ScopeCallsRead), h.Calls.ListCalls)
+
+		// WebSocket routes
+		protected.GET("/ws", middleware.RequireScope(auth.ScopeCallsWrite), verified, h.WebSocket.HandleWebSocket)
+		protected.GET("/rooms/:room_id/participants", middleware.RequireScope(auth.ScopeCallsRead), h.WebSocket.GetRoomParticipants)
+
+		// Admin routes
+		admin := protected.Group("/admin", middleware.RequireScope(auth.ScopeAdmin))
+		admin.GET("/users", middleware.RequirePermission(auth.PermissionViewUsers), h.Admin.ListUsers)
+		admin.POST("/users/:id/disable", middleware.RequirePermission(auth.PermissionManageUsers), h.Admin.DisableUser)
+		admin.POST("/users/:id/enable", middleware.RequirePermission(auth.PermissionManageUsers), h.Admin.EnableUser)
+		admin.PUT("/users/:id/role", middleware.RequirePermission(auth.PermissionManageUsers), h.Admin.SetRole)
+		admin.POST("/calls/:id/end", middleware.RequirePermission(auth.PermissionModerateCalls), h.Admin.EndCall)
+		admin.GET("/rooms", middleware.RequirePermission(auth.PermissionViewRooms), h.Admin.ListRooms)
+		admin.GET("/rooms/:room_id", middleware.RequirePermission(auth.PermissionViewRooms), h.Admin.GetRoom)
+	}
+}
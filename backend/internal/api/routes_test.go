@@ -0,0 +1,41 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/ayush/accountability-app/backend/internal/auth"
+	"github.com/ayush/accountability-app/backend/internal/repository"
+)
+
+func TestRegisterRoutesMiddleware(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	router := newTestRouterWith(repos, testDeps{requireVerified: true})
+	_, token := createTestUser(t, repos, "john@example.com", "johndoe", "secret123")
+	_, adminToken := createTestUserWithRole(t, repos, "admin@example.com", "admin", auth.RoleAdmin)
+	profileKey := createAPIKey(t, router, token, "profile:read")
+	callsKey := createAPIKey(t, router, token, "calls:read")
+
+	tests := []struct {
+		name   string
+		path   string
+		token  string
+		status int
+	}{
+		{"liveness needs no token", "/healthz", "", http.StatusOK},
+		{"hub diagnostics need a token", "/debug/hub", "", http.StatusUnauthorized},
+		{"hub diagnostics need the permission", "/debug/hub", token, http.StatusForbidden},
+		{"hub diagnostics for admins", "/debug/hub", adminToken, http.StatusOK},
+		{"hub diagnostics refuse API keys", "/debug/hub", callsKey.Key, http.StatusUnauthorized},
+		{"room participants need calls:read", "/api/rooms/1/participants", profileKey.Key, http.StatusForbidden},
+		{"room participants with calls:read", "/api/rooms/1/participants", callsKey.Key, http.StatusOK},
+		{"WebSocket needs calls:write", "/api/ws?room_id=1", callsKey.Key, http.StatusForbidden},
+		{"WebSocket needs a verified email", "/api/ws?room_id=1", token, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := doRequest(t, router, http.MethodGet, tt.path, nil, tt.token)
+			expectStatus(t, rec, tt.status)
+		})
+	}
+}
@@ -0,0 +1,254 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ayush/accountability-app/backend/internal/auth"
+	"github.com/ayush/accountability-app/backend/internal/logger"
+	"github.com/ayush/accountability-app/backend/internal/models"
+	"github.com/ayush/accountability-app/backend/internal/repository"
+	ws "github.com/ayush/accountability-app/backend/internal/websocket"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// maxDeviceNameLength bounds device names given by clients
+const maxDeviceNameLength = 100
+
+// SessionHandler issues access tokens for login sessions and lets users see
+// and revoke the devices they are logged in on
+type SessionHandler struct {
+	sessions repository.SessionRepository
+	hub      *ws.Hub
+}
+
+// SessionResponse describes a login session
+type SessionResponse struct {
+	ID         uint      `json:"id" example:"1"`
+	DeviceName string    `json:"device_name" example:"Firefox on Linux"`
+	UserAgent  string    `json:"user_agent" example:"Mozilla/5.0 (X11; Linux x86_64; rv:131.0) Gecko/20100101 Firefox/131.0"`
+	IP         string    `json:"ip" example:"203.0.113.7"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+
+	// Current is set on the session of the token making the request
+	Current bool `json:"current" example:"true"`
+}
+
+// SessionListResponse lists a user's active sessions, most recently seen first
+type SessionListResponse struct {
+	Sessions []SessionResponse `json:"sessions"`
+}
+
+func newSessionResponse(session *models.Session, current uint) SessionResponse {
+	return SessionResponse{
+		ID:         session.ID,
+		DeviceName: session.DeviceName,
+		UserAgent:  session.UserAgent,
+		IP:         session.IP,
+		CreatedAt:  session.CreatedAt,
+		LastSeenAt: session.LastSeenAt,
+		ExpiresAt:  session.ExpiresAt,
+		Current:    session.ID == current,
+	}
+}
+
+// NewSessionHandler creates a session handler; hub is used to disconnect the
+// WebSocket clients of revoked sessions
+func NewSessionHandler(sessions repository.SessionRepository, hub *ws.Hub) *SessionHandler {
+	return &SessionHandler{sessions: sessions, hub: hub}
+}
+
+// issueToken starts a session for user on the requesting device and returns
+// an access token for it. deviceName is optional; without it a name is
+// derived from the User-Agent header.
+func (h *SessionHandler) issueToken(c *gin.Context, user *models.User, deviceName string) (string, error) {
+	now := time.Now()
+	userAgent := c.Request.UserAgent()
+
+	deviceName = strings.TrimSpace(deviceName)
+	if deviceName == "" {
+		deviceName = deviceFromUserAgent(userAgent)
+	}
+
+	session := models.Session{
+		UserID:     user.ID,
+		DeviceName: deviceName,
+		UserAgent:  userAgent,
+		IP:         c.ClientIP(),
+		CreatedAt:  now,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(auth.TokenTTL()),
+	}
+	if err := h.sessions.Create(c.Request.Context(), &session); err != nil {
+		return "", err
+	}
+
+	return auth.GenerateToken(user.ID, user.Email, auth.Role(user.Role), session.ID)
+}
+
+// revokeAll ends every session of a user and closes their WebSocket
+// connections. It returns the number of clients disconnected.
+func (h *SessionHandler) revokeAll(ctx context.Context, userID uint, reason string) (int, error) {
+	if err := h.sessions.RevokeAllForUser(ctx, userID, time.Now()); err != nil {
+		return 0, err
+	}
+	return h.hub.DisconnectUser(userID, reason), nil
+}
+
+// revokeOthers ends every session of a user except keep and closes their
+// WebSocket connections. It returns the number of sessions revoked.
+func (h *SessionHandler) revokeOthers(ctx context.Context, userID, keep uint, reason string) (int, error) {
+	now := time.Now()
+	sessions, err := h.sessions.ListActiveByUser(ctx, userID, now)
+	if err != nil {
+		return 0, err
+	}
+
+	revoked := 0
+	for _, session := range sessions {
+		if session.ID == keep {
+			continue
+		}
+		err := h.sessions.Revoke(ctx, userID, session.ID, now)
+		if errors.Is(err, repository.ErrNotFound) {
+			// Revoked or expired in the meantime
+			continue
+		}
+		if err != nil {
+			return revoked, err
+		}
+		h.hub.DisconnectSession(session.ID, reason)
+		revoked++
+	}
+	return revoked, nil
+}
+
+// List godoc
+// @Summary List sessions
+// @Description List the devices the current user is logged in on, most recently seen first. The session making the request is marked as current.
+// @Tags sessions
+// @Produce json
+// @Success 200 {object} SessionListResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /users/me/sessions [get]
+func (h *SessionHandler) List(c *gin.Context) {
+	sessions, err := h.sessions.ListActiveByUser(c.Request.Context(), c.GetUint("user_id"), time.Now())
+	if err != nil {
+		logger.FromContext(c.Request.Context()).Error("Failed to list sessions", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to list sessions"})
+		return
+	}
+
+	current := c.GetUint("session_id")
+	resp := SessionListResponse{Sessions: make([]SessionResponse, 0, len(sessions))}
+	for i := range sessions {
+		resp.Sessions = append(resp.Sessions, newSessionResponse(&sessions[i], current))
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// Revoke godoc
+// @Summary Revoke a session
+// @Description Log one of the current user's devices out. Its token stops working immediately and its WebSocket connections are closed. Revoking the current session logs the caller out.
+// @Tags sessions
+// @Produce json
+// @Param id path string true "Session ID"
+// @Success 200 {object} SuccessResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /users/me/sessions/{id} [delete]
+func (h *SessionHandler) Revoke(c *gin.Context) {
+	log := logger.FromContext(c.Request.Context())
+
+	sessionID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Session not found"})
+		return
+	}
+
+	err = h.sessions.Revoke(c.Request.Context(), c.GetUint("user_id"), uint(sessionID), time.Now())
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Session not found"})
+		return
+	}
+	if err != nil {
+		log.Error("Failed to revoke session", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to revoke session"})
+		return
+	}
+
+	disconnected := h.hub.DisconnectSession(uint(sessionID), "session revoked")
+	log.Info("Session revoked", zap.Uint64("session_id", sessionID), zap.Int("disconnected", disconnected))
+	c.JSON(http.StatusOK, SuccessResponse{Message: "Session revoked"})
+}
+
+// deviceFromUserAgent names a device after its browser and operating system,
+// e.g. "Firefox on Linux". It only needs to be recognisable in a list, so
+// the detection is deliberately rough.
+func deviceFromUserAgent(userAgent string) string {
+	if userAgent == "" {
+		return "Unknown device"
+	}
+
+	browser := ""
+	for _, b := range []struct{ token, name string }{
+		// Order matters: Edge and Opera also claim to be Chrome, and Chrome
+		// claims to be Safari
+		{"Edg/", "Edge"},
+		{"OPR/", "Opera"},
+		{"Firefox/", "Firefox"},
+		{"Chrome/", "Chrome"},
+		{"Safari/", "Safari"},
+	} {
+		if strings.Contains(userAgent, b.token) {
+			browser = b.name
+			break
+		}
+	}
+
+	system := ""
+	for _, s := range []struct{ token, name string }{
+		{"Android", "Android"},
+		{"iPhone", "iOS"},
+		{"iPad", "iPadOS"},
+		{"Mac OS X", "macOS"},
+		{"Windows", "Windows"},
+		{"Linux", "Linux"},
+	} {
+		if strings.Contains(userAgent, s.token) {
+			system = s.name
+			break
+		}
+	}
+
+	switch {
+	case browser != "" && system != "":
+		return browser + " on " + system
+	case browser != "":
+		return browser
+	case system != "":
+		return system
+	}
+
+	// Not a browser; use the client's product token, e.g. "curl"
+	product, _, _ := strings.Cut(userAgent, "/")
+	product, _, _ = strings.Cut(product, " ")
+	if len(product) > maxDeviceNameLength {
+		product = product[:maxDeviceNameLength]
+	}
+	return product
+}
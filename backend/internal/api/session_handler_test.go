@@ -0,0 +1,128 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ayush/accountability-app/backend/internal/auth"
+	"github.com/ayush/accountability-app/backend/internal/repository"
+)
+
+// listSessions returns the sessions visible to token
+func listSessions(t *testing.T, router http.Handler, token string) []SessionResponse {
+	t.Helper()
+
+	rec := doRequest(t, router, http.MethodGet, "/api/users/me/sessions", nil, token)
+	expectStatus(t, rec, http.StatusOK)
+	var resp SessionListResponse
+	decodeResponse(t, rec, &resp)
+	return resp.Sessions
+}
+
+func TestLoginStartsSession(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	router := newTestRouter(repos)
+	user, _ := createTestUser(t, repos, "john@example.com", "johndoe", "secret123")
+
+	rec := doRequest(t, router, http.MethodPost, "/api/users/login", LoginRequest{Email: user.Email, Password: "secret123", DeviceName: "Work laptop"}, "")
+	expectStatus(t, rec, http.StatusOK)
+	var named LoginResponse
+	decodeResponse(t, rec, &named)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/users/login", strings.NewReader(`{"email":"john@example.com","password":"secret123"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 14_5) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/129.0.0.0 Safari/537.36")
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	expectStatus(t, rec, http.StatusOK)
+
+	sessions := listSessions(t, router, named.Token)
+	if len(sessions) != 3 {
+		t.Fatalf("expected 3 sessions, got %+v", sessions)
+	}
+	devices := map[string]SessionResponse{}
+	for _, s := range sessions {
+		devices[s.DeviceName] = s
+	}
+	if !devices["Work laptop"].Current || devices["Chrome on macOS"].Current || devices["Chrome on macOS"].IP == "" {
+		t.Fatalf("unexpected sessions: %+v", sessions)
+	}
+
+	claims, err := auth.ValidateToken(named.Token)
+	if err != nil || claims.SessionID != devices["Work laptop"].ID {
+		t.Fatalf("expected the token to carry its session, got %+v (%v)", claims, err)
+	}
+}
+
+func TestRevokeSession(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	router := newTestRouter(repos)
+	user, token := createTestUser(t, repos, "john@example.com", "johndoe", "secret123")
+	phoneToken := tokenFor(t, repos, user)
+	_, otherToken := createTestUser(t, repos, "jane@example.com", "janedoe", "secret123")
+
+	phone, _ := auth.ValidateToken(phoneToken)
+	path := fmt.Sprintf("/api/users/me/sessions/%d", phone.SessionID)
+
+	rec := doRequest(t, router, http.MethodDelete, path, nil, otherToken)
+	expectStatus(t, rec, http.StatusNotFound)
+
+	rec = doRequest(t, router, http.MethodDelete, path, nil, token)
+	expectStatus(t, rec, http.StatusOK)
+
+	rec = doRequest(t, router, http.MethodGet, fmt.Sprintf("/api/users/%d", user.ID), nil, phoneToken)
+	expectStatus(t, rec, http.StatusUnauthorized)
+
+	rec = doRequest(t, router, http.MethodDelete, path, nil, token)
+	expectStatus(t, rec, http.StatusNotFound)
+
+	if sessions := listSessions(t, router, token); len(sessions) != 1 || !sessions[0].Current {
+		t.Fatalf("expected only the current session to be left, got %+v", sessions)
+	}
+
+	t.Run("revoking the current session logs out", func(t *testing.T) {
+		current, _ := auth.ValidateToken(token)
+		rec := doRequest(t, router, http.MethodDelete, fmt.Sprintf("/api/users/me/sessions/%d", current.SessionID), nil, token)
+		expectStatus(t, rec, http.StatusOK)
+
+		rec = doRequest(t, router, http.MethodGet, "/api/users/me/sessions", nil, token)
+		expectStatus(t, rec, http.StatusUnauthorized)
+	})
+}
+
+func TestTokenWithoutSession(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	router := newTestRouter(repos)
+	user, _ := createTestUser(t, repos, "john@example.com", "johndoe", "secret123")
+
+	// Tokens issued before sessions were tracked carry no session ID
+	legacy, err := auth.GenerateToken(user.ID, user.Email, auth.RoleUser, 0)
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+
+	rec := doRequest(t, router, http.MethodGet, fmt.Sprintf("/api/users/%d", user.ID), nil, legacy)
+	expectStatus(t, rec, http.StatusUnauthorized)
+}
+
+func TestDeviceFromUserAgent(t *testing.T) {
+	tests := []struct {
+		userAgent string
+		want      string
+	}{
+		{"Mozilla/5.0 (X11; Linux x86_64; rv:131.0) Gecko/20100101 Firefox/131.0", "Firefox on Linux"},
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/129.0.0.0 Safari/537.36 Edg/129.0.0.0", "Edge on Windows"},
+		{"Mozilla/5.0 (iPhone; CPU iPhone OS 17_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Mobile/15E148 Safari/604.1", "Safari on iOS"},
+		{"Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/129.0.0.0 Mobile Safari/537.36", "Chrome on Android"},
+		{"curl/8.5.0", "curl"},
+		{"", "Unknown device"},
+	}
+	for _, tt := range tests {
+		if got := deviceFromUserAgent(tt.userAgent); got != tt.want {
+			t.Errorf("deviceFromUserAgent(%q) = %q, want %q", tt.userAgent, got, tt.want)
+		}
+	}
+}
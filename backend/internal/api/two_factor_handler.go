@@ -0,0 +1,487 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/ayush/accountability-app/backend/internal/auth"
+	"github.com/ayush/accountability-app/backend/internal/logger"
+	"github.com/ayush/accountability-app/backend/internal/models"
+	"github.com/ayush/accountability-app/backend/internal/ratelimit"
+	"github.com/ayush/accountability-app/backend/internal/repository"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// TwoFactorHandler manages TOTP two-factor authentication and the second
+// step of logging in
+type TwoFactorHandler struct {
+	users        repository.UserRepository
+	codes        repository.RecoveryCodeRepository
+	limiter      *ratelimit.Limiter
+	sessions     *SessionHandler
+	issuer       string
+	challengeTTL time.Duration
+}
+
+// TwoFactorStatusResponse describes the user's two-factor authentication
+type TwoFactorStatusResponse struct {
+	Enabled                bool `json:"enabled" example:"true"`
+	RecoveryCodesRemaining int  `json:"recovery_codes_remaining" example:"10"`
+}
+
+// TwoFactorEnrollResponse carries the new TOTP secret for authenticator apps
+type TwoFactorEnrollResponse struct {
+	Secret     string `json:"secret" example:"JBSWY3DPEHPK3PXP"`
+	OTPAuthURI string `json:"otpauth_uri" example:"otpauth://totp/Accountability%20App:john@example.com?secret=JBSWY3DPEHPK3PXP&issuer=Accountability%20App"`
+}
+
+// TwoFactorCodeRequest carries a TOTP code, or a recovery code where accepted
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required" example:"123456"`
+}
+
+// DisableTwoFactorRequest represents the request to turn off two-factor authentication
+type DisableTwoFactorRequest struct {
+	Password string `json:"password" binding:"required" example:"secret123"`
+	Code     string `json:"code" binding:"required" example:"123456"`
+}
+
+// RecoveryCodesResponse lists new recovery codes; they are only shown once
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes" example:"abcd-efgh-jkmn-pqrs"`
+}
+
+// TwoFactorChallengeResponse is returned by login when a second factor is required
+type TwoFactorChallengeResponse struct {
+	TwoFactorRequired bool   `json:"two_factor_required" example:"true"`
+	ChallengeToken    string `json:"challenge_token" example:"eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9..."`
+	ExpiresIn         int    `json:"expires_in" example:"300"`
+}
+
+// TwoFactorLoginRequest exchanges a login challenge and a code for a token
+type TwoFactorLoginRequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required" example:"eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9..."`
+	Code           string `json:"code" binding:"required" example:"123456"`
+
+	// DeviceName labels the session in the session list
+	DeviceName string `json:"device_name" binding:"max=100" example:"Work laptop"`
+}
+
+// NewTwoFactorHandler creates a two-factor handler. issuer names the account
+// in authenticator apps; login challenges expire after challengeTTL and
+// sessions issues the access token once the code is checked.
+func NewTwoFactorHandler(users repository.UserRepository, codes repository.RecoveryCodeRepository, limiter *ratelimit.Limiter, sessions *SessionHandler, issuer string, challengeTTL time.Duration) *TwoFactorHandler {
+	return &TwoFactorHandler{
+		users:        users,
+		codes:        codes,
+		limiter:      limiter,
+		sessions:     sessions,
+		issuer:       issuer,
+		challengeTTL: challengeTTL,
+	}
+}
+
+// Status godoc
+// @Summary Get two-factor status
+// @Description Report whether two-factor authentication is enabled and how many recovery codes are left
+// @Tags two-factor
+// @Produce json
+// @Success 200 {object} TwoFactorStatusResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /users/me/2fa [get]
+func (h *TwoFactorHandler) Status(c *gin.Context) {
+	user, ok := currentUser(c, h.users)
+	if !ok {
+		return
+	}
+
+	resp := TwoFactorStatusResponse{Enabled: user.IsTwoFactorEnabled()}
+	if resp.Enabled {
+		remaining, err := h.codes.CountUnused(c.Request.Context(), user.ID)
+		if err != nil {
+			logger.FromContext(c.Request.Context()).Error("Failed to count recovery codes", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to get two-factor status"})
+			return
+		}
+		resp.RecoveryCodesRemaining = remaining
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// Enroll godoc
+// @Summary Start two-factor enrollment
+// @Description Generate a TOTP secret and otpauth URI to add to an authenticator app. Two-factor authentication is enabled once a code is confirmed.
+// @Tags two-factor
+// @Produce json
+// @Success 200 {object} TwoFactorEnrollResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /users/me/2fa/enroll [post]
+func (h *TwoFactorHandler) Enroll(c *gin.Context) {
+	log := logger.FromContext(c.Request.Context())
+
+	user, ok := currentUser(c, h.users)
+	if !ok {
+		return
+	}
+	if user.IsTwoFactorEnabled() {
+		c.JSON(http.StatusConflict, ErrorResponse{Error: "Two-factor authentication is already enabled"})
+		return
+	}
+
+	secret, uri, err := auth.NewTOTPKey(h.issuer, user.Email)
+	if err != nil {
+		log.Error("Failed to generate TOTP secret", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to start enrollment"})
+		return
+	}
+
+	if err := h.users.SetTOTP(c.Request.Context(), user.ID, secret, nil); err != nil {
+		log.Error("Failed to store TOTP secret", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to start enrollment"})
+		return
+	}
+
+	log.Info("Two-factor enrollment started")
+	c.JSON(http.StatusOK, TwoFactorEnrollResponse{Secret: secret, OTPAuthURI: uri})
+}
+
+// Confirm godoc
+// @Summary Confirm two-factor enrollment
+// @Description Enable two-factor authentication by confirming a code from the authenticator app, and get recovery codes
+// @Tags two-factor
+// @Accept json
+// @Produce json
+// @Param request body TwoFactorCodeRequest true "TOTP code"
+// @Success 200 {object} RecoveryCodesResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 429 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /users/me/2fa/confirm [post]
+func (h *TwoFactorHandler) Confirm(c *gin.Context) {
+	log := logger.FromContext(c.Request.Context())
+
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	user, ok := currentUser(c, h.users)
+	if !ok {
+		return
+	}
+	if user.IsTwoFactorEnabled() {
+		c.JSON(http.StatusConflict, ErrorResponse{Error: "Two-factor authentication is already enabled"})
+		return
+	}
+	if user.TOTPSecret == "" {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Start enrollment first"})
+		return
+	}
+	if !checkLoginAllowed(c, h.limiter, user.Email) {
+		return
+	}
+
+	valid, err := h.checkTOTP(c.Request.Context(), user, req.Code)
+	if err != nil {
+		log.Error("Failed to check TOTP code", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to confirm enrollment"})
+		return
+	}
+	if !valid {
+		loginFailed(c, h.limiter, user.Email, http.StatusForbidden, "Invalid code")
+		return
+	}
+
+	codes, hashes, err := auth.NewRecoveryCodes()
+	if err == nil {
+		err = h.codes.Replace(c.Request.Context(), user.ID, hashes)
+	}
+	if err != nil {
+		log.Error("Failed to create recovery codes", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to confirm enrollment"})
+		return
+	}
+
+	now := time.Now()
+	if err := h.users.SetTOTP(c.Request.Context(), user.ID, user.TOTPSecret, &now); err != nil {
+		log.Error("Failed to enable two-factor authentication", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to confirm enrollment"})
+		return
+	}
+
+	log.Info("Two-factor authentication enabled")
+	c.JSON(http.StatusOK, RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// Disable godoc
+// @Summary Disable two-factor authentication
+// @Description Turn off two-factor authentication. Requires the password and a TOTP or recovery code.
+// @Tags two-factor
+// @Accept json
+// @Produce json
+// @Param request body DisableTwoFactorRequest true "Password and code"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 429 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /users/me/2fa/disable [post]
+func (h *TwoFactorHandler) Disable(c *gin.Context) {
+	log := logger.FromContext(c.Request.Context())
+
+	var req DisableTwoFactorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	user, ok := currentUser(c, h.users)
+	if !ok {
+		return
+	}
+	if !user.IsTwoFactorEnabled() {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Two-factor authentication is not enabled"})
+		return
+	}
+	if !checkLoginAllowed(c, h.limiter, user.Email) {
+		return
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)) != nil {
+		loginFailed(c, h.limiter, user.Email, http.StatusForbidden, "Invalid password or code")
+		return
+	}
+	valid, err := h.checkSecondFactor(c.Request.Context(), user, req.Code)
+	if err != nil {
+		log.Error("Failed to check second factor", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to disable two-factor authentication"})
+		return
+	}
+	if !valid {
+		loginFailed(c, h.limiter, user.Email, http.StatusForbidden, "Invalid password or code")
+		return
+	}
+
+	if err := h.users.SetTOTP(c.Request.Context(), user.ID, "", nil); err != nil {
+		log.Error("Failed to disable two-factor authentication", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to disable two-factor authentication"})
+		return
+	}
+	if err := h.codes.DeleteForUser(c.Request.Context(), user.ID); err != nil {
+		log.Warn("Failed to delete recovery codes", zap.Error(err))
+	}
+
+	log.Info("Two-factor authentication disabled")
+	c.JSON(http.StatusOK, SuccessResponse{Message: "Two-factor authentication disabled"})
+}
+
+// RegenerateRecoveryCodes godoc
+// @Summary Regenerate recovery codes
+// @Description Replace all recovery codes with new ones. Requires a TOTP code.
+// @Tags two-factor
+// @Accept json
+// @Produce json
+// @Param request body TwoFactorCodeRequest true "TOTP code"
+// @Success 200 {object} RecoveryCodesResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 429 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /users/me/2fa/recovery-codes [post]
+func (h *TwoFactorHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	log := logger.FromContext(c.Request.Context())
+
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	user, ok := currentUser(c, h.users)
+	if !ok {
+		return
+	}
+	if !user.IsTwoFactorEnabled() {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Two-factor authentication is not enabled"})
+		return
+	}
+	if !checkLoginAllowed(c, h.limiter, user.Email) {
+		return
+	}
+
+	valid, err := h.checkTOTP(c.Request.Context(), user, req.Code)
+	if err != nil {
+		log.Error("Failed to check TOTP code", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to regenerate recovery codes"})
+		return
+	}
+	if !valid {
+		loginFailed(c, h.limiter, user.Email, http.StatusForbidden, "Invalid code")
+		return
+	}
+
+	codes, hashes, err := auth.NewRecoveryCodes()
+	if err == nil {
+		err = h.codes.Replace(c.Request.Context(), user.ID, hashes)
+	}
+	if err != nil {
+		log.Error("Failed to create recovery codes", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to regenerate recovery codes"})
+		return
+	}
+
+	log.Info("Recovery codes regenerated")
+	c.JSON(http.StatusOK, RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// CompleteLogin godoc
+// @Summary Complete two-factor login
+// @Description Exchange the challenge token from /users/login and a TOTP or recovery code for an access token
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param request body TwoFactorLoginRequest true "Challenge token and code"
+// @Success 200 {object} LoginResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 429 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /users/login/2fa [post]
+func (h *TwoFactorHandler) CompleteLogin(c *gin.Context) {
+	log := logger.FromContext(c.Request.Context())
+
+	var req TwoFactorLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	userID, email, err := auth.ParseTwoFactorChallenge(req.ChallengeToken)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Invalid or expired challenge, log in again"})
+		return
+	}
+	if !checkLoginAllowed(c, h.limiter, email) {
+		return
+	}
+
+	user, err := h.users.GetByID(c.Request.Context(), userID)
+	if errors.Is(err, repository.ErrNotFound) || (err == nil && (user.Email != email || !user.IsTwoFactorEnabled())) {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Invalid or expired challenge, log in again"})
+		return
+	}
+	if err != nil {
+		log.Error("Failed to look up user", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to log in"})
+		return
+	}
+
+	valid, err := h.checkSecondFactor(c.Request.Context(), user, req.Code)
+	if err != nil {
+		log.Error("Failed to check second factor", zap.Error(err), zap.Uint("user_id", user.ID))
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to log in"})
+		return
+	}
+	if !valid {
+		log.Info("Login failed: wrong two-factor code", zap.Uint("user_id", user.ID))
+		loginFailed(c, h.limiter, email, http.StatusUnauthorized, "Invalid code")
+		return
+	}
+
+	completeLogin(c, h.limiter, h.sessions, user, req.DeviceName)
+}
+
+// challenge responds to a login whose password was correct with a token to
+// exchange for an access token once the second factor is checked
+func (h *TwoFactorHandler) challenge(c *gin.Context, user *models.User) {
+	resp, err := h.newChallenge(user)
+	if err != nil {
+		logger.FromContext(c.Request.Context()).Error("Failed to create two-factor challenge", zap.Error(err), zap.Uint("user_id", user.ID))
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to log in"})
+		return
+	}
+
+	logger.FromContext(c.Request.Context()).Info("Password accepted, two-factor code required", zap.Uint("user_id", user.ID))
+	c.JSON(http.StatusAccepted, resp)
+}
+
+// newChallenge creates the challenge a user exchanges for a token at /users/login/2fa
+func (h *TwoFactorHandler) newChallenge(user *models.User) (*TwoFactorChallengeResponse, error) {
+	token, err := auth.NewTwoFactorChallenge(user.ID, user.Email, h.challengeTTL)
+	if err != nil {
+		return nil, err
+	}
+	return &TwoFactorChallengeResponse{
+		TwoFactorRequired: true,
+		ChallengeToken:    token,
+		ExpiresIn:         int(h.challengeTTL / time.Second),
+	}, nil
+}
+
+// checkSecondFactor accepts a TOTP code or an unused recovery code, which is
+// then used up
+func (h *TwoFactorHandler) checkSecondFactor(ctx context.Context, user *models.User, code string) (bool, error) {
+	if auth.IsTOTPCode(code) {
+		return h.checkTOTP(ctx, user, code)
+	}
+
+	err := h.codes.Consume(ctx, user.ID, auth.HashRecoveryCode(code), time.Now())
+	if errors.Is(err, repository.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	logger.FromContext(ctx).Info("Recovery code used", zap.Uint("user_id", user.ID))
+	return true, nil
+}
+
+// checkTOTP accepts a TOTP code that has not been used before
+func (h *TwoFactorHandler) checkTOTP(ctx context.Context, user *models.User, code string) (bool, error) {
+	step, ok := auth.MatchTOTP(user.TOTPSecret, code, time.Now())
+	if !ok {
+		return false, nil
+	}
+
+	err := h.users.AdvanceTOTPStep(ctx, user.ID, step)
+	if errors.Is(err, repository.ErrNotFound) {
+		logger.FromContext(ctx).Info("Rejected reused TOTP code", zap.Uint("user_id", user.ID))
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// currentUser loads the authenticated user, responding with an error if it fails
+func currentUser(c *gin.Context, users repository.UserRepository) (*models.User, bool) {
+	user, err := users.GetByID(c.Request.Context(), c.GetUint("user_id"))
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "User no longer exists"})
+		return nil, false
+	}
+	if err != nil {
+		logger.FromContext(c.Request.Context()).Error("Failed to look up user", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to look up user"})
+		return nil, false
+	}
+	return user, true
+}
@@ -0,0 +1,168 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ayush/accountability-app/backend/internal/repository"
+	"github.com/ayush/accountability-app/backend/internal/testutil/totptest"
+
+	"github.com/gin-gonic/gin"
+)
+
+// enableTwoFactor enrolls the user and returns the TOTP secret, the time of
+// the code used to confirm it and the recovery codes
+func enableTwoFactor(t *testing.T, router *gin.Engine, token string) (string, time.Time, []string) {
+	t.Helper()
+
+	rec := doRequest(t, router, http.MethodPost, "/api/users/me/2fa/enroll", nil, token)
+	expectStatus(t, rec, http.StatusOK)
+	var enroll TwoFactorEnrollResponse
+	decodeResponse(t, rec, &enroll)
+	if enroll.Secret == "" || !strings.HasPrefix(enroll.OTPAuthURI, "otpauth://totp/") {
+		t.Fatalf("unexpected enrollment: %+v", enroll)
+	}
+
+	confirmedAt := time.Now()
+	rec = doRequest(t, router, http.MethodPost, "/api/users/me/2fa/confirm", TwoFactorCodeRequest{Code: totptest.Code(t, enroll.Secret, confirmedAt)}, token)
+	expectStatus(t, rec, http.StatusOK)
+	var codes RecoveryCodesResponse
+	decodeResponse(t, rec, &codes)
+	if len(codes.RecoveryCodes) != 10 {
+		t.Fatalf("expected 10 recovery codes, got %v", codes.RecoveryCodes)
+	}
+	return enroll.Secret, confirmedAt, codes.RecoveryCodes
+}
+
+// loginChallenge logs in with a password and returns the two-factor challenge token
+func loginChallenge(t *testing.T, router *gin.Engine) string {
+	t.Helper()
+
+	rec := doRequest(t, router, http.MethodPost, "/api/users/login", LoginRequest{Email: "john@example.com", Password: "secret123"}, "")
+	expectStatus(t, rec, http.StatusAccepted)
+	var challenge TwoFactorChallengeResponse
+	decodeResponse(t, rec, &challenge)
+	if !challenge.TwoFactorRequired || challenge.ChallengeToken == "" {
+		t.Fatalf("expected a two-factor challenge, got %+v", challenge)
+	}
+	return challenge.ChallengeToken
+}
+
+func TestTwoFactorLogin(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	router := newTestRouter(repos)
+	_, token := createTestUser(t, repos, "john@example.com", "johndoe", "secret123")
+
+	t.Run("pending enrollment is not enforced", func(t *testing.T) {
+		rec := doRequest(t, router, http.MethodPost, "/api/users/me/2fa/enroll", nil, token)
+		expectStatus(t, rec, http.StatusOK)
+
+		rec = doRequest(t, router, http.MethodPost, "/api/users/me/2fa/confirm", TwoFactorCodeRequest{Code: "000000"}, token)
+		expectStatus(t, rec, http.StatusForbidden)
+
+		rec = doRequest(t, router, http.MethodPost, "/api/users/login", LoginRequest{Email: "john@example.com", Password: "secret123"}, "")
+		expectStatus(t, rec, http.StatusOK)
+	})
+
+	secret, confirmedAt, recoveryCodes := enableTwoFactor(t, router, token)
+
+	rec := doRequest(t, router, http.MethodGet, "/api/users/me/2fa", nil, token)
+	expectStatus(t, rec, http.StatusOK)
+	var status TwoFactorStatusResponse
+	decodeResponse(t, rec, &status)
+	if !status.Enabled || status.RecoveryCodesRemaining != 10 {
+		t.Fatalf("unexpected status: %+v", status)
+	}
+
+	t.Run("code used for enrollment cannot be replayed", func(t *testing.T) {
+		challenge := loginChallenge(t, router)
+		rec := doRequest(t, router, http.MethodPost, "/api/users/login/2fa", TwoFactorLoginRequest{
+			ChallengeToken: challenge,
+			Code:           totptest.Code(t, secret, confirmedAt),
+		}, "")
+		expectStatus(t, rec, http.StatusUnauthorized)
+	})
+
+	t.Run("next TOTP code", func(t *testing.T) {
+		challenge := loginChallenge(t, router)
+		rec := doRequest(t, router, http.MethodPost, "/api/users/login/2fa", TwoFactorLoginRequest{
+			ChallengeToken: challenge,
+			Code:           totptest.Code(t, secret, confirmedAt.Add(30*time.Second)),
+		}, "")
+		expectStatus(t, rec, http.StatusOK)
+
+		var resp LoginResponse
+		decodeResponse(t, rec, &resp)
+		if resp.Token == "" {
+			t.Fatal("expected an access token")
+		}
+	})
+
+	t.Run("recovery code works once", func(t *testing.T) {
+		// Recovery codes are accepted however they are typed
+		typed := strings.ToUpper(strings.ReplaceAll(recoveryCodes[0], "-", " "))
+		rec := doRequest(t, router, http.MethodPost, "/api/users/login/2fa", TwoFactorLoginRequest{
+			ChallengeToken: loginChallenge(t, router),
+			Code:           typed,
+		}, "")
+		expectStatus(t, rec, http.StatusOK)
+
+		rec = doRequest(t, router, http.MethodPost, "/api/users/login/2fa", TwoFactorLoginRequest{
+			ChallengeToken: loginChallenge(t, router),
+			Code:           recoveryCodes[0],
+		}, "")
+		expectStatus(t, rec, http.StatusUnauthorized)
+	})
+
+	t.Run("access token is not a challenge", func(t *testing.T) {
+		rec := doRequest(t, router, http.MethodPost, "/api/users/login/2fa", TwoFactorLoginRequest{
+			ChallengeToken: token,
+			Code:           recoveryCodes[1],
+		}, "")
+		expectStatus(t, rec, http.StatusUnauthorized)
+	})
+}
+
+func TestTwoFactorCodeGuessingLocksOut(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	router := newTestRouter(repos)
+	_, token := createTestUser(t, repos, "john@example.com", "johndoe", "secret123")
+	enableTwoFactor(t, router, token)
+
+	// Guesses count as failed logins, so they are delayed and then locked out
+	challenge := loginChallenge(t, router)
+	guess := TwoFactorLoginRequest{ChallengeToken: challenge, Code: "not-a-recovery-code"}
+	for i := 0; i < 10; i++ {
+		rec := doRequest(t, router, http.MethodPost, "/api/users/login/2fa", guess, "")
+		if rec.Code == http.StatusTooManyRequests {
+			return
+		}
+		expectStatus(t, rec, http.StatusUnauthorized)
+	}
+	t.Fatal("expected repeated wrong codes to be refused with 429")
+}
+
+func TestDisableTwoFactor(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	router := newTestRouter(repos)
+	_, token := createTestUser(t, repos, "john@example.com", "johndoe", "secret123")
+	_, _, recoveryCodes := enableTwoFactor(t, router, token)
+
+	rec := doRequest(t, router, http.MethodPost, "/api/users/me/2fa/disable", DisableTwoFactorRequest{Password: "wrong", Code: recoveryCodes[0]}, token)
+	expectStatus(t, rec, http.StatusForbidden)
+
+	rec = doRequest(t, router, http.MethodPost, "/api/users/me/2fa/disable", DisableTwoFactorRequest{Password: "secret123", Code: recoveryCodes[0]}, token)
+	expectStatus(t, rec, http.StatusOK)
+
+	rec = doRequest(t, router, http.MethodPost, "/api/users/login", LoginRequest{Email: "john@example.com", Password: "secret123"}, "")
+	expectStatus(t, rec, http.StatusOK)
+
+	rec = doRequest(t, router, http.MethodGet, "/api/users/me/2fa", nil, token)
+	var status TwoFactorStatusResponse
+	decodeResponse(t, rec, &status)
+	if status.Enabled || status.RecoveryCodesRemaining != 0 {
+		t.Fatalf("unexpected status: %+v", status)
+	}
+}
@@ -1,18 +1,62 @@
 package api
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/ayush/accountability-app/backend/internal/auth"
+	"github.com/ayush/accountability-app/backend/internal/logger"
 	"github.com/ayush/accountability-app/backend/internal/models"
+	"github.com/ayush/accountability-app/backend/internal/ratelimit"
+	"github.com/ayush/accountability-app/backend/internal/repository"
 
 	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
 	"golang.org/x/crypto/bcrypt"
-	"gorm.io/gorm"
+)
+
+const (
+	// Usernames are 3 to 30 letters, digits, dots, dashes and underscores,
+	// starting with a letter or digit
+	minUsernameLength = 3
+	maxUsernameLength = 30
+
+	maxAvatarURLLength = 2048
+
+	// User search queries are 2 to 100 characters; shorter ones match
+	// nearly everyone
+	minSearchLength = 2
+	maxSearchLength = 100
+
+	// defaultSearchPageSize is the number of results when no limit is given
+	// and maxSearchPageSize caps the limit query parameter
+	defaultSearchPageSize = 20
+	maxSearchPageSize     = 50
+)
+
+var (
+	usernamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+	// localePattern accepts BCP 47 language tags such as "en" or "pt-BR"
+	localePattern = regexp.MustCompile(`^[A-Za-z]{2,3}(-[A-Za-z0-9]{2,8})*$`)
 )
 
 type UserHandler struct {
-	db *gorm.DB
+	users     repository.UserRepository
+	limiter   *ratelimit.Limiter
+	verifier  *EmailVerificationHandler
+	twoFactor *TwoFactorHandler
+	sessions  *SessionHandler
+	avatars   *AvatarHandler
 }
 
 // CreateUserRequest represents the request to create a new user
@@ -26,6 +70,9 @@ type CreateUserRequest struct {
 type LoginRequest struct {
 	Email    string `json:"email" binding:"required,email" example:"john@example.com"`
 	Password string `json:"password" binding:"required" example:"secret123"`
+
+	// DeviceName labels the session in the session list
+	DeviceName string `json:"device_name" binding:"max=100" example:"Work laptop"`
 }
 
 // LoginResponse represents the login response
@@ -39,135 +86,731 @@ type UserResponse struct {
 	ID       uint   `json:"id" example:"1"`
 	Email    string `json:"email" example:"john@example.com"`
 	Username string `json:"username" example:"johndoe"`
+
+	EmailVerified bool `json:"email_verified" example:"true"`
+
+	DisplayName string `json:"display_name" example:"John Doe"`
+	Bio         string `json:"bio" example:"Writing a novel, 500 words a day"`
+	AvatarURL   string `json:"avatar_url" example:"https://cdn.example.com/avatars/johndoe.png"`
+	Timezone    string `json:"timezone" example:"Europe/Berlin"`
+	Locale      string `json:"locale" example:"en-GB"`
+
+	// AvatarThumbnails maps edge lengths in pixels to the URLs of an
+	// uploaded avatar's square thumbnails; empty for avatars set as a URL
+	AvatarThumbnails map[string]string `json:"avatar_thumbnails"`
+
+	// Discoverable users can be found through user search
+	Discoverable bool `json:"discoverable" example:"true"`
 }
 
-func NewUserHandler(db *gorm.DB) *UserHandler {
-	return &UserHandler{db: db}
+// PublicUserResponse is what other users see of an account in search results
+type PublicUserResponse struct {
+	ID               uint              `json:"id" example:"2"`
+	Username         string            `json:"username" example:"janedoe"`
+	DisplayName      string            `json:"display_name" example:"Jane Doe"`
+	Bio              string            `json:"bio" example:"Morning pages, every day"`
+	AvatarURL        string            `json:"avatar_url" example:"https://cdn.example.com/avatars/janedoe.png"`
+	AvatarThumbnails map[string]string `json:"avatar_thumbnails"`
+}
+
+// UserSearchResponse is one page of search results, best matches first
+type UserSearchResponse struct {
+	Users  []PublicUserResponse `json:"users"`
+	Total  int64                `json:"total" example:"3"`
+	Offset int                  `json:"offset" example:"0"`
+	Limit  int                  `json:"limit" example:"20"`
+}
+
+// UpdateProfileRequest changes the current user's profile. Omitted fields are
+// left as they are; an empty string clears a field other than username.
+type UpdateProfileRequest struct {
+	Username    *string `json:"username" example:"johndoe"`
+	DisplayName *string `json:"display_name" binding:"omitempty,max=50" example:"John Doe"`
+	Bio         *string `json:"bio" binding:"omitempty,max=500" example:"Writing a novel, 500 words a day"`
+	AvatarURL   *string `json:"avatar_url" example:"https://cdn.example.com/avatars/johndoe.png"`
+	Timezone    *string `json:"timezone" example:"Europe/Berlin"`
+	Locale      *string `json:"locale" example:"en-GB"`
+
+	// Discoverable decides whether the user shows up in user search
+	Discoverable *bool `json:"discoverable" example:"true"`
+}
+
+// ChangeEmailRequest represents the request to change the account's email address
+type ChangeEmailRequest struct {
+	Email    string `json:"email" binding:"required,email" example:"john.doe@example.com"`
+	Password string `json:"password" binding:"required" example:"secret123"`
+}
+
+// ChangePasswordRequest represents the request to change the account's password
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required" example:"secret123"`
+	NewPassword     string `json:"new_password" binding:"required,min=6" example:"newsecret123"`
+}
+
+func newUserResponse(user *models.User) UserResponse {
+	thumbnails := user.AvatarThumbnails
+	if thumbnails == nil {
+		thumbnails = map[string]string{}
+	}
+	return UserResponse{
+		ID:            user.ID,
+		Email:         user.Email,
+		Username:      user.Username,
+		EmailVerified: user.IsEmailVerified(),
+		DisplayName:   user.DisplayName,
+		Bio:           user.Bio,
+		AvatarURL:     user.AvatarURL,
+		Timezone:      user.Timezone,
+		Locale:        user.Locale,
+
+		AvatarThumbnails: thumbnails,
+		Discoverable:     !user.Unlisted,
+	}
+}
+
+func newPublicUserResponse(user *models.User) PublicUserResponse {
+	thumbnails := user.AvatarThumbnails
+	if thumbnails == nil {
+		thumbnails = map[string]string{}
+	}
+	return PublicUserResponse{
+		ID:               user.ID,
+		Username:         user.Username,
+		DisplayName:      user.DisplayName,
+		Bio:              user.Bio,
+		AvatarURL:        user.AvatarURL,
+		AvatarThumbnails: thumbnails,
+	}
+}
+
+// NewUserHandler creates a user handler; limiter throttles failed logins,
+// verifier sends the verification email to new users, twoFactor issues login
+// challenges to users with two-factor authentication, sessions issues access
+// tokens and avatars deletes uploaded avatars replaced by a URL
+func NewUserHandler(users repository.UserRepository, limiter *ratelimit.Limiter, verifier *EmailVerificationHandler, twoFactor *TwoFactorHandler, sessions *SessionHandler, avatars *AvatarHandler) *UserHandler {
+	return &UserHandler{users: users, limiter: limiter, verifier: verifier, twoFactor: twoFactor, sessions: sessions, avatars: avatars}
 }
 
 // Register godoc
 // @Summary Register a new user
-// @Description Register a new user with email, username, and password
+// @Description Register a new user with email, username, and password. Usernames are 3 to 30 letters, digits, dots, dashes and underscores, starting with a letter or digit, and are unique ignoring case. Emails are stored in lower case. The account starts unverified and a verification link is emailed; log in to get a token. If the email is already registered the response is the same and the address is sent a notice instead, so the endpoint does not reveal which addresses have accounts.
 // @Tags users
 // @Accept json
 // @Produce json
 // @Param user body CreateUserRequest true "User registration details"
-// @Success 201 {object} LoginResponse
+// @Success 202 {object} SuccessResponse
 // @Failure 400 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
 // @Router /users/register [post]
 func (h *UserHandler) Register(c *gin.Context) {
+	log := logger.FromContext(c.Request.Context())
+
 	var req CreateUserRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 		return
 	}
+	req.Email = NormalizeEmail(req.Email)
+
+	if err := validateUsername(req.Username); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	taken, err := usernameTaken(c.Request.Context(), h.users, req.Username, 0)
+	if err != nil {
+		log.Error("Failed to look up username", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to create user"})
+		return
+	}
+	if taken {
+		c.JSON(http.StatusConflict, ErrorResponse{Error: "Username is already taken"})
+		return
+	}
 
-	// Hash password
+	// Hash password, also for a registered email so both cases take as long
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
 	if err != nil {
+		log.Error("Failed to hash password", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to hash password"})
 		return
 	}
 
+	// New and registered addresses get the same answer; only the mail differs
+	accepted := SuccessResponse{Message: "Check your email to finish signing up, then log in"}
+
 	user := models.User{
 		Email:    req.Email,
 		Username: req.Username,
 		Password: string(hashedPassword),
 	}
 
-	if err := h.db.Create(&user).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to create user"})
+	err = h.users.Create(c.Request.Context(), &user)
+	if errors.Is(err, repository.ErrDuplicate) {
+		existing, lookupErr := h.users.GetByEmail(c.Request.Context(), req.Email)
+		if lookupErr != nil {
+			// The username was checked above, unless it was taken since
+			c.JSON(http.StatusConflict, ErrorResponse{Error: "Username is already taken"})
+			return
+		}
+
+		log.Info("Registration attempted for a registered email", zap.Uint("user_id", existing.ID))
+		if err := h.verifier.notifyAlreadyRegistered(c.Request.Context(), existing); err != nil {
+			log.Error("Failed to notify the registered email address", zap.Error(err), zap.Uint("user_id", existing.ID))
+		}
+		c.JSON(http.StatusAccepted, accepted)
 		return
 	}
-
-	// Generate JWT token
-	token, err := auth.GenerateToken(user.ID, user.Email)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to generate token"})
+		log.Error("Failed to create user", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to create user"})
 		return
 	}
 
-	c.JSON(http.StatusCreated, LoginResponse{
-		Token: token,
-		User: UserResponse{
-			ID:       user.ID,
-			Email:    user.Email,
-			Username: user.Username,
-		},
-	})
+	log.Info("User registered", zap.Uint("user_id", user.ID))
+
+	// The user can ask for another link, so a mail failure does not fail registration
+	if err := h.verifier.sendVerification(c.Request.Context(), &user); err != nil {
+		log.Error("Failed to send verification email", zap.Error(err), zap.Uint("user_id", user.ID))
+	}
+
+	c.JSON(http.StatusAccepted, accepted)
 }
 
 // Login godoc
 // @Summary Login user
-// @Description Authenticate user with email and password
+// @Description Authenticate user with email and password. Users with two-factor authentication get a challenge to complete at /users/login/2fa instead of a token.
 // @Tags users
 // @Accept json
 // @Produce json
 // @Param credentials body LoginRequest true "Login credentials"
 // @Success 200 {object} LoginResponse
+// @Success 202 {object} TwoFactorChallengeResponse
 // @Failure 400 {object} ErrorResponse
 // @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 429 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
 // @Router /users/login [post]
 func (h *UserHandler) Login(c *gin.Context) {
+	log := logger.FromContext(c.Request.Context())
+
 	var req LoginRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 		return
 	}
+	req.Email = NormalizeEmail(req.Email)
 
-	var user models.User
-	if err := h.db.Where("email = ?", req.Email).First(&user).Error; err != nil {
-		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Invalid credentials"})
+	if !checkLoginAllowed(c, h.limiter, req.Email) {
+		return
+	}
+
+	user, err := h.users.GetByEmail(c.Request.Context(), req.Email)
+	if errors.Is(err, repository.ErrNotFound) {
+		log.Info("Login failed: unknown email")
+		loginFailed(c, h.limiter, req.Email, http.StatusUnauthorized, "Invalid credentials")
+		return
+	}
+	if err != nil {
+		log.Error("Failed to look up user", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to log in"})
 		return
 	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
-		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Invalid credentials"})
+		log.Info("Login failed: wrong password", zap.Uint("user_id", user.ID))
+		loginFailed(c, h.limiter, req.Email, http.StatusUnauthorized, "Invalid credentials")
 		return
 	}
 
-	// Generate JWT token
-	token, err := auth.GenerateToken(user.ID, user.Email)
+	// Only tell someone who knows the password that the account is disabled
+	if user.IsDisabled() {
+		log.Info("Login refused: account is disabled", zap.Uint("user_id", user.ID))
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: "Account is disabled"})
+		return
+	}
+
+	// The failure count is only cleared once the second factor is checked too,
+	// so knowing the password does not allow unlimited guesses at the code
+	if user.IsTwoFactorEnabled() {
+		h.twoFactor.challenge(c, user)
+		return
+	}
+
+	completeLogin(c, h.limiter, h.sessions, user, req.DeviceName)
+}
+
+// checkLoginAllowed refuses attempts with 429 while the account or IP is
+// delayed or locked out. A failing store must not lock everyone out, so
+// errors let the attempt through.
+func checkLoginAllowed(c *gin.Context, limiter *ratelimit.Limiter, email string) bool {
+	log := logger.FromContext(c.Request.Context())
+
+	wait, err := limiter.CheckLogin(c.Request.Context(), email, c.ClientIP())
+	if err != nil {
+		log.Error("Failed to check login attempts", zap.Error(err))
+	}
+	if wait > 0 {
+		log.Info("Login refused: too many failed attempts", zap.Duration("retry_after", wait))
+		c.Header("Retry-After", ratelimit.RetryAfterHeader(wait))
+		c.JSON(http.StatusTooManyRequests, ErrorResponse{Error: "Too many failed login attempts, try again later"})
+		return false
+	}
+	return true
+}
+
+// loginFailed records a failed login and responds with status, telling the
+// client when it may try again if further attempts are now delayed
+func loginFailed(c *gin.Context, limiter *ratelimit.Limiter, email string, status int, message string) {
+	wait, err := limiter.LoginFailed(c.Request.Context(), email, c.ClientIP())
+	if err != nil {
+		logger.FromContext(c.Request.Context()).Error("Failed to record failed login", zap.Error(err))
+	}
+	if wait > 0 {
+		c.Header("Retry-After", ratelimit.RetryAfterHeader(wait))
+	}
+	c.JSON(status, ErrorResponse{Error: message})
+}
+
+// completeLogin clears the failed login count and responds with an access
+// token for a new session, unless the account has been disabled
+func completeLogin(c *gin.Context, limiter *ratelimit.Limiter, sessions *SessionHandler, user *models.User, deviceName string) {
+	log := logger.FromContext(c.Request.Context())
+
+	if user.IsDisabled() {
+		log.Info("Login refused: account is disabled", zap.Uint("user_id", user.ID))
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: "Account is disabled"})
+		return
+	}
+
+	if err := limiter.LoginSucceeded(c.Request.Context(), user.Email); err != nil {
+		log.Error("Failed to reset failed login count", zap.Error(err), zap.Uint("user_id", user.ID))
+	}
+
+	token, err := sessions.issueToken(c, user, deviceName)
 	if err != nil {
+		log.Error("Failed to generate token", zap.Error(err), zap.Uint("user_id", user.ID))
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to generate token"})
 		return
 	}
 
+	log.Info("User logged in", zap.Uint("user_id", user.ID))
+
 	c.JSON(http.StatusOK, LoginResponse{
 		Token: token,
-		User: UserResponse{
-			ID:       user.ID,
-			Email:    user.Email,
-			Username: user.Username,
-		},
+		User:  newUserResponse(user),
 	})
 }
 
 // GetUser godoc
 // @Summary Get user details
-// @Description Get user information by ID
+// @Description Get a user by ID. Other users' profiles only carry the public fields of PublicUserResponse, without email, timezone, locale or settings; the full UserResponse is returned for the caller's own ID and to moderators and admins with the users:read permission.
 // @Tags users
 // @Accept json
 // @Produce json
 // @Param id path string true "User ID"
 // @Success 200 {object} UserResponse
 // @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
 // @Security Bearer
 // @Router /users/{id} [get]
 func (h *UserHandler) GetUser(c *gin.Context) {
-	userID := c.Param("id")
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "User not found"})
+		return
+	}
 
-	var user models.User
-	if err := h.db.First(&user, userID).Error; err != nil {
+	user, err := h.users.GetByID(c.Request.Context(), uint(userID))
+	if errors.Is(err, repository.ErrNotFound) {
 		c.JSON(http.StatusNotFound, ErrorResponse{Error: "User not found"})
 		return
 	}
+	if err != nil {
+		logger.FromContext(c.Request.Context()).Error("Failed to fetch user", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch user"})
+		return
+	}
 
-	c.JSON(http.StatusOK, UserResponse{
-		ID:       user.ID,
-		Email:    user.Email,
-		Username: user.Username,
-	})
+	if !canViewFullProfile(c, user.ID) {
+		c.JSON(http.StatusOK, newPublicUserResponse(user))
+		return
+	}
+	c.JSON(http.StatusOK, newUserResponse(user))
+}
+
+// canViewFullProfile reports whether the caller may see every profile field
+// of a user: their own, or anyone's with the users:read permission. An API
+// key only carries that permission with the admin scope.
+func canViewFullProfile(c *gin.Context, userID uint) bool {
+	if c.GetUint("user_id") == userID {
+		return true
+	}
+	role, _ := c.Get("user_role")
+	if !asRole(role).Can(auth.PermissionViewUsers) {
+		return false
+	}
+	if value, ok := c.Get("api_key_scopes"); ok {
+		scopes, _ := value.([]auth.Scope)
+		return slices.Contains(scopes, auth.ScopeAdmin)
+	}
+	return true
+}
+
+// SearchUsers godoc
+// @Summary Search users
+// @Description Find other users to invite by username or display name. Names starting with the query come first, followed by similar spellings. Users who turned off discoverable, disabled and deleted accounts and the caller are left out.
+// @Tags users
+// @Produce json
+// @Param q query string true "At least 2 characters of a username or display name"
+// @Param offset query int false "Number of results to skip" default(0)
+// @Param limit query int false "Maximum number of results to return (at most 50)" default(20)
+// @Success 200 {object} UserSearchResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /users/search [get]
+func (h *UserHandler) SearchUsers(c *gin.Context) {
+	query := strings.TrimSpace(c.Query("q"))
+	if n := utf8.RuneCountInString(query); n < minSearchLength || n > maxSearchLength {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("q must be %d to %d characters long", minSearchLength, maxSearchLength)})
+		return
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "offset must be a non-negative integer"})
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultSearchPageSize)))
+	if err != nil || limit < 1 {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "limit must be a positive integer"})
+		return
+	}
+	limit = min(limit, maxSearchPageSize)
+
+	users, total, err := h.users.Search(c.Request.Context(), query, c.GetUint("user_id"), offset, limit)
+	if err != nil {
+		logger.FromContext(c.Request.Context()).Error("Failed to search users", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to search users"})
+		return
+	}
+
+	resp := UserSearchResponse{
+		Users:  make([]PublicUserResponse, 0, len(users)),
+		Total:  total,
+		Offset: offset,
+		Limit:  limit,
+	}
+	for i := range users {
+		resp.Users = append(resp.Users, newPublicUserResponse(&users[i]))
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// GetMe godoc
+// @Summary Get the current user
+// @Description Get the profile of the authenticated user
+// @Tags users
+// @Produce json
+// @Success 200 {object} UserResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /users/me [get]
+func (h *UserHandler) GetMe(c *gin.Context) {
+	user, ok := currentUser(c, h.users)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, newUserResponse(user))
+}
+
+// UpdateMe godoc
+// @Summary Update the current user
+// @Description Change the username, display name, bio, avatar URL, time zone or locale. Omitted fields are unchanged and an empty string clears a field. Setting avatar_url replaces an uploaded avatar. The time zone is an IANA name such as "Europe/Berlin" and the locale a BCP 47 tag such as "en-GB".
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param profile body UpdateProfileRequest true "Profile fields to change"
+// @Success 200 {object} UserResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /users/me [patch]
+func (h *UserHandler) UpdateMe(c *gin.Context) {
+	log := logger.FromContext(c.Request.Context())
+
+	var req UpdateProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	update, err := req.validate()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	user, ok := currentUser(c, h.users)
+	if !ok {
+		return
+	}
+
+	if update.Username != nil {
+		taken, err := usernameTaken(c.Request.Context(), h.users, *update.Username, user.ID)
+		if err != nil {
+			log.Error("Failed to look up username", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to update profile"})
+			return
+		}
+		if taken {
+			c.JSON(http.StatusConflict, ErrorResponse{Error: "Username is already taken"})
+			return
+		}
+	}
+
+	err = h.users.UpdateProfile(c.Request.Context(), user.ID, update)
+	if errors.Is(err, repository.ErrDuplicate) {
+		c.JSON(http.StatusConflict, ErrorResponse{Error: "Username is already taken"})
+		return
+	}
+	if err != nil {
+		log.Error("Failed to update profile", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to update profile"})
+		return
+	}
+	if update.AvatarURL != nil {
+		h.avatars.deleteObjects(c.Request.Context(), user.AvatarKeyList())
+	}
+
+	user, ok = currentUser(c, h.users)
+	if !ok {
+		return
+	}
+	log.Info("Profile updated", zap.Uint("user_id", user.ID))
+	c.JSON(http.StatusOK, newUserResponse(user))
+}
+
+// ChangeEmail godoc
+// @Summary Change email address
+// @Description Change the account's email address. Requires the current password. The new address is unverified until the link emailed to it is opened, and the old address is told about the change. An address that already has an account gets the same answer, but its owner is emailed a notice instead and the account is left unchanged.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param request body ChangeEmailRequest true "New address and current password"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 429 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /users/me/email [post]
+func (h *UserHandler) ChangeEmail(c *gin.Context) {
+	log := logger.FromContext(c.Request.Context())
+
+	var req ChangeEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	req.Email = NormalizeEmail(req.Email)
+
+	user, ok := currentUser(c, h.users)
+	if !ok {
+		return
+	}
+	if !checkLoginAllowed(c, h.limiter, user.Email) {
+		return
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)) != nil {
+		loginFailed(c, h.limiter, user.Email, http.StatusForbidden, "Invalid password")
+		return
+	}
+	if req.Email == user.Email {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "That is already your email address"})
+		return
+	}
+
+	// Free and registered addresses get the same answer; only the mail differs
+	accepted := SuccessResponse{Message: "Check the inbox of the new address to verify it"}
+
+	err := h.users.UpdateEmail(c.Request.Context(), user.ID, req.Email)
+	if errors.Is(err, repository.ErrDuplicate) {
+		existing, lookupErr := h.users.GetByEmail(c.Request.Context(), req.Email)
+		if lookupErr != nil {
+			log.Error("Failed to look up the registered email address", zap.Error(lookupErr))
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to change email"})
+			return
+		}
+
+		log.Info("Email change attempted to a registered address",
+			zap.Uint("user_id", user.ID), zap.Uint("owner_id", existing.ID))
+		if err := h.verifier.notifyAlreadyRegistered(c.Request.Context(), existing); err != nil {
+			log.Error("Failed to notify the registered email address", zap.Error(err), zap.Uint("user_id", existing.ID))
+		}
+		c.JSON(http.StatusOK, accepted)
+		return
+	}
+	if err != nil {
+		log.Error("Failed to change email", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to change email"})
+		return
+	}
+
+	oldEmail := user.Email
+	user.Email = req.Email
+	user.EmailVerifiedAt = nil
+	log.Info("Email changed", zap.Uint("user_id", user.ID))
+
+	// The user can ask for another link, so mail failures do not fail the change
+	if err := h.verifier.sendVerification(c.Request.Context(), user); err != nil {
+		log.Error("Failed to send verification email", zap.Error(err), zap.Uint("user_id", user.ID))
+	}
+	if err := h.verifier.notifyEmailChanged(c.Request.Context(), user, oldEmail); err != nil {
+		log.Error("Failed to notify the old email address", zap.Error(err), zap.Uint("user_id", user.ID))
+	}
+
+	c.JSON(http.StatusOK, accepted)
+}
+
+// ChangePassword godoc
+// @Summary Change password
+// @Description Change the account's password. Requires the current password. Every other session is logged out.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param request body ChangePasswordRequest true "Current and new password"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 429 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /users/me/password [post]
+func (h *UserHandler) ChangePassword(c *gin.Context) {
+	log := logger.FromContext(c.Request.Context())
+
+	var req ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	user, ok := currentUser(c, h.users)
+	if !ok {
+		return
+	}
+	if !checkLoginAllowed(c, h.limiter, user.Email) {
+		return
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.CurrentPassword)) != nil {
+		loginFailed(c, h.limiter, user.Email, http.StatusForbidden, "Invalid password")
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		log.Error("Failed to hash password", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to change password"})
+		return
+	}
+	if err := h.users.UpdatePassword(c.Request.Context(), user.ID, string(hashedPassword)); err != nil {
+		log.Error("Failed to update password", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to change password"})
+		return
+	}
+
+	revoked, err := h.sessions.revokeOthers(c.Request.Context(), user.ID, c.GetUint("session_id"), "password changed")
+	if err != nil {
+		log.Error("Failed to revoke other sessions", zap.Error(err))
+	}
+
+	log.Info("Password changed", zap.Uint("user_id", user.ID), zap.Int("sessions_revoked", revoked))
+	c.JSON(http.StatusOK, SuccessResponse{Message: "Password changed"})
+}
+
+// validate checks the requested changes and returns them trimmed
+func (r *UpdateProfileRequest) validate() (models.ProfileUpdate, error) {
+	trim := func(value *string) *string {
+		if value == nil {
+			return nil
+		}
+		trimmed := strings.TrimSpace(*value)
+		return &trimmed
+	}
+	update := models.ProfileUpdate{
+		Username:    trim(r.Username),
+		DisplayName: trim(r.DisplayName),
+		Bio:         trim(r.Bio),
+		AvatarURL:   trim(r.AvatarURL),
+		Timezone:    trim(r.Timezone),
+		Locale:      trim(r.Locale),
+	}
+	if r.Discoverable != nil {
+		unlisted := !*r.Discoverable
+		update.Unlisted = &unlisted
+	}
+
+	if update.Username != nil {
+		if err := validateUsername(*update.Username); err != nil {
+			return update, err
+		}
+	}
+	if update.AvatarURL != nil && *update.AvatarURL != "" {
+		link, err := url.Parse(*update.AvatarURL)
+		if err != nil || (link.Scheme != "https" && link.Scheme != "http") || link.Host == "" || len(*update.AvatarURL) > maxAvatarURLLength {
+			return update, errors.New("avatar_url must be an http or https URL")
+		}
+	}
+	if update.Timezone != nil && *update.Timezone != "" {
+		// LoadLocation also accepts "Local", which means nothing to other users
+		if _, err := time.LoadLocation(*update.Timezone); err != nil || *update.Timezone == "Local" {
+			return update, fmt.Errorf("unknown time zone %q", *update.Timezone)
+		}
+	}
+	if update.Locale != nil && *update.Locale != "" && !localePattern.MatchString(*update.Locale) {
+		return update, fmt.Errorf("invalid locale %q", *update.Locale)
+	}
+	return update, nil
+}
+
+// NormalizeEmail lower-cases an address so it is stored and looked up one
+// way only. Strictly the local part is case-sensitive, but no provider
+// treats it so and users do not expect it.
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// validateUsername checks the username rules
+func validateUsername(username string) error {
+	if len(username) < minUsernameLength || len(username) > maxUsernameLength {
+		return fmt.Errorf("username must be %d to %d characters long", minUsernameLength, maxUsernameLength)
+	}
+	if !usernamePattern.MatchString(username) {
+		return errors.New("username may only contain letters, digits, dots, dashes and underscores, and must start with a letter or digit")
+	}
+	return nil
+}
+
+// usernameTaken reports whether an account other than except has the
+// username, ignoring case. It gives a clear 409 up front; the unique index on
+// LOWER(username) still refuses names taken concurrently.
+func usernameTaken(ctx context.Context, users repository.UserRepository, username string, except uint) (bool, error) {
+	existing, err := users.GetByUsername(ctx, username)
+	if errors.Is(err, repository.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return existing.ID != except, nil
 }
@@ -0,0 +1,531 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ayush/accountability-app/backend/internal/auth"
+	"github.com/ayush/accountability-app/backend/internal/config"
+	"github.com/ayush/accountability-app/backend/internal/models"
+	"github.com/ayush/accountability-app/backend/internal/ratelimit"
+	"github.com/ayush/accountability-app/backend/internal/repository"
+)
+
+func TestRegister(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	router := newTestRouter(repos)
+
+	rec := doRequest(t, router, http.MethodPost, "/api/users/register", CreateUserRequest{
+		Email:    "John@Example.com",
+		Username: "johndoe",
+		Password: "secret123",
+	}, "")
+	expectStatus(t, rec, http.StatusAccepted)
+
+	stored, err := repos.Users.GetByEmail(t.Context(), "john@example.com")
+	if err != nil {
+		t.Fatalf("user was not stored: %v", err)
+	}
+	if stored.Email != "john@example.com" {
+		t.Fatalf("expected the email to be stored in lower case, got %q", stored.Email)
+	}
+	if stored.Password == "secret123" {
+		t.Fatal("password was stored in plain text")
+	}
+
+	rec = doRequest(t, router, http.MethodPost, "/api/users/login", LoginRequest{
+		Email:    "JOHN@example.com",
+		Password: "secret123",
+	}, "")
+	expectStatus(t, rec, http.StatusOK)
+
+	var resp LoginResponse
+	decodeResponse(t, rec, &resp)
+	if resp.User.ID != stored.ID || resp.User.Username != "johndoe" {
+		t.Fatalf("unexpected user in response: %+v", resp.User)
+	}
+	claims, err := auth.ValidateToken(resp.Token)
+	if err != nil {
+		t.Fatalf("returned token is invalid: %v", err)
+	}
+	if claims.UserID != stored.ID {
+		t.Fatalf("token is for user %d, want %d", claims.UserID, stored.ID)
+	}
+}
+
+func TestRegisterDoesNotRevealRegisteredEmails(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	mailer := &outbox{}
+	router := newTestRouterWith(repos, testDeps{mailer: mailer})
+	createTestUser(t, repos, "john@example.com", "johndoe", "secret123")
+
+	fresh := doRequest(t, router, http.MethodPost, "/api/users/register", CreateUserRequest{
+		Email: "jane@example.com", Username: "janedoe", Password: "secret123",
+	}, "")
+	expectStatus(t, fresh, http.StatusAccepted)
+
+	for _, email := range []string{"john@example.com", "John@Example.COM"} {
+		t.Run(email, func(t *testing.T) {
+			before := len(mailer.sent())
+
+			rec := doRequest(t, router, http.MethodPost, "/api/users/register", CreateUserRequest{
+				Email: email, Username: "john2", Password: "secret123",
+			}, "")
+			expectStatus(t, rec, http.StatusAccepted)
+			if rec.Body.String() != fresh.Body.String() {
+				t.Fatalf("expected the same answer as for a new address, got %s, want %s", rec.Body, fresh.Body)
+			}
+
+			if _, err := repos.Users.GetByUsername(t.Context(), "john2"); !errors.Is(err, repository.ErrNotFound) {
+				t.Fatalf("expected no account to be created, got %v", err)
+			}
+			sent := mailer.sent()[before:]
+			if len(sent) != 1 || sent[0].To != "john@example.com" || sent[0].Subject != "You already have an account" {
+				t.Fatalf("expected a notice to the registered address, got %+v", sent)
+			}
+		})
+	}
+}
+
+func TestRegisterValidation(t *testing.T) {
+	router := newTestRouter(repository.NewMemoryRepositories())
+
+	tests := []struct {
+		name string
+		req  CreateUserRequest
+	}{
+		{"missing email", CreateUserRequest{Username: "johndoe", Password: "secret123"}},
+		{"invalid email", CreateUserRequest{Email: "not-an-email", Username: "johndoe", Password: "secret123"}},
+		{"missing username", CreateUserRequest{Email: "john@example.com", Password: "secret123"}},
+		{"short password", CreateUserRequest{Email: "john@example.com", Username: "johndoe", Password: "123"}},
+		{"short username", CreateUserRequest{Email: "john@example.com", Username: "jo", Password: "secret123"}},
+		{"username with spaces", CreateUserRequest{Email: "john@example.com", Username: "john doe", Password: "secret123"}},
+		{"username starting with a dot", CreateUserRequest{Email: "john@example.com", Username: ".johndoe", Password: "secret123"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := doRequest(t, router, http.MethodPost, "/api/users/register", tt.req, "")
+			expectStatus(t, rec, http.StatusBadRequest)
+		})
+	}
+}
+
+func TestRegisterConflicts(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	router := newTestRouter(repos)
+	createTestUser(t, repos, "john@example.com", "johndoe", "secret123")
+
+	tests := []struct {
+		name    string
+		req     CreateUserRequest
+		message string
+	}{
+		{"username taken", CreateUserRequest{Email: "other@example.com", Username: "johndoe", Password: "secret123"}, "Username is already taken"},
+		{"username taken ignoring case", CreateUserRequest{Email: "other@example.com", Username: "JohnDoe", Password: "secret123"}, "Username is already taken"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := doRequest(t, router, http.MethodPost, "/api/users/register", tt.req, "")
+			expectStatus(t, rec, http.StatusConflict)
+			var resp ErrorResponse
+			decodeResponse(t, rec, &resp)
+			if resp.Error != tt.message {
+				t.Fatalf("expected %q, got %q", tt.message, resp.Error)
+			}
+		})
+	}
+
+	t.Run("store refuses names differing only in case", func(t *testing.T) {
+		// What a registration racing past the usernameTaken check runs into
+		err := repos.Users.Create(t.Context(), &models.User{Email: "race@example.com", Username: "JOHNDOE"})
+		if !errors.Is(err, repository.ErrDuplicate) {
+			t.Fatalf("expected ErrDuplicate, got %v", err)
+		}
+	})
+
+	t.Run("store refuses emails differing only in case", func(t *testing.T) {
+		err := repos.Users.Create(t.Context(), &models.User{Email: "JOHN@example.com", Username: "race"})
+		if !errors.Is(err, repository.ErrDuplicate) {
+			t.Fatalf("expected ErrDuplicate, got %v", err)
+		}
+	})
+}
+
+func TestLogin(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	router := newTestRouter(repos)
+	user, _ := createTestUser(t, repos, "john@example.com", "johndoe", "secret123")
+
+	t.Run("valid credentials", func(t *testing.T) {
+		rec := doRequest(t, router, http.MethodPost, "/api/users/login", LoginRequest{
+			Email:    "john@example.com",
+			Password: "secret123",
+		}, "")
+		expectStatus(t, rec, http.StatusOK)
+
+		var resp LoginResponse
+		decodeResponse(t, rec, &resp)
+		if resp.User.ID != user.ID {
+			t.Fatalf("logged in as user %d, want %d", resp.User.ID, user.ID)
+		}
+		if resp.Token == "" {
+			t.Fatal("expected a token")
+		}
+	})
+
+	t.Run("wrong password", func(t *testing.T) {
+		rec := doRequest(t, router, http.MethodPost, "/api/users/login", LoginRequest{
+			Email:    "john@example.com",
+			Password: "wrong",
+		}, "")
+		expectStatus(t, rec, http.StatusUnauthorized)
+	})
+
+	t.Run("unknown email", func(t *testing.T) {
+		rec := doRequest(t, router, http.MethodPost, "/api/users/login", LoginRequest{
+			Email:    "nobody@example.com",
+			Password: "secret123",
+		}, "")
+		expectStatus(t, rec, http.StatusUnauthorized)
+	})
+}
+
+func TestGetUser(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	router := newTestRouter(repos)
+	user, token := createTestUser(t, repos, "john@example.com", "johndoe", "secret123")
+
+	t.Run("existing user", func(t *testing.T) {
+		rec := doRequest(t, router, http.MethodGet, fmt.Sprintf("/api/users/%d", user.ID), nil, token)
+		expectStatus(t, rec, http.StatusOK)
+
+		var resp UserResponse
+		decodeResponse(t, rec, &resp)
+		if resp.ID != user.ID || resp.Username != "johndoe" {
+			t.Fatalf("unexpected user: %+v", resp)
+		}
+	})
+
+	t.Run("unknown user", func(t *testing.T) {
+		rec := doRequest(t, router, http.MethodGet, "/api/users/999", nil, token)
+		expectStatus(t, rec, http.StatusNotFound)
+	})
+
+	t.Run("invalid id", func(t *testing.T) {
+		rec := doRequest(t, router, http.MethodGet, "/api/users/abc", nil, token)
+		expectStatus(t, rec, http.StatusNotFound)
+	})
+
+	t.Run("missing token", func(t *testing.T) {
+		rec := doRequest(t, router, http.MethodGet, fmt.Sprintf("/api/users/%d", user.ID), nil, "")
+		expectStatus(t, rec, http.StatusUnauthorized)
+	})
+
+	t.Run("other users", func(t *testing.T) {
+		private, _ := createTestUser(t, repos, "jane@example.com", "janedoe", "secret123")
+		unlisted := true
+		if err := repos.Users.UpdateProfile(t.Context(), private.ID, models.ProfileUpdate{Unlisted: &unlisted}); err != nil {
+			t.Fatalf("UpdateProfile: %v", err)
+		}
+		_, moderatorToken := createTestUserWithRole(t, repos, "mod@example.com", "mod", auth.RoleModerator)
+		moderatorKey := createAPIKey(t, router, moderatorToken, "profile:read")
+		path := fmt.Sprintf("/api/users/%d", private.ID)
+
+		for name, token := range map[string]string{"user": token, "moderator's key without the admin scope": moderatorKey.Key} {
+			t.Run(name, func(t *testing.T) {
+				rec := doRequest(t, router, http.MethodGet, path, nil, token)
+				expectStatus(t, rec, http.StatusOK)
+				for _, field := range []string{"jane@example.com", `"email"`, `"timezone"`, `"discoverable"`} {
+					if strings.Contains(rec.Body.String(), field) {
+						t.Fatalf("public profile exposes %s: %s", field, rec.Body.String())
+					}
+				}
+				var resp PublicUserResponse
+				decodeResponse(t, rec, &resp)
+				if resp.Username != "janedoe" {
+					t.Fatalf("unexpected user: %+v", resp)
+				}
+			})
+		}
+
+		t.Run("moderator", func(t *testing.T) {
+			rec := doRequest(t, router, http.MethodGet, path, nil, moderatorToken)
+			expectStatus(t, rec, http.StatusOK)
+			var resp UserResponse
+			decodeResponse(t, rec, &resp)
+			if resp.Email != "jane@example.com" || resp.Discoverable {
+				t.Fatalf("expected the full profile, got %+v", resp)
+			}
+		})
+	})
+}
+
+func TestLoginLockout(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	cfg := config.DefaultRateLimitConfig()
+	cfg.Login.MaxFailures = 3
+	cfg.Login.DelayAfter = 3
+	router := newTestRouterWith(repos, testDeps{limiter: ratelimit.New(ratelimit.NewMemoryStore(), cfg)})
+	createTestUser(t, repos, "john@example.com", "johndoe", "secret123")
+
+	wrong := LoginRequest{Email: "john@example.com", Password: "wrong"}
+	for i := 0; i < 2; i++ {
+		rec := doRequest(t, router, http.MethodPost, "/api/users/login", wrong, "")
+		expectStatus(t, rec, http.StatusUnauthorized)
+		if rec.Header().Get("Retry-After") != "" {
+			t.Fatalf("failure %d should not be delayed", i+1)
+		}
+	}
+
+	rec := doRequest(t, router, http.MethodPost, "/api/users/login", wrong, "")
+	expectStatus(t, rec, http.StatusUnauthorized)
+	if got := rec.Header().Get("Retry-After"); got != "900" {
+		t.Fatalf("expected the account to be locked for 900s, got Retry-After %q", got)
+	}
+
+	// Even the right password is refused while the account is locked
+	rec = doRequest(t, router, http.MethodPost, "/api/users/login", LoginRequest{
+		Email:    "john@example.com",
+		Password: "secret123",
+	}, "")
+	expectStatus(t, rec, http.StatusTooManyRequests)
+	if rec.Header().Get("Retry-After") == "" {
+		t.Fatal("expected a Retry-After header")
+	}
+}
+
+func TestGetMe(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	router := newTestRouter(repos)
+	user, token := createTestUser(t, repos, "john@example.com", "johndoe", "secret123")
+
+	rec := doRequest(t, router, http.MethodGet, "/api/users/me", nil, token)
+	expectStatus(t, rec, http.StatusOK)
+	var resp UserResponse
+	decodeResponse(t, rec, &resp)
+	if resp.ID != user.ID || resp.Email != "john@example.com" {
+		t.Fatalf("unexpected user: %+v", resp)
+	}
+
+	rec = doRequest(t, router, http.MethodGet, "/api/users/me", nil, "")
+	expectStatus(t, rec, http.StatusUnauthorized)
+}
+
+func TestUpdateMe(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	router := newTestRouter(repos)
+	user, token := createTestUser(t, repos, "john@example.com", "johndoe", "secret123")
+	createTestUser(t, repos, "jane@example.com", "janedoe", "secret123")
+
+	rec := doRequest(t, router, http.MethodPatch, "/api/users/me", map[string]string{
+		"display_name": "  John Doe ",
+		"bio":          "Writing every morning",
+		"avatar_url":   "https://cdn.example.com/john.png",
+		"timezone":     "Europe/Berlin",
+		"locale":       "en-GB",
+	}, token)
+	expectStatus(t, rec, http.StatusOK)
+	var resp UserResponse
+	decodeResponse(t, rec, &resp)
+	if resp.DisplayName != "John Doe" || resp.Timezone != "Europe/Berlin" || resp.Locale != "en-GB" || resp.Username != "johndoe" {
+		t.Fatalf("unexpected profile: %+v", resp)
+	}
+
+	t.Run("omitted fields are kept and empty ones cleared", func(t *testing.T) {
+		rec := doRequest(t, router, http.MethodPatch, "/api/users/me", map[string]string{"bio": ""}, token)
+		expectStatus(t, rec, http.StatusOK)
+		stored, _ := repos.Users.GetByID(t.Context(), user.ID)
+		if stored.Bio != "" || stored.DisplayName != "John Doe" {
+			t.Fatalf("unexpected profile: %+v", stored)
+		}
+	})
+
+	t.Run("username", func(t *testing.T) {
+		rec := doRequest(t, router, http.MethodPatch, "/api/users/me", map[string]string{"username": "JaneDoe"}, token)
+		expectStatus(t, rec, http.StatusConflict)
+
+		rec = doRequest(t, router, http.MethodPatch, "/api/users/me", map[string]string{"username": "JohnDoe"}, token)
+		expectStatus(t, rec, http.StatusOK)
+		decodeResponse(t, rec, &resp)
+		if resp.Username != "JohnDoe" {
+			t.Fatalf("expected the username to change case, got %q", resp.Username)
+		}
+	})
+
+	tests := []struct {
+		name string
+		req  map[string]string
+	}{
+		{"invalid username", map[string]string{"username": "j"}},
+		{"long display name", map[string]string{"display_name": strings.Repeat("a", 51)}},
+		{"avatar is not a URL", map[string]string{"avatar_url": "javascript:alert(1)"}},
+		{"unknown time zone", map[string]string{"timezone": "Mars/Olympus_Mons"}},
+		{"local time zone", map[string]string{"timezone": "Local"}},
+		{"invalid locale", map[string]string{"locale": "english"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := doRequest(t, router, http.MethodPatch, "/api/users/me", tt.req, token)
+			expectStatus(t, rec, http.StatusBadRequest)
+		})
+	}
+}
+
+func TestChangeEmail(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	mailer := &outbox{}
+	router := newTestRouterWith(repos, testDeps{mailer: mailer})
+	user, token := createTestUser(t, repos, "john@example.com", "johndoe", "secret123")
+	createTestUser(t, repos, "jane@example.com", "janedoe", "secret123")
+	now := time.Now()
+	if err := repos.Users.MarkEmailVerified(t.Context(), user.ID, user.Email, now); err != nil {
+		t.Fatalf("MarkEmailVerified: %v", err)
+	}
+
+	rec := doRequest(t, router, http.MethodPost, "/api/users/me/email", ChangeEmailRequest{Email: "john.doe@example.com", Password: "wrong"}, token)
+	expectStatus(t, rec, http.StatusForbidden)
+
+	// A registered address gets the same answer, and only its owner hears of it
+	taken := doRequest(t, router, http.MethodPost, "/api/users/me/email", ChangeEmailRequest{Email: "Jane@example.com", Password: "secret123"}, token)
+	expectStatus(t, taken, http.StatusOK)
+	if stored, _ := repos.Users.GetByID(t.Context(), user.ID); stored.Email != "john@example.com" || !stored.IsEmailVerified() {
+		t.Fatalf("expected the account to be unchanged, got %+v", stored)
+	}
+	sent := mailer.sent()
+	if len(sent) != 1 || sent[0].To != "jane@example.com" || sent[0].Subject != "You already have an account" {
+		t.Fatalf("expected a notice to the owner of the address, got %+v", sent)
+	}
+
+	rec = doRequest(t, router, http.MethodPost, "/api/users/me/email", ChangeEmailRequest{Email: "john.doe@example.com", Password: "secret123"}, token)
+	expectStatus(t, rec, http.StatusOK)
+	if rec.Body.String() != taken.Body.String() {
+		t.Fatalf("expected the same answer for free and registered addresses, got %q and %q", rec.Body, taken.Body)
+	}
+	if stored, _ := repos.Users.GetByID(t.Context(), user.ID); stored.Email != "john.doe@example.com" || stored.IsEmailVerified() {
+		t.Fatalf("expected an unverified new address, got %+v", stored)
+	}
+
+	sent = mailer.sent()[1:]
+	if len(sent) != 2 || sent[0].To != "john.doe@example.com" || sent[1].To != "john@example.com" {
+		t.Fatalf("expected a verification link to the new address and a notice to the old one, got %+v", sent)
+	}
+	rec = doRequest(t, router, http.MethodGet, verifyPathFrom(t, sent[0].Body), nil, "")
+	expectStatus(t, rec, http.StatusOK)
+	if stored, _ := repos.Users.GetByID(t.Context(), user.ID); !stored.IsEmailVerified() {
+		t.Fatal("expected the new address to be verified")
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	router := newTestRouter(repos)
+	user, token := createTestUser(t, repos, "john@example.com", "johndoe", "secret123")
+	otherToken := tokenFor(t, repos, user)
+
+	rec := doRequest(t, router, http.MethodPost, "/api/users/me/password", ChangePasswordRequest{CurrentPassword: "wrong", NewPassword: "newsecret"}, token)
+	expectStatus(t, rec, http.StatusForbidden)
+
+	rec = doRequest(t, router, http.MethodPost, "/api/users/me/password", ChangePasswordRequest{CurrentPassword: "secret123", NewPassword: "new"}, token)
+	expectStatus(t, rec, http.StatusBadRequest)
+
+	rec = doRequest(t, router, http.MethodPost, "/api/users/me/password", ChangePasswordRequest{CurrentPassword: "secret123", NewPassword: "newsecret"}, token)
+	expectStatus(t, rec, http.StatusOK)
+
+	// The session that changed the password stays logged in, the others do not
+	expectStatus(t, doRequest(t, router, http.MethodGet, "/api/users/me", nil, token), http.StatusOK)
+	expectStatus(t, doRequest(t, router, http.MethodGet, "/api/users/me", nil, otherToken), http.StatusUnauthorized)
+
+	rec = doRequest(t, router, http.MethodPost, "/api/users/login", LoginRequest{Email: user.Email, Password: "newsecret"}, "")
+	expectStatus(t, rec, http.StatusOK)
+}
+
+func TestSearchUsers(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	router := newTestRouter(repos)
+	_, token := createTestUser(t, repos, "me@example.com", "janet", "secret123")
+
+	names := map[string]string{
+		"jane":       "",
+		"janedoe":    "Jane Doe",
+		"writer42":   "Mary Jane Watson",
+		"jaen":       "",
+		"bob":        "Bob Builder",
+		"janehidden": "",
+		"janegone":   "",
+	}
+	ids := map[string]uint{}
+	for username, displayName := range names {
+		user, _ := createTestUser(t, repos, username+"@example.com", username, "secret123")
+		repos.Users.UpdateProfile(t.Context(), user.ID, models.ProfileUpdate{DisplayName: &displayName})
+		ids[username] = user.ID
+	}
+	unlisted := true
+	repos.Users.UpdateProfile(t.Context(), ids["janehidden"], models.ProfileUpdate{Unlisted: &unlisted})
+	now := time.Now()
+	repos.Users.SetDisabled(t.Context(), ids["janegone"], &now)
+
+	search := func(t *testing.T, query string) UserSearchResponse {
+		t.Helper()
+		rec := doRequest(t, router, http.MethodGet, "/api/users/search?"+query, nil, token)
+		expectStatus(t, rec, http.StatusOK)
+		var resp UserSearchResponse
+		decodeResponse(t, rec, &resp)
+		return resp
+	}
+	usernames := func(resp UserSearchResponse) string {
+		var names []string
+		for _, user := range resp.Users {
+			names = append(names, user.Username)
+		}
+		return strings.Join(names, " ")
+	}
+
+	t.Run("exact and prefix matches first", func(t *testing.T) {
+		resp := search(t, "q=JANE")
+		if got := usernames(resp); got != "jane janedoe writer42" || resp.Total != 3 {
+			t.Fatalf("unexpected results %q (total %d)", got, resp.Total)
+		}
+		if strings.Contains(fmt.Sprint(resp), "@example.com") {
+			t.Fatal("search results must not include email addresses")
+		}
+	})
+
+	t.Run("similar spellings", func(t *testing.T) {
+		if got := usernames(search(t, "q=buildr")); got != "bob" {
+			t.Fatalf("unexpected results %q", got)
+		}
+	})
+
+	t.Run("pagination", func(t *testing.T) {
+		resp := search(t, "q=jane&offset=1&limit=1")
+		if got := usernames(resp); got != "janedoe" || resp.Total != 3 || resp.Limit != 1 {
+			t.Fatalf("unexpected page %q: %+v", got, resp)
+		}
+	})
+
+	t.Run("discoverable setting", func(t *testing.T) {
+		_, hiddenToken := createTestUser(t, repos, "hide@example.com", "hideme", "secret123")
+		rec := doRequest(t, router, http.MethodPatch, "/api/users/me", map[string]bool{"discoverable": false}, hiddenToken)
+		expectStatus(t, rec, http.StatusOK)
+		var me UserResponse
+		decodeResponse(t, rec, &me)
+		if me.Discoverable {
+			t.Fatal("expected discoverable to be off")
+		}
+		if got := usernames(search(t, "q=hideme")); got != "" {
+			t.Fatalf("expected no results, got %q", got)
+		}
+	})
+
+	for _, query := range []string{"q=j", "q=" + strings.Repeat("a", 101), "q=jane&limit=0", "q=jane&offset=-1"} {
+		t.Run("invalid "+query[:min(len(query), 12)], func(t *testing.T) {
+			rec := doRequest(t, router, http.MethodGet, "/api/users/search?"+query, nil, token)
+			expectStatus(t, rec, http.StatusBadRequest)
+		})
+	}
+}
@@ -0,0 +1,183 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/ayush/accountability-app/backend/internal/auth"
+	"github.com/ayush/accountability-app/backend/internal/logger"
+	"github.com/ayush/accountability-app/backend/internal/mail"
+	"github.com/ayush/accountability-app/backend/internal/models"
+	"github.com/ayush/accountability-app/backend/internal/repository"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// EmailVerificationHandler sends verification links and confirms them
+type EmailVerificationHandler struct {
+	users     repository.UserRepository
+	mailer    mail.Mailer
+	verifyURL string
+	ttl       time.Duration
+}
+
+// NewEmailVerificationHandler creates an email verification handler. Links
+// point to verifyURL with the token as a query parameter and expire after ttl.
+func NewEmailVerificationHandler(users repository.UserRepository, mailer mail.Mailer, verifyURL string, ttl time.Duration) *EmailVerificationHandler {
+	return &EmailVerificationHandler{
+		users:     users,
+		mailer:    mailer,
+		verifyURL: verifyURL,
+		ttl:       ttl,
+	}
+}
+
+// VerifyEmail godoc
+// @Summary Verify email address
+// @Description Confirm the email address using the token from a verification link
+// @Tags users
+// @Produce json
+// @Param token query string true "Verification token"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 429 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /users/verify [get]
+func (h *EmailVerificationHandler) VerifyEmail(c *gin.Context) {
+	log := logger.FromContext(c.Request.Context())
+
+	token := c.Query("token")
+	if token == "" {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "token is required"})
+		return
+	}
+
+	userID, email, err := auth.ParseEmailVerificationToken(token)
+	if err != nil {
+		log.Info("Email verification with invalid or expired token")
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid or expired verification link"})
+		return
+	}
+
+	err = h.users.MarkEmailVerified(c.Request.Context(), userID, email, time.Now())
+	if errors.Is(err, repository.ErrNotFound) {
+		// The account was removed or its email changed since the link was sent
+		log.Info("Email verification for an address the user no longer has", zap.Uint("user_id", userID))
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid or expired verification link"})
+		return
+	}
+	if err != nil {
+		log.Error("Failed to mark email verified", zap.Error(err), zap.Uint("user_id", userID))
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to verify email"})
+		return
+	}
+
+	log.Info("Email verified", zap.Uint("user_id", userID))
+	c.JSON(http.StatusOK, SuccessResponse{Message: "Email verified"})
+}
+
+// ResendVerification godoc
+// @Summary Resend verification email
+// @Description Send a new verification link to the authenticated user's email address
+// @Tags users
+// @Produce json
+// @Success 202 {object} SuccessResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 429 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security Bearer
+// @Router /users/verify/resend [post]
+func (h *EmailVerificationHandler) ResendVerification(c *gin.Context) {
+	log := logger.FromContext(c.Request.Context())
+
+	user, err := h.users.GetByID(c.Request.Context(), c.GetUint("user_id"))
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "User no longer exists"})
+		return
+	}
+	if err != nil {
+		log.Error("Failed to look up user", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to send verification email"})
+		return
+	}
+
+	if user.IsEmailVerified() {
+		c.JSON(http.StatusConflict, ErrorResponse{Error: "Email is already verified"})
+		return
+	}
+
+	if err := h.sendVerification(c.Request.Context(), user); err != nil {
+		log.Error("Failed to send verification email", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to send verification email"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, SuccessResponse{Message: "Verification email sent"})
+}
+
+// sendVerification emails user a link that verifies their current address
+func (h *EmailVerificationHandler) sendVerification(ctx context.Context, user *models.User) error {
+	token, err := auth.NewEmailVerificationToken(user.ID, user.Email, h.ttl)
+	if err != nil {
+		return fmt.Errorf("failed to create verification token: %v", err)
+	}
+
+	link, err := url.Parse(h.verifyURL)
+	if err != nil {
+		return fmt.Errorf("invalid verification URL: %v", err)
+	}
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+
+	err = h.mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Hi %s,\n\n"+
+			"Please confirm your email address by opening the link below:\n\n"+
+			"%s\n\n"+
+			"The link expires in %s. If you did not create an account, you can ignore this email.\n",
+			user.Username, link, formatDuration(h.ttl)),
+	})
+	if err != nil {
+		return err
+	}
+
+	logger.FromContext(ctx).Info("Verification email sent", zap.Uint("user_id", user.ID))
+	return nil
+}
+
+// notifyEmailChanged tells the previous address of user that the account's
+// email was changed, in case the owner did not make the change
+func (h *EmailVerificationHandler) notifyEmailChanged(ctx context.Context, user *models.User, oldEmail string) error {
+	return h.mailer.Send(ctx, mail.Message{
+		To:      oldEmail,
+		Subject: "Your email address was changed",
+		Body: fmt.Sprintf("Hi %s,\n\n"+
+			"The email address of your account was changed to %s.\n\n"+
+			"If you did not make this change, reset your password and contact support.\n",
+			user.Username, user.Email),
+	})
+}
+
+// notifyAlreadyRegistered tells the owner of user's address that someone
+// tried to register it again or move another account to it, instead of
+// telling whoever tried
+func (h *EmailVerificationHandler) notifyAlreadyRegistered(ctx context.Context, user *models.User) error {
+	return h.mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "You already have an account",
+		Body: fmt.Sprintf("Hi %s,\n\n"+
+			"Someone tried to create an account with this email address, or to change another account to it, "+
+			"but it already belongs to your account.\n\n"+
+			"If that was you, log in instead, or reset your password if you have forgotten it. "+
+			"Otherwise you can ignore this email.\n",
+			user.Username),
+	})
+}
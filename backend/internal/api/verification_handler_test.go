@@ -0,0 +1,122 @@
+package api
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/ayush/accountability-app/backend/internal/auth"
+	"github.com/ayush/accountability-app/backend/internal/models"
+	"github.com/ayush/accountability-app/backend/internal/repository"
+)
+
+var verifyLinkPattern = regexp.MustCompile(`https://api\.example\.com/api/users/verify\?token=\S+`)
+
+// verifyPathFrom turns the verification link in a message body into a request path
+func verifyPathFrom(t *testing.T, body string) string {
+	t.Helper()
+
+	link, err := url.Parse(verifyLinkPattern.FindString(body))
+	if err != nil || link.Query().Get("token") == "" {
+		t.Fatalf("no verification link in message:\n%s", body)
+	}
+	return link.RequestURI()
+}
+
+func TestEmailVerification(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	mailer := &outbox{}
+	router := newTestRouterWith(repos, testDeps{mailer: mailer, requireVerified: true})
+
+	rec := doRequest(t, router, http.MethodPost, "/api/users/register", CreateUserRequest{
+		Email:    "john@example.com",
+		Username: "johndoe",
+		Password: "secret123",
+	}, "")
+	expectStatus(t, rec, http.StatusAccepted)
+
+	rec = doRequest(t, router, http.MethodPost, "/api/users/login", LoginRequest{
+		Email:    "john@example.com",
+		Password: "secret123",
+	}, "")
+	expectStatus(t, rec, http.StatusOK)
+	var resp LoginResponse
+	decodeResponse(t, rec, &resp)
+	if resp.User.EmailVerified {
+		t.Fatal("new accounts should start unverified")
+	}
+
+	sent := mailer.sent()
+	if len(sent) != 1 || sent[0].To != "john@example.com" {
+		t.Fatalf("expected one verification email, got %+v", sent)
+	}
+
+	newCall := models.CallCreate{Title: "Standup", CreatorID: resp.User.ID}
+	rec = doRequest(t, router, http.MethodPost, "/api/calls", newCall, resp.Token)
+	expectStatus(t, rec, http.StatusForbidden)
+
+	rec = doRequest(t, router, http.MethodGet, verifyPathFrom(t, sent[0].Body), nil, "")
+	expectStatus(t, rec, http.StatusOK)
+
+	rec = doRequest(t, router, http.MethodPost, "/api/calls", newCall, resp.Token)
+	expectStatus(t, rec, http.StatusCreated)
+
+	rec = doRequest(t, router, http.MethodPost, "/api/users/verify/resend", nil, resp.Token)
+	expectStatus(t, rec, http.StatusConflict)
+}
+
+func TestVerifyEmailRejectsBadTokens(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	router := newTestRouter(repos)
+	user, accessToken := createTestUser(t, repos, "john@example.com", "johndoe", "secret123")
+
+	expired, err := auth.NewEmailVerificationToken(user.ID, user.Email, -time.Minute)
+	if err != nil {
+		t.Fatalf("NewEmailVerificationToken: %v", err)
+	}
+	otherAddress, err := auth.NewEmailVerificationToken(user.ID, "old@example.com", time.Hour)
+	if err != nil {
+		t.Fatalf("NewEmailVerificationToken: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"missing token", ""},
+		{"garbage", "not-a-token"},
+		{"expired", expired},
+		{"address no longer on the account", otherAddress},
+		{"access token", accessToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := doRequest(t, router, http.MethodGet, "/api/users/verify?token="+url.QueryEscape(tt.token), nil, "")
+			expectStatus(t, rec, http.StatusBadRequest)
+		})
+	}
+
+	stored, _ := repos.Users.GetByID(t.Context(), user.ID)
+	if stored.IsEmailVerified() {
+		t.Fatal("user should still be unverified")
+	}
+}
+
+func TestResendVerification(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	mailer := &outbox{}
+	router := newTestRouterWith(repos, testDeps{mailer: mailer})
+	_, token := createTestUser(t, repos, "john@example.com", "johndoe", "secret123")
+
+	rec := doRequest(t, router, http.MethodPost, "/api/users/verify/resend", nil, token)
+	expectStatus(t, rec, http.StatusAccepted)
+
+	sent := mailer.sent()
+	if len(sent) != 1 {
+		t.Fatalf("expected one email, got %d", len(sent))
+	}
+	rec = doRequest(t, router, http.MethodGet, verifyPathFrom(t, sent[0].Body), nil, "")
+	expectStatus(t, rec, http.StatusOK)
+}
@@ -2,11 +2,16 @@
 package api
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"strconv"
+	"sync/atomic"
 
 	"github.com/ayush/accountability-app/backend/internal/config"
 	"github.com/ayush/accountability-app/backend/internal/logger"
+	"github.com/ayush/accountability-app/backend/internal/origin"
+	"github.com/ayush/accountability-app/backend/internal/repository"
 	ws "github.com/ayush/accountability-app/backend/internal/websocket"
 
 	"github.com/gin-gonic/gin"
@@ -16,32 +21,52 @@ import (
 
 // WSHandler handles WebSocket connections
 type WSHandler struct {
-	hub    *ws.Hub
-	config *config.WebSocketConfig
-}
+	hub      *ws.Hub
+	origins  *origin.Policy
+	calls    repository.CallRepository
+	upgrader websocket.Upgrader
 
-var wsUpgrader = websocket.Upgrader{
-	ReadBufferSize:  1024,
-	WriteBufferSize: 1024,
-	CheckOrigin: func(r *http.Request) bool {
-		// Note: In production, implement proper origin checking
-		logger.Debug("Checking WebSocket origin",
-			zap.String("origin", r.Header.Get("Origin")))
-		return true
-	},
+	// config is swapped atomically when the configuration is reloaded
+	config atomic.Pointer[config.WebSocketConfig]
 }
 
-// NewWSHandler creates a new WebSocket handler
-func NewWSHandler(config *config.WebSocketConfig) *WSHandler {
+// NewWSHandler creates a new WebSocket handler serving clients through the
+// given hub and accepting upgrades from the origins the policy allows. Rooms
+// named after a call, by its numeric ID, are only open while the call is
+// active.
+func NewWSHandler(hub *ws.Hub, config *config.WebSocketConfig, origins *origin.Policy, calls repository.CallRepository) *WSHandler {
 	logger.Info("Creating new WebSocket handler",
-		zap.Strings("allowed_origins", config.AllowedOrigins))
-
-	hub := ws.NewHub()
-	go hub.Run()
-	return &WSHandler{
-		hub:    hub,
-		config: config,
+		zap.Strings("allowed_origins", origins.Config().AllowedOrigins))
+
+	h := &WSHandler{
+		hub:     hub,
+		origins: origins,
+		calls:   calls,
+		upgrader: websocket.Upgrader{
+			ReadBufferSize:  1024,
+			WriteBufferSize: 1024,
+			CheckOrigin:     origins.CheckOrigin,
+		},
 	}
+	h.SetConfig(config)
+	return h
+}
+
+// SetConfig replaces the room limits. Connections that are already open keep
+// running; the new values apply to joins and messages from then on.
+func (h *WSHandler) SetConfig(cfg *config.WebSocketConfig) {
+	h.config.Store(cfg)
+	h.hub.SetLimits(ws.Limits{
+		MaxClientsPerRoom: cfg.MaxClientsPerRoom,
+		MessageRate:       cfg.MessageRateLimit,
+		MessageBurst:      cfg.MessageBurst,
+	})
+}
+
+// Shutdown stops accepting new WebSocket connections and gracefully closes
+// the existing ones through the hub
+func (h *WSHandler) Shutdown(ctx context.Context) error {
+	return h.hub.Shutdown(ctx)
 }
 
 // HandleWebSocket godoc
@@ -51,82 +76,139 @@ func NewWSHandler(config *config.WebSocketConfig) *WSHandler {
 // @Accept json
 // @Produce json
 // @Param room_id query string true "Room ID"
-// @Param user_id query string true "User ID"
+// @Param user_id query string false "User ID, which must be the current user's; any other ID is refused"
 // @Success 101 {string} string "Switching Protocols to websocket"
 // @Failure 400 {object} ErrorResponse
 // @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Failure 503 {object} ErrorResponse
 // @Security Bearer
 // @Router /ws [get]
 func (h *WSHandler) HandleWebSocket(c *gin.Context) {
-	roomID := c.Query("room_id")
-	if roomID == "" {
-		logger.Warn("WebSocket connection attempt without room_id")
-		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "room_id is required"})
+	log := logger.FromContext(c.Request.Context())
+
+	if h.hub.IsClosing() {
+		log.Info("Rejecting WebSocket connection during shutdown",
+			zap.String("remote_addr", c.Request.RemoteAddr))
+		c.Header("Retry-After", "5")
+		c.JSON(http.StatusServiceUnavailable, ErrorResponse{Error: "server is restarting"})
 		return
 	}
 
-	userIDStr := c.Query("user_id")
-	if userIDStr == "" {
-		logger.Warn("WebSocket connection attempt without user_id",
-			zap.String("room_id", roomID))
-		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "user_id is required"})
+	roomID := c.Query("room_id")
+	if roomID == "" {
+		log.Warn("WebSocket connection attempt without room_id")
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "room_id is required"})
 		return
 	}
 
-	userID, err := strconv.ParseUint(userIDStr, 10, 32)
-	if err != nil {
-		logger.Warn("Invalid user_id format in WebSocket connection attempt",
-			zap.String("room_id", roomID),
-			zap.String("user_id_str", userIDStr),
-			zap.Error(err))
-		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid user_id format"})
-		return
+	// Clients are registered as the authenticated user so that disabling or
+	// deleting an account reaches all of its connections
+	userID := uint64(c.GetUint("user_id"))
+	if userIDStr := c.Query("user_id"); userIDStr != "" {
+		requested, err := strconv.ParseUint(userIDStr, 10, 32)
+		if err != nil {
+			log.Warn("Invalid user_id format in WebSocket connection attempt",
+				zap.String("room_id", roomID),
+				zap.String("user_id_str", userIDStr),
+				zap.Error(err))
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid user_id format"})
+			return
+		}
+		if requested != userID {
+			log.Warn("WebSocket connection attempt as another user",
+				zap.String("room_id", roomID),
+				zap.Uint64("user_id", userID),
+				zap.Uint64("requested_user_id", requested))
+			c.JSON(http.StatusForbidden, ErrorResponse{Error: "WebSocket connections can only be opened as yourself"})
+			return
+		}
 	}
 
-	logger.Info("WebSocket connection attempt",
+	log.Info("WebSocket connection attempt",
 		zap.String("room_id", roomID),
 		zap.Uint64("user_id", userID),
 		zap.String("remote_addr", c.Request.RemoteAddr),
 		zap.String("origin", c.Request.Header.Get("Origin")))
 
-	// Check origin if configured
-	if len(h.config.AllowedOrigins) > 0 {
-		origin := c.Request.Header.Get("Origin")
-		allowed := false
-		for _, allowedOrigin := range h.config.AllowedOrigins {
-			if origin == allowedOrigin {
-				allowed = true
-				break
-			}
+	// The upgrader checks the origin too, but checking first gives a JSON error
+	if !h.origins.CheckOrigin(c.Request) {
+		log.Warn("WebSocket connection rejected due to unauthorized origin",
+			zap.String("origin", c.Request.Header.Get("Origin")),
+			zap.String("room_id", roomID),
+			zap.Uint64("user_id", userID))
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: "origin not allowed"})
+		return
+	}
+
+	// A call's room is named after its ID. Clients reconnecting after the call
+	// was ended must not land back in its room.
+	if callID, err := strconv.ParseUint(roomID, 10, 32); err == nil {
+		call, err := h.calls.GetByID(c.Request.Context(), uint(callID))
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "call not found"})
+			return
+		}
+		if err != nil {
+			log.Error("Failed to look up call for WebSocket connection",
+				zap.Error(err),
+				zap.String("room_id", roomID))
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to look up call"})
+			return
 		}
-		if !allowed {
-			logger.Warn("WebSocket connection rejected due to unauthorized origin",
-				zap.String("origin", origin),
+		if call.Status != "active" {
+			log.Info("WebSocket connection rejected, call is not active",
 				zap.String("room_id", roomID),
 				zap.Uint64("user_id", userID),
-				zap.Strings("allowed_origins", h.config.AllowedOrigins))
-			c.JSON(http.StatusForbidden, ErrorResponse{Error: "origin not allowed"})
+				zap.String("status", call.Status))
+			c.JSON(http.StatusConflict, ErrorResponse{Error: "call has ended"})
 			return
 		}
 	}
 
-	conn, err := wsUpgrader.Upgrade(c.Writer, c.Request, nil)
+	cfg := h.config.Load()
+
+	if h.hub.IsRoomFull(roomID) {
+		log.Warn("WebSocket connection rejected, room is full",
+			zap.String("room_id", roomID),
+			zap.Uint64("user_id", userID),
+			zap.Int("max_clients_per_room", cfg.MaxClientsPerRoom))
+		c.JSON(http.StatusConflict, ErrorResponse{Error: "room is full"})
+		return
+	}
+
+	conn, err := h.upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
-		logger.Error("Failed to upgrade WebSocket connection",
+		// The upgrader has already written the error response
+		log.Error("Failed to upgrade WebSocket connection",
 			zap.Error(err),
 			zap.String("room_id", roomID),
 			zap.Uint64("user_id", userID))
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to upgrade connection"})
 		return
 	}
 
-	logger.Info("WebSocket connection established",
+	log.Info("WebSocket connection established",
 		zap.String("room_id", roomID),
 		zap.Uint64("user_id", userID),
 		zap.String("remote_addr", c.Request.RemoteAddr))
 
-	client := ws.NewClient(h.hub, conn, roomID, uint(userID))
-	h.hub.Register(client)
+	client := ws.NewClient(h.hub, conn, roomID, uint(userID), c.GetUint("session_id"), c.GetUint("api_key_id"))
+	if err := h.hub.Register(client); err != nil {
+		// The room filled up or the server began shutting down after the checks above
+		closeCode, reason := websocket.CloseGoingAway, "server restarting"
+		if errors.Is(err, ws.ErrRoomFull) {
+			closeCode, reason = websocket.CloseTryAgainLater, "room is full"
+		}
+		log.Info("Closing WebSocket connection refused by the hub",
+			zap.String("room_id", roomID),
+			zap.Uint64("user_id", userID),
+			zap.String("reason", reason))
+		conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(closeCode, reason))
+		conn.Close()
+		return
+	}
 
 	// Start client message pumps
 	go client.WritePump()
@@ -145,15 +227,17 @@ func (h *WSHandler) HandleWebSocket(c *gin.Context) {
 // @Security Bearer
 // @Router /rooms/{room_id}/participants [get]
 func (h *WSHandler) GetRoomParticipants(c *gin.Context) {
+	log := logger.FromContext(c.Request.Context())
+
 	roomID := c.Param("room_id")
 	if roomID == "" {
-		logger.Warn("Room participants request without room_id")
+		log.Warn("Room participants request without room_id")
 		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "room_id is required"})
 		return
 	}
 
 	count := h.hub.GetClientsInRoom(roomID)
-	logger.Debug("Retrieved room participants count",
+	log.Debug("Retrieved room participants count",
 		zap.String("room_id", roomID),
 		zap.Int("count", count))
 
@@ -0,0 +1,511 @@
+package api_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ayush/accountability-app/backend/internal/auth"
+	"github.com/ayush/accountability-app/backend/internal/config"
+	"github.com/ayush/accountability-app/backend/internal/metrics"
+	"github.com/ayush/accountability-app/backend/internal/models"
+	"github.com/ayush/accountability-app/backend/internal/testutil/wstest"
+	ws "github.com/ayush/accountability-app/backend/internal/websocket"
+
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestWebSocketBroadcastFanOut(t *testing.T) {
+	srv := wstest.NewServer(t)
+
+	alice := srv.Dial("room-1", 1)
+	bob := srv.Dial("room-1", 2)
+	carol := srv.Dial("room-1", 3)
+
+	wstest.AssertFanOut(t, alice, "hello", alice, bob, carol)
+	wstest.AssertFanOut(t, carol, "hi alice", alice, bob, carol)
+}
+
+func TestWebSocketRoomIsolation(t *testing.T) {
+	srv := wstest.NewServer(t)
+
+	alice := srv.Dial("room-1", 1)
+	bob := srv.Dial("room-1", 2)
+	dave := srv.Dial("room-2", 4)
+
+	wstest.AssertFanOut(t, alice, "only room 1", alice, bob)
+	wstest.AssertIsolated(t, 100*time.Millisecond, dave)
+
+	wstest.AssertFanOut(t, dave, "only room 2", dave)
+	wstest.AssertIsolated(t, 100*time.Millisecond, alice, bob)
+}
+
+func TestWebSocketRejectsMessagesForOtherRooms(t *testing.T) {
+	srv := wstest.NewServer(t)
+
+	alice := srv.Dial("room-1", 1)
+	dave := srv.Dial("room-2", 4)
+
+	alice.SendMessage(ws.NewMessage(ws.MessageTypeChat, "sneaky", "room-2", 1))
+	wstest.AssertIsolated(t, 100*time.Millisecond, alice, dave)
+}
+
+func TestWebSocketServerSetsSenderID(t *testing.T) {
+	srv := wstest.NewServer(t)
+
+	alice := srv.Dial("room-1", 1)
+	bob := srv.Dial("room-1", 2)
+
+	alice.SendMessage(ws.NewMessage(ws.MessageTypeChat, "spoofed", "room-1", 2))
+	if msg := bob.Expect(); msg.UserID != alice.UserID {
+		t.Fatalf("message attributed to user %d, want sender %d", msg.UserID, alice.UserID)
+	}
+}
+
+func TestWebSocketDisconnectCleanup(t *testing.T) {
+	srv := wstest.NewServer(t)
+
+	alice := srv.Dial("room-1", 1)
+	bob := srv.Dial("room-1", 2)
+
+	alice.Close()
+	srv.WaitForClients("room-1", 1)
+	wstest.AssertFanOut(t, bob, "still here", bob)
+
+	bob.Close()
+	srv.WaitForClients("room-1", 0)
+	srv.WaitForRoomClosed("room-1")
+}
+
+func TestWebSocketDisconnectLeavesCall(t *testing.T) {
+	srv := wstest.NewServer(t)
+	srv.User(2)
+
+	call := &models.Call{Title: "Sprint", CreatorID: 1, Status: "active"}
+	if err := srv.Repos.Calls.Create(t.Context(), call); err != nil {
+		t.Fatalf("failed to create call: %v", err)
+	}
+	for _, userID := range []uint{1, 2} {
+		participant := &models.CallParticipant{CallID: call.ID, UserID: userID, JoinedAt: time.Now()}
+		if err := srv.Repos.Participants.Create(t.Context(), participant); err != nil {
+			t.Fatalf("failed to create participant: %v", err)
+		}
+	}
+	roomID := strconv.FormatUint(uint64(call.ID), 10)
+
+	laptop := srv.Dial(roomID, 1)
+	phone := srv.Dial(roomID, 1)
+	bob := srv.Dial(roomID, 2)
+
+	// Alice is still in the call on her phone
+	laptop.Close()
+	srv.WaitForClients(roomID, 2)
+	srv.ExpectInCall(call.ID, 1, 200*time.Millisecond)
+	participants, _ := srv.Repos.Participants.ListByUser(t.Context(), 1)
+	if len(participants) != 1 || participants[0].LeftAt != nil {
+		t.Fatalf("expected alice to still be in the call, got %+v", participants)
+	}
+
+	phone.Close()
+	srv.WaitForLeave(call.ID, 1)
+
+	srv.Hub.DisconnectUser(2, "account disabled")
+	srv.WaitForLeave(call.ID, 2)
+	bob.Close()
+}
+
+func TestWebSocketReconnectRejoinsCall(t *testing.T) {
+	srv := wstest.NewServer(t)
+	roomID := srv.Call(1, "active")
+	callID, _ := strconv.ParseUint(roomID, 10, 32)
+
+	// Connecting counts as joining, without calling POST /calls/join
+	alice := srv.Dial(roomID, 1)
+	srv.WaitForJoin(uint(callID), 1)
+
+	// A dropped connection leaves the call and reconnecting rejoins it
+	alice.Close()
+	srv.WaitForLeave(uint(callID), 1)
+	alice = srv.Dial(roomID, 1)
+	srv.WaitForJoin(uint(callID), 1)
+	defer alice.Close()
+
+	participants, _ := srv.Repos.Participants.ListByCall(t.Context(), uint(callID))
+	if len(participants) != 2 || participants[0].LeftAt == nil || participants[1].LeftAt != nil {
+		t.Fatalf("expected a closed and an open record, got %+v", participants)
+	}
+}
+
+func TestWebSocketShutdownLeavesCall(t *testing.T) {
+	srv := wstest.NewServer(t)
+	roomID := srv.Call(1, "active")
+	callID, _ := strconv.ParseUint(roomID, 10, 32)
+
+	alice := srv.Dial(roomID, 1)
+	srv.WaitForJoin(uint(callID), 1)
+
+	// A client that never reconnects after a restart must not stay in the call
+	ctx, cancel := context.WithTimeout(context.Background(), wstest.DefaultWait)
+	defer cancel()
+	if err := srv.Hub.Shutdown(ctx); err != nil {
+		t.Fatalf("shutdown did not drain clients: %v", err)
+	}
+	alice.Close()
+
+	participants, _ := srv.Repos.Participants.ListByCall(t.Context(), uint(callID))
+	if len(participants) != 1 || participants[0].LeftAt == nil {
+		t.Fatalf("expected shutdown to close the attendance record, got %+v", participants)
+	}
+}
+
+func TestWebSocketPingPong(t *testing.T) {
+	srv := wstest.NewServer(t, wstest.WithTimeouts(wstest.FastTimeouts))
+
+	t.Run("responsive client stays connected", func(t *testing.T) {
+		alice := srv.Dial("room-1", 1)
+
+		// Outlive several pong deadlines
+		time.Sleep(3 * wstest.FastTimeouts.Pong)
+
+		if n := srv.Hub.GetClientsInRoom("room-1"); n != 1 {
+			t.Fatalf("expected responsive client to stay registered, hub has %d clients", n)
+		}
+		wstest.AssertFanOut(t, alice, "alive", alice)
+	})
+
+	t.Run("unresponsive client is dropped", func(t *testing.T) {
+		bob := srv.DialUnresponsive("room-2", 2)
+
+		bob.ExpectClosed()
+		srv.WaitForClients("room-2", 0)
+		srv.WaitForRoomClosed("room-2")
+	})
+}
+
+func TestWebSocketUpgradeValidation(t *testing.T) {
+	srv := wstest.NewServer(t)
+
+	t.Run("missing token", func(t *testing.T) {
+		header := http.Header{}
+		header.Set("Origin", wstest.DefaultOrigin)
+		if status := srv.Reject("room-1", 1, header); status != http.StatusUnauthorized {
+			t.Fatalf("expected 401, got %d", status)
+		}
+	})
+
+	t.Run("disallowed origin", func(t *testing.T) {
+		header := srv.Header(1)
+		header.Set("Origin", "http://evil.example.com")
+		if status := srv.Reject("room-1", 1, header); status != http.StatusForbidden {
+			t.Fatalf("expected 403, got %d", status)
+		}
+	})
+}
+
+func TestWebSocketCallRooms(t *testing.T) {
+	srv := wstest.NewServer(t)
+
+	t.Run("ended call", func(t *testing.T) {
+		// A client reconnecting after the call was ended stays out
+		roomID := srv.Call(1, "ended")
+		if status := srv.Reject(roomID, 2, srv.Header(2)); status != http.StatusConflict {
+			t.Fatalf("expected 409, got %d", status)
+		}
+	})
+
+	t.Run("unknown call", func(t *testing.T) {
+		if status := srv.Reject("999", 2, srv.Header(2)); status != http.StatusNotFound {
+			t.Fatalf("expected 404, got %d", status)
+		}
+	})
+
+	t.Run("active call", func(t *testing.T) {
+		roomID := srv.Call(1, "active")
+		alice := srv.Dial(roomID, 1)
+		bob := srv.Dial(roomID, 2)
+		wstest.AssertFanOut(t, alice, "hello", alice, bob)
+	})
+}
+
+func TestWebSocketGracefulShutdown(t *testing.T) {
+	srv := wstest.NewServer(t)
+
+	alice := srv.Dial("room-1", 1)
+	bob := srv.Dial("room-2", 2)
+
+	ctx, cancel := context.WithTimeout(context.Background(), wstest.DefaultWait)
+	defer cancel()
+	if err := srv.Hub.Shutdown(ctx); err != nil {
+		t.Fatalf("shutdown did not drain clients: %v", err)
+	}
+
+	for _, c := range []*wstest.Conn{alice, bob} {
+		msg := c.Expect()
+		if msg.Type != ws.MessageTypeSystem {
+			t.Fatalf("expected a system message, got %q", msg.Type)
+		}
+		data, ok := msg.Data.(map[string]interface{})
+		if !ok || data["event"] != ws.SystemEventServerRestarting || data["reconnect_after_ms"] == nil {
+			t.Fatalf("unexpected shutdown notice: %+v", msg.Data)
+		}
+
+		var closeErr *websocket.CloseError
+		if err := c.ExpectClosed(); !errors.As(err, &closeErr) || closeErr.Code != websocket.CloseGoingAway {
+			t.Fatalf("expected close code %d, got %v", websocket.CloseGoingAway, err)
+		}
+	}
+
+	if status := srv.Reject("room-1", 3, srv.Header(3)); status != http.StatusServiceUnavailable {
+		t.Fatalf("expected new connections to be refused with 503, got %d", status)
+	}
+}
+
+// expectDisconnected asserts that c gets a system notice with event and is
+// then closed with code
+func expectDisconnected(t *testing.T, c *wstest.Conn, event string, code int) {
+	t.Helper()
+
+	msg := c.Expect()
+	data, ok := msg.Data.(map[string]interface{})
+	if msg.Type != ws.MessageTypeSystem || !ok || data["event"] != event {
+		t.Fatalf("expected a %q system message, got %+v", event, msg)
+	}
+
+	var closeErr *websocket.CloseError
+	if err := c.ExpectClosed(); !errors.As(err, &closeErr) || closeErr.Code != code {
+		t.Fatalf("expected close code %d, got %v", code, err)
+	}
+}
+
+func TestWebSocketCloseRoom(t *testing.T) {
+	srv := wstest.NewServer(t)
+
+	ending, other := srv.Call(1, "active"), srv.Call(3, "active")
+	alice := srv.Dial(ending, 1)
+	bob := srv.Dial(ending, 2)
+	carol := srv.Dial(other, 3)
+
+	if n := srv.Hub.CloseRoom(ending, "call ended"); n != 2 {
+		t.Fatalf("expected 2 clients disconnected, got %d", n)
+	}
+	expectDisconnected(t, alice, ws.SystemEventRoomClosed, websocket.CloseNormalClosure)
+	expectDisconnected(t, bob, ws.SystemEventRoomClosed, websocket.CloseNormalClosure)
+	srv.WaitForRoomClosed(ending)
+
+	wstest.AssertFanOut(t, carol, "unaffected", carol)
+}
+
+func TestWebSocketDisconnectUser(t *testing.T) {
+	srv := wstest.NewServer(t)
+
+	first := srv.Dial("room-1", 1)
+	second := srv.Dial("room-2", 1)
+	bob := srv.Dial("room-1", 2)
+
+	if n := srv.Hub.DisconnectUser(1, "account disabled"); n != 2 {
+		t.Fatalf("expected 2 clients disconnected, got %d", n)
+	}
+	expectDisconnected(t, first, ws.SystemEventDisconnected, websocket.ClosePolicyViolation)
+	expectDisconnected(t, second, ws.SystemEventDisconnected, websocket.ClosePolicyViolation)
+
+	srv.WaitForClients("room-1", 1)
+	wstest.AssertFanOut(t, bob, "still here", bob)
+}
+
+func TestWebSocketConnectsAsTokenUser(t *testing.T) {
+	srv := wstest.NewServer(t)
+
+	// User 1 asking to connect as user 2 would escape DisconnectUser(1)
+	if status := srv.Reject("room-1", 2, srv.Header(1)); status != http.StatusForbidden {
+		t.Fatalf("expected a connection as another user to be refused with 403, got %d", status)
+	}
+
+	alice := srv.Dial("room-1", 1)
+	bob := srv.Dial("room-1", 2)
+	if n := srv.Hub.DisconnectUser(1, "account disabled"); n != 1 {
+		t.Fatalf("expected 1 client disconnected, got %d", n)
+	}
+	expectDisconnected(t, alice, ws.SystemEventDisconnected, websocket.ClosePolicyViolation)
+	wstest.AssertFanOut(t, bob, "still here", bob)
+}
+
+func TestWebSocketDisconnectSession(t *testing.T) {
+	srv := wstest.NewServer(t)
+
+	phone := srv.Session(1)
+	first := srv.DialSession("room-1", 1, phone)
+	second := srv.DialSession("room-2", 1, phone)
+	laptop := srv.Dial("room-1", 1)
+
+	if n := srv.Hub.DisconnectSession(phone, "session revoked"); n != 2 {
+		t.Fatalf("expected 2 clients disconnected, got %d", n)
+	}
+	expectDisconnected(t, first, ws.SystemEventDisconnected, websocket.ClosePolicyViolation)
+	expectDisconnected(t, second, ws.SystemEventDisconnected, websocket.ClosePolicyViolation)
+
+	srv.WaitForClients("room-1", 1)
+	wstest.AssertFanOut(t, laptop, "still here", laptop)
+}
+
+func TestWebSocketRevokedAPIKey(t *testing.T) {
+	srv := wstest.NewServer(t)
+	srv.User(1)
+
+	secret, hash, prefix, err := auth.NewAPIKey()
+	if err != nil {
+		t.Fatalf("NewAPIKey: %v", err)
+	}
+	key := &models.APIKey{UserID: 1, Name: "bot", KeyHash: hash, Prefix: prefix, Scopes: "calls:write", CreatedAt: time.Now()}
+	if err := srv.Repos.APIKeys.Create(t.Context(), key); err != nil {
+		t.Fatalf("failed to create API key: %v", err)
+	}
+
+	header := http.Header{}
+	header.Set("X-API-Key", secret)
+	header.Set("Origin", wstest.DefaultOrigin)
+	bot := srv.DialWithHeader("room-1", 1, header)
+	srv.WaitForClients("room-1", 1)
+	laptop := srv.Dial("room-1", 1)
+
+	req, _ := http.NewRequest(http.MethodDelete, srv.HTTP.URL+"/api/users/me/api-keys/"+strconv.FormatUint(uint64(key.ID), 10), nil)
+	req.Header = srv.Header(1)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("failed to revoke API key: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 revoking the key, got %d", resp.StatusCode)
+	}
+
+	expectDisconnected(t, bot, ws.SystemEventDisconnected, websocket.ClosePolicyViolation)
+	srv.WaitForClients("room-1", 1)
+	wstest.AssertFanOut(t, laptop, "still here", laptop)
+}
+
+func TestWebSocketRevokedSession(t *testing.T) {
+	srv := wstest.NewServer(t)
+
+	session := srv.Session(1)
+	if err := srv.Repos.Sessions.Revoke(t.Context(), 1, session, time.Now()); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+	if status := srv.Reject("room-1", 1, srv.SessionHeader(1, session)); status != http.StatusUnauthorized {
+		t.Fatalf("expected a revoked session to be refused with 401, got %d", status)
+	}
+}
+
+func TestWebSocketRoomCapacity(t *testing.T) {
+	srv := wstest.NewServer(t, wstest.WithConfig(&config.WebSocketConfig{
+		MaxClientsPerRoom: 2,
+	}))
+
+	srv.Dial("room-1", 1)
+	srv.Dial("room-1", 2)
+	if status := srv.Reject("room-1", 3, srv.Header(3)); status != http.StatusConflict {
+		t.Fatalf("expected a full room to refuse with 409, got %d", status)
+	}
+	srv.Dial("room-2", 3)
+
+	// Raising the limit at runtime admits the waiting user
+	srv.Handler.SetConfig(&config.WebSocketConfig{
+		MaxClientsPerRoom: 3,
+	})
+	srv.Dial("room-1", 3)
+}
+
+func TestWebSocketMessageRateLimit(t *testing.T) {
+	srv := wstest.NewServer(t, wstest.WithConfig(&config.WebSocketConfig{
+		MessageRateLimit: 1,
+		MessageBurst:     2,
+	}))
+
+	alice := srv.Dial("room-1", 1)
+	bob := srv.Dial("room-1", 2)
+
+	for i := 0; i < 4; i++ {
+		alice.Send(ws.MessageTypeChat, "spam")
+	}
+
+	// The burst goes through, then alice alone is told once that she is limited
+	for i := 0; i < 2; i++ {
+		if msg := bob.Expect(); msg.Type != ws.MessageTypeChat {
+			t.Fatalf("expected chat message %d, got %q", i, msg.Type)
+		}
+		alice.Expect()
+	}
+	msg := alice.Expect()
+	data, ok := msg.Data.(map[string]interface{})
+	if msg.Type != ws.MessageTypeSystem || !ok || data["event"] != ws.SystemEventRateLimited {
+		t.Fatalf("expected a rate limit notice, got %+v", msg)
+	}
+	wstest.AssertIsolated(t, 100*time.Millisecond, alice, bob)
+}
+
+func TestWebSocketUnknownMessageTypeMetrics(t *testing.T) {
+	srv := wstest.NewServer(t)
+
+	alice := srv.Dial("room-1", 1)
+	bob := srv.Dial("room-1", 2)
+
+	alice.Send(ws.MessageType("made-up-"+strconv.FormatInt(time.Now().UnixNano(), 10)), "hi")
+	bob.Expect()
+	alice.Expect()
+
+	// Whatever type a client sends, the metrics only ever carry the known labels
+	known := map[string]bool{"chat": true, "presence": true, "system": true, "unknown": true}
+	for _, vec := range []*prometheus.CounterVec{metrics.WSMessagesReceived, metrics.WSMessagesSent} {
+		for _, label := range typeLabels(t, vec) {
+			if !known[label] {
+				t.Errorf("unexpected message type label %q", label)
+			}
+		}
+	}
+}
+
+// typeLabels returns the "type" label of every series in vec
+func typeLabels(t *testing.T, vec *prometheus.CounterVec) []string {
+	t.Helper()
+	ch := make(chan prometheus.Metric, 16)
+	go func() {
+		vec.Collect(ch)
+		close(ch)
+	}()
+
+	var labels []string
+	for m := range ch {
+		var out dto.Metric
+		if err := m.Write(&out); err != nil {
+			t.Fatalf("failed to read metric: %v", err)
+		}
+		for _, pair := range out.GetLabel() {
+			if pair.GetName() == "type" {
+				labels = append(labels, pair.GetValue())
+			}
+		}
+	}
+	return labels
+}
+
+func TestWebSocketReloadAllowedOrigins(t *testing.T) {
+	srv := wstest.NewServer(t)
+	const newOrigin = "https://app.example.com"
+
+	header := srv.Header(1)
+	header.Set("Origin", newOrigin)
+	if status := srv.Reject("room-1", 1, header); status != http.StatusForbidden {
+		t.Fatalf("expected 403 before reload, got %d", status)
+	}
+
+	if err := srv.Origins.Update(config.CORSConfig{
+		AllowedOrigins: []string{wstest.DefaultOrigin, newOrigin},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	srv.DialWithHeader("room-1", 1, header)
+}
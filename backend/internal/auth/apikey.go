@@ -0,0 +1,59 @@
+package auth
+
+import (
+	"slices"
+	"strings"
+)
+
+// APIKeyPrefix starts every API key, so keys are told apart from JWTs and
+// are easy to spot in leaked logs or commits
+const APIKeyPrefix = "aak_"
+
+// apiKeyDisplayLength is how much of a key is kept in clear to identify it
+const apiKeyDisplayLength = len(APIKeyPrefix) + 6
+
+// Scope limits what an API key may be used for. Requests authenticated with
+// a JWT are not limited by scopes.
+type Scope string
+
+const (
+	// ScopeProfileRead allows reading user profiles
+	ScopeProfileRead Scope = "profile:read"
+
+	// ScopeCallsRead allows listing calls and room participants
+	ScopeCallsRead Scope = "calls:read"
+
+	// ScopeCallsWrite allows creating, joining and leaving calls and
+	// connecting to the WebSocket
+	ScopeCallsWrite Scope = "calls:write"
+
+	// ScopeAdmin allows the admin endpoints, within the owner's role
+	ScopeAdmin Scope = "admin"
+)
+
+// Scopes returns every scope an API key can be granted
+func Scopes() []Scope {
+	return []Scope{ScopeProfileRead, ScopeCallsRead, ScopeCallsWrite, ScopeAdmin}
+}
+
+// ParseScope returns the scope named s
+func ParseScope(s string) (Scope, bool) {
+	scope := Scope(s)
+	return scope, slices.Contains(Scopes(), scope)
+}
+
+// NewAPIKey returns a new API key, the hash to store in its place and the
+// start of the key to show in listings
+func NewAPIKey() (key, hash, display string, err error) {
+	token, _, err := NewOpaqueToken()
+	if err != nil {
+		return "", "", "", err
+	}
+	key = APIKeyPrefix + token
+	return key, HashOpaqueToken(key), key[:apiKeyDisplayLength], nil
+}
+
+// IsAPIKey reports whether a bearer credential is an API key rather than a JWT
+func IsAPIKey(credential string) bool {
+	return strings.HasPrefix(credential, APIKeyPrefix)
+}
@@ -2,7 +2,6 @@ package auth
 
 import (
 	"errors"
-	"os"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -10,22 +9,45 @@ import (
 
 var (
 	ErrInvalidToken = errors.New("invalid token")
-	jwtSecret       = []byte(getEnvOrDefault("JWT_SECRET", "your-secret-key"))
+	jwtSecret       = []byte("your-secret-key")
+	tokenTTL        = 24 * time.Hour
 )
 
+// Configure sets the signing secret and lifetime used for all tokens
+func Configure(secret string, ttl time.Duration) {
+	jwtSecret = []byte(secret)
+	tokenTTL = ttl
+}
+
 type Claims struct {
 	UserID uint   `json:"user_id"`
 	Email  string `json:"email"`
+
+	// Role is the user's role when the token was issued; tokens from before
+	// roles existed have none and are treated as RoleUser
+	Role Role `json:"role,omitempty"`
+
+	// SessionID is the login session the token belongs to; revoking the
+	// session invalidates the token
+	SessionID uint `json:"sid,omitempty"`
 	jwt.RegisteredClaims
 }
 
-// GenerateToken creates a new JWT token for a user
-func GenerateToken(userID uint, email string) (string, error) {
+// TokenTTL returns how long issued tokens are valid
+func TokenTTL() time.Duration {
+	return tokenTTL
+}
+
+// GenerateToken creates a new JWT token for a user with the given role,
+// belonging to a login session
+func GenerateToken(userID uint, email string, role Role, sessionID uint) (string, error) {
 	claims := Claims{
-		UserID: userID,
-		Email:  email,
+		UserID:    userID,
+		Email:     email,
+		Role:      role,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(tokenTTL)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
@@ -53,10 +75,3 @@ func ValidateToken(tokenString string) (*Claims, error) {
 
 	return nil, ErrInvalidToken
 }
-
-func getEnvOrDefault(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
-	}
-	return defaultValue
-} 
\ No newline at end of file
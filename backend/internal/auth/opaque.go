@@ -0,0 +1,27 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+)
+
+// NewOpaqueToken returns a random URL-safe token for one-time links, together
+// with the hash to store in its place
+func NewOpaqueToken() (token, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", fmt.Errorf("failed to generate token: %v", err)
+	}
+	token = base64.RawURLEncoding.EncodeToString(b)
+	return token, HashOpaqueToken(token), nil
+}
+
+// HashOpaqueToken returns the hex SHA-256 of token. The tokens are random, so
+// an unsalted fast hash is enough to keep a database leak from exposing them.
+func HashOpaqueToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,70 @@
+package auth
+
+import (
+	"slices"
+)
+
+// Role is a user's role; each role grants a fixed set of permissions
+type Role string
+
+const (
+	RoleUser      Role = "user"
+	RoleModerator Role = "moderator"
+	RoleAdmin     Role = "admin"
+)
+
+// Permission allows one kind of privileged action
+type Permission string
+
+const (
+	// PermissionViewUsers allows listing every account
+	PermissionViewUsers Permission = "users:read"
+
+	// PermissionManageUsers allows disabling accounts and changing roles
+	PermissionManageUsers Permission = "users:write"
+
+	// PermissionModerateCalls allows ending any call
+	PermissionModerateCalls Permission = "calls:moderate"
+
+	// PermissionViewRooms allows inspecting any WebSocket room
+	PermissionViewRooms Permission = "rooms:read"
+
+	// PermissionViewDiagnostics allows the /debug endpoints
+	PermissionViewDiagnostics Permission = "debug:read"
+)
+
+// rolePermissions lists what each role may do; ordinary users have no
+// privileged permissions
+var rolePermissions = map[Role][]Permission{
+	RoleUser:      nil,
+	RoleModerator: {PermissionViewUsers, PermissionModerateCalls, PermissionViewRooms},
+	RoleAdmin: {
+		PermissionViewUsers,
+		PermissionManageUsers,
+		PermissionModerateCalls,
+		PermissionViewRooms,
+		PermissionViewDiagnostics,
+	},
+}
+
+// Roles returns every role from least to most privileged
+func Roles() []Role {
+	return []Role{RoleUser, RoleModerator, RoleAdmin}
+}
+
+// ParseRole returns the role named s
+func ParseRole(s string) (Role, bool) {
+	role := Role(s)
+	_, ok := rolePermissions[role]
+	return role, ok
+}
+
+// Can reports whether the role grants permission. Unknown roles grant nothing.
+func (r Role) Can(permission Permission) bool {
+	return slices.Contains(rolePermissions[r], permission)
+}
+
+// Permissions returns the permissions the role grants
+func (r Role) Permissions() []Permission {
+	return slices.Clone(rolePermissions[r])
+}
@@ -0,0 +1,117 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+)
+
+const (
+	// totpPeriod and totpSkew accept the current code and the ones either side
+	// of it, to allow for clock drift
+	totpPeriod = 30
+	totpSkew   = 1
+
+	recoveryCodeCount = 10
+
+	// recoveryCodeLength is the number of characters in a recovery code, about
+	// 79 bits of randomness with the alphabet below
+	recoveryCodeLength = 16
+	recoveryGroupSize  = 4
+
+	recoveryPurpose = "recovery_code"
+
+	// recoveryAlphabet leaves out characters that are easy to confuse
+	recoveryAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+)
+
+// NewTOTPKey generates a TOTP secret for account and the otpauth:// URI
+// authenticator apps read from a QR code
+func NewTOTPKey(issuer, account string) (secret, uri string, err error) {
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      issuer,
+		AccountName: account,
+		Period:      totpPeriod,
+		Digits:      otp.DigitsSix,
+		Algorithm:   otp.AlgorithmSHA1,
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("failed to generate TOTP key: %v", err)
+	}
+	return key.Secret(), key.URL(), nil
+}
+
+// MatchTOTP checks code against secret at now and returns the time step it
+// belongs to. Callers reject steps at or before the last one used so a code
+// cannot be replayed.
+func MatchTOTP(secret, code string, now time.Time) (int64, bool) {
+	code = strings.TrimSpace(code)
+	step := now.Unix() / totpPeriod
+	for skew := int64(-totpSkew); skew <= totpSkew; skew++ {
+		at := time.Unix((step+skew)*totpPeriod, 0)
+		expected, err := totp.GenerateCodeCustom(secret, at, totp.ValidateOpts{
+			Period:    totpPeriod,
+			Digits:    otp.DigitsSix,
+			Algorithm: otp.AlgorithmSHA1,
+		})
+		if err == nil && expected == code {
+			return step + skew, true
+		}
+	}
+	return 0, false
+}
+
+// IsTOTPCode reports whether s looks like a six digit TOTP code rather than a
+// recovery code
+func IsTOTPCode(s string) bool {
+	s = strings.TrimSpace(s)
+	if len(s) != 6 {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// NewRecoveryCodes returns single-use codes formatted as xxxx-xxxx-xxxx-xxxx,
+// and the hashes to store in their place
+func NewRecoveryCodes() (codes, hashes []string, err error) {
+	for i := 0; i < recoveryCodeCount; i++ {
+		var code strings.Builder
+		for j := 0; j < recoveryCodeLength; j++ {
+			n, err := rand.Int(rand.Reader, big.NewInt(int64(len(recoveryAlphabet))))
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to generate recovery code: %v", err)
+			}
+			if j > 0 && j%recoveryGroupSize == 0 {
+				code.WriteByte('-')
+			}
+			code.WriteByte(recoveryAlphabet[n.Int64()])
+		}
+		codes = append(codes, code.String())
+		hashes = append(hashes, HashRecoveryCode(code.String()))
+	}
+	return codes, hashes, nil
+}
+
+// HashRecoveryCode hashes a recovery code as typed by the user, ignoring case,
+// spaces and dashes. Recovery codes are short enough that a fast unkeyed
+// hash could be brute-forced from a database leak, so it is an HMAC keyed
+// with a key derived from the JWT secret, which is not kept in the database.
+func HashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	mac := hmac.New(sha256.New, PurposeKey(recoveryPurpose))
+	mac.Write([]byte(code))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,150 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ayush/accountability-app/backend/internal/testutil/totptest"
+)
+
+func TestMatchTOTPSkewWindow(t *testing.T) {
+	secret, _, err := NewTOTPKey("Accountability App", "alice@example.com")
+	if err != nil {
+		t.Fatalf("NewTOTPKey: %v", err)
+	}
+	// In the middle of a step, so only the offsets below move across steps
+	now := time.Unix(1_700_000_000/totpPeriod*totpPeriod+totpPeriod/2, 0)
+	step := now.Unix() / totpPeriod
+
+	tests := []struct {
+		name  string
+		steps int64
+		match bool
+	}{
+		{"current step", 0, true},
+		{"one step behind", -1, true},
+		{"one step ahead", 1, true},
+		{"two steps behind", -2, false},
+		{"two steps ahead", 2, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code := totptest.Code(t, secret, now.Add(time.Duration(tt.steps*totpPeriod)*time.Second))
+			got, ok := MatchTOTP(secret, code, now)
+			if ok != tt.match {
+				t.Fatalf("expected match %v, got %v", tt.match, ok)
+			}
+			if ok && got != step+tt.steps {
+				t.Errorf("expected step %d, got %d", step+tt.steps, got)
+			}
+		})
+	}
+}
+
+func TestMatchTOTPTrimsSpaces(t *testing.T) {
+	secret, _, err := NewTOTPKey("Accountability App", "alice@example.com")
+	if err != nil {
+		t.Fatalf("NewTOTPKey: %v", err)
+	}
+	now := time.Now()
+
+	if _, ok := MatchTOTP(secret, " "+totptest.Code(t, secret, now)+"\n", now); !ok {
+		t.Error("expected a code with surrounding spaces to match")
+	}
+	if _, ok := MatchTOTP(secret, "", now); ok {
+		t.Error("expected an empty code not to match")
+	}
+}
+
+func TestIsTOTPCode(t *testing.T) {
+	tests := []struct {
+		input string
+		want  bool
+	}{
+		{"123456", true},
+		{" 123456 ", true},
+		{"000000", true},
+		{"12345", false},
+		{"1234567", false},
+		{"12345a", false},
+		{"123 456", false},
+		{"abcd-efgh-jkmn-pqrs", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsTOTPCode(tt.input); got != tt.want {
+			t.Errorf("IsTOTPCode(%q) = %v, want %v", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestNewRecoveryCodes(t *testing.T) {
+	codes, hashes, err := NewRecoveryCodes()
+	if err != nil {
+		t.Fatalf("NewRecoveryCodes: %v", err)
+	}
+	if len(codes) != recoveryCodeCount || len(hashes) != recoveryCodeCount {
+		t.Fatalf("expected %d codes and hashes, got %d and %d", recoveryCodeCount, len(codes), len(hashes))
+	}
+
+	seen := map[string]bool{}
+	for i, code := range codes {
+		if len(code) != 19 || code[4] != '-' || code[9] != '-' || code[14] != '-' {
+			t.Errorf("code %q is not formatted as xxxx-xxxx-xxxx-xxxx", code)
+		}
+		for _, r := range strings.ReplaceAll(code, "-", "") {
+			if !strings.ContainsRune(recoveryAlphabet, r) {
+				t.Errorf("code %q contains %q, which is not in the recovery alphabet", code, r)
+			}
+		}
+		if IsTOTPCode(code) {
+			t.Errorf("code %q would be taken for a TOTP code", code)
+		}
+		if hashes[i] != HashRecoveryCode(code) {
+			t.Errorf("hash %d does not match its code", i)
+		}
+		if seen[code] {
+			t.Errorf("code %q was generated twice", code)
+		}
+		seen[code] = true
+	}
+}
+
+func TestHashRecoveryCodeNormalises(t *testing.T) {
+	want := HashRecoveryCode("abcd-efgh-jkmn-pqrs")
+
+	for _, typed := range []string{
+		"abcdefghjkmnpqrs",
+		"ABCD-EFGH-JKMN-PQRS",
+		"AbCd eFgH jKmN pQrS",
+		" abcd - efgh - jkmn - pqrs ",
+		"ab-cd-ef-gh-jk-mn-pq-rs",
+	} {
+		if got := HashRecoveryCode(typed); got != want {
+			t.Errorf("HashRecoveryCode(%q) differs from the hash of abcd-efgh-jkmn-pqrs", typed)
+		}
+	}
+
+	if HashRecoveryCode("abcd-efgh-jkmn-pqrt") == want {
+		t.Error("expected a different code to hash differently")
+	}
+}
+
+func TestHashRecoveryCodeIsKeyed(t *testing.T) {
+	defer Configure(string(jwtSecret), tokenTTL)
+
+	Configure("first-secret", time.Hour)
+	first := HashRecoveryCode("abcd-efgh-jkmn-pqrs")
+	Configure("second-secret", time.Hour)
+	second := HashRecoveryCode("abcd-efgh-jkmn-pqrs")
+
+	if first == second {
+		t.Error("expected the hash to depend on the secret")
+	}
+	if first == HashOpaqueToken("abcdefghjkmnpqrs") {
+		t.Error("expected a keyed hash, not a plain SHA-256")
+	}
+}
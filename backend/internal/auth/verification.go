@@ -0,0 +1,35 @@
+package auth
+
+import (
+	"time"
+)
+
+const (
+	verificationPurpose = "email_verification"
+	challengePurpose    = "two_factor_challenge"
+)
+
+// NewEmailVerificationToken creates a signed token confirming that userID
+// owns email, valid for ttl. It is bound to the address, so changing the
+// email invalidates links sent to the old one.
+func NewEmailVerificationToken(userID uint, email string, ttl time.Duration) (string, error) {
+	return newPurposeToken(verificationPurpose, userID, email, ttl)
+}
+
+// ParseEmailVerificationToken checks a verification token and returns the
+// user and email it was issued for
+func ParseEmailVerificationToken(token string) (uint, string, error) {
+	return parsePurposeToken(verificationPurpose, token)
+}
+
+// NewTwoFactorChallenge creates the token a user who passed the password
+// check exchanges, together with a second factor, for an access token
+func NewTwoFactorChallenge(userID uint, email string, ttl time.Duration) (string, error) {
+	return newPurposeToken(challengePurpose, userID, email, ttl)
+}
+
+// ParseTwoFactorChallenge checks a challenge token and returns the user and
+// email it was issued for
+func ParseTwoFactorChallenge(token string) (uint, string, error) {
+	return parsePurposeToken(challengePurpose, token)
+}
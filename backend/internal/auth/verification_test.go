@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTwoFactorChallengeRoundTrip(t *testing.T) {
+	token, err := NewTwoFactorChallenge(7, "alice@example.com", time.Minute)
+	if err != nil {
+		t.Fatalf("NewTwoFactorChallenge: %v", err)
+	}
+
+	userID, email, err := ParseTwoFactorChallenge(token)
+	if err != nil {
+		t.Fatalf("ParseTwoFactorChallenge: %v", err)
+	}
+	if userID != 7 || email != "alice@example.com" {
+		t.Errorf("expected user 7 and alice@example.com, got %d and %q", userID, email)
+	}
+}
+
+func TestTwoFactorChallengeExpires(t *testing.T) {
+	token, err := NewTwoFactorChallenge(7, "alice@example.com", -time.Minute)
+	if err != nil {
+		t.Fatalf("NewTwoFactorChallenge: %v", err)
+	}
+	if _, _, err := ParseTwoFactorChallenge(token); err == nil {
+		t.Error("expected an expired challenge to be rejected")
+	}
+}
+
+func TestTokensAreNotInterchangeable(t *testing.T) {
+	access, err := GenerateToken(7, "alice@example.com", RoleUser, 1)
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+	challenge, err := NewTwoFactorChallenge(7, "alice@example.com", time.Minute)
+	if err != nil {
+		t.Fatalf("NewTwoFactorChallenge: %v", err)
+	}
+	verification, err := NewEmailVerificationToken(7, "alice@example.com", time.Minute)
+	if err != nil {
+		t.Fatalf("NewEmailVerificationToken: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		parse func(string) error
+		token string
+	}{
+		{"challenge as access token", validate, challenge},
+		{"verification as access token", validate, verification},
+		{"access token as challenge", parseChallenge, access},
+		{"verification as challenge", parseChallenge, verification},
+		{"access token as verification", parseVerification, access},
+		{"challenge as verification", parseVerification, challenge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.parse(tt.token); err == nil {
+				t.Fatal("expected the token to be rejected")
+			}
+		})
+	}
+}
+
+func validate(token string) error {
+	_, err := ValidateToken(token)
+	return err
+}
+
+func parseChallenge(token string) error {
+	_, _, err := ParseTwoFactorChallenge(token)
+	return err
+}
+
+func parseVerification(token string) error {
+	_, _, err := ParseEmailVerificationToken(token)
+	return err
+}
@@ -0,0 +1,31 @@
+package config
+
+// PasswordResetConfig holds the password reset link settings
+type PasswordResetConfig struct {
+	// URL is the frontend page that completes the reset; the token is added
+	// as the token query parameter
+	URL             string `yaml:"url"`
+	TokenTTLMinutes int    `yaml:"token_ttl_minutes"`
+}
+
+// EmailVerificationConfig holds the email verification settings
+type EmailVerificationConfig struct {
+	// Required blocks creating and joining calls until the address is verified
+	Required bool `yaml:"required"`
+
+	// URL is where the link in the email points; the token is added as the
+	// token query parameter. It can be the API's /api/users/verify endpoint or
+	// a frontend page that calls it.
+	URL           string `yaml:"url"`
+	TokenTTLHours int    `yaml:"token_ttl_hours"`
+}
+
+// TwoFactorConfig holds the TOTP two-factor authentication settings
+type TwoFactorConfig struct {
+	// Issuer names the account in authenticator apps
+	Issuer string `yaml:"issuer"`
+
+	// ChallengeTTLSeconds is how long a user has to enter their code after
+	// passing the password check
+	ChallengeTTLSeconds int `yaml:"challenge_ttl_seconds"`
+}
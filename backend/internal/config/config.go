@@ -1,93 +1,151 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
+// Config is the complete application configuration
 type Config struct {
-	Database struct {
-		Host     string `yaml:"host"`
-		Port     int    `yaml:"port"`
-		User     string `yaml:"user"`
-		Password string `yaml:"password"`
-		Name     string `yaml:"name"`
-		SSLMode  string `yaml:"sslmode"`
-	} `yaml:"database"`
-
-	JWT struct {
-		Secret          string `yaml:"secret"`
-		ExpirationHours int    `yaml:"expiration_hours"`
-	} `yaml:"jwt"`
-
-	WebSocket struct {
-		AllowedOrigins []string `yaml:"allowed_origins"`
-	} `yaml:"websocket"`
-
-	Server struct {
-		Port        int    `yaml:"port"`
-		Environment string `yaml:"environment"`
-	} `yaml:"server"`
-}
-
-var globalConfig *Config
-
-// LoadConfig loads the configuration from the config file
-func LoadConfig() (*Config, error) {
-	if globalConfig != nil {
-		return globalConfig, nil
-	}
+	Server            ServerConfig            `yaml:"server"`
+	Database          DatabaseConfig          `yaml:"database"`
+	JWT               JWTConfig               `yaml:"jwt"`
+	WebSocket         WebSocketConfig         `yaml:"websocket"`
+	CORS              CORSConfig              `yaml:"cors"`
+	RateLimit         RateLimitConfig         `yaml:"rate_limit"`
+	Mail              MailConfig              `yaml:"mail"`
+	PasswordReset     PasswordResetConfig     `yaml:"password_reset"`
+	EmailVerification EmailVerificationConfig `yaml:"email_verification"`
+	TwoFactor         TwoFactorConfig         `yaml:"two_factor"`
+	OIDC              OIDCConfig              `yaml:"oidc"`
+	Storage           StorageConfig           `yaml:"storage"`
+	Tracing           TracingConfig           `yaml:"tracing"`
+
+	// path is the file the configuration was read from, empty when none was found
+	path string
+}
 
-	// Try to find config file in different locations
-	configPaths := []string{
-		"config.yaml",
-		"../config.yaml",
-		"../../config.yaml",
+// defaultPaths are searched in order when no config file is given explicitly
+var defaultPaths = []string{
+	"config.yaml",
+	"../config.yaml",
+	"../../config.yaml",
+}
+
+// Default returns the configuration used for any field not set by the file or environment
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Port:                   8080,
+			MetricsPort:            9091,
+			Environment:            "development",
+			ShutdownTimeoutSeconds: 15,
+		},
+		Database: DatabaseConfig{
+			Host:    "localhost",
+			Port:    5432,
+			User:    "postgres",
+			Name:    "videocall",
+			SSLMode: "disable",
+		},
+		JWT: JWTConfig{
+			Secret:          DefaultJWTSecret,
+			ExpirationHours: 24,
+		},
+		WebSocket: *DefaultWebSocketConfig(),
+		CORS:      DefaultCORSConfig(),
+		RateLimit: DefaultRateLimitConfig(),
+		Mail: MailConfig{
+			Driver: "log",
+			From:   "Accountability App <no-reply@localhost>",
+			SMTP:   SMTPConfig{Port: 587},
+		},
+		PasswordReset: PasswordResetConfig{
+			URL:             "http://localhost:3000/reset-password",
+			TokenTTLMinutes: 60,
+		},
+		EmailVerification: EmailVerificationConfig{
+			URL:           "http://localhost:8080/api/users/verify",
+			TokenTTLHours: 48,
+		},
+		TwoFactor: TwoFactorConfig{
+			Issuer:              "Accountability App",
+			ChallengeTTLSeconds: 300,
+		},
+		OIDC: OIDCConfig{
+			CallbackBaseURL: "http://localhost:8080",
+			FrontendURL:     "http://localhost:3000/login/callback",
+			StateTTLSeconds: 600,
+		},
+		Storage: StorageConfig{
+			Driver:         "local",
+			PublicURL:      "http://localhost:8080/media",
+			Dir:            "media",
+			S3:             S3Config{Region: "us-east-1"},
+			MaxAvatarBytes: 5 << 20,
+		},
+		Tracing: TracingConfig{
+			Exporter:    "stdout",
+			ServiceName: "accountability-backend",
+			SampleRatio: 1.0,
+		},
 	}
+}
 
-	var configData []byte
-	var err error
+// Load builds the configuration from the defaults, the config file and APP_* environment
+// variables, in increasing order of precedence. An empty path searches the default
+// locations and carries on without a file if none exists; an explicit path must exist.
+// The result is not validated, call Validate before using it.
+func Load(path string) (*Config, error) {
+	cfg := Default()
 
-	for _, path := range configPaths {
-		configData, err = os.ReadFile(path)
-		if err == nil {
-			break
+	data, found, err := readConfigFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if data != nil {
+		if err := yaml.Unmarshal(data, cfg); err != nil {
+			return nil, fmt.Errorf("failed to parse config file %s: %v", found, err)
 		}
+		cfg.path = found
 	}
 
-	if err != nil {
-		return nil, fmt.Errorf("failed to read config file: %v", err)
+	if err := applyEnv(cfg, os.LookupEnv); err != nil {
+		return nil, err
 	}
 
-	config := &Config{}
-	if err := yaml.Unmarshal(configData, config); err != nil {
-		return nil, fmt.Errorf("failed to parse config file: %v", err)
-	}
+	return cfg, nil
+}
 
-	// Override with environment variables if they exist
-	if envHost := os.Getenv("DB_HOST"); envHost != "" {
-		config.Database.Host = envHost
-	}
-	if envPort := os.Getenv("DB_PORT"); envPort != "" {
-		fmt.Sscanf(envPort, "%d", &config.Database.Port)
-	}
-	if envUser := os.Getenv("DB_USER"); envUser != "" {
-		config.Database.User = envUser
-	}
-	if envPassword := os.Getenv("DB_PASSWORD"); envPassword != "" {
-		config.Database.Password = envPassword
-	}
-	if envName := os.Getenv("DB_NAME"); envName != "" {
-		config.Database.Name = envName
+func readConfigFile(path string) ([]byte, string, error) {
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to read config file: %v", err)
+		}
+		return data, path, nil
 	}
-	if envSecret := os.Getenv("JWT_SECRET"); envSecret != "" {
-		config.JWT.Secret = envSecret
+
+	for _, candidate := range defaultPaths {
+		data, err := os.ReadFile(candidate)
+		if err == nil {
+			return data, candidate, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, "", fmt.Errorf("failed to read config file: %v", err)
+		}
 	}
+	return nil, "", nil
+}
 
-	globalConfig = config
-	return config, nil
+// Path returns the config file that was loaded, or an empty string if none was used
+func (c *Config) Path() string {
+	return c.path
 }
 
 // GetDSN returns the database connection string
@@ -109,12 +167,63 @@ func (c *Config) GetDSN() string {
 
 // GetWebSocketConfig returns the WebSocket configuration
 func (c *Config) GetWebSocketConfig() *WebSocketConfig {
-	return &WebSocketConfig{
-		AllowedOrigins: c.WebSocket.AllowedOrigins,
+	ws := c.WebSocket
+	return &ws
+}
+
+// GetCORSConfig returns the origin policy, falling back to the deprecated
+// websocket.allowed_origins when cors.allowed_origins is not set
+func (c *Config) GetCORSConfig() CORSConfig {
+	cors := c.CORS
+	if len(cors.AllowedOrigins) == 0 {
+		cors.AllowedOrigins = c.WebSocket.AllowedOrigins
 	}
+	return cors
 }
 
 // GetServerAddress returns the server address with port
 func (c *Config) GetServerAddress() string {
 	return fmt.Sprintf(":%d", c.Server.Port)
 }
+
+// GetMetricsAddress returns the address of the metrics listener, or "" when
+// metrics are disabled
+func (c *Config) GetMetricsAddress() string {
+	if c.Server.MetricsPort == 0 {
+		return ""
+	}
+	return fmt.Sprintf(":%d", c.Server.MetricsPort)
+}
+
+// GetShutdownTimeout returns how long the server waits for connections to drain on shutdown
+func (c *Config) GetShutdownTimeout() time.Duration {
+	if c.Server.ShutdownTimeoutSeconds <= 0 {
+		return 15 * time.Second
+	}
+	return time.Duration(c.Server.ShutdownTimeoutSeconds) * time.Second
+}
+
+// GetPasswordResetTTL returns how long password reset links stay valid
+func (c *Config) GetPasswordResetTTL() time.Duration {
+	return time.Duration(c.PasswordReset.TokenTTLMinutes) * time.Minute
+}
+
+// GetEmailVerificationTTL returns how long email verification links stay valid
+func (c *Config) GetEmailVerificationTTL() time.Duration {
+	return time.Duration(c.EmailVerification.TokenTTLHours) * time.Hour
+}
+
+// GetTwoFactorChallengeTTL returns how long a two-factor login challenge stays valid
+func (c *Config) GetTwoFactorChallengeTTL() time.Duration {
+	return time.Duration(c.TwoFactor.ChallengeTTLSeconds) * time.Second
+}
+
+// GetOIDCStateTTL returns how long an OpenID Connect login may take at the provider
+func (c *Config) GetOIDCStateTTL() time.Duration {
+	return time.Duration(c.OIDC.StateTTLSeconds) * time.Second
+}
+
+// GetTokenTTL returns how long issued JWTs stay valid
+func (c *Config) GetTokenTTL() time.Duration {
+	return time.Duration(c.JWT.ExpirationHours) * time.Hour
+}
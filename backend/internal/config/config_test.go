@@ -0,0 +1,250 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func lookupFrom(env map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		v, ok := env[key]
+		return v, ok
+	}
+}
+
+func TestApplyEnvOverridesEveryKind(t *testing.T) {
+	cfg := Default()
+	err := applyEnv(cfg, lookupFrom(map[string]string{
+		"APP_SERVER_PORT":               "9090",
+		"APP_DATABASE_MIGRATE_ON_START": "true",
+		"APP_TRACING_SAMPLE_RATIO":      "0.25",
+		"APP_CORS_ALLOWED_ORIGINS":      "https://a.example, https://b.example",
+		"APP_JWT_SECRET":                "from-env",
+	}))
+	if err != nil {
+		t.Fatalf("applyEnv: %v", err)
+	}
+
+	if cfg.Server.Port != 9090 {
+		t.Errorf("server.port = %d, want 9090", cfg.Server.Port)
+	}
+	if !cfg.Database.MigrateOnStart {
+		t.Error("database.migrate_on_start was not set")
+	}
+	if cfg.Tracing.SampleRatio != 0.25 {
+		t.Errorf("tracing.sample_ratio = %g, want 0.25", cfg.Tracing.SampleRatio)
+	}
+	want := []string{"https://a.example", "https://b.example"}
+	if !reflect.DeepEqual(cfg.CORS.AllowedOrigins, want) {
+		t.Errorf("cors.allowed_origins = %v, want %v", cfg.CORS.AllowedOrigins, want)
+	}
+	if cfg.JWT.Secret != "from-env" {
+		t.Errorf("jwt.secret = %q, want from-env", cfg.JWT.Secret)
+	}
+}
+
+func TestApplyEnvLegacyNames(t *testing.T) {
+	cfg := Default()
+	err := applyEnv(cfg, lookupFrom(map[string]string{
+		"DB_HOST":           "legacy-host",
+		"DB_PORT":           "6543",
+		"APP_DATABASE_PORT": "7654",
+	}))
+	if err != nil {
+		t.Fatalf("applyEnv: %v", err)
+	}
+	if cfg.Database.Host != "legacy-host" {
+		t.Errorf("database.host = %q, want legacy-host", cfg.Database.Host)
+	}
+	if cfg.Database.Port != 7654 {
+		t.Errorf("database.port = %d, want the APP_ value to win", cfg.Database.Port)
+	}
+}
+
+func TestApplyEnvReportsAllBadValues(t *testing.T) {
+	err := applyEnv(Default(), lookupFrom(map[string]string{
+		"DB_PORT":                  "five",
+		"APP_TRACING_ENABLED":      "maybe",
+		"APP_TRACING_SAMPLE_RATIO": "half",
+	}))
+
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected a ValidationError, got %v", err)
+	}
+	if len(verr.Problems) != 3 {
+		t.Fatalf("expected 3 problems, got %v", verr.Problems)
+	}
+	if !strings.Contains(err.Error(), "DB_PORT") {
+		t.Errorf("error does not name the bad variable: %v", err)
+	}
+}
+
+func TestDefaultIsValid(t *testing.T) {
+	if err := Default().Validate(); err != nil {
+		t.Fatalf("default config is invalid: %v", err)
+	}
+}
+
+func TestValidateAggregatesProblems(t *testing.T) {
+	cfg := Default()
+	cfg.Server.Port = 0
+	cfg.Database.SSLMode = "sometimes"
+	cfg.JWT.ExpirationHours = 0
+	cfg.CORS.AllowedOrigins = []string{"localhost:3000", "https://*.example.com", "regex:^https://(pr-[0-9]+$"}
+
+	var verr *ValidationError
+	if !errors.As(cfg.Validate(), &verr) {
+		t.Fatal("expected a ValidationError")
+	}
+	if len(verr.Problems) != 5 {
+		t.Fatalf("expected 5 problems, got %d: %v", len(verr.Problems), verr.Problems)
+	}
+}
+
+func TestValidateRejectsDefaultSecretInProduction(t *testing.T) {
+	cfg := Default()
+	cfg.Server.Environment = "production"
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "jwt.secret") {
+		t.Fatalf("expected the default secret to be rejected, got %v", err)
+	}
+
+	cfg.JWT.Secret = strings.Repeat("x", minProductionSecretLength)
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("expected a strong secret to pass, got %v", err)
+	}
+}
+
+func TestValidateMail(t *testing.T) {
+	cfg := Default()
+	cfg.Mail.Driver = "smtp"
+	cfg.Mail.From = "not an address"
+	cfg.PasswordReset.URL = "/reset"
+
+	err := cfg.Validate()
+	for _, want := range []string{"mail.from", "mail.smtp.host", "password_reset.url"} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("expected a problem with %s, got %v", want, err)
+		}
+	}
+}
+
+func TestValidateStorage(t *testing.T) {
+	cfg := Default()
+	cfg.Storage.Driver = "s3"
+	cfg.Storage.MaxAvatarBytes = 0
+	cfg.Storage.S3.Endpoint = "minio:9000"
+
+	err := cfg.Validate()
+	for _, want := range []string{"storage.max_avatar_bytes", "storage.s3.endpoint", "storage.s3.bucket", "storage.s3.access_key_id"} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("expected a problem with %s, got %v", want, err)
+		}
+	}
+}
+
+func TestValidateOIDC(t *testing.T) {
+	cfg := Default()
+	cfg.OIDC.FrontendURL = "/login"
+	cfg.OIDC.Providers = []OIDCProviderConfig{
+		{Name: "google", Issuer: "https://accounts.google.com", ClientID: "app"},
+		{Name: "google", Issuer: "https://accounts.google.com", ClientID: "app"},
+		{Name: "Corp SSO", Issuer: "idp.example.com"},
+	}
+
+	err := cfg.Validate()
+	for _, want := range []string{
+		"oidc.frontend_url",
+		`oidc.providers[1].name "google" is used more than once`,
+		"oidc.providers[2].name",
+		"oidc.providers[2].issuer",
+		"oidc.providers[2].client_id",
+	} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("expected a problem with %s, got %v", want, err)
+		}
+	}
+	if err != nil && strings.Contains(err.Error(), "oidc.providers[0]") {
+		t.Errorf("valid provider reported as invalid: %v", err)
+	}
+}
+
+func TestApplyEnvProviderSecrets(t *testing.T) {
+	cfg := Default()
+	cfg.OIDC.Providers = []OIDCProviderConfig{{Name: "corp-sso", ClientSecret: "from-file"}, {Name: "google"}}
+
+	err := applyEnv(cfg, lookupFrom(map[string]string{"APP_OIDC_CORP_SSO_CLIENT_SECRET": "from-env"}))
+	if err != nil {
+		t.Fatalf("applyEnv: %v", err)
+	}
+	if got := cfg.OIDC.Providers[0].ClientSecret; got != "from-env" {
+		t.Errorf("expected the secret from the environment, got %q", got)
+	}
+	if got := cfg.OIDC.Providers[1].ClientSecret; got != "" {
+		t.Errorf("expected no secret for google, got %q", got)
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	cfg := Default()
+	cfg.Database.Password = "hunter2"
+	cfg.JWT.Secret = "top-secret"
+	cfg.Mail.SMTP.Password = "smtp-pass"
+	cfg.OIDC.Providers = []OIDCProviderConfig{{Name: "google", ClientSecret: "oidc-secret"}}
+
+	out, err := cfg.YAML()
+	if err != nil {
+		t.Fatalf("YAML: %v", err)
+	}
+	for _, secret := range []string{"hunter2", "top-secret", "smtp-pass", "oidc-secret"} {
+		if strings.Contains(string(out), secret) {
+			t.Errorf("rendered config leaks %q:\n%s", secret, out)
+		}
+	}
+	if cfg.JWT.Secret != "top-secret" {
+		t.Error("redaction modified the original config")
+	}
+}
+
+func TestLoadExplicitPath(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "custom.yaml")
+	if err := os.WriteFile(path, []byte("server:\n  port: 7070\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.Server.Port != 7070 {
+		t.Errorf("server.port = %d, want 7070", cfg.Server.Port)
+	}
+	if cfg.Database.Port != 5432 {
+		t.Errorf("database.port = %d, want the default to survive", cfg.Database.Port)
+	}
+	if cfg.Path() != path {
+		t.Errorf("Path() = %q, want %q", cfg.Path(), path)
+	}
+
+	if _, err := Load(filepath.Join(dir, "missing.yaml")); err == nil {
+		t.Fatal("expected an error for a missing explicit config file")
+	}
+}
+
+func TestGetCORSConfigFallsBackToWebSocketOrigins(t *testing.T) {
+	cfg := Default()
+	cfg.WebSocket.AllowedOrigins = []string{"https://legacy.example"}
+	if got := cfg.GetCORSConfig().AllowedOrigins; !reflect.DeepEqual(got, cfg.WebSocket.AllowedOrigins) {
+		t.Errorf("expected the legacy origins, got %v", got)
+	}
+
+	cfg.CORS.AllowedOrigins = []string{"https://app.example"}
+	if got := cfg.GetCORSConfig().AllowedOrigins; !reflect.DeepEqual(got, cfg.CORS.AllowedOrigins) {
+		t.Errorf("expected cors origins to win, got %v", got)
+	}
+}
@@ -0,0 +1,40 @@
+package config
+
+// CORSConfig holds the browser origin policy shared by the REST API and the
+// WebSocket upgrader. All of it can be reloaded without restarting the server.
+type CORSConfig struct {
+	// AllowedOrigins lists the origins browsers may call the API from. Each
+	// entry is an exact origin ("https://app.example.com"), a wildcard
+	// subdomain ("https://*.example.com"), a regular expression matched
+	// against the whole origin ("regex:^https://pr-[0-9]+\.example\.com$"),
+	// or "*" for any origin. Requests without an Origin header, and
+	// WebSocket upgrades from the server's own host, are always allowed.
+	AllowedOrigins []string `yaml:"allowed_origins"`
+
+	// AllowCredentials lets browsers send cookies and Authorization headers cross-origin
+	AllowCredentials bool `yaml:"allow_credentials"`
+
+	// AllowedMethods are returned in preflight responses
+	AllowedMethods []string `yaml:"allowed_methods"`
+
+	// AllowedHeaders are the request headers browsers may send
+	AllowedHeaders []string `yaml:"allowed_headers"`
+
+	// ExposedHeaders are the response headers scripts may read
+	ExposedHeaders []string `yaml:"exposed_headers"`
+
+	// MaxAgeSeconds is how long browsers may cache a preflight response
+	MaxAgeSeconds int `yaml:"max_age_seconds"`
+}
+
+// DefaultCORSConfig returns the default CORS configuration, which allows no
+// cross-origin callers until origins are configured
+func DefaultCORSConfig() CORSConfig {
+	return CORSConfig{
+		AllowCredentials: true,
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Authorization", "Content-Type", "X-Request-ID"},
+		ExposedHeaders:   []string{"X-Request-ID", "Retry-After", "Link", "X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset"},
+		MaxAgeSeconds:    600,
+	}
+}
@@ -1,45 +1,14 @@
 package config
 
-import (
-	"fmt"
-	"os"
-
-	"gorm.io/driver/postgres"
-	"gorm.io/gorm"
-)
-
-// Config holds database configuration
+// DatabaseConfig holds the PostgreSQL connection settings
 type DatabaseConfig struct {
-	Host     string
-	Port     string
-	User     string
-	Password string
-	DBName   string
-}
-
-// NewDatabaseConfig creates a new database configuration
-func NewDatabaseConfig() *DatabaseConfig {
-	return &DatabaseConfig{
-		Host:     getEnvOrDefault("DB_HOST", "localhost"),
-		Port:     getEnvOrDefault("DB_PORT", "5432"),
-		User:     getEnvOrDefault("DB_USER", "postgres"),
-		Password: getEnvOrDefault("DB_PASSWORD", "postgres"),
-		DBName:   getEnvOrDefault("DB_NAME", "videocall"),
-	}
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	User     string `yaml:"user"`
+	Password string `yaml:"password" secret:"true"`
+	Name     string `yaml:"name"`
+	SSLMode  string `yaml:"sslmode"`
+
+	// MigrateOnStart applies pending migrations when the server starts
+	MigrateOnStart bool `yaml:"migrate_on_start"`
 }
-
-// Connect establishes a connection to the database
-func (c *DatabaseConfig) Connect() (*gorm.DB, error) {
-	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=disable",
-		c.Host, c.User, c.Password, c.DBName, c.Port)
-	
-	return gorm.Open(postgres.Open(dsn), &gorm.Config{})
-}
-
-// Helper function to get environment variable with default value
-func getEnvOrDefault(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
-	}
-	return defaultValue
-} 
\ No newline at end of file
@@ -0,0 +1,115 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// EnvPrefix starts the name of every environment override, e.g. APP_SERVER_PORT
+const EnvPrefix = "APP"
+
+// legacyEnv maps the variable names used before APP_* overrides to their replacements
+var legacyEnv = map[string]string{
+	"APP_DATABASE_HOST":     "DB_HOST",
+	"APP_DATABASE_PORT":     "DB_PORT",
+	"APP_DATABASE_USER":     "DB_USER",
+	"APP_DATABASE_PASSWORD": "DB_PASSWORD",
+	"APP_DATABASE_NAME":     "DB_NAME",
+	"APP_JWT_SECRET":        "JWT_SECRET",
+}
+
+// applyEnv overrides cfg with every APP_* variable that lookup returns a non-empty value for.
+// Slices take a comma-separated list. All malformed values are reported together.
+// OIDC client secrets are read from APP_OIDC_<PROVIDER>_CLIENT_SECRET.
+func applyEnv(cfg *Config, lookup func(string) (string, bool)) error {
+	var problems []string
+	walkFields(reflect.ValueOf(cfg).Elem(), EnvPrefix, func(name string, field reflect.Value, _ reflect.StructField) {
+		key := name
+		value, ok := lookup(name)
+		if (!ok || value == "") && legacyEnv[name] != "" {
+			key = legacyEnv[name]
+			value, ok = lookup(key)
+		}
+		if !ok || value == "" {
+			return
+		}
+		if err := setField(field, value); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", key, err))
+		}
+	})
+	applyProviderSecrets(cfg, lookup)
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// walkFields calls fn for every settable leaf field reachable through yaml-tagged structs
+func walkFields(v reflect.Value, prefix string, fn func(name string, field reflect.Value, sf reflect.StructField)) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := strings.Split(sf.Tag.Get("yaml"), ",")[0]
+		if !sf.IsExported() || tag == "" || tag == "-" {
+			continue
+		}
+
+		name := prefix + "_" + strings.ToUpper(tag)
+
+		field := v.Field(i)
+		if field.Kind() == reflect.Struct {
+			walkFields(field, name, fn)
+			continue
+		}
+		if !isSupportedKind(field.Type()) {
+			continue
+		}
+		fn(name, field, sf)
+	}
+}
+
+func isSupportedKind(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.String, reflect.Bool, reflect.Int, reflect.Int64, reflect.Float64:
+		return true
+	case reflect.Slice:
+		return t.Elem().Kind() == reflect.String
+	}
+	return false
+}
+
+func setField(field reflect.Value, value string) error {
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", value)
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", value)
+		}
+		field.SetInt(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", value)
+		}
+		field.SetFloat(f)
+	case reflect.Slice:
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		field.Set(reflect.ValueOf(items))
+	}
+	return nil
+}
@@ -0,0 +1,10 @@
+package config
+
+// DefaultJWTSecret is the development signing key; it is rejected in production
+const DefaultJWTSecret = "dev-secret-key"
+
+// JWTConfig holds settings for signing access tokens
+type JWTConfig struct {
+	Secret          string `yaml:"secret" secret:"true"`
+	ExpirationHours int    `yaml:"expiration_hours"`
+}
@@ -0,0 +1,20 @@
+package config
+
+// MailConfig selects how outgoing email is delivered
+type MailConfig struct {
+	// Driver is "smtp", or "log" which writes messages to the log and, when
+	// Dir is set, to one file per message for local development
+	Driver string     `yaml:"driver"`
+	From   string     `yaml:"from"`
+	Dir    string     `yaml:"dir"`
+	SMTP   SMTPConfig `yaml:"smtp"`
+}
+
+// SMTPConfig holds the SMTP server settings. STARTTLS is used when the
+// server offers it; credentials are only sent over TLS or to localhost.
+type SMTPConfig struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password" secret:"true"`
+}
@@ -0,0 +1,52 @@
+package config
+
+import (
+	"strings"
+)
+
+// OIDCConfig holds the OpenID Connect login settings
+type OIDCConfig struct {
+	// CallbackBaseURL is the public URL of the API; each provider's redirect
+	// URI is <callback_base_url>/api/auth/oidc/<name>/callback
+	CallbackBaseURL string `yaml:"callback_base_url"`
+
+	// FrontendURL is where the browser is sent after logging in, with the
+	// token, two-factor challenge or error in the URL fragment
+	FrontendURL string `yaml:"frontend_url"`
+
+	// StateTTLSeconds is how long the user has to finish logging in at the provider
+	StateTTLSeconds int `yaml:"state_ttl_seconds"`
+
+	Providers []OIDCProviderConfig `yaml:"providers"`
+}
+
+// OIDCProviderConfig describes one OpenID Connect identity provider
+type OIDCProviderConfig struct {
+	// Name appears in the login URLs and is stored with linked identities,
+	// so it must not change once users have logged in with the provider
+	Name        string `yaml:"name"`
+	DisplayName string `yaml:"display_name"`
+
+	// Issuer is the provider's issuer URL, used for discovery
+	Issuer       string   `yaml:"issuer"`
+	ClientID     string   `yaml:"client_id"`
+	ClientSecret string   `yaml:"client_secret" secret:"true"`
+	Scopes       []string `yaml:"scopes"`
+}
+
+// providerSecretEnv returns the variable that overrides a provider's client
+// secret, e.g. APP_OIDC_GOOGLE_CLIENT_SECRET for the provider named google
+func providerSecretEnv(name string) string {
+	return EnvPrefix + "_OIDC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_CLIENT_SECRET"
+}
+
+// applyProviderSecrets sets client secrets from the environment, since the
+// provider list itself can only come from the config file
+func applyProviderSecrets(cfg *Config, lookup func(string) (string, bool)) {
+	for i := range cfg.OIDC.Providers {
+		provider := &cfg.OIDC.Providers[i]
+		if value, ok := lookup(providerSecretEnv(provider.Name)); ok && value != "" {
+			provider.ClientSecret = value
+		}
+	}
+}
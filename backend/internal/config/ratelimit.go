@@ -0,0 +1,62 @@
+package config
+
+// RateLimitConfig holds the HTTP rate limits and login brute-force protection.
+// Everything except Store can be reloaded without restarting the server.
+type RateLimitConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// Store is "postgres", which keeps counters and lockouts across restarts
+	// and replicas, or "memory"
+	Store string `yaml:"store"`
+
+	// IP limits requests to /api per client IP
+	IP RateLimitRule `yaml:"ip"`
+
+	// Account limits authenticated requests per user
+	Account RateLimitRule `yaml:"account"`
+
+	Login LoginLimitConfig `yaml:"login"`
+}
+
+// RateLimitRule allows Requests per window; zero requests disables the rule
+type RateLimitRule struct {
+	Requests      int `yaml:"requests"`
+	WindowSeconds int `yaml:"window_seconds"`
+}
+
+// LoginLimitConfig slows down and then locks out repeated failed logins
+type LoginLimitConfig struct {
+	// MaxFailures failed logins for one account within WindowSeconds lock it
+	MaxFailures int `yaml:"max_failures"`
+
+	// IPMaxFailures failed logins from one IP within WindowSeconds lock the IP
+	IPMaxFailures int `yaml:"ip_max_failures"`
+
+	WindowSeconds  int `yaml:"window_seconds"`
+	LockoutSeconds int `yaml:"lockout_seconds"`
+
+	// DelayAfter is how many failures are allowed before each further attempt
+	// must wait, starting at BaseDelayMs and doubling up to MaxDelayMs
+	DelayAfter  int `yaml:"delay_after"`
+	BaseDelayMs int `yaml:"base_delay_ms"`
+	MaxDelayMs  int `yaml:"max_delay_ms"`
+}
+
+// DefaultRateLimitConfig returns the default rate limits
+func DefaultRateLimitConfig() RateLimitConfig {
+	return RateLimitConfig{
+		Enabled: true,
+		Store:   "postgres",
+		IP:      RateLimitRule{Requests: 300, WindowSeconds: 60},
+		Account: RateLimitRule{Requests: 600, WindowSeconds: 60},
+		Login: LoginLimitConfig{
+			MaxFailures:    5,
+			IPMaxFailures:  20,
+			WindowSeconds:  900,
+			LockoutSeconds: 900,
+			DelayAfter:     2,
+			BaseDelayMs:    1000,
+			MaxDelayMs:     30000,
+		},
+	}
+}
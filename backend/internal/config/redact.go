@@ -0,0 +1,66 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+
+	"gopkg.in/yaml.v3"
+)
+
+// redactedValue replaces secrets that have been set
+const redactedValue = "[REDACTED]"
+
+// Redacted returns a deep copy of the configuration with fields tagged secret:"true" masked
+func (c *Config) Redacted() (*Config, error) {
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return nil, fmt.Errorf("failed to copy config: %v", err)
+	}
+	clone := &Config{path: c.path}
+	if err := yaml.Unmarshal(data, clone); err != nil {
+		return nil, fmt.Errorf("failed to copy config: %v", err)
+	}
+	redact(reflect.ValueOf(clone).Elem())
+	return clone, nil
+}
+
+// YAML renders the configuration with secrets redacted
+func (c *Config) YAML() ([]byte, error) {
+	redacted, err := c.Redacted()
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(redacted); err != nil {
+		return nil, fmt.Errorf("failed to render config: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func redact(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			if !sf.IsExported() {
+				continue
+			}
+			field := v.Field(i)
+			if sf.Tag.Get("secret") == "true" && field.Kind() == reflect.String {
+				if field.String() != "" {
+					field.SetString(redactedValue)
+				}
+				continue
+			}
+			redact(field)
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			redact(v.Index(i))
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package config
+
+// ServerConfig holds settings for the HTTP server process
+type ServerConfig struct {
+	Port int `yaml:"port"`
+
+	// MetricsPort serves /metrics on a listener of its own, so Prometheus
+	// can scrape it without exposing it on the public port; 0 disables it
+	MetricsPort int `yaml:"metrics_port"`
+
+	// Environment is one of "development", "test", "staging" or "production"
+	Environment string `yaml:"environment"`
+
+	// LogLevel is "debug", "info", "warn" or "error"; empty uses the environment's
+	// default. It can be reloaded without restarting the server.
+	LogLevel string `yaml:"log_level"`
+
+	// ShutdownTimeoutSeconds bounds how long shutdown waits for connections to drain
+	ShutdownTimeoutSeconds int `yaml:"shutdown_timeout_seconds"`
+
+	// TrustedProxies lists the proxy addresses or CIDRs whose X-Forwarded-For
+	// header is believed when determining the client IP; empty trusts none
+	TrustedProxies []string `yaml:"trusted_proxies"`
+
+	// AdminEmails lists accounts given the admin role at startup. Deprecated:
+	// use `server user set-role`; removing an address does not demote it.
+	AdminEmails []string `yaml:"admin_emails"`
+}
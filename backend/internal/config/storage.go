@@ -0,0 +1,33 @@
+package config
+
+// StorageConfig selects where uploaded media such as avatars is kept
+type StorageConfig struct {
+	// Driver is "local", which keeps files in Dir and serves them under
+	// /media, or "s3" for Amazon S3 or any S3-compatible store such as MinIO
+	Driver string `yaml:"driver"`
+
+	// PublicURL is the base URL stored objects are served from; the object
+	// key is appended to it
+	PublicURL string `yaml:"public_url"`
+
+	Dir string   `yaml:"dir"`
+	S3  S3Config `yaml:"s3"`
+
+	// MaxAvatarBytes limits the size of uploaded avatar images
+	MaxAvatarBytes int64 `yaml:"max_avatar_bytes"`
+}
+
+// S3Config holds the settings of an S3-compatible object store
+type S3Config struct {
+	// Endpoint is the store's base URL, e.g. https://s3.eu-central-1.amazonaws.com
+	// or http://localhost:9000 for MinIO
+	Endpoint        string `yaml:"endpoint"`
+	Region          string `yaml:"region"`
+	Bucket          string `yaml:"bucket"`
+	AccessKeyID     string `yaml:"access_key_id"`
+	SecretAccessKey string `yaml:"secret_access_key" secret:"true"`
+
+	// PathStyle addresses the bucket as endpoint/bucket instead of
+	// bucket.endpoint, which MinIO and most self-hosted stores need
+	PathStyle bool `yaml:"path_style"`
+}
@@ -0,0 +1,22 @@
+package config
+
+// TracingConfig holds configuration for OpenTelemetry tracing
+type TracingConfig struct {
+	// Enabled turns span export on; trace context is propagated either way
+	Enabled bool `yaml:"enabled"`
+
+	// Exporter selects where spans are sent: "otlp" or "stdout"
+	Exporter string `yaml:"exporter"`
+
+	// Endpoint is the OTLP/HTTP collector address, e.g. "localhost:4318"
+	Endpoint string `yaml:"endpoint"`
+
+	// Insecure disables TLS when talking to the OTLP collector
+	Insecure bool `yaml:"insecure"`
+
+	// ServiceName is reported as the service.name resource attribute
+	ServiceName string `yaml:"service_name"`
+
+	// SampleRatio is the fraction of new traces that are sampled, from 0 to 1
+	SampleRatio float64 `yaml:"sample_ratio"`
+}
@@ -0,0 +1,211 @@
+package config
+
+import (
+	"fmt"
+	"net/mail"
+	"net/netip"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// minProductionSecretLength is the shortest JWT secret accepted in production
+const minProductionSecretLength = 32
+
+var (
+	environments   = []string{"development", "test", "staging", "production"}
+	logLevels      = []string{"", "debug", "info", "warn", "error"}
+	sslModes       = []string{"disable", "allow", "prefer", "require", "verify-ca", "verify-full"}
+	exporters      = []string{"otlp", "stdout"}
+	mailDrivers    = []string{"log", "smtp"}
+	storageDrivers = []string{"local", "s3"}
+
+	// providerName keeps OIDC provider names safe to use in URLs
+	providerName = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+	// weakSecrets are well-known signing keys that must never reach production
+	weakSecrets = []string{DefaultJWTSecret, "your-secret-key", "secret", "changeme"}
+)
+
+// ValidationError lists every problem found in a configuration
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+// Validate checks the whole configuration and reports all problems at once
+func (c *Config) Validate() error {
+	var v validator
+
+	v.check(c.Server.Port >= 1 && c.Server.Port <= 65535, "server.port must be between 1 and 65535, got %d", c.Server.Port)
+	v.check(c.Server.MetricsPort >= 0 && c.Server.MetricsPort <= 65535, "server.metrics_port must be between 0 and 65535, got %d", c.Server.MetricsPort)
+	v.check(c.Server.MetricsPort != c.Server.Port, "server.metrics_port must differ from server.port")
+	v.check(slices.Contains(environments, c.Server.Environment), "server.environment must be one of %s, got %q", strings.Join(environments, ", "), c.Server.Environment)
+	v.check(slices.Contains(logLevels, c.Server.LogLevel), "server.log_level must be one of debug, info, warn, error, got %q", c.Server.LogLevel)
+	v.check(c.Server.ShutdownTimeoutSeconds >= 0, "server.shutdown_timeout_seconds must not be negative")
+	for _, proxy := range c.Server.TrustedProxies {
+		v.check(isIPOrCIDR(proxy), "server.trusted_proxies contains invalid address %q", proxy)
+	}
+	for _, email := range c.Server.AdminEmails {
+		v.check(strings.Contains(email, "@"), "server.admin_emails contains invalid address %q", email)
+	}
+
+	v.check(c.Database.Host != "", "database.host is required")
+	v.check(c.Database.Port >= 1 && c.Database.Port <= 65535, "database.port must be between 1 and 65535, got %d", c.Database.Port)
+	v.check(c.Database.User != "", "database.user is required")
+	v.check(c.Database.Name != "", "database.name is required")
+	v.check(slices.Contains(sslModes, c.Database.SSLMode), "database.sslmode must be one of %s, got %q", strings.Join(sslModes, ", "), c.Database.SSLMode)
+
+	v.check(c.JWT.Secret != "", "jwt.secret is required")
+	v.check(c.JWT.ExpirationHours > 0, "jwt.expiration_hours must be positive, got %d", c.JWT.ExpirationHours)
+	if c.IsProduction() && c.JWT.Secret != "" {
+		v.check(!slices.Contains(weakSecrets, c.JWT.Secret), "jwt.secret must be changed from the default in production")
+		v.check(len(c.JWT.Secret) >= minProductionSecretLength, "jwt.secret must be at least %d characters in production", minProductionSecretLength)
+	}
+
+	for _, origin := range c.WebSocket.AllowedOrigins {
+		v.check(isOriginPattern(origin), "websocket.allowed_origins contains invalid origin %q", origin)
+	}
+	for _, origin := range c.CORS.AllowedOrigins {
+		v.check(isOriginPattern(origin), "cors.allowed_origins contains invalid origin %q, expected scheme://host[:port], scheme://*.domain, regex:<pattern> or *", origin)
+	}
+	if c.IsProduction() && c.CORS.AllowCredentials {
+		v.check(!slices.Contains(c.GetCORSConfig().AllowedOrigins, "*"), "cors.allowed_origins must not contain * with allow_credentials in production")
+	}
+	v.check(c.CORS.MaxAgeSeconds >= 0, "cors.max_age_seconds must not be negative")
+
+	v.check(c.WebSocket.MaxClientsPerRoom >= 0, "websocket.max_clients_per_room must not be negative")
+	v.check(c.WebSocket.MessageRateLimit >= 0, "websocket.message_rate_limit must not be negative")
+	v.check(c.WebSocket.MessageBurst >= 0, "websocket.message_burst must not be negative")
+
+	v.check(c.RateLimit.Store == "memory" || c.RateLimit.Store == "postgres", "rate_limit.store must be memory or postgres, got %q", c.RateLimit.Store)
+	v.checkRule("rate_limit.ip", c.RateLimit.IP)
+	v.checkRule("rate_limit.account", c.RateLimit.Account)
+	login := c.RateLimit.Login
+	v.check(login.MaxFailures >= 0 && login.IPMaxFailures >= 0 && login.DelayAfter >= 0, "rate_limit.login failure counts must not be negative")
+	v.check(login.WindowSeconds > 0, "rate_limit.login.window_seconds must be positive")
+	v.check(login.LockoutSeconds > 0, "rate_limit.login.lockout_seconds must be positive")
+	v.check(login.BaseDelayMs >= 0 && login.MaxDelayMs >= login.BaseDelayMs, "rate_limit.login.max_delay_ms must be at least base_delay_ms")
+
+	v.check(slices.Contains(mailDrivers, c.Mail.Driver), "mail.driver must be one of %s, got %q", strings.Join(mailDrivers, ", "), c.Mail.Driver)
+	_, err := mail.ParseAddress(c.Mail.From)
+	v.check(err == nil, "mail.from must be an email address, got %q", c.Mail.From)
+	if c.Mail.Driver == "smtp" {
+		v.check(c.Mail.SMTP.Host != "", "mail.smtp.host is required when mail.driver is smtp")
+		v.check(c.Mail.SMTP.Port >= 1 && c.Mail.SMTP.Port <= 65535, "mail.smtp.port must be between 1 and 65535, got %d", c.Mail.SMTP.Port)
+	}
+
+	v.check(isHTTPURL(c.PasswordReset.URL), "password_reset.url must be an http or https URL, got %q", c.PasswordReset.URL)
+	v.check(c.PasswordReset.TokenTTLMinutes > 0, "password_reset.token_ttl_minutes must be positive, got %d", c.PasswordReset.TokenTTLMinutes)
+	v.check(isHTTPURL(c.EmailVerification.URL), "email_verification.url must be an http or https URL, got %q", c.EmailVerification.URL)
+	v.check(c.EmailVerification.TokenTTLHours > 0, "email_verification.token_ttl_hours must be positive, got %d", c.EmailVerification.TokenTTLHours)
+	v.check(c.TwoFactor.Issuer != "" && !strings.Contains(c.TwoFactor.Issuer, ":"), "two_factor.issuer is required and must not contain a colon")
+	v.check(c.TwoFactor.ChallengeTTLSeconds > 0, "two_factor.challenge_ttl_seconds must be positive, got %d", c.TwoFactor.ChallengeTTLSeconds)
+
+	v.check(c.OIDC.StateTTLSeconds > 0, "oidc.state_ttl_seconds must be positive, got %d", c.OIDC.StateTTLSeconds)
+	if len(c.OIDC.Providers) > 0 {
+		v.check(isHTTPURL(c.OIDC.CallbackBaseURL), "oidc.callback_base_url must be an http or https URL, got %q", c.OIDC.CallbackBaseURL)
+		v.check(isHTTPURL(c.OIDC.FrontendURL), "oidc.frontend_url must be an http or https URL, got %q", c.OIDC.FrontendURL)
+	}
+	seenProviders := map[string]bool{}
+	for i, p := range c.OIDC.Providers {
+		v.check(providerName.MatchString(p.Name), "oidc.providers[%d].name must be lowercase letters, digits and dashes, got %q", i, p.Name)
+		v.check(!seenProviders[p.Name], "oidc.providers[%d].name %q is used more than once", i, p.Name)
+		seenProviders[p.Name] = true
+		v.check(isHTTPURL(p.Issuer), "oidc.providers[%d].issuer must be an http or https URL, got %q", i, p.Issuer)
+		v.check(p.ClientID != "", "oidc.providers[%d].client_id is required", i)
+		if c.IsProduction() && isHTTPURL(p.Issuer) {
+			v.check(strings.HasPrefix(p.Issuer, "https://"), "oidc.providers[%d].issuer must use https in production", i)
+		}
+	}
+
+	v.check(slices.Contains(storageDrivers, c.Storage.Driver), "storage.driver must be one of %s, got %q", strings.Join(storageDrivers, ", "), c.Storage.Driver)
+	v.check(isHTTPURL(c.Storage.PublicURL), "storage.public_url must be an http or https URL, got %q", c.Storage.PublicURL)
+	v.check(c.Storage.MaxAvatarBytes > 0, "storage.max_avatar_bytes must be positive, got %d", c.Storage.MaxAvatarBytes)
+	switch c.Storage.Driver {
+	case "local":
+		v.check(c.Storage.Dir != "", "storage.dir is required when storage.driver is local")
+	case "s3":
+		v.check(isHTTPURL(c.Storage.S3.Endpoint), "storage.s3.endpoint must be an http or https URL, got %q", c.Storage.S3.Endpoint)
+		v.check(c.Storage.S3.Region != "", "storage.s3.region is required when storage.driver is s3")
+		v.check(c.Storage.S3.Bucket != "", "storage.s3.bucket is required when storage.driver is s3")
+		v.check(c.Storage.S3.AccessKeyID != "" && c.Storage.S3.SecretAccessKey != "", "storage.s3.access_key_id and storage.s3.secret_access_key are required when storage.driver is s3")
+	}
+
+	if c.Tracing.Enabled {
+		v.check(slices.Contains(exporters, c.Tracing.Exporter), "tracing.exporter must be one of %s, got %q", strings.Join(exporters, ", "), c.Tracing.Exporter)
+	}
+	v.check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1, "tracing.sample_ratio must be between 0 and 1, got %g", c.Tracing.SampleRatio)
+
+	return v.err()
+}
+
+// IsProduction reports whether the server runs in the production environment
+func (c *Config) IsProduction() bool {
+	return c.Server.Environment == "production"
+}
+
+// isIPOrCIDR reports whether s is an IP address or CIDR range
+func isIPOrCIDR(s string) bool {
+	if _, err := netip.ParsePrefix(s); err == nil {
+		return true
+	}
+	_, err := netip.ParseAddr(s)
+	return err == nil
+}
+
+// isOriginPattern reports whether s is an allowed origin entry understood by the origin policy
+func isOriginPattern(s string) bool {
+	switch {
+	case s == "*":
+		return true
+	case strings.HasPrefix(s, "regex:"):
+		_, err := regexp.Compile(strings.TrimPrefix(s, "regex:"))
+		return err == nil
+	case strings.Contains(s, "://*."):
+		return isOrigin(strings.Replace(s, "://*.", "://", 1))
+	}
+	return isOrigin(s)
+}
+
+// isHTTPURL reports whether s is an absolute http or https URL
+func isHTTPURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// isOrigin reports whether s is a bare scheme://host[:port] origin
+func isOrigin(s string) bool {
+	u, err := url.Parse(s)
+	if err != nil {
+		return false
+	}
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" &&
+		(u.Path == "" || u.Path == "/") && u.RawQuery == "" && u.User == nil
+}
+
+type validator struct {
+	problems []string
+}
+
+func (v *validator) check(ok bool, format string, args ...any) {
+	if !ok {
+		v.problems = append(v.problems, fmt.Sprintf(format, args...))
+	}
+}
+
+func (v *validator) checkRule(name string, rule RateLimitRule) {
+	v.check(rule.Requests >= 0, "%s.requests must not be negative", name)
+	v.check(rule.Requests == 0 || rule.WindowSeconds > 0, "%s.window_seconds must be positive", name)
+}
+
+func (v *validator) err() error {
+	if len(v.problems) == 0 {
+		return nil
+	}
+	return &ValidationError{Problems: v.problems}
+}
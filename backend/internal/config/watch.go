@@ -0,0 +1,88 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchDebounce coalesces the burst of events editors produce when saving
+const watchDebounce = 250 * time.Millisecond
+
+// Watch calls onChange whenever the process receives SIGHUP or, if path is
+// not empty, the contents of the file at path change. It keeps running in the
+// background until ctx is done. If the file cannot be watched the error is
+// returned, but SIGHUP is still handled.
+func Watch(ctx context.Context, path string, onChange func()) error {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	var (
+		watcher  *fsnotify.Watcher
+		events   chan fsnotify.Event
+		errs     chan error
+		last     []byte
+		watchErr error
+	)
+	if path != "" {
+		watcher, watchErr = watchDir(filepath.Dir(path))
+		if watcher != nil {
+			events, errs = watcher.Events, watcher.Errors
+			last, _ = os.ReadFile(path)
+		}
+	}
+
+	go func() {
+		defer signal.Stop(hup)
+		if watcher != nil {
+			defer watcher.Close()
+		}
+
+		debounce := time.NewTimer(watchDebounce)
+		debounce.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hup:
+				onChange()
+			case <-events:
+				debounce.Reset(watchDebounce)
+			case <-errs:
+				// Overflow or similar; check the file in case an event was lost
+				debounce.Reset(watchDebounce)
+			case <-debounce.C:
+				data, err := os.ReadFile(path)
+				if err != nil || bytes.Equal(data, last) {
+					continue
+				}
+				last = data
+				onChange()
+			}
+		}
+	}()
+
+	return watchErr
+}
+
+// watchDir watches a directory rather than the file itself so editors that
+// replace the file and Kubernetes ConfigMap symlink swaps are both noticed
+func watchDir(dir string) (*fsnotify.Watcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create config watcher: %v", err)
+	}
+	if err := watcher.Add(dir); err != nil {
+		watcher.Close()
+		return nil, fmt.Errorf("failed to watch %s: %v", dir, err)
+	}
+	return watcher, nil
+}
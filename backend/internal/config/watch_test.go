@@ -0,0 +1,43 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatchReportsFileChanges(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("server:\n  log_level: info\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	changed := make(chan struct{}, 10)
+	if err := Watch(ctx, path, func() { changed <- struct{}{} }); err != nil {
+		t.Fatalf("Watch: %v", err)
+	}
+
+	// Rewriting identical contents is not a change
+	if err := os.WriteFile(path, []byte("server:\n  log_level: info\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-changed:
+		t.Fatal("unchanged contents triggered a reload")
+	case <-time.After(3 * watchDebounce):
+	}
+
+	if err := os.WriteFile(path, []byte("server:\n  log_level: debug\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-changed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("file change did not trigger a reload")
+	}
+}
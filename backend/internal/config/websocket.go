@@ -1,14 +1,30 @@
 package config
 
-// WebSocketConfig holds configuration for WebSocket connections
+// WebSocketConfig holds configuration for WebSocket connections. All of it can
+// be reloaded without restarting the server.
 type WebSocketConfig struct {
-	// AllowedOrigins is a list of origins allowed to connect to the WebSocket server
-	AllowedOrigins []string
+	// AllowedOrigins is used as cors.allowed_origins when that is empty.
+	//
+	// Deprecated: configure origins in the cors section instead.
+	AllowedOrigins []string `yaml:"allowed_origins,omitempty"`
+
+	// MaxClientsPerRoom caps how many clients can join one room, zero means unlimited
+	MaxClientsPerRoom int `yaml:"max_clients_per_room"`
+
+	// MessageRateLimit is the sustained number of messages per second each
+	// client may send, zero means unlimited
+	MessageRateLimit float64 `yaml:"message_rate_limit"`
+
+	// MessageBurst is how many messages a client may send back to back before
+	// the rate limit applies
+	MessageBurst int `yaml:"message_burst"`
 }
 
 // DefaultWebSocketConfig returns the default WebSocket configuration
 func DefaultWebSocketConfig() *WebSocketConfig {
 	return &WebSocketConfig{
-		AllowedOrigins: []string{"http://localhost:3000", "http://localhost:5173"},
+		MaxClientsPerRoom: 50,
+		MessageRateLimit:  10,
+		MessageBurst:      20,
 	}
 }
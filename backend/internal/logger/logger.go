@@ -1,6 +1,8 @@
 package logger
 
 import (
+	"context"
+	"fmt"
 	"os"
 	"sync"
 
@@ -11,6 +13,12 @@ import (
 var (
 	log  *zap.Logger
 	once sync.Once
+
+	// level is shared by every logger so it can be changed at runtime
+	level = zap.NewAtomicLevel()
+
+	// defaultLevel is the environment's level, restored by SetLevel("")
+	defaultLevel zapcore.Level
 )
 
 // Initialize sets up the logger with the given environment
@@ -27,6 +35,10 @@ func Initialize(env string) {
 			config.EncoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
 		}
 
+		defaultLevel = config.Level.Level()
+		level.SetLevel(defaultLevel)
+		config.Level = level
+
 		var err error
 		log, err = config.Build()
 		if err != nil {
@@ -35,6 +47,28 @@ func Initialize(env string) {
 	})
 }
 
+// SetLevel changes the minimum level of every logger at runtime. An empty
+// string restores the environment's default level.
+func SetLevel(text string) error {
+	GetLogger()
+	if text == "" {
+		level.SetLevel(defaultLevel)
+		return nil
+	}
+
+	var l zapcore.Level
+	if err := l.UnmarshalText([]byte(text)); err != nil {
+		return fmt.Errorf("invalid log level %q: %v", text, err)
+	}
+	level.SetLevel(l)
+	return nil
+}
+
+// Level returns the current minimum log level
+func Level() zapcore.Level {
+	return level.Level()
+}
+
 // GetLogger returns the global logger instance
 func GetLogger() *zap.Logger {
 	if log == nil {
@@ -77,3 +111,21 @@ func With(fields ...zapcore.Field) *zap.Logger {
 func Sync() error {
 	return GetLogger().Sync()
 }
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying the given logger
+func NewContext(ctx context.Context, l *zap.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, l)
+}
+
+// FromContext returns the request-scoped logger stored in ctx, or the global
+// logger if there is none
+func FromContext(ctx context.Context) *zap.Logger {
+	if ctx != nil {
+		if l, ok := ctx.Value(contextKey{}).(*zap.Logger); ok {
+			return l
+		}
+	}
+	return GetLogger()
+}
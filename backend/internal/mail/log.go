@@ -0,0 +1,65 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ayush/accountability-app/backend/internal/logger"
+
+	"go.uber.org/zap"
+)
+
+// logMailer logs messages instead of sending them, and writes each one to a
+// file when a directory is configured
+type logMailer struct {
+	from string
+	dir  string
+}
+
+// NewLogMailer creates a mailer for local development and tests. Messages
+// are logged in full and, if dir is not empty, saved there as .eml files.
+func NewLogMailer(from, dir string) Mailer {
+	return &logMailer{from: from, dir: dir}
+}
+
+func (m *logMailer) Send(ctx context.Context, msg Message) error {
+	log := logger.FromContext(ctx)
+	if m.dir == "" {
+		log.Info("Email not sent, mail driver is log",
+			zap.String("to", msg.To),
+			zap.String("subject", msg.Subject),
+			zap.String("body", msg.Body))
+		return nil
+	}
+
+	if err := os.MkdirAll(m.dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create mail directory: %v", err)
+	}
+	now := time.Now()
+	name := fmt.Sprintf("%s-%s.eml", now.UTC().Format("20060102T150405.000000000"), fileSafe(msg.To))
+	path := filepath.Join(m.dir, name)
+	if err := os.WriteFile(path, format(m.from, msg, now), 0o600); err != nil {
+		return fmt.Errorf("failed to write message: %v", err)
+	}
+
+	log.Info("Email written to file, mail driver is log",
+		zap.String("to", msg.To),
+		zap.String("subject", msg.Subject),
+		zap.String("path", path))
+	return nil
+}
+
+// fileSafe replaces characters that are awkward in file names
+func fileSafe(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '@', r == '.', r == '-', r == '_':
+			return r
+		}
+		return '_'
+	}, s)
+}
@@ -0,0 +1,70 @@
+// Package mail delivers transactional email such as password reset links.
+package mail
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"mime"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/ayush/accountability-app/backend/internal/config"
+)
+
+// Message is a plain text email to a single recipient
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends email
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// New returns the mailer selected by mail.driver
+func New(cfg config.MailConfig) (Mailer, error) {
+	switch cfg.Driver {
+	case "smtp":
+		return NewSMTPMailer(cfg), nil
+	case "log":
+		return NewLogMailer(cfg.From, cfg.Dir), nil
+	default:
+		return nil, fmt.Errorf("unknown mail driver %q", cfg.Driver)
+	}
+}
+
+// format renders msg as an RFC 5322 message. Header values are stripped of
+// line breaks so user input cannot inject headers.
+func format(from string, msg Message, now time.Time) []byte {
+	var b bytes.Buffer
+	header := func(name, value string) {
+		fmt.Fprintf(&b, "%s: %s\r\n", name, value)
+	}
+	header("From", headerValue(from))
+	header("To", headerValue(msg.To))
+	header("Subject", mime.QEncoding.Encode("utf-8", headerValue(msg.Subject)))
+	header("Date", now.Format(time.RFC1123Z))
+	header("MIME-Version", "1.0")
+	header("Content-Type", `text/plain; charset="utf-8"`)
+	header("Content-Transfer-Encoding", "8bit")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(strings.ReplaceAll(msg.Body, "\r\n", "\n"), "\n", "\r\n"))
+	return b.Bytes()
+}
+
+func headerValue(s string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(s)
+}
+
+// address returns the bare address of a "Name <address>" value
+func address(s string) (string, error) {
+	addr, err := mail.ParseAddress(headerValue(s))
+	if err != nil {
+		return "", fmt.Errorf("invalid address %q: %v", s, err)
+	}
+	return addr.Address, nil
+}
@@ -0,0 +1,158 @@
+package mail
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ayush/accountability-app/backend/internal/config"
+)
+
+func TestLogMailerWritesFiles(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "mail")
+	mailer := NewLogMailer("App <no-reply@example.com>", dir)
+
+	err := mailer.Send(t.Context(), Message{
+		To:      "john@example.com",
+		Subject: "Reset your password",
+		Body:    "Open https://example.com/reset?token=abc\n",
+	})
+	if err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil || len(files) != 1 {
+		t.Fatalf("expected one message file, got %v, %v", files, err)
+	}
+	if !strings.HasSuffix(files[0].Name(), "-john@example.com.eml") {
+		t.Fatalf("unexpected file name %q", files[0].Name())
+	}
+	data, _ := os.ReadFile(filepath.Join(dir, files[0].Name()))
+	for _, want := range []string{"To: john@example.com\r\n", "Subject: Reset your password\r\n", "token=abc\r\n"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("message does not contain %q:\n%s", want, data)
+		}
+	}
+}
+
+func TestFormatStripsHeaderInjection(t *testing.T) {
+	data := string(format("no-reply@example.com", Message{
+		To:      "john@example.com\r\nBcc: attacker@example.com",
+		Subject: "Hi\nBcc: attacker@example.com",
+	}, time.Now()))
+
+	headers, _, _ := strings.Cut(data, "\r\n\r\n")
+	for _, line := range strings.Split(headers, "\r\n") {
+		if strings.HasPrefix(line, "Bcc:") {
+			t.Fatalf("header injected:\n%s", headers)
+		}
+	}
+}
+
+func TestSMTPMailer(t *testing.T) {
+	server := newFakeSMTPServer(t)
+	host, port, _ := net.SplitHostPort(server.addr)
+	portNum, _ := strconv.Atoi(port)
+
+	mailer, err := New(config.MailConfig{
+		Driver: "smtp",
+		From:   "App <no-reply@example.com>",
+		SMTP:   config.SMTPConfig{Host: host, Port: portNum},
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	err = mailer.Send(t.Context(), Message{To: "John <john@example.com>", Subject: "Hello", Body: "Hi there"})
+	if err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	got := <-server.received
+	if got.from != "no-reply@example.com" || got.to != "john@example.com" {
+		t.Fatalf("unexpected envelope from %q to %q", got.from, got.to)
+	}
+	if !strings.Contains(got.data, "Subject: Hello\r\n") || !strings.HasSuffix(got.data, "\r\nHi there") {
+		t.Fatalf("unexpected message data:\n%s", got.data)
+	}
+}
+
+type smtpDelivery struct {
+	from, to, data string
+}
+
+type fakeSMTPServer struct {
+	addr     string
+	received chan smtpDelivery
+}
+
+// newFakeSMTPServer accepts a single session and records the message sent in it
+func newFakeSMTPServer(t *testing.T) *fakeSMTPServer {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	s := &fakeSMTPServer{addr: ln.Addr().String(), received: make(chan smtpDelivery, 1)}
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+		reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+		var d smtpDelivery
+
+		reply("220 localhost ESMTP")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			cmd := strings.TrimSpace(line)
+			switch {
+			case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+				reply("250 localhost")
+			case strings.HasPrefix(cmd, "MAIL FROM:"):
+				d.from = strings.Trim(strings.TrimPrefix(cmd, "MAIL FROM:"), "<>")
+				reply("250 OK")
+			case strings.HasPrefix(cmd, "RCPT TO:"):
+				d.to = strings.Trim(strings.TrimPrefix(cmd, "RCPT TO:"), "<>")
+				reply("250 OK")
+			case cmd == "DATA":
+				reply("354 Go ahead")
+				var data strings.Builder
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if line == ".\r\n" {
+						break
+					}
+					data.WriteString(line)
+				}
+				d.data = strings.TrimSuffix(data.String(), "\r\n")
+				s.received <- d
+				reply("250 Queued")
+			case cmd == "QUIT":
+				reply("221 Bye")
+				return
+			default:
+				reply("502 Not implemented")
+			}
+		}
+	}()
+	return s
+}
@@ -0,0 +1,92 @@
+package mail
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"time"
+
+	"github.com/ayush/accountability-app/backend/internal/config"
+)
+
+// smtpTimeout bounds a whole delivery when the context has no deadline
+const smtpTimeout = 30 * time.Second
+
+// smtpMailer delivers messages through an SMTP server
+type smtpMailer struct {
+	from string
+	cfg  config.SMTPConfig
+}
+
+// NewSMTPMailer creates a mailer that sends through the configured SMTP server
+func NewSMTPMailer(cfg config.MailConfig) Mailer {
+	return &smtpMailer{from: cfg.From, cfg: cfg.SMTP}
+}
+
+func (m *smtpMailer) Send(ctx context.Context, msg Message) error {
+	from, err := address(m.from)
+	if err != nil {
+		return err
+	}
+	to, err := address(msg.To)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, smtpTimeout)
+		defer cancel()
+	}
+
+	addr := net.JoinHostPort(m.cfg.Host, strconv.Itoa(m.cfg.Port))
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to connect to SMTP server %s: %v", addr, err)
+	}
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+
+	client, err := smtp.NewClient(conn, m.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to start SMTP session: %v", err)
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: m.cfg.Host}); err != nil {
+			return fmt.Errorf("failed to start TLS: %v", err)
+		}
+	}
+	if m.cfg.Username != "" {
+		// PlainAuth refuses to send credentials without TLS unless the server is local
+		auth := smtp.PlainAuth("", m.cfg.Username, m.cfg.Password, m.cfg.Host)
+		if err := client.Auth(auth); err != nil {
+			return fmt.Errorf("SMTP authentication failed: %v", err)
+		}
+	}
+
+	if err := client.Mail(from); err != nil {
+		return fmt.Errorf("SMTP MAIL FROM failed: %v", err)
+	}
+	if err := client.Rcpt(to); err != nil {
+		return fmt.Errorf("SMTP RCPT TO failed: %v", err)
+	}
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("SMTP DATA failed: %v", err)
+	}
+	if _, err := w.Write(format(m.from, msg, time.Now())); err != nil {
+		w.Close()
+		return fmt.Errorf("failed to write message: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("SMTP server rejected message: %v", err)
+	}
+	return client.Quit()
+}
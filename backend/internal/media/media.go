@@ -0,0 +1,101 @@
+// Package media validates uploaded images and renders them as thumbnails.
+package media
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"net/http"
+	"slices"
+
+	"golang.org/x/image/draw"
+
+	// Decoders for the accepted types besides PNG
+	_ "image/gif"
+	_ "image/jpeg"
+
+	_ "golang.org/x/image/webp"
+)
+
+// MaxDimension bounds the width and height of images that are decoded, so a
+// small file cannot expand into a huge bitmap
+const MaxDimension = 4096
+
+// ThumbnailSizes are the edge lengths in pixels of the square thumbnails
+// rendered for avatars, smallest first
+var ThumbnailSizes = []int{64, 128, 256}
+
+// ThumbnailContentType is the type of every rendered thumbnail
+const ThumbnailContentType = "image/png"
+
+var (
+	// ErrUnsupportedType is returned for files that are not PNG, JPEG, GIF or
+	// WebP images
+	ErrUnsupportedType = errors.New("unsupported image type")
+
+	// ErrInvalidImage is returned for images that cannot be decoded or whose
+	// dimensions are out of bounds
+	ErrInvalidImage = errors.New("invalid image")
+)
+
+// imageTypes are the accepted content types as detected from the data
+var imageTypes = []string{"image/png", "image/jpeg", "image/gif", "image/webp"}
+
+// DetectType returns the content type of data, judged by its first bytes
+// rather than a client-supplied name or header, and whether it is accepted
+func DetectType(data []byte) (string, bool) {
+	contentType := http.DetectContentType(data)
+	return contentType, slices.Contains(imageTypes, contentType)
+}
+
+// Thumbnail is an encoded square thumbnail
+type Thumbnail struct {
+	Size int
+	Data []byte
+}
+
+// Thumbnails decodes data, crops it to a centred square and renders it at
+// each of sizes as PNG. Only the first frame of animated images is used.
+// Metadata such as EXIF is not carried over.
+func Thumbnails(data []byte, sizes []int) ([]Thumbnail, error) {
+	if _, ok := DetectType(data); !ok {
+		return nil, ErrUnsupportedType
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidImage, err)
+	}
+	if cfg.Width < 1 || cfg.Height < 1 || cfg.Width > MaxDimension || cfg.Height > MaxDimension {
+		return nil, fmt.Errorf("%w: %dx%d pixels, at most %dx%d allowed", ErrInvalidImage, cfg.Width, cfg.Height, MaxDimension, MaxDimension)
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidImage, err)
+	}
+	square := centerSquare(src.Bounds())
+
+	thumbnails := make([]Thumbnail, 0, len(sizes))
+	for _, size := range sizes {
+		dst := image.NewRGBA(image.Rect(0, 0, size, size))
+		draw.CatmullRom.Scale(dst, dst.Bounds(), src, square, draw.Src, nil)
+
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, dst); err != nil {
+			return nil, fmt.Errorf("failed to encode thumbnail: %v", err)
+		}
+		thumbnails = append(thumbnails, Thumbnail{Size: size, Data: buf.Bytes()})
+	}
+	return thumbnails, nil
+}
+
+// centerSquare returns the largest square centred in r
+func centerSquare(r image.Rectangle) image.Rectangle {
+	side := min(r.Dx(), r.Dy())
+	x := r.Min.X + (r.Dx()-side)/2
+	y := r.Min.Y + (r.Dy()-side)/2
+	return image.Rect(x, y, x+side, y+side)
+}
@@ -0,0 +1,81 @@
+package media
+
+import (
+	"bytes"
+	"errors"
+	"image/png"
+	"testing"
+
+	"github.com/ayush/accountability-app/backend/internal/testutil/imagetest"
+)
+
+func TestDetectType(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want string
+		ok   bool
+	}{
+		{"png", imagetest.Encode(t, 2, 2, "png"), "image/png", true},
+		{"jpeg", imagetest.Encode(t, 2, 2, "jpeg"), "image/jpeg", true},
+		{"gif", []byte("GIF89a\x01\x00\x01\x00"), "image/gif", true},
+		{"webp", []byte("RIFF\x00\x00\x00\x00WEBPVP8 "), "image/webp", true},
+		{"svg", []byte(`<svg xmlns="http://www.w3.org/2000/svg"></svg>`), "text/plain; charset=utf-8", false},
+		{"html", []byte("<html><script>alert(1)</script>"), "text/html; charset=utf-8", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := DetectType(tt.data)
+			if got != tt.want || ok != tt.ok {
+				t.Fatalf("DetectType = %q, %v; want %q, %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestThumbnails(t *testing.T) {
+	// A wide image is cropped to its centre, so the left edge of the
+	// thumbnail is red and the right edge blue
+	thumbnails, err := Thumbnails(imagetest.Encode(t, 300, 100, "jpeg"), ThumbnailSizes)
+	if err != nil {
+		t.Fatalf("Thumbnails: %v", err)
+	}
+	if len(thumbnails) != len(ThumbnailSizes) {
+		t.Fatalf("expected %d thumbnails, got %d", len(ThumbnailSizes), len(thumbnails))
+	}
+	for i, thumb := range thumbnails {
+		img, err := png.Decode(bytes.NewReader(thumb.Data))
+		if err != nil {
+			t.Fatalf("thumbnail %d is not a PNG: %v", thumb.Size, err)
+		}
+		if thumb.Size != ThumbnailSizes[i] || img.Bounds().Dx() != thumb.Size || img.Bounds().Dy() != thumb.Size {
+			t.Fatalf("thumbnail %d has bounds %v", thumb.Size, img.Bounds())
+		}
+		left, right := img.At(1, thumb.Size/2), img.At(thumb.Size-2, thumb.Size/2)
+		if r, _, b, _ := left.RGBA(); r < 0xc000 || b > 0x4000 {
+			t.Errorf("thumbnail %d: expected red on the left, got %v", thumb.Size, left)
+		}
+		if r, _, b, _ := right.RGBA(); b < 0xc000 || r > 0x4000 {
+			t.Errorf("thumbnail %d: expected blue on the right, got %v", thumb.Size, right)
+		}
+	}
+}
+
+func TestThumbnailsRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"not an image", []byte("hello, world"), ErrUnsupportedType},
+		{"truncated", imagetest.Encode(t, 50, 50, "png")[:40], ErrInvalidImage},
+		{"too large", imagetest.Encode(t, MaxDimension+1, 1, "png"), ErrInvalidImage},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Thumbnails(tt.data, ThumbnailSizes); !errors.Is(err, tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
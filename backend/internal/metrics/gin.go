@@ -0,0 +1,45 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// knownMethods are the request methods recorded under their own name
+var knownMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodPost:    true,
+	http.MethodPut:     true,
+	http.MethodPatch:   true,
+	http.MethodDelete:  true,
+	http.MethodConnect: true,
+	http.MethodOptions: true,
+	http.MethodTrace:   true,
+}
+
+// GinMiddleware records request counts and latencies per route. Requests that
+// do not match a route are grouped under "unmatched" and methods outside the
+// standard set under "other" to keep cardinality bounded.
+func GinMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		method := c.Request.Method
+		if !knownMethods[method] {
+			method = "other"
+		}
+
+		HTTPRequests.WithLabelValues(method, route, strconv.Itoa(c.Writer.Status())).Inc()
+		HTTPRequestDuration.WithLabelValues(method, route).Observe(time.Since(start).Seconds())
+	}
+}
@@ -0,0 +1,35 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestGinMiddlewareGroupsUnknownMethods(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(GinMiddleware())
+
+	before := testutil.ToFloat64(HTTPRequests.WithLabelValues("other", "unmatched", "404"))
+	for _, method := range []string{"FOO1", "FOO2"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(method, "/nowhere", nil))
+	}
+	if got := testutil.ToFloat64(HTTPRequests.WithLabelValues("other", "unmatched", "404")) - before; got != 2 {
+		t.Fatalf("expected 2 requests counted as other, got %v", got)
+	}
+
+	for _, method := range []string{"FOO1", "FOO2"} {
+		if HTTPRequests.DeleteLabelValues(method, "unmatched", "404") {
+			t.Errorf("expected no series for method %q", method)
+		}
+	}
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/nowhere", nil))
+	if got := testutil.ToFloat64(HTTPRequests.WithLabelValues(http.MethodGet, "unmatched", "404")); got < 1 {
+		t.Fatalf("expected GET to keep its own label, got %v", got)
+	}
+}
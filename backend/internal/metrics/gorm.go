@@ -0,0 +1,75 @@
+package metrics
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const gormStartKey = "metrics:start"
+
+// GormPlugin records query durations and errors for every GORM operation.
+// Register it with db.Use(metrics.GormPlugin{}).
+type GormPlugin struct{}
+
+// Name implements gorm.Plugin
+func (GormPlugin) Name() string {
+	return "metrics"
+}
+
+// Initialize implements gorm.Plugin
+func (GormPlugin) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+
+	hooks := []struct {
+		operation string
+		before    func(name string, fn func(*gorm.DB)) error
+		after     func(name string, fn func(*gorm.DB)) error
+	}{
+		{"create", cb.Create().Before("gorm:create").Register, cb.Create().After("gorm:create").Register},
+		{"query", cb.Query().Before("gorm:query").Register, cb.Query().After("gorm:query").Register},
+		{"update", cb.Update().Before("gorm:update").Register, cb.Update().After("gorm:update").Register},
+		{"delete", cb.Delete().Before("gorm:delete").Register, cb.Delete().After("gorm:delete").Register},
+		{"row", cb.Row().Before("gorm:row").Register, cb.Row().After("gorm:row").Register},
+		{"raw", cb.Raw().Before("gorm:raw").Register, cb.Raw().After("gorm:raw").Register},
+	}
+
+	for _, hook := range hooks {
+		if err := hook.before("metrics:before_"+hook.operation, startTimer); err != nil {
+			return err
+		}
+		if err := hook.after("metrics:after_"+hook.operation, observeQuery(hook.operation)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func startTimer(db *gorm.DB) {
+	db.InstanceSet(gormStartKey, time.Now())
+}
+
+func observeQuery(operation string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		value, ok := db.InstanceGet(gormStartKey)
+		if !ok {
+			return
+		}
+		start, ok := value.(time.Time)
+		if !ok {
+			return
+		}
+
+		table := db.Statement.Table
+		if table == "" {
+			table = "unknown"
+		}
+
+		DBQueryDuration.WithLabelValues(operation, table).Observe(time.Since(start).Seconds())
+		if db.Error != nil && !errors.Is(db.Error, gorm.ErrRecordNotFound) {
+			DBQueryErrors.WithLabelValues(operation, table).Inc()
+		}
+	}
+}
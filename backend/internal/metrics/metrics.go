@@ -0,0 +1,119 @@
+// Package metrics defines the Prometheus collectors exported by the server
+// and the instrumentation that feeds them.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "accountability"
+
+var (
+	// HTTPRequests counts handled HTTP requests by method, route and status code
+	HTTPRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "Total number of HTTP requests by method, route and status code.",
+	}, []string{"method", "route", "status"})
+
+	// HTTPRequestDuration observes HTTP request latencies by method and route
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "HTTP request latencies in seconds by method and route.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	// DBQueryDuration observes database query durations by operation and table
+	DBQueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "db",
+		Name:      "query_duration_seconds",
+		Help:      "Database query durations in seconds by operation and table.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"operation", "table"})
+
+	// DBQueryErrors counts failed database queries by operation and table
+	DBQueryErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "db",
+		Name:      "query_errors_total",
+		Help:      "Total number of failed database queries by operation and table.",
+	}, []string{"operation", "table"})
+
+	// WSConnections tracks currently registered WebSocket clients
+	WSConnections = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "websocket",
+		Name:      "connections_active",
+		Help:      "Number of WebSocket clients currently registered with the hub.",
+	})
+
+	// WSRooms tracks rooms that currently have at least one client
+	WSRooms = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "websocket",
+		Name:      "rooms_active",
+		Help:      "Number of WebSocket rooms currently open.",
+	})
+
+	// WSMessagesReceived counts messages read from clients by message type
+	WSMessagesReceived = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "websocket",
+		Name:      "messages_received_total",
+		Help:      "Total number of WebSocket messages received from clients by type.",
+	}, []string{"type"})
+
+	// WSMessagesSent counts messages written to clients by message type
+	WSMessagesSent = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "websocket",
+		Name:      "messages_sent_total",
+		Help:      "Total number of WebSocket messages written to clients by type.",
+	}, []string{"type"})
+
+	// WSMessagesDropped counts messages discarded because a client's send buffer was full
+	WSMessagesDropped = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "websocket",
+		Name:      "messages_dropped_total",
+		Help:      "Total number of WebSocket messages dropped because a client's send buffer was full.",
+	})
+
+	// WSMessagesRateLimited counts client messages discarded for exceeding the message rate limit
+	WSMessagesRateLimited = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "websocket",
+		Name:      "messages_rate_limited_total",
+		Help:      "Total number of WebSocket messages from clients discarded by the message rate limit.",
+	})
+
+	// WSJoinsRejected counts clients turned away because their room was full
+	WSJoinsRejected = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "websocket",
+		Name:      "joins_rejected_total",
+		Help:      "Total number of WebSocket clients rejected because their room was at capacity.",
+	})
+
+	// WSPingRTT observes the round trip time between a ping and its pong
+	WSPingRTT = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "websocket",
+		Name:      "ping_rtt_seconds",
+		Help:      "Round trip time between WebSocket pings and their pongs in seconds.",
+		Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+	})
+)
+
+// Handler returns the HTTP handler serving metrics in the Prometheus exposition format
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
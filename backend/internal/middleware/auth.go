@@ -1,43 +1,186 @@
 package middleware
 
 import (
+	"errors"
 	"net/http"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/ayush/accountability-app/backend/internal/auth"
+	"github.com/ayush/accountability-app/backend/internal/logger"
+	"github.com/ayush/accountability-app/backend/internal/repository"
 
 	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
 )
 
-// AuthMiddleware verifies the JWT token and sets the user in the context
-func AuthMiddleware() gin.HandlerFunc {
+// lastUseInterval limits how often the last use of a session or API key is
+// written, so busy clients do not turn every request into a database write
+const lastUseInterval = time.Minute
+
+// AuthMiddleware verifies the JWT token and sets the user in the context.
+// When sessions is not nil the token's session must not be revoked. When keys
+// is not nil it also accepts API keys, either as the bearer token or in the
+// X-API-Key header; routes they may reach must use RequireScope.
+func AuthMiddleware(sessions repository.SessionRepository, keys repository.APIKeyRepository) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header is required"})
-			c.Abort()
-			return
+		credential := c.GetHeader("X-API-Key")
+		if credential == "" {
+			authHeader := c.GetHeader("Authorization")
+			if authHeader == "" {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header is required"})
+				c.Abort()
+				return
+			}
+
+			// Check if the Authorization header has the Bearer scheme
+			parts := strings.Split(authHeader, " ")
+			if len(parts) != 2 || parts[0] != "Bearer" {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authorization header format"})
+				c.Abort()
+				return
+			}
+			credential = parts[1]
 		}
 
-		// Check if the Authorization header has the Bearer scheme
-		parts := strings.Split(authHeader, " ")
-		if len(parts) != 2 || parts[0] != "Bearer" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authorization header format"})
-			c.Abort()
+		if keys != nil && auth.IsAPIKey(credential) {
+			authenticateAPIKey(c, keys, credential)
 			return
 		}
 
 		// Validate the token
-		claims, err := auth.ValidateToken(parts[1])
+		claims, err := auth.ValidateToken(credential)
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
 			c.Abort()
 			return
 		}
 
-		// Set the user ID in the context
+		// Set the user ID in the context; tokens issued before roles existed
+		// carry none and belong to ordinary users
+		role := claims.Role
+		if role == "" {
+			role = auth.RoleUser
+		}
 		c.Set("user_id", claims.UserID)
 		c.Set("user_email", claims.Email)
+		c.Set("user_role", role)
+
+		if sessions != nil && !checkSession(c, sessions, claims) {
+			return
+		}
+		setRequestUser(c, claims.UserID)
+
+		c.Next()
+	}
+}
+
+// checkSession refuses tokens whose session was revoked, or that were issued
+// before sessions existed, and records when the session was last seen
+func checkSession(c *gin.Context, sessions repository.SessionRepository, claims *auth.Claims) bool {
+	ctx := c.Request.Context()
+	now := time.Now()
+
+	if claims.SessionID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Session expired, log in again"})
+		c.Abort()
+		return false
+	}
+
+	session, err := sessions.GetActive(ctx, claims.SessionID, now)
+	if errors.Is(err, repository.ErrNotFound) || (err == nil && session.UserID != claims.UserID) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Session has been revoked, log in again"})
+		c.Abort()
+		return false
+	}
+	if err != nil {
+		logger.FromContext(ctx).Error("Failed to look up session", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check session"})
+		c.Abort()
+		return false
+	}
+
+	if now.Sub(session.LastSeenAt) >= lastUseInterval || session.IP != c.ClientIP() {
+		if err := sessions.Touch(ctx, session.ID, c.ClientIP(), now); err != nil {
+			logger.FromContext(ctx).Warn("Failed to record session use", zap.Error(err), zap.Uint("session_id", session.ID))
+		}
+	}
+
+	c.Set("session_id", session.ID)
+	return true
+}
+
+// authenticateAPIKey sets the key's owner and scopes in the context. The
+// owner's role is loaded by RequireActiveUser.
+func authenticateAPIKey(c *gin.Context, keys repository.APIKeyRepository, credential string) {
+	ctx := c.Request.Context()
+	now := time.Now()
+
+	key, err := keys.GetActiveByHash(ctx, auth.HashOpaqueToken(credential), now)
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid, expired or revoked API key"})
+		c.Abort()
+		return
+	}
+	if err != nil {
+		logger.FromContext(ctx).Error("Failed to look up API key", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check API key"})
+		c.Abort()
+		return
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= lastUseInterval || key.LastUsedIP != c.ClientIP() {
+		if err := keys.RecordUse(ctx, key.ID, c.ClientIP(), now); err != nil {
+			logger.FromContext(ctx).Warn("Failed to record API key use", zap.Error(err), zap.Uint("api_key_id", key.ID))
+		}
+	}
+
+	scopes := make([]auth.Scope, 0, len(key.ScopeList()))
+	for _, s := range key.ScopeList() {
+		scopes = append(scopes, auth.Scope(s))
+	}
+	c.Set("user_id", key.UserID)
+	c.Set("user_role", auth.RoleUser)
+	c.Set("api_key_id", key.ID)
+	c.Set("api_key_scopes", scopes)
+	setRequestUser(c, key.UserID, zap.Uint("api_key_id", key.ID))
+
+	c.Next()
+}
+
+// setRequestUser adds the user to the request-scoped logger
+func setRequestUser(c *gin.Context, userID uint, fields ...zap.Field) {
+	ctx := c.Request.Context()
+	log := logger.FromContext(ctx).With(append([]zap.Field{zap.Uint("user_id", userID)}, fields...)...)
+	c.Request = c.Request.WithContext(logger.NewContext(ctx, log))
+}
+
+// RequireScope only lets API keys through that were granted scope. Requests
+// authenticated with a JWT are not limited. It must run after AuthMiddleware.
+func RequireScope(scope auth.Scope) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if value, ok := c.Get("api_key_scopes"); ok {
+			if scopes, _ := value.([]auth.Scope); !slices.Contains(scopes, scope) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "API key lacks the " + string(scope) + " scope"})
+				c.Abort()
+				return
+			}
+		}
+
+		c.Next()
+	}
+}
+
+// RejectAPIKeys refuses requests authenticated with an API key, for routes
+// that manage the account itself. It must run after AuthMiddleware.
+func RejectAPIKeys() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := c.Get("api_key_id"); ok {
+			c.JSON(http.StatusForbidden, gin.H{"error": "API keys cannot be used for this endpoint"})
+			c.Abort()
+			return
+		}
 
 		c.Next()
 	}
@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ayush/accountability-app/backend/internal/logger"
+	"github.com/ayush/accountability-app/backend/internal/origin"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// CORS answers preflight requests and adds the CORS response headers for
+// origins the policy allows. Disallowed origins get no CORS headers, so the
+// browser refuses to expose the response; disallowed preflights get a 403.
+func CORS(policy *origin.Policy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestOrigin := c.GetHeader("Origin")
+		if requestOrigin == "" {
+			c.Next()
+			return
+		}
+
+		header := c.Writer.Header()
+		header.Add("Vary", "Origin")
+		preflight := c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != ""
+
+		if !policy.Allowed(requestOrigin) {
+			if preflight {
+				logger.FromContext(c.Request.Context()).Info("Rejected CORS preflight",
+					zap.String("origin", requestOrigin))
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+			c.Next()
+			return
+		}
+
+		cfg := policy.Config()
+		header.Set("Access-Control-Allow-Origin", requestOrigin)
+		if cfg.AllowCredentials {
+			header.Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		if preflight {
+			header.Add("Vary", "Access-Control-Request-Method")
+			header.Add("Vary", "Access-Control-Request-Headers")
+			header.Set("Access-Control-Allow-Methods", strings.Join(cfg.AllowedMethods, ", "))
+			if len(cfg.AllowedHeaders) > 0 {
+				header.Set("Access-Control-Allow-Headers", strings.Join(cfg.AllowedHeaders, ", "))
+			}
+			if cfg.MaxAgeSeconds > 0 {
+				header.Set("Access-Control-Max-Age", strconv.Itoa(cfg.MaxAgeSeconds))
+			}
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+
+		if len(cfg.ExposedHeaders) > 0 {
+			header.Set("Access-Control-Expose-Headers", strings.Join(cfg.ExposedHeaders, ", "))
+		}
+		c.Next()
+	}
+}
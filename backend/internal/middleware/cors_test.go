@@ -0,0 +1,102 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ayush/accountability-app/backend/internal/config"
+	"github.com/ayush/accountability-app/backend/internal/origin"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newCORSRouter(t *testing.T) *gin.Engine {
+	t.Helper()
+
+	cfg := config.DefaultCORSConfig()
+	cfg.AllowedOrigins = []string{"https://*.example.com"}
+	policy, err := origin.NewPolicy(cfg)
+	if err != nil {
+		t.Fatalf("NewPolicy: %v", err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(CORS(policy))
+	router.GET("/api/things", func(c *gin.Context) {
+		c.Header(RequestIDHeader, "abc")
+		c.Status(http.StatusOK)
+	})
+	return router
+}
+
+func serve(router *gin.Engine, method, origin string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/api/things", nil)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if origin != "" {
+		req.Header.Set("Origin", origin)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestCORSPreflight(t *testing.T) {
+	router := newCORSRouter(t)
+	header := http.Header{}
+	header.Set("Access-Control-Request-Method", "POST")
+	header.Set("Access-Control-Request-Headers", "Authorization, Content-Type")
+
+	w := serve(router, http.MethodOptions, "https://app.example.com", header)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", w.Code)
+	}
+	for name, want := range map[string]string{
+		"Access-Control-Allow-Origin":      "https://app.example.com",
+		"Access-Control-Allow-Credentials": "true",
+		"Access-Control-Max-Age":           "600",
+	} {
+		if got := w.Header().Get(name); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+	if w.Header().Get("Access-Control-Allow-Methods") == "" || w.Header().Get("Access-Control-Allow-Headers") == "" {
+		t.Error("preflight response is missing allowed methods or headers")
+	}
+
+	w = serve(router, http.MethodOptions, "https://evil.test", header)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("expected a disallowed preflight to get 403, got %d", w.Code)
+	}
+}
+
+func TestCORSSimpleRequest(t *testing.T) {
+	router := newCORSRouter(t)
+
+	w := serve(router, http.MethodGet, "https://app.example.com", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "https://app.example.com" {
+		t.Errorf("Access-Control-Allow-Origin = %q", got)
+	}
+	if got := w.Header().Get("Access-Control-Expose-Headers"); got != "X-Request-ID, Retry-After, Link, X-RateLimit-Limit, X-RateLimit-Remaining, X-RateLimit-Reset" {
+		t.Errorf("Access-Control-Expose-Headers = %q", got)
+	}
+	if got := w.Header().Get("Vary"); got != "Origin" {
+		t.Errorf("Vary = %q, want Origin", got)
+	}
+
+	w = serve(router, http.MethodGet, "https://evil.test", nil)
+	if w.Code != http.StatusOK || w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("disallowed origin got CORS headers: %v", w.Header())
+	}
+
+	w = serve(router, http.MethodGet, "", nil)
+	if w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Error("same-origin request got CORS headers")
+	}
+}
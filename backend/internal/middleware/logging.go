@@ -0,0 +1,103 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"regexp"
+	"runtime/debug"
+	"time"
+
+	"github.com/ayush/accountability-app/backend/internal/logger"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// RequestIDHeader is the header used to receive and propagate request IDs
+const RequestIDHeader = "X-Request-ID"
+
+// validRequestID limits client-supplied request IDs to safe, bounded values
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// RequestLogger assigns every request an ID, honoring a valid incoming
+// X-Request-ID, echoes it in the response, stores a request-scoped logger in
+// the request context and logs the request once it has been handled.
+func RequestLogger() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		requestID := c.GetHeader(RequestIDHeader)
+		if !validRequestID.MatchString(requestID) {
+			requestID = newRequestID()
+		}
+		c.Header(RequestIDHeader, requestID)
+		c.Set("request_id", requestID)
+
+		fields := []zap.Field{zap.String("request_id", requestID)}
+		if sc := trace.SpanContextFromContext(c.Request.Context()); sc.IsValid() {
+			fields = append(fields, zap.String("trace_id", sc.TraceID().String()))
+		}
+		ctx := logger.NewContext(c.Request.Context(), logger.With(fields...))
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		status := c.Writer.Status()
+
+		fields = []zap.Field{
+			zap.String("method", c.Request.Method),
+			zap.String("route", route),
+			zap.String("path", c.Request.URL.Path),
+			zap.Int("status", status),
+			zap.Duration("latency", time.Since(start)),
+			zap.String("client_ip", c.ClientIP()),
+			zap.String("user_agent", c.Request.UserAgent()),
+			zap.Int("response_size", c.Writer.Size()),
+		}
+		if len(c.Errors) > 0 {
+			fields = append(fields, zap.String("errors", c.Errors.String()))
+		}
+
+		// The context logger picks up user_id once AuthMiddleware has run
+		log := logger.FromContext(c.Request.Context())
+		switch {
+		case status >= http.StatusInternalServerError:
+			log.Error("HTTP request", fields...)
+		case status >= http.StatusBadRequest:
+			log.Warn("HTTP request", fields...)
+		default:
+			log.Info("HTTP request", fields...)
+		}
+	}
+}
+
+// Recovery recovers from panics in handlers, logs them with the request-scoped
+// logger and responds with a 500
+func Recovery() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			if r := recover(); r != nil {
+				logger.FromContext(c.Request.Context()).Error("Recovered from panic",
+					zap.Any("panic", r),
+					zap.ByteString("stack", debug.Stack()))
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			}
+		}()
+
+		c.Next()
+	}
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return time.Now().UTC().Format("20060102T150405.000000000")
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ayush/accountability-app/backend/internal/logger"
+	"github.com/ayush/accountability-app/backend/internal/ratelimit"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// RateLimitByIP limits requests per client IP
+func RateLimitByIP(limiter *ratelimit.Limiter) gin.HandlerFunc {
+	return rateLimit("ip", func(ctx context.Context, c *gin.Context) (ratelimit.Result, error) {
+		return limiter.AllowIP(ctx, c.ClientIP())
+	})
+}
+
+// RateLimitByAccount limits requests per authenticated user. It must run
+// after AuthMiddleware.
+func RateLimitByAccount(limiter *ratelimit.Limiter) gin.HandlerFunc {
+	return rateLimit("account", func(ctx context.Context, c *gin.Context) (ratelimit.Result, error) {
+		return limiter.AllowAccount(ctx, c.GetUint("user_id"))
+	})
+}
+
+// rateLimit adds X-RateLimit-* headers and refuses requests over the limit
+// with 429 and Retry-After. If the store fails the request is let through.
+func rateLimit(scope string, check func(context.Context, *gin.Context) (ratelimit.Result, error)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		res, err := check(ctx, c)
+		if err != nil {
+			logger.FromContext(ctx).Error("Rate limit check failed, allowing request",
+				zap.String("scope", scope), zap.Error(err))
+			c.Next()
+			return
+		}
+
+		if res.Limit > 0 {
+			header := c.Writer.Header()
+			header.Set("X-RateLimit-Limit", strconv.Itoa(res.Limit))
+			header.Set("X-RateLimit-Remaining", strconv.Itoa(res.Remaining))
+			header.Set("X-RateLimit-Reset", strconv.FormatInt(res.ResetAt.Unix(), 10))
+		}
+
+		if !res.Allowed {
+			logger.FromContext(ctx).Warn("Rate limit exceeded",
+				zap.String("scope", scope),
+				zap.String("client_ip", c.ClientIP()),
+				zap.Duration("retry_after", res.RetryAfter))
+			tooManyRequests(c, res.RetryAfter, "Too many requests")
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// tooManyRequests aborts with 429 and a Retry-After header
+func tooManyRequests(c *gin.Context, retryAfter time.Duration, message string) {
+	c.Header("Retry-After", ratelimit.RetryAfterHeader(retryAfter))
+	c.JSON(http.StatusTooManyRequests, gin.H{"error": message})
+	c.Abort()
+}
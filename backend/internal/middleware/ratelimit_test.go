@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ayush/accountability-app/backend/internal/config"
+	"github.com/ayush/accountability-app/backend/internal/ratelimit"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRateLimitByIP(t *testing.T) {
+	cfg := config.DefaultRateLimitConfig()
+	cfg.IP = config.RateLimitRule{Requests: 2, WindowSeconds: 60}
+	limiter := ratelimit.New(ratelimit.NewMemoryStore(), cfg)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(RateLimitByIP(limiter))
+	router.GET("/api/things", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	request := func(ip string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/things", nil)
+		req.RemoteAddr = ip + ":1234"
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	for i, remaining := range []string{"1", "0"} {
+		w := request("10.0.0.1")
+		if w.Code != http.StatusOK {
+			t.Fatalf("request %d: expected 200, got %d", i+1, w.Code)
+		}
+		if got := w.Header().Get("X-RateLimit-Limit"); got != "2" {
+			t.Fatalf("X-RateLimit-Limit = %q, want 2", got)
+		}
+		if got := w.Header().Get("X-RateLimit-Remaining"); got != remaining {
+			t.Fatalf("request %d: X-RateLimit-Remaining = %q, want %s", i+1, got, remaining)
+		}
+	}
+
+	w := request("10.0.0.1")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429, got %d", w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "60" {
+		t.Fatalf("Retry-After = %q, want 60", got)
+	}
+
+	if w := request("10.0.0.2"); w.Code != http.StatusOK {
+		t.Fatalf("another IP should not be limited, got %d", w.Code)
+	}
+}
@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/ayush/accountability-app/backend/internal/auth"
+	"github.com/ayush/accountability-app/backend/internal/logger"
+	"github.com/ayush/accountability-app/backend/internal/repository"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// RequireActiveUser refuses tokens of accounts that were deleted or
+// disabled since the token was issued, and replaces the role from the token
+// with the current one so role changes apply at once. It must run after
+// AuthMiddleware.
+func RequireActiveUser(users repository.UserRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, err := users.GetByID(c.Request.Context(), c.GetUint("user_id"))
+		if errors.Is(err, repository.ErrNotFound) || err == nil && user.IsDeleted() {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User no longer exists"})
+			c.Abort()
+			return
+		}
+		if err != nil {
+			logger.FromContext(c.Request.Context()).Error("Failed to look up user", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check account"})
+			c.Abort()
+			return
+		}
+
+		if user.IsDisabled() {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Account is disabled"})
+			c.Abort()
+			return
+		}
+
+		c.Set("user_role", auth.Role(user.Role))
+		c.Next()
+	}
+}
+
+// RequirePermission only lets through users whose role grants permission.
+// It must run after AuthMiddleware.
+func RequirePermission(permission auth.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role, _ := c.Get("user_role")
+		if r, ok := role.(auth.Role); !ok || !r.Can(permission) {
+			logger.FromContext(c.Request.Context()).Info("Permission denied", zap.String("permission", string(permission)))
+			c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/ayush/accountability-app/backend/internal/logger"
+	"github.com/ayush/accountability-app/backend/internal/repository"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// RequireVerifiedEmail only lets through users who have verified their email
+// address when required is true, and does nothing otherwise. It must run
+// after AuthMiddleware.
+func RequireVerifiedEmail(users repository.UserRepository, required bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !required {
+			c.Next()
+			return
+		}
+
+		user, err := users.GetByID(c.Request.Context(), c.GetUint("user_id"))
+		if err != nil {
+			logger.FromContext(c.Request.Context()).Error("Failed to check email verification", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check email verification"})
+			c.Abort()
+			return
+		}
+
+		if !user.IsEmailVerified() {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Email address must be verified"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
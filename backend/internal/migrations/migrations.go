@@ -0,0 +1,283 @@
+// Package migrations applies the versioned SQL migrations embedded in the
+// binary and records them in the schema_migrations table.
+package migrations
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/ayush/accountability-app/backend/internal/logger"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// advisoryLockID identifies the Postgres advisory lock held while migrating,
+// so replicas starting at the same time apply migrations one at a time
+const advisoryLockID = 727_246_183
+
+//go:embed sql/*.sql
+var files embed.FS
+
+// fileName matches migration files such as 0001_initial_schema.up.sql
+var fileName = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// Migration is a single versioned schema change
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status describes whether a migration has been applied
+type Status struct {
+	Version   int64
+	Name      string
+	Applied   bool
+	AppliedAt *time.Time
+	// Unknown is set for versions recorded in the database that this binary does not know about
+	Unknown bool
+}
+
+// schemaMigration is a row of the schema_migrations table
+type schemaMigration struct {
+	Version   int64     `gorm:"primaryKey;autoIncrement:false"`
+	Name      string    `gorm:"not null"`
+	AppliedAt time.Time `gorm:"not null"`
+}
+
+func (schemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// Migrator applies migrations to a database
+type Migrator struct {
+	db         *gorm.DB
+	migrations []Migration
+}
+
+// New creates a migrator for the embedded migrations
+func New(db *gorm.DB) (*Migrator, error) {
+	migrations, err := Load(files)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// Load reads migrations from the sql directory of fsys, ordered by version.
+// Every version must have both an up and a down file.
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, "sql")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %v", err)
+	}
+
+	byVersion := map[int64]*Migration{}
+	for _, entry := range entries {
+		match := fileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("invalid migration file name %q", entry.Name())
+		}
+
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version in %q: %v", entry.Name(), err)
+		}
+
+		contents, err := fs.ReadFile(fsys, path.Join("sql", entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %q: %v", entry.Name(), err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		} else if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has conflicting names %q and %q", version, m.Name, match[2])
+		}
+
+		// 1_x.up.sql and 0001_x.up.sql are the same version; silently
+		// keeping one of them would depend on directory order
+		target := &m.Down
+		if match[3] == "up" {
+			target = &m.Up
+		}
+		if *target != "" {
+			return nil, fmt.Errorf("migration %d_%s has more than one %s file", version, m.Name, match[3])
+		}
+		*target = string(contents)
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s must have both up and down files", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// Up applies every pending migration in order and returns the ones applied
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var applied []Migration
+	err := m.withLock(ctx, func(conn *gorm.DB) error {
+		done, err := appliedVersions(conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			if _, ok := done[migration.Version]; ok {
+				continue
+			}
+
+			logger.Info("Applying migration",
+				zap.Int64("version", migration.Version),
+				zap.String("name", migration.Name))
+
+			err := conn.Transaction(func(tx *gorm.DB) error {
+				if err := tx.Exec(migration.Up).Error; err != nil {
+					return err
+				}
+				return tx.Create(&schemaMigration{
+					Version:   migration.Version,
+					Name:      migration.Name,
+					AppliedAt: time.Now(),
+				}).Error
+			})
+			if err != nil {
+				return fmt.Errorf("migration %d_%s failed: %v", migration.Version, migration.Name, err)
+			}
+			applied = append(applied, migration)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down rolls back the given number of most recently applied migrations and
+// returns the ones rolled back
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	var reverted []Migration
+	err := m.withLock(ctx, func(conn *gorm.DB) error {
+		done, err := appliedVersions(conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+			migration := m.migrations[i]
+			if _, ok := done[migration.Version]; !ok {
+				continue
+			}
+
+			logger.Info("Reverting migration",
+				zap.Int64("version", migration.Version),
+				zap.String("name", migration.Name))
+
+			err := conn.Transaction(func(tx *gorm.DB) error {
+				if err := tx.Exec(migration.Down).Error; err != nil {
+					return err
+				}
+				return tx.Delete(&schemaMigration{}, migration.Version).Error
+			})
+			if err != nil {
+				return fmt.Errorf("reverting migration %d_%s failed: %v", migration.Version, migration.Name, err)
+			}
+			reverted = append(reverted, migration)
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// Status lists every known migration and whether it has been applied, followed
+// by any applied versions this binary does not know about
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	var statuses []Status
+	err := m.withLock(ctx, func(conn *gorm.DB) error {
+		done, err := appliedVersions(conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			status := Status{Version: migration.Version, Name: migration.Name}
+			if row, ok := done[migration.Version]; ok {
+				status.Applied = true
+				status.AppliedAt = &row.AppliedAt
+				delete(done, migration.Version)
+			}
+			statuses = append(statuses, status)
+		}
+
+		var unknown []Status
+		for _, row := range done {
+			appliedAt := row.AppliedAt
+			unknown = append(unknown, Status{
+				Version:   row.Version,
+				Name:      row.Name,
+				Applied:   true,
+				AppliedAt: &appliedAt,
+				Unknown:   true,
+			})
+		}
+		sort.Slice(unknown, func(i, j int) bool { return unknown[i].Version < unknown[j].Version })
+		statuses = append(statuses, unknown...)
+		return nil
+	})
+	return statuses, err
+}
+
+// withLock runs fn on a single connection holding the migrations advisory
+// lock, creating the schema_migrations table first if needed
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *gorm.DB) error) error {
+	return m.db.WithContext(ctx).Connection(func(conn *gorm.DB) error {
+		if err := conn.Exec("SELECT pg_advisory_lock(?)", advisoryLockID).Error; err != nil {
+			return fmt.Errorf("failed to acquire migration lock: %v", err)
+		}
+		defer func() {
+			if err := conn.Exec("SELECT pg_advisory_unlock(?)", advisoryLockID).Error; err != nil {
+				logger.Error("Failed to release migration lock", zap.Error(err))
+			}
+		}()
+
+		if err := conn.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+			version    BIGINT PRIMARY KEY,
+			name       TEXT NOT NULL,
+			applied_at TIMESTAMPTZ NOT NULL
+		)`).Error; err != nil {
+			return fmt.Errorf("failed to create schema_migrations table: %v", err)
+		}
+
+		return fn(conn)
+	})
+}
+
+func appliedVersions(conn *gorm.DB) (map[int64]schemaMigration, error) {
+	var rows []schemaMigration
+	if err := conn.Order("version").Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %v", err)
+	}
+
+	done := make(map[int64]schemaMigration, len(rows))
+	for _, row := range rows {
+		done[row.Version] = row
+	}
+	return done, nil
+}
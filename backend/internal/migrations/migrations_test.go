@@ -0,0 +1,322 @@
+package migrations
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// sqlFiles builds a file system with the given files in its sql directory
+func sqlFiles(names ...string) fstest.MapFS {
+	fsys := fstest.MapFS{}
+	for _, name := range names {
+		fsys["sql/"+name] = &fstest.MapFile{Data: []byte("-- " + name)}
+	}
+	return fsys
+}
+
+func TestLoadPairsAndOrdersMigrations(t *testing.T) {
+	migrations, err := Load(sqlFiles(
+		"0010_add_index.down.sql",
+		"0002_add_calls.up.sql",
+		"0010_add_index.up.sql",
+		"0001_initial_schema.up.sql",
+		"0002_add_calls.down.sql",
+		"0001_initial_schema.down.sql",
+	))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	want := []Migration{
+		{Version: 1, Name: "initial_schema", Up: "-- 0001_initial_schema.up.sql", Down: "-- 0001_initial_schema.down.sql"},
+		{Version: 2, Name: "add_calls", Up: "-- 0002_add_calls.up.sql", Down: "-- 0002_add_calls.down.sql"},
+		{Version: 10, Name: "add_index", Up: "-- 0010_add_index.up.sql", Down: "-- 0010_add_index.down.sql"},
+	}
+	if len(migrations) != len(want) {
+		t.Fatalf("expected %d migrations, got %d", len(want), len(migrations))
+	}
+	for i, m := range migrations {
+		if m != want[i] {
+			t.Errorf("migration %d: expected %+v, got %+v", i, want[i], m)
+		}
+	}
+}
+
+func TestLoadRejectsInvalidSets(t *testing.T) {
+	tests := []struct {
+		name  string
+		files []string
+		err   string
+	}{
+		{
+			name:  "missing down",
+			files: []string{"0001_initial_schema.up.sql"},
+			err:   "must have both up and down files",
+		},
+		{
+			name:  "missing up",
+			files: []string{"0001_initial_schema.down.sql"},
+			err:   "must have both up and down files",
+		},
+		{
+			name:  "conflicting names",
+			files: []string{"0001_initial_schema.up.sql", "0001_other.down.sql"},
+			err:   "conflicting names",
+		},
+		{
+			name:  "duplicate version",
+			files: []string{"0001_initial_schema.up.sql", "1_initial_schema.up.sql", "0001_initial_schema.down.sql"},
+			err:   "more than one up file",
+		},
+		{
+			name:  "no version",
+			files: []string{"initial_schema.up.sql"},
+			err:   "invalid migration file name",
+		},
+		{
+			name:  "no direction",
+			files: []string{"0001_initial_schema.sql"},
+			err:   "invalid migration file name",
+		},
+		{
+			name:  "upper case name",
+			files: []string{"0001_Initial.up.sql"},
+			err:   "invalid migration file name",
+		},
+		{
+			name:  "version out of range",
+			files: []string{"99999999999999999999_big.up.sql"},
+			err:   "invalid migration version",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load(sqlFiles(tt.files...))
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("expected error containing %q, got %q", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestLoadRequiresSQLDirectory(t *testing.T) {
+	if _, err := Load(fstest.MapFS{}); err == nil {
+		t.Fatal("expected an error without a sql directory")
+	}
+}
+
+func TestEmbeddedMigrationsLoad(t *testing.T) {
+	migrations, err := Load(files)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("expected embedded migrations")
+	}
+	for i, m := range migrations {
+		if m.Version != int64(i+1) {
+			t.Errorf("expected migration %d to have version %d, got %d", i, i+1, m.Version)
+		}
+	}
+}
+
+// openTestDB connects to the database in TEST_DATABASE_URL, skipping the test
+// when it is not set, and gives the test an empty schema of its own
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("failed to get connection pool: %v", err)
+	}
+	// One connection, so the search_path below applies to every statement
+	sqlDB.SetMaxOpenConns(1)
+
+	schema := fmt.Sprintf("migrations_test_%d", time.Now().UnixNano())
+	if err := db.Exec("CREATE SCHEMA " + schema).Error; err != nil {
+		t.Fatalf("failed to create schema: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Exec("DROP SCHEMA " + schema + " CASCADE")
+		sqlDB.Close()
+	})
+	if err := db.Exec("SET search_path TO " + schema + ", public").Error; err != nil {
+		t.Fatalf("failed to set search_path: %v", err)
+	}
+	return db
+}
+
+func TestUserProfilesRenamesDuplicateUsernames(t *testing.T) {
+	db := openTestDB(t)
+
+	all, err := Load(files)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	var before []Migration
+	for _, m := range all {
+		if m.Name == "user_profiles" {
+			break
+		}
+		before = append(before, m)
+	}
+	if _, err := (&Migrator{db: db, migrations: before}).Up(t.Context()); err != nil {
+		t.Fatalf("migrating to before user_profiles: %v", err)
+	}
+
+	// bob would be renamed to bob-2, which is already taken
+	err = db.Exec(`INSERT INTO users (id, username, email, password) VALUES
+		(1, 'Bob', 'bob1@example.com', 'x'),
+		(2, 'bob', 'bob2@example.com', 'x'),
+		(3, 'bob-2', 'bob3@example.com', 'x'),
+		(4, 'BOB', 'bob4@example.com', 'x')`).Error
+	if err != nil {
+		t.Fatalf("failed to insert users: %v", err)
+	}
+
+	if _, err := (&Migrator{db: db, migrations: all}).Up(t.Context()); err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+
+	var rows []struct {
+		ID       uint
+		Username string
+	}
+	if err := db.Raw("SELECT id, username FROM users ORDER BY id").Scan(&rows).Error; err != nil {
+		t.Fatalf("failed to read users: %v", err)
+	}
+	want := []string{"Bob", "bob-2-2", "bob-2", "BOB-4"}
+	if len(rows) != len(want) {
+		t.Fatalf("expected %d users, got %d", len(want), len(rows))
+	}
+	for i, row := range rows {
+		if row.Username != want[i] {
+			t.Errorf("user %d: expected username %q, got %q", row.ID, want[i], row.Username)
+		}
+	}
+}
+
+func TestUserProfilesLowercasesEmails(t *testing.T) {
+	db := openTestDB(t)
+
+	all, err := Load(files)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	var before []Migration
+	for _, m := range all {
+		if m.Name == "user_profiles" {
+			break
+		}
+		before = append(before, m)
+	}
+	if _, err := (&Migrator{db: db, migrations: before}).Up(t.Context()); err != nil {
+		t.Fatalf("migrating to before user_profiles: %v", err)
+	}
+
+	err = db.Exec(`INSERT INTO users (id, username, email, password) VALUES
+		(1, 'ann', 'Ann@Example.com', 'x'),
+		(2, 'ann2', 'ann@example.com', 'x'),
+		(3, 'bob', 'BOB@example.com', 'x')`).Error
+	if err != nil {
+		t.Fatalf("failed to insert users: %v", err)
+	}
+
+	if _, err := (&Migrator{db: db, migrations: all}).Up(t.Context()); err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+
+	var rows []struct {
+		ID    uint
+		Email string
+	}
+	if err := db.Raw("SELECT id, email FROM users ORDER BY id").Scan(&rows).Error; err != nil {
+		t.Fatalf("failed to read users: %v", err)
+	}
+	want := []string{"ann@example.com", "duplicate:2@duplicate.invalid", "bob@example.com"}
+	if len(rows) != len(want) {
+		t.Fatalf("expected %d users, got %d", len(want), len(rows))
+	}
+	for i, row := range rows {
+		if row.Email != want[i] {
+			t.Errorf("user %d: expected email %q, got %q", row.ID, want[i], row.Email)
+		}
+	}
+
+	err = db.Exec(`INSERT INTO users (username, email, password) VALUES ('carol', 'Bob@Example.com', 'x')`).Error
+	if err == nil {
+		t.Error("expected the index to refuse an email differing only in case")
+	}
+}
+
+func TestCallAttendanceRollbackKeepsHistory(t *testing.T) {
+	db := openTestDB(t)
+
+	all, err := Load(files)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	var upTo []Migration
+	for _, m := range all {
+		upTo = append(upTo, m)
+		if m.Name == "call_attendance" {
+			break
+		}
+	}
+	migrator := &Migrator{db: db, migrations: upTo}
+	if _, err := migrator.Up(t.Context()); err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+
+	err = db.Exec(`INSERT INTO users (id, username, email, password) VALUES (1, 'ann', 'ann@example.com', 'x')`).Error
+	if err != nil {
+		t.Fatalf("failed to insert user: %v", err)
+	}
+	err = db.Exec(`INSERT INTO calls (id, title, creator_id, status) VALUES (1, 'Sprint', 1, 'ended')`).Error
+	if err != nil {
+		t.Fatalf("failed to insert call: %v", err)
+	}
+	err = db.Exec(`INSERT INTO call_participants (call_id, user_id, joined_at, left_at)
+		VALUES (1, 1, NOW() - INTERVAL '1 hour', NOW())`).Error
+	if err != nil {
+		t.Fatalf("failed to insert participant: %v", err)
+	}
+
+	if _, err := migrator.Down(t.Context(), 1); err == nil {
+		t.Fatal("expected the rollback to refuse while attendance history exists")
+	}
+	var count int64
+	if err := db.Raw("SELECT COUNT(*) FROM call_participants").Scan(&count).Error; err != nil {
+		t.Fatalf("failed to count participants: %v", err)
+	}
+	if count != 1 {
+		t.Fatalf("expected the history to be kept, got %d rows", count)
+	}
+
+	if err := db.Exec("DELETE FROM call_participants WHERE left_at IS NOT NULL").Error; err != nil {
+		t.Fatalf("failed to delete history: %v", err)
+	}
+	if _, err := migrator.Down(t.Context(), 1); err != nil {
+		t.Fatalf("Down: %v", err)
+	}
+}
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS call_participants;
+DROP TABLE IF EXISTS calls;
+DROP TABLE IF EXISTS users;
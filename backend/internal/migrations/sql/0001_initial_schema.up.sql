@@ -0,0 +1,33 @@
+-- Initial schema, matching what GORM AutoMigrate created for the User, Call
+-- and CallParticipant models. IF NOT EXISTS lets databases that were set up
+-- by AutoMigrate adopt versioned migrations without changes.
+
+CREATE TABLE IF NOT EXISTS users (
+    id         BIGSERIAL PRIMARY KEY,
+    username   TEXT,
+    email      TEXT,
+    password   TEXT NOT NULL,
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_username ON users (username);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email ON users (email);
+
+CREATE TABLE IF NOT EXISTS calls (
+    id          BIGSERIAL PRIMARY KEY,
+    title       TEXT,
+    description TEXT,
+    creator_id  BIGINT,
+    status      TEXT,
+    created_at  TIMESTAMPTZ,
+    updated_at  TIMESTAMPTZ
+);
+
+CREATE TABLE IF NOT EXISTS call_participants (
+    id         BIGSERIAL PRIMARY KEY,
+    call_id    BIGINT,
+    user_id    BIGINT,
+    joined_at  TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ
+);
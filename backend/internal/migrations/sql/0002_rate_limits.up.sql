@@ -0,0 +1,10 @@
+-- Rate limit and failed login counters, kept in the database so lockouts
+-- survive restarts and apply across replicas.
+
+CREATE TABLE rate_limits (
+    key      TEXT PRIMARY KEY,
+    count    INTEGER NOT NULL,
+    reset_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX idx_rate_limits_reset_at ON rate_limits (reset_at);
@@ -0,0 +1,14 @@
+-- Single-use password reset tokens. Only a SHA-256 hash of each token is
+-- stored; used_at is set when it is redeemed or superseded.
+
+CREATE TABLE password_reset_tokens (
+    id         BIGSERIAL PRIMARY KEY,
+    user_id    BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    token_hash TEXT NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at    TIMESTAMPTZ,
+    created_at TIMESTAMPTZ
+);
+
+CREATE UNIQUE INDEX idx_password_reset_tokens_token_hash ON password_reset_tokens (token_hash);
+CREATE INDEX idx_password_reset_tokens_user_id ON password_reset_tokens (user_id);
@@ -0,0 +1,6 @@
+-- Track when each user verified their email address. Accounts that existed
+-- before verification was introduced are treated as verified.
+
+ALTER TABLE users ADD COLUMN email_verified_at TIMESTAMPTZ;
+
+UPDATE users SET email_verified_at = COALESCE(created_at, NOW());
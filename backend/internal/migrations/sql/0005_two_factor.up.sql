@@ -0,0 +1,18 @@
+-- TOTP two-factor authentication. totp_secret is set on enrollment and
+-- totp_enabled_at once the user confirms a code. Recovery codes are stored
+-- as SHA-256 hashes.
+
+ALTER TABLE users
+    ADD COLUMN totp_secret     TEXT NOT NULL DEFAULT '',
+    ADD COLUMN totp_enabled_at TIMESTAMPTZ,
+    ADD COLUMN totp_last_step  BIGINT NOT NULL DEFAULT 0;
+
+CREATE TABLE recovery_codes (
+    id         BIGSERIAL PRIMARY KEY,
+    user_id    BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    code_hash  TEXT NOT NULL,
+    used_at    TIMESTAMPTZ,
+    created_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_recovery_codes_user_id ON recovery_codes (user_id);
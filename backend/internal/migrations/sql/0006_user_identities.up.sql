@@ -0,0 +1,15 @@
+-- Accounts at external OpenID Connect providers linked to users. A provider
+-- identifies an account by its subject, which never changes, unlike email.
+
+CREATE TABLE user_identities (
+    id            BIGSERIAL PRIMARY KEY,
+    user_id       BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    provider      TEXT NOT NULL,
+    subject       TEXT NOT NULL,
+    email         TEXT NOT NULL DEFAULT '',
+    last_login_at TIMESTAMPTZ,
+    created_at    TIMESTAMPTZ
+);
+
+CREATE UNIQUE INDEX idx_user_identities_provider_subject ON user_identities (provider, subject);
+CREATE INDEX idx_user_identities_user_id ON user_identities (user_id);
@@ -0,0 +1,4 @@
+ALTER TABLE users
+    DROP CONSTRAINT IF EXISTS users_role_check,
+    DROP COLUMN IF EXISTS role,
+    DROP COLUMN IF EXISTS disabled_at;
@@ -0,0 +1,7 @@
+-- Roles decide what a user may do beyond their own account; administrators
+-- can disable accounts, which blocks logging in and existing tokens.
+
+ALTER TABLE users
+    ADD COLUMN role        TEXT NOT NULL DEFAULT 'user',
+    ADD COLUMN disabled_at TIMESTAMPTZ,
+    ADD CONSTRAINT users_role_check CHECK (role IN ('user', 'moderator', 'admin'));
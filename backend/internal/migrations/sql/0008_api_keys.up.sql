@@ -0,0 +1,20 @@
+-- API keys users create for scripts and integrations. Only a SHA-256 hash of
+-- each key is stored; prefix keeps its first characters so it can be named in
+-- listings. Revoked keys are kept so their last use can still be audited.
+
+CREATE TABLE api_keys (
+    id           BIGSERIAL PRIMARY KEY,
+    user_id      BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    name         TEXT NOT NULL,
+    key_hash     TEXT NOT NULL,
+    prefix       TEXT NOT NULL,
+    scopes       TEXT NOT NULL DEFAULT '',
+    expires_at   TIMESTAMPTZ,
+    last_used_at TIMESTAMPTZ,
+    last_used_ip TEXT NOT NULL DEFAULT '',
+    revoked_at   TIMESTAMPTZ,
+    created_at   TIMESTAMPTZ
+);
+
+CREATE UNIQUE INDEX idx_api_keys_key_hash ON api_keys (key_hash);
+CREATE INDEX idx_api_keys_user_id ON api_keys (user_id);
@@ -0,0 +1,16 @@
+-- Login sessions. Every access token carries its session ID in the sid
+-- claim and is refused once the session is revoked.
+
+CREATE TABLE sessions (
+    id           BIGSERIAL PRIMARY KEY,
+    user_id      BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    device_name  TEXT NOT NULL DEFAULT '',
+    user_agent   TEXT NOT NULL DEFAULT '',
+    ip           TEXT NOT NULL DEFAULT '',
+    created_at   TIMESTAMPTZ,
+    last_seen_at TIMESTAMPTZ,
+    expires_at   TIMESTAMPTZ NOT NULL,
+    revoked_at   TIMESTAMPTZ
+);
+
+CREATE INDEX idx_sessions_user_id ON sessions (user_id);
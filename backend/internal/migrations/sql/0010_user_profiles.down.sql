@@ -0,0 +1,10 @@
+-- Renamed duplicates keep their new names and emails stay in lower case
+DROP INDEX IF EXISTS idx_users_email_lower;
+DROP INDEX IF EXISTS idx_users_username_lower;
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS display_name,
+    DROP COLUMN IF EXISTS bio,
+    DROP COLUMN IF EXISTS avatar_url,
+    DROP COLUMN IF EXISTS timezone,
+    DROP COLUMN IF EXISTS locale;
@@ -0,0 +1,53 @@
+-- Optional profile fields users can edit at /api/users/me. Usernames become
+-- unique ignoring case, and emails are stored in lower case.
+
+ALTER TABLE users
+    ADD COLUMN display_name TEXT NOT NULL DEFAULT '',
+    ADD COLUMN bio          TEXT NOT NULL DEFAULT '',
+    ADD COLUMN avatar_url   TEXT NOT NULL DEFAULT '',
+    ADD COLUMN timezone     TEXT NOT NULL DEFAULT '',
+    ADD COLUMN locale       TEXT NOT NULL DEFAULT '';
+
+-- Registrations only compared exact names until now, so accounts may have
+-- names differing only in case; all but the oldest get their ID appended.
+-- Someone may already have that name, in which case a counter is added too.
+DO $$
+DECLARE
+    dup       RECORD;
+    candidate TEXT;
+    n         INT;
+BEGIN
+    FOR dup IN
+        SELECT u.id, u.username FROM users u
+        WHERE EXISTS (
+            SELECT 1 FROM users o
+            WHERE LOWER(o.username) = LOWER(u.username) AND o.id < u.id
+        )
+        ORDER BY u.id
+    LOOP
+        candidate := dup.username || '-' || dup.id;
+        n := 1;
+        WHILE EXISTS (SELECT 1 FROM users WHERE LOWER(username) = LOWER(candidate)) LOOP
+            n := n + 1;
+            candidate := dup.username || '-' || dup.id || '-' || n;
+        END LOOP;
+        UPDATE users SET username = candidate WHERE id = dup.id;
+    END LOOP;
+END $$;
+
+CREATE UNIQUE INDEX idx_users_username_lower ON users (LOWER(username));
+
+-- Emails were stored as typed, so one address may be on several accounts in
+-- different case. It can only sign in to one of them: the oldest keeps it and
+-- the others get a placeholder under the reserved .invalid domain, which an
+-- administrator replaces with `server user set-email <id> <email>`.
+UPDATE users u
+SET email = 'duplicate:' || u.id || '@duplicate.invalid', email_verified_at = NULL
+WHERE EXISTS (
+    SELECT 1 FROM users o
+    WHERE LOWER(o.email) = LOWER(u.email) AND o.id < u.id
+);
+
+UPDATE users SET email = LOWER(email) WHERE email <> LOWER(email);
+
+CREATE UNIQUE INDEX idx_users_email_lower ON users (LOWER(email));
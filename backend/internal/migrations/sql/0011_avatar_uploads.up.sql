@@ -0,0 +1,7 @@
+-- Avatars uploaded through PUT /api/users/me/avatar. avatar_url points at the
+-- largest image; avatar_keys lists the space-separated storage keys of all
+-- images so they can be deleted when the avatar changes.
+
+ALTER TABLE users
+    ADD COLUMN avatar_keys       TEXT  NOT NULL DEFAULT '',
+    ADD COLUMN avatar_thumbnails JSONB NOT NULL DEFAULT '{}';
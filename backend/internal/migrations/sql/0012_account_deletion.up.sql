@@ -0,0 +1,4 @@
+-- Users can delete their account. The row stays so calls keep their creator
+-- and participants, but its personal data is overwritten and deleted_at set.
+
+ALTER TABLE users ADD COLUMN deleted_at TIMESTAMPTZ;
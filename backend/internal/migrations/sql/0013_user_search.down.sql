@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_users_display_name_trgm;
+DROP INDEX IF EXISTS idx_users_username_trgm;
+
+ALTER TABLE users DROP COLUMN IF EXISTS unlisted;
+
+-- pg_trgm is left installed; other objects may depend on it
@@ -0,0 +1,11 @@
+-- User search matches prefixes and similar spellings of usernames and
+-- display names. pg_trgm's GIN indexes serve both ILIKE 'prefix%' and the %
+-- similarity operator. Creating the extension needs a role allowed to do so,
+-- e.g. the database owner on PostgreSQL 13 and later.
+
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+ALTER TABLE users ADD COLUMN unlisted BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE INDEX idx_users_username_trgm ON users USING gin (username gin_trgm_ops);
+CREATE INDEX idx_users_display_name_trgm ON users USING gin (display_name gin_trgm_ops);
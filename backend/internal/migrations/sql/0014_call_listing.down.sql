@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_call_participants_user_id;
+DROP INDEX IF EXISTS idx_calls_creator_id;
+DROP INDEX IF EXISTS idx_calls_status_created_at;
+
+DROP TABLE IF EXISTS call_tags;
@@ -0,0 +1,14 @@
+-- Call listing pages through calls by keyset and filters them by status,
+-- creator, participant and tag.
+
+CREATE TABLE call_tags (
+    call_id BIGINT NOT NULL REFERENCES calls (id) ON DELETE CASCADE,
+    tag     TEXT NOT NULL,
+    PRIMARY KEY (call_id, tag)
+);
+
+CREATE INDEX idx_call_tags_tag ON call_tags (tag, call_id);
+
+CREATE INDEX idx_calls_status_created_at ON calls (status, created_at, id);
+CREATE INDEX idx_calls_creator_id ON calls (creator_id);
+CREATE INDEX idx_call_participants_user_id ON call_participants (user_id, call_id);
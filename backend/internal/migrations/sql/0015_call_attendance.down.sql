@@ -0,0 +1,19 @@
+-- Earlier versions deleted participants on leaving and would take closed
+-- records for people still in the call. Those records are the attendance
+-- history, so refuse to roll back while any exist instead of deleting them;
+-- an operator who accepts losing the history deletes them first.
+DO $$
+DECLARE
+    closed BIGINT;
+BEGIN
+    SELECT COUNT(*) INTO closed FROM call_participants WHERE left_at IS NOT NULL;
+    IF closed > 0 THEN
+        RAISE EXCEPTION '% call_participants rows are attendance history that earlier versions cannot read', closed
+            USING HINT = 'Back them up, then run DELETE FROM call_participants WHERE left_at IS NOT NULL to roll back anyway';
+    END IF;
+END $$;
+
+DROP INDEX IF EXISTS idx_call_participants_open;
+DROP INDEX IF EXISTS idx_call_participants_call_id;
+
+ALTER TABLE call_participants DROP COLUMN IF EXISTS left_at;
@@ -0,0 +1,18 @@
+-- Participant records are kept when users leave a call so attendance can be
+-- reported; each join starts a new record and leaving sets left_at on it.
+
+ALTER TABLE call_participants ADD COLUMN left_at TIMESTAMPTZ;
+
+-- Earlier versions only deleted rows when the leave endpoint was called, so
+-- the rows already present are mostly users who closed the app long ago.
+-- Treat them as having left when they were last updated; anyone still in a
+-- call is given a new record when they next join or connect.
+UPDATE call_participants
+SET left_at = COALESCE(updated_at, joined_at, NOW())
+WHERE left_at IS NULL;
+
+CREATE INDEX idx_call_participants_call_id ON call_participants (call_id, joined_at);
+
+-- A user is in a call at most once at a time, however many devices they
+-- have connected
+CREATE UNIQUE INDEX idx_call_participants_open ON call_participants (call_id, user_id) WHERE left_at IS NULL;
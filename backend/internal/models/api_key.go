@@ -0,0 +1,42 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// APIKey is a long-lived credential a user creates for scripts and
+// integrations. Only the hash of the key is stored.
+type APIKey struct {
+	ID      uint   `json:"id" gorm:"primaryKey"`
+	UserID  uint   `json:"user_id" gorm:"not null;index"`
+	Name    string `json:"name" gorm:"not null"`
+	KeyHash string `json:"-" gorm:"not null;uniqueIndex"`
+
+	// Prefix is the start of the key, shown so users can tell keys apart
+	Prefix string `json:"prefix" gorm:"not null"`
+
+	// Scopes is the space-separated list of scopes granted to the key
+	Scopes string `json:"scopes" gorm:"not null"`
+
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	LastUsedIP string     `json:"last_used_ip"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// TableName specifies the table name for the APIKey model
+func (APIKey) TableName() string {
+	return "api_keys"
+}
+
+// ScopeList returns the scopes granted to the key
+func (k *APIKey) ScopeList() []string {
+	return strings.Fields(k.Scopes)
+}
+
+// IsActive reports whether the key can still be used at the given time
+func (k *APIKey) IsActive(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
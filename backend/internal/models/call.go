@@ -13,28 +13,51 @@ type Call struct {
 	Status      string    `json:"status"`
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
+
+	// Tags are short labels such as "writing" used to filter calls. They are
+	// kept in the call_tags table and loaded by the repository.
+	Tags []string `json:"tags" gorm:"-"`
+}
+
+// CallTag labels a call with a tag
+type CallTag struct {
+	CallID uint   `gorm:"primaryKey"`
+	Tag    string `gorm:"primaryKey"`
 }
 
 // CallCreate represents the request to create a new call
 type CallCreate struct {
 	Title       string `json:"title" binding:"required" example:"Team Meeting"`
 	Description string `json:"description" example:"Weekly team sync meeting"`
-	CreatorID   uint   `json:"creator_id" binding:"required"`
+
+	// CreatorID is optional; calls are always created by the current user and
+	// any other ID is refused
+	CreatorID uint `json:"creator_id" example:"1"`
+
+	// Tags are up to 10 lowercase labels of letters, digits and dashes
+	Tags []string `json:"tags" binding:"max=10" example:"writing,morning"`
 }
 
 // CallJoin represents the request to join a call
 type CallJoin struct {
 	CallID uint `json:"call_id" binding:"required" example:"1"`
-	UserID uint `json:"user_id" binding:"required" example:"2"`
+
+	// UserID is optional; the current user is the one joining and any other
+	// ID is refused
+	UserID uint `json:"user_id" example:"2"`
 }
 
-// CallParticipant represents a user participating in a call
+// CallParticipant is one stretch of a user's time in a call, from joining
+// until leaving. A user who leaves and rejoins gets a new record each time.
 type CallParticipant struct {
-	ID        uint      `json:"id" gorm:"primaryKey"`
-	CallID    uint      `json:"call_id"`
-	UserID    uint      `json:"user_id"`
-	JoinedAt  time.Time `json:"joined_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID       uint      `json:"id" gorm:"primaryKey"`
+	CallID   uint      `json:"call_id"`
+	UserID   uint      `json:"user_id"`
+	JoinedAt time.Time `json:"joined_at"`
+
+	// LeftAt is unset while the user is still in the call
+	LeftAt    *time.Time `json:"left_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
 }
 
 // TableName specifies the table name for the Call model
@@ -42,6 +65,11 @@ func (Call) TableName() string {
 	return "calls"
 }
 
+// TableName specifies the table name for the CallTag model
+func (CallTag) TableName() string {
+	return "call_tags"
+}
+
 // TableName specifies the table name for the CallParticipant model
 func (CallParticipant) TableName() string {
 	return "call_participants"
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+)
+
+// UserIdentity links a user to their account at an OpenID Connect provider,
+// which identifies it by the subject claim
+type UserIdentity struct {
+	ID       uint   `json:"id" gorm:"primaryKey"`
+	UserID   uint   `json:"user_id" gorm:"not null;index"`
+	Provider string `json:"provider" gorm:"not null;uniqueIndex:idx_user_identities_provider_subject"`
+	Subject  string `json:"subject" gorm:"not null;uniqueIndex:idx_user_identities_provider_subject"`
+
+	// Email is the address the provider reported at the last login
+	Email       string     `json:"email"`
+	LastLoginAt *time.Time `json:"last_login_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// TableName specifies the table name for the UserIdentity model
+func (UserIdentity) TableName() string {
+	return "user_identities"
+}
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+)
+
+// PasswordResetToken is a single-use password reset link. Only the hash of
+// the token is stored.
+type PasswordResetToken struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	UserID    uint       `json:"user_id" gorm:"not null;index"`
+	TokenHash string     `json:"-" gorm:"not null;uniqueIndex"`
+	ExpiresAt time.Time  `json:"expires_at" gorm:"not null"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// TableName specifies the table name for the PasswordResetToken model
+func (PasswordResetToken) TableName() string {
+	return "password_reset_tokens"
+}
@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+)
+
+// RecoveryCode is a single-use two-factor recovery code. Only the hash of
+// the code is stored.
+type RecoveryCode struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	UserID    uint       `json:"user_id" gorm:"not null;index"`
+	CodeHash  string     `json:"-" gorm:"not null"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// TableName specifies the table name for the RecoveryCode model
+func (RecoveryCode) TableName() string {
+	return "recovery_codes"
+}
@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+)
+
+// Session is one login of a user on a device. Every access token carries the
+// ID of its session, and revoking the session invalidates the token.
+type Session struct {
+	ID     uint `json:"id" gorm:"primaryKey"`
+	UserID uint `json:"user_id" gorm:"not null;index"`
+
+	// DeviceName is given by the client at login or derived from UserAgent
+	DeviceName string `json:"device_name"`
+	UserAgent  string `json:"user_agent"`
+
+	// IP is the address the session was last seen from
+	IP string `json:"ip"`
+
+	CreatedAt  time.Time  `json:"created_at"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	ExpiresAt  time.Time  `json:"expires_at" gorm:"not null"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+}
+
+// TableName specifies the table name for the Session model
+func (Session) TableName() string {
+	return "sessions"
+}
+
+// IsActive reports whether the session can still be used at the given time
+func (s *Session) IsActive(now time.Time) bool {
+	return s.RevokedAt == nil && now.Before(s.ExpiresAt)
+}
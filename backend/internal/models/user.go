@@ -1,6 +1,7 @@
 package models
 
 import (
+	"strings"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
@@ -14,6 +15,73 @@ type User struct {
 	Password  string    `json:"-" gorm:"not null"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+
+	// Role is "user", "moderator" or "admin" and decides what the user may
+	// do beyond their own account
+	Role string `json:"role" gorm:"not null;default:user"`
+
+	// DisabledAt is when an administrator disabled the account, nil while it
+	// is active. Disabled users cannot log in or use existing tokens.
+	DisabledAt *time.Time `json:"disabled_at"`
+
+	// DeletedAt is when the user deleted their account. Deleted accounts
+	// keep their ID, so calls still refer to them, but their personal data
+	// is erased and nobody can log in to them.
+	DeletedAt *time.Time `json:"deleted_at"`
+
+	// EmailVerifiedAt is when the user confirmed owning Email, nil until then
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+
+	// TOTPSecret is set when enrolling in two-factor authentication, which is
+	// only enforced once TOTPEnabledAt is set by confirming a code
+	TOTPSecret    string     `json:"-" gorm:"column:totp_secret"`
+	TOTPEnabledAt *time.Time `json:"-" gorm:"column:totp_enabled_at"`
+
+	// TOTPLastStep is the time step of the last accepted code, so a code
+	// cannot be used twice
+	TOTPLastStep int64 `json:"-" gorm:"column:totp_last_step"`
+
+	// Profile shown to other users; all optional
+	DisplayName string `json:"display_name" gorm:"not null;default:''"`
+	Bio         string `json:"bio" gorm:"not null;default:''"`
+	AvatarURL   string `json:"avatar_url" gorm:"not null;default:''"`
+
+	// AvatarKeys lists the space-separated storage keys of an uploaded
+	// avatar; it is empty when AvatarURL points elsewhere or is not set
+	AvatarKeys string `json:"-" gorm:"not null;default:''"`
+
+	// AvatarThumbnails maps the edge length in pixels of an uploaded
+	// avatar's square thumbnails, e.g. "64", to their URLs
+	AvatarThumbnails map[string]string `json:"avatar_thumbnails" gorm:"serializer:json;not null;default:'{}'"`
+
+	// Timezone is an IANA time zone name such as "Europe/Berlin" and Locale a
+	// BCP 47 language tag such as "en-GB"; empty means not set
+	Timezone string `json:"timezone" gorm:"not null;default:''"`
+	Locale   string `json:"locale" gorm:"not null;default:''"`
+
+	// Unlisted users are left out of user search; the API presents this as
+	// the inverse "discoverable" setting
+	Unlisted bool `json:"unlisted" gorm:"not null;default:false"`
+}
+
+// ProfileUpdate holds changes to a user's profile; nil fields are left as
+// they are
+type ProfileUpdate struct {
+	Username    *string
+	DisplayName *string
+	Bio         *string
+	AvatarURL   *string
+	Timezone    *string
+	Locale      *string
+	Unlisted    *bool
+}
+
+// Avatar is an uploaded avatar: its largest image, the storage keys of all
+// its images and the URLs of its thumbnails by size
+type Avatar struct {
+	URL        string
+	Keys       []string
+	Thumbnails map[string]string
 }
 
 // UserRegistration represents the request to register a new user
@@ -35,6 +103,31 @@ func (u *User) CheckPassword(password string) bool {
 	return err == nil
 }
 
+// IsEmailVerified reports whether the user has confirmed their email address
+func (u *User) IsEmailVerified() bool {
+	return u.EmailVerifiedAt != nil
+}
+
+// AvatarKeyList returns the storage keys of the user's uploaded avatar
+func (u *User) AvatarKeyList() []string {
+	return strings.Fields(u.AvatarKeys)
+}
+
+// IsDeleted reports whether the user deleted their account
+func (u *User) IsDeleted() bool {
+	return u.DeletedAt != nil
+}
+
+// IsDisabled reports whether an administrator has disabled the account
+func (u *User) IsDisabled() bool {
+	return u.DisabledAt != nil
+}
+
+// IsTwoFactorEnabled reports whether logging in requires a TOTP or recovery code
+func (u *User) IsTwoFactorEnabled() bool {
+	return u.TOTPEnabledAt != nil
+}
+
 // GenerateToken generates a JWT token for the user
 func (u *User) GenerateToken() (string, error) {
 	// TODO: Implement JWT token generation
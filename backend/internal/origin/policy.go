@@ -0,0 +1,137 @@
+// Package origin decides which browser origins may call the API, for both
+// CORS on REST routes and the WebSocket upgrade.
+package origin
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync/atomic"
+
+	"github.com/ayush/accountability-app/backend/internal/config"
+)
+
+// regexPrefix marks an allowed origin entry as a regular expression
+const regexPrefix = "regex:"
+
+// Policy matches origins against the configured patterns. It is safe for
+// concurrent use and can be updated while the server is running.
+type Policy struct {
+	state atomic.Pointer[state]
+}
+
+// state is an immutable compiled configuration
+type state struct {
+	cfg       config.CORSConfig
+	allowAll  bool
+	exact     map[string]bool
+	wildcards []wildcard
+	patterns  []*regexp.Regexp
+}
+
+// wildcard matches any subdomain of suffix with the given scheme and port
+type wildcard struct {
+	scheme string
+	suffix string
+	port   string
+}
+
+// NewPolicy compiles the allowed origins in cfg
+func NewPolicy(cfg config.CORSConfig) (*Policy, error) {
+	p := &Policy{}
+	if err := p.Update(cfg); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Update atomically replaces the policy. On error the previous policy stays in force.
+func (p *Policy) Update(cfg config.CORSConfig) error {
+	s := &state{cfg: cfg, exact: make(map[string]bool)}
+	for _, entry := range cfg.AllowedOrigins {
+		switch {
+		case entry == "*":
+			s.allowAll = true
+		case strings.HasPrefix(entry, regexPrefix):
+			// Origins are compared ignoring case, so patterns are too
+			re, err := regexp.Compile("(?i)^(?:" + strings.TrimPrefix(entry, regexPrefix) + ")$")
+			if err != nil {
+				return fmt.Errorf("invalid origin pattern %q: %v", entry, err)
+			}
+			s.patterns = append(s.patterns, re)
+		case strings.Contains(entry, "://*."):
+			w, err := parseWildcard(entry)
+			if err != nil {
+				return err
+			}
+			s.wildcards = append(s.wildcards, w)
+		default:
+			s.exact[strings.ToLower(strings.TrimSuffix(entry, "/"))] = true
+		}
+	}
+	p.state.Store(s)
+	return nil
+}
+
+func parseWildcard(entry string) (wildcard, error) {
+	u, err := url.Parse(strings.Replace(entry, "://*.", "://", 1))
+	if err != nil || u.Host == "" {
+		return wildcard{}, fmt.Errorf("invalid wildcard origin %q", entry)
+	}
+	return wildcard{
+		scheme: strings.ToLower(u.Scheme),
+		suffix: "." + strings.ToLower(u.Hostname()),
+		port:   u.Port(),
+	}, nil
+}
+
+// Config returns the CORS settings the policy was built from
+func (p *Policy) Config() config.CORSConfig {
+	return p.state.Load().cfg
+}
+
+// Allowed reports whether a browser on origin may call the API
+func (p *Policy) Allowed(origin string) bool {
+	s := p.state.Load()
+	if s.allowAll {
+		return true
+	}
+
+	origin = strings.ToLower(origin)
+	if s.exact[origin] {
+		return true
+	}
+
+	if len(s.wildcards) > 0 {
+		if u, err := url.Parse(origin); err == nil && u.Host != "" {
+			for _, w := range s.wildcards {
+				if u.Scheme == w.scheme && u.Port() == w.port && strings.HasSuffix(u.Hostname(), w.suffix) {
+					return true
+				}
+			}
+		}
+	}
+
+	for _, re := range s.patterns {
+		if re.MatchString(origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckOrigin is a websocket.Upgrader CheckOrigin function. Requests without
+// an Origin header come from non-browser clients and are allowed, as are
+// pages served from the API's own host.
+func (p *Policy) CheckOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	return p.Allowed(origin)
+}
@@ -0,0 +1,107 @@
+package origin
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ayush/accountability-app/backend/internal/config"
+)
+
+func TestPolicyAllowed(t *testing.T) {
+	policy, err := NewPolicy(config.CORSConfig{AllowedOrigins: []string{
+		"http://localhost:3000",
+		"https://*.example.com",
+		`regex:https://pr-[0-9]+\.preview\.dev`,
+		`regex:https://Staging-[a-z]+\.Example\.org`,
+	}})
+	if err != nil {
+		t.Fatalf("NewPolicy: %v", err)
+	}
+
+	tests := []struct {
+		origin string
+		want   bool
+	}{
+		{"http://localhost:3000", true},
+		{"HTTP://LOCALHOST:3000", true},
+		{"http://localhost:5173", false},
+		{"https://app.example.com", true},
+		{"https://a.b.example.com", true},
+		{"https://example.com", false},
+		{"http://app.example.com", false},
+		{"https://app.example.com:8443", false},
+		{"https://evil-example.com", false},
+		{"https://app.example.com.evil.net", false},
+		{"https://pr-42.preview.dev", true},
+		{"https://pr-42.preview.dev.evil.net", false},
+		{"https://pr-x.preview.dev", false},
+		{"https://PR-42.Preview.dev", true},
+		{"https://staging-eu.example.org", true},
+		{"https://Staging-EU.Example.org", true},
+	}
+	for _, tt := range tests {
+		if got := policy.Allowed(tt.origin); got != tt.want {
+			t.Errorf("Allowed(%q) = %v, want %v", tt.origin, got, tt.want)
+		}
+	}
+}
+
+func TestPolicyAllowAll(t *testing.T) {
+	policy, err := NewPolicy(config.CORSConfig{AllowedOrigins: []string{"*"}})
+	if err != nil {
+		t.Fatalf("NewPolicy: %v", err)
+	}
+	if !policy.Allowed("https://anything.test") {
+		t.Error("* should allow any origin")
+	}
+}
+
+func TestPolicyUpdateKeepsOldPolicyOnError(t *testing.T) {
+	policy, err := NewPolicy(config.CORSConfig{AllowedOrigins: []string{"https://a.test"}})
+	if err != nil {
+		t.Fatalf("NewPolicy: %v", err)
+	}
+
+	if err := policy.Update(config.CORSConfig{AllowedOrigins: []string{"regex:("}}); err == nil {
+		t.Fatal("expected an invalid regex to be rejected")
+	}
+	if !policy.Allowed("https://a.test") {
+		t.Error("failed update replaced the previous policy")
+	}
+
+	if err := policy.Update(config.CORSConfig{AllowedOrigins: []string{"https://b.test"}}); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if policy.Allowed("https://a.test") || !policy.Allowed("https://b.test") {
+		t.Error("update did not replace the allowed origins")
+	}
+}
+
+func TestCheckOrigin(t *testing.T) {
+	policy, err := NewPolicy(config.CORSConfig{AllowedOrigins: []string{"https://app.test"}})
+	if err != nil {
+		t.Fatalf("NewPolicy: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		origin string
+		want   bool
+	}{
+		{"no origin header", "", true},
+		{"same host", "http://api.test", true},
+		{"allowed origin", "https://app.test", true},
+		{"other origin", "https://evil.test", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "http://api.test/api/ws", nil)
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			if got := policy.CheckOrigin(r); got != tt.want {
+				t.Errorf("CheckOrigin = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,225 @@
+package ratelimit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"math"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/ayush/accountability-app/backend/internal/config"
+	"github.com/ayush/accountability-app/backend/internal/logger"
+
+	"go.uber.org/zap"
+)
+
+// Result describes the outcome of a rate limit check
+type Result struct {
+	Allowed bool
+
+	// Limit is the number of requests allowed per window, zero when no rule applies
+	Limit     int
+	Remaining int
+	ResetAt   time.Time
+
+	// RetryAfter is how long a refused caller should wait
+	RetryAfter time.Duration
+}
+
+// Limiter applies the configured request limits and login protection on top
+// of a Store. Its configuration can be replaced while it is in use.
+type Limiter struct {
+	store Store
+	cfg   atomic.Pointer[config.RateLimitConfig]
+
+	// now is replaced in tests
+	now func() time.Time
+}
+
+// New creates a limiter backed by store
+func New(store Store, cfg config.RateLimitConfig) *Limiter {
+	l := &Limiter{store: store, now: time.Now}
+	l.Update(cfg)
+	return l
+}
+
+// Update replaces the limits. The store cannot be changed.
+func (l *Limiter) Update(cfg config.RateLimitConfig) {
+	l.cfg.Store(&cfg)
+}
+
+// AllowIP counts a request from a client IP against the per-IP limit
+func (l *Limiter) AllowIP(ctx context.Context, ip string) (Result, error) {
+	cfg := l.cfg.Load()
+	if !cfg.Enabled {
+		return Result{Allowed: true}, nil
+	}
+	return l.allow(ctx, "ip:"+ip, cfg.IP)
+}
+
+// AllowAccount counts an authenticated request against the per-user limit
+func (l *Limiter) AllowAccount(ctx context.Context, userID uint) (Result, error) {
+	cfg := l.cfg.Load()
+	if !cfg.Enabled {
+		return Result{Allowed: true}, nil
+	}
+	return l.allow(ctx, "account:"+strconv.FormatUint(uint64(userID), 10), cfg.Account)
+}
+
+func (l *Limiter) allow(ctx context.Context, key string, rule config.RateLimitRule) (Result, error) {
+	if rule.Requests <= 0 {
+		return Result{Allowed: true}, nil
+	}
+
+	now := l.now()
+	c, err := l.store.Increment(ctx, "req:"+key, seconds(rule.WindowSeconds), now)
+	if err != nil {
+		return Result{Allowed: true}, err
+	}
+
+	res := Result{
+		Allowed:   c.Count <= rule.Requests,
+		Limit:     rule.Requests,
+		Remaining: max(rule.Requests-c.Count, 0),
+		ResetAt:   c.ResetAt,
+	}
+	if !res.Allowed {
+		res.RetryAfter = c.ResetAt.Sub(now)
+	}
+	return res, nil
+}
+
+// CheckLogin reports how long a login attempt for email from ip must wait
+// because of earlier failures. Zero means the attempt may proceed. Like the
+// other login methods it expects email to be normalized already, so every
+// spelling of an address shares one count.
+func (l *Limiter) CheckLogin(ctx context.Context, email, ip string) (time.Duration, error) {
+	if !l.cfg.Load().Enabled {
+		return 0, nil
+	}
+
+	now := l.now()
+	var wait time.Duration
+	for _, key := range []string{lockKey("account", email), lockKey("ip", ip)} {
+		c, err := l.store.Get(ctx, key, now)
+		if err != nil {
+			return 0, err
+		}
+		if c.Count > 0 {
+			wait = max(wait, c.ResetAt.Sub(now))
+		}
+	}
+	return wait, nil
+}
+
+// LoginFailed records a failed login and returns how long the caller must
+// wait before trying again. Past delay_after failures each attempt waits
+// twice as long as the last, and max_failures locks the account for the
+// lockout period. Too many failures from one IP lock the IP.
+func (l *Limiter) LoginFailed(ctx context.Context, email, ip string) (time.Duration, error) {
+	cfg := l.cfg.Load()
+	if !cfg.Enabled {
+		return 0, nil
+	}
+	login := cfg.Login
+	now := l.now()
+	window := seconds(login.WindowSeconds)
+	lockout := seconds(login.LockoutSeconds)
+
+	account, err := l.store.Increment(ctx, failKey("account", email), window, now)
+	if err != nil {
+		return 0, err
+	}
+	byIP, err := l.store.Increment(ctx, failKey("ip", ip), window, now)
+	if err != nil {
+		return 0, err
+	}
+
+	var wait time.Duration
+	switch {
+	case login.MaxFailures > 0 && account.Count >= login.MaxFailures:
+		wait = lockout
+		logger.Warn("Locking account after repeated failed logins",
+			zap.String("email_hash", hashEmail(email)),
+			zap.Int("failures", account.Count),
+			zap.Duration("lockout", lockout))
+	case account.Count > login.DelayAfter:
+		wait = progressiveDelay(account.Count-login.DelayAfter, login)
+	}
+	if wait > 0 {
+		if err := l.store.Set(ctx, lockKey("account", email), Counter{Count: 1, ResetAt: now.Add(wait)}); err != nil {
+			return 0, err
+		}
+	}
+
+	if login.IPMaxFailures > 0 && byIP.Count >= login.IPMaxFailures {
+		logger.Warn("Locking IP after repeated failed logins",
+			zap.String("client_ip", ip),
+			zap.Int("failures", byIP.Count),
+			zap.Duration("lockout", lockout))
+		if err := l.store.Set(ctx, lockKey("ip", ip), Counter{Count: 1, ResetAt: now.Add(lockout)}); err != nil {
+			return 0, err
+		}
+		wait = max(wait, lockout)
+	}
+
+	return wait, nil
+}
+
+// LoginSucceeded clears the failure count of an account
+func (l *Limiter) LoginSucceeded(ctx context.Context, email string) error {
+	return l.store.Delete(ctx, failKey("account", email))
+}
+
+// RunCleanup removes expired counters every interval until ctx is done
+func (l *Limiter) RunCleanup(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := l.store.Cleanup(ctx, l.now()); err != nil {
+				logger.Warn("Failed to clean up rate limit counters", zap.Error(err))
+			}
+		}
+	}
+}
+
+// progressiveDelay doubles from the base delay for every failure past the threshold
+func progressiveDelay(over int, login config.LoginLimitConfig) time.Duration {
+	base := time.Duration(login.BaseDelayMs) * time.Millisecond
+	limit := time.Duration(login.MaxDelayMs) * time.Millisecond
+	delay := base
+	for i := 1; i < over && delay < limit; i++ {
+		delay *= 2
+	}
+	return min(delay, limit)
+}
+
+func failKey(kind, id string) string {
+	return "login:fail:" + kind + ":" + id
+}
+
+func lockKey(kind, id string) string {
+	return "login:lock:" + kind + ":" + id
+}
+
+// hashEmail identifies an address in logs without writing the address itself
+func hashEmail(email string) string {
+	sum := sha256.Sum256([]byte(email))
+	return hex.EncodeToString(sum[:8])
+}
+
+// RetryAfterHeader formats a wait as a Retry-After value, rounded up to whole seconds
+func RetryAfterHeader(d time.Duration) string {
+	return strconv.Itoa(max(int(math.Ceil(d.Seconds())), 1))
+}
+
+func seconds(n int) time.Duration {
+	return time.Duration(n) * time.Second
+}
@@ -0,0 +1,146 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ayush/accountability-app/backend/internal/config"
+)
+
+// newTestLimiter returns a limiter on a memory store whose clock only moves
+// when the returned function is called
+func newTestLimiter(cfg config.RateLimitConfig) (*Limiter, func(time.Duration)) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	l := New(NewMemoryStore(), cfg)
+	l.now = func() time.Time { return now }
+	return l, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestAllowIP(t *testing.T) {
+	cfg := config.DefaultRateLimitConfig()
+	cfg.IP = config.RateLimitRule{Requests: 3, WindowSeconds: 60}
+	l, advance := newTestLimiter(cfg)
+	ctx := t.Context()
+
+	for i := 1; i <= 3; i++ {
+		res, err := l.AllowIP(ctx, "10.0.0.1")
+		if err != nil {
+			t.Fatalf("AllowIP: %v", err)
+		}
+		if !res.Allowed || res.Remaining != 3-i {
+			t.Fatalf("request %d: got %+v", i, res)
+		}
+	}
+
+	res, _ := l.AllowIP(ctx, "10.0.0.1")
+	if res.Allowed || res.RetryAfter != time.Minute {
+		t.Fatalf("expected the fourth request to be refused for a minute, got %+v", res)
+	}
+	if res, _ := l.AllowIP(ctx, "10.0.0.2"); !res.Allowed {
+		t.Fatal("another IP should not be limited")
+	}
+
+	advance(time.Minute)
+	if res, _ := l.AllowIP(ctx, "10.0.0.1"); !res.Allowed || res.Remaining != 2 {
+		t.Fatalf("expected a new window, got %+v", res)
+	}
+}
+
+func TestDisabledLimiterAllowsEverything(t *testing.T) {
+	cfg := config.DefaultRateLimitConfig()
+	cfg.IP = config.RateLimitRule{Requests: 1, WindowSeconds: 60}
+	l, _ := newTestLimiter(cfg)
+	ctx := t.Context()
+
+	cfg.Enabled = false
+	l.Update(cfg)
+	for i := 0; i < 3; i++ {
+		if res, _ := l.AllowIP(ctx, "10.0.0.1"); !res.Allowed || res.Limit != 0 {
+			t.Fatalf("request %d: got %+v", i, res)
+		}
+		if wait, _ := l.LoginFailed(ctx, "john@example.com", "10.0.0.1"); wait != 0 {
+			t.Fatalf("failed login %d: expected no delay, got %v", i, wait)
+		}
+	}
+}
+
+func TestLoginProgressiveDelayAndLockout(t *testing.T) {
+	cfg := config.DefaultRateLimitConfig()
+	cfg.Login = config.LoginLimitConfig{
+		MaxFailures:    5,
+		IPMaxFailures:  100,
+		WindowSeconds:  900,
+		LockoutSeconds: 600,
+		DelayAfter:     2,
+		BaseDelayMs:    1000,
+		MaxDelayMs:     1500,
+	}
+	l, advance := newTestLimiter(cfg)
+	ctx := t.Context()
+
+	want := []time.Duration{0, 0, time.Second, 1500 * time.Millisecond, 10 * time.Minute}
+	for i, delay := range want {
+		if wait, err := l.CheckLogin(ctx, "john@example.com", "10.0.0.1"); err != nil || wait != 0 {
+			t.Fatalf("attempt %d: expected no wait before trying, got %v, %v", i+1, wait, err)
+		}
+		wait, err := l.LoginFailed(ctx, "john@example.com", "10.0.0.1")
+		if err != nil {
+			t.Fatalf("LoginFailed: %v", err)
+		}
+		if wait != delay {
+			t.Fatalf("failure %d: expected a wait of %v, got %v", i+1, delay, wait)
+		}
+		if wait, _ := l.CheckLogin(ctx, "john@example.com", "10.0.0.2"); wait != delay {
+			t.Fatalf("failure %d: CheckLogin returned %v, want %v", i+1, wait, delay)
+		}
+		advance(delay)
+	}
+}
+
+func TestLoginSucceededResetsFailures(t *testing.T) {
+	l, _ := newTestLimiter(config.DefaultRateLimitConfig())
+	ctx := t.Context()
+
+	for i := 0; i < 2; i++ {
+		l.LoginFailed(ctx, "john@example.com", "10.0.0.1")
+	}
+	if err := l.LoginSucceeded(ctx, "john@example.com"); err != nil {
+		t.Fatalf("LoginSucceeded: %v", err)
+	}
+	if wait, _ := l.LoginFailed(ctx, "john@example.com", "10.0.0.1"); wait != 0 {
+		t.Fatalf("expected the failure count to start over, got a wait of %v", wait)
+	}
+}
+
+func TestLoginIPLockout(t *testing.T) {
+	cfg := config.DefaultRateLimitConfig()
+	cfg.Login.IPMaxFailures = 3
+	l, _ := newTestLimiter(cfg)
+	ctx := t.Context()
+
+	// Spread the failures over several accounts so only the IP trips
+	for _, email := range []string{"a@example.com", "b@example.com", "c@example.com"} {
+		l.LoginFailed(ctx, email, "10.0.0.1")
+	}
+
+	if wait, _ := l.CheckLogin(ctx, "d@example.com", "10.0.0.1"); wait != 15*time.Minute {
+		t.Fatalf("expected the IP to be locked out, got a wait of %v", wait)
+	}
+	if wait, _ := l.CheckLogin(ctx, "d@example.com", "10.0.0.2"); wait != 0 {
+		t.Fatalf("expected other IPs to be unaffected, got a wait of %v", wait)
+	}
+}
+
+func TestRetryAfterHeader(t *testing.T) {
+	for d, want := range map[time.Duration]string{
+		0:                       "1",
+		300 * time.Millisecond:  "1",
+		time.Second:             "1",
+		1500 * time.Millisecond: "2",
+		15 * time.Minute:        "900",
+	} {
+		if got := RetryAfterHeader(d); got != want {
+			t.Errorf("RetryAfterHeader(%v) = %q, want %q", d, got, want)
+		}
+	}
+}
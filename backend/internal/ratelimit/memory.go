@@ -0,0 +1,68 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// memoryStore keeps counters in process memory. They are lost on restart and
+// not shared between replicas.
+type memoryStore struct {
+	mu       sync.Mutex
+	counters map[string]Counter
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() Store {
+	return &memoryStore{counters: make(map[string]Counter)}
+}
+
+func (s *memoryStore) Increment(_ context.Context, key string, window time.Duration, now time.Time) (Counter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.counters[key]
+	if !ok || !now.Before(c.ResetAt) {
+		c = Counter{ResetAt: now.Add(window)}
+	}
+	c.Count++
+	s.counters[key] = c
+	return c, nil
+}
+
+func (s *memoryStore) Get(_ context.Context, key string, now time.Time) (Counter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.counters[key]
+	if !ok || !now.Before(c.ResetAt) {
+		return Counter{}, nil
+	}
+	return c, nil
+}
+
+func (s *memoryStore) Set(_ context.Context, key string, counter Counter) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.counters[key] = counter
+	return nil
+}
+
+func (s *memoryStore) Delete(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.counters, key)
+	return nil
+}
+
+func (s *memoryStore) Cleanup(_ context.Context, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, c := range s.counters {
+		if !now.Before(c.ResetAt) {
+			delete(s.counters, key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// postgresStore keeps counters in the rate_limits table so lockouts survive
+// restarts and are shared by every replica
+type postgresStore struct {
+	db *gorm.DB
+}
+
+// NewPostgresStore creates a store backed by the rate_limits table
+func NewPostgresStore(db *gorm.DB) Store {
+	return &postgresStore{db: db}
+}
+
+// counterRow is the scan target for rate_limits rows
+type counterRow struct {
+	Count   int
+	ResetAt time.Time
+}
+
+func (s *postgresStore) Increment(ctx context.Context, key string, window time.Duration, now time.Time) (Counter, error) {
+	var row counterRow
+	err := s.db.WithContext(ctx).Raw(`
+		INSERT INTO rate_limits (key, count, reset_at) VALUES (?, 1, ?)
+		ON CONFLICT (key) DO UPDATE SET
+			count    = CASE WHEN rate_limits.reset_at <= ? THEN 1 ELSE rate_limits.count + 1 END,
+			reset_at = CASE WHEN rate_limits.reset_at <= ? THEN EXCLUDED.reset_at ELSE rate_limits.reset_at END
+		RETURNING count, reset_at`,
+		key, now.Add(window), now, now).Scan(&row).Error
+	if err != nil {
+		return Counter{}, err
+	}
+	return Counter(row), nil
+}
+
+func (s *postgresStore) Get(ctx context.Context, key string, now time.Time) (Counter, error) {
+	var rows []counterRow
+	err := s.db.WithContext(ctx).Raw(
+		`SELECT count, reset_at FROM rate_limits WHERE key = ? AND reset_at > ?`, key, now).
+		Scan(&rows).Error
+	if err != nil || len(rows) == 0 {
+		return Counter{}, err
+	}
+	return Counter(rows[0]), nil
+}
+
+func (s *postgresStore) Set(ctx context.Context, key string, counter Counter) error {
+	return s.db.WithContext(ctx).Exec(`
+		INSERT INTO rate_limits (key, count, reset_at) VALUES (?, ?, ?)
+		ON CONFLICT (key) DO UPDATE SET count = EXCLUDED.count, reset_at = EXCLUDED.reset_at`,
+		key, counter.Count, counter.ResetAt).Error
+}
+
+func (s *postgresStore) Delete(ctx context.Context, key string) error {
+	return s.db.WithContext(ctx).Exec(`DELETE FROM rate_limits WHERE key = ?`, key).Error
+}
+
+func (s *postgresStore) Cleanup(ctx context.Context, now time.Time) error {
+	return s.db.WithContext(ctx).Exec(`DELETE FROM rate_limits WHERE reset_at <= ?`, now).Error
+}
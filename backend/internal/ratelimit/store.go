@@ -0,0 +1,34 @@
+// Package ratelimit counts requests and failed logins in fixed windows and
+// decides when callers must back off.
+package ratelimit
+
+import (
+	"context"
+	"time"
+)
+
+// Counter is the number of hits for a key in its current window
+type Counter struct {
+	Count   int
+	ResetAt time.Time
+}
+
+// Store keeps counters keyed by string. Implementations must be safe for
+// concurrent use.
+type Store interface {
+	// Increment adds one to key's counter, starting a new window of the given
+	// length if there is none or it has expired, and returns the result
+	Increment(ctx context.Context, key string, window time.Duration, now time.Time) (Counter, error)
+
+	// Get returns key's counter, which is zero if the key is unknown or expired
+	Get(ctx context.Context, key string, now time.Time) (Counter, error)
+
+	// Set replaces key's counter
+	Set(ctx context.Context, key string, counter Counter) error
+
+	// Delete removes key's counter
+	Delete(ctx context.Context, key string) error
+
+	// Cleanup removes counters that expired before now
+	Cleanup(ctx context.Context, now time.Time) error
+}
@@ -0,0 +1,751 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/ayush/accountability-app/backend/internal/models"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// NewGormRepositories creates repositories backed by the given database.
+// The database must be opened with TranslateError enabled so uniqueness
+// violations are reported as ErrDuplicate.
+func NewGormRepositories(db *gorm.DB) *Repositories {
+	return &Repositories{
+		Users:          &gormUserRepository{db: db},
+		Calls:          &gormCallRepository{db: db},
+		Participants:   &gormParticipantRepository{db: db},
+		PasswordResets: &gormPasswordResetRepository{db: db},
+		RecoveryCodes:  &gormRecoveryCodeRepository{db: db},
+		Identities:     &gormIdentityRepository{db: db},
+		APIKeys:        &gormAPIKeyRepository{db: db},
+		Sessions:       &gormSessionRepository{db: db},
+	}
+}
+
+// uniqueViolation is the PostgreSQL SQLSTATE for a unique index violation
+const uniqueViolation = "23505"
+
+// translateError maps GORM errors to repository errors
+func translateError(err error) error {
+	var pgErr *pgconn.PgError
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return ErrNotFound
+	case errors.Is(err, gorm.ErrDuplicatedKey):
+		return ErrDuplicate
+	case errors.As(err, &pgErr) && pgErr.Code == uniqueViolation:
+		// Wrapped errors, e.g. from transactions, escape GORM's translation
+		return ErrDuplicate
+	default:
+		return err
+	}
+}
+
+type gormUserRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormUserRepository) Create(ctx context.Context, user *models.User) error {
+	return translateError(r.db.WithContext(ctx).Create(user).Error)
+}
+
+func (r *gormUserRepository) GetByID(ctx context.Context, id uint) (*models.User, error) {
+	var user models.User
+	if err := r.db.WithContext(ctx).First(&user, id).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &user, nil
+}
+
+func (r *gormUserRepository) GetByIDs(ctx context.Context, ids []uint) ([]models.User, error) {
+	users := []models.User{}
+	if len(ids) == 0 {
+		return users, nil
+	}
+	err := r.db.WithContext(ctx).Where("id IN ?", ids).Order("id").Find(&users).Error
+	return users, translateError(err)
+}
+
+func (r *gormUserRepository) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	var user models.User
+	if err := r.db.WithContext(ctx).Where("LOWER(email) = LOWER(?)", email).First(&user).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &user, nil
+}
+
+func (r *gormUserRepository) UpdatePassword(ctx context.Context, id uint, hash string) error {
+	res := r.db.WithContext(ctx).Model(&models.User{ID: id}).Update("password", hash)
+	if res.Error != nil {
+		return translateError(res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *gormUserRepository) MarkEmailVerified(ctx context.Context, id uint, email string, at time.Time) error {
+	res := r.db.WithContext(ctx).Model(&models.User{}).
+		Where("id = ? AND email = ?", id, email).
+		Update("email_verified_at", gorm.Expr("COALESCE(email_verified_at, ?)", at))
+	if res.Error != nil {
+		return translateError(res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *gormUserRepository) SetTOTP(ctx context.Context, id uint, secret string, enabledAt *time.Time) error {
+	res := r.db.WithContext(ctx).Model(&models.User{ID: id}).
+		Updates(map[string]interface{}{"totp_secret": secret, "totp_enabled_at": enabledAt})
+	if res.Error != nil {
+		return translateError(res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *gormUserRepository) AdvanceTOTPStep(ctx context.Context, id uint, step int64) error {
+	res := r.db.WithContext(ctx).Model(&models.User{}).
+		Where("id = ? AND totp_last_step < ?", id, step).
+		Update("totp_last_step", step)
+	if res.Error != nil {
+		return translateError(res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *gormUserRepository) List(ctx context.Context, offset, limit int) ([]models.User, int64, error) {
+	var total int64
+	if err := r.db.WithContext(ctx).Model(&models.User{}).Count(&total).Error; err != nil {
+		return nil, 0, translateError(err)
+	}
+
+	users := []models.User{}
+	err := r.db.WithContext(ctx).Order("id").Offset(offset).Limit(limit).Find(&users).Error
+	return users, total, translateError(err)
+}
+
+func (r *gormUserRepository) SetRole(ctx context.Context, id uint, role string) error {
+	res := r.db.WithContext(ctx).Model(&models.User{ID: id}).Update("role", role)
+	if res.Error != nil {
+		return translateError(res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *gormUserRepository) SetDisabled(ctx context.Context, id uint, disabledAt *time.Time) error {
+	res := r.db.WithContext(ctx).Model(&models.User{ID: id}).Update("disabled_at", disabledAt)
+	if res.Error != nil {
+		return translateError(res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *gormUserRepository) GetByUsername(ctx context.Context, username string) (*models.User, error) {
+	var user models.User
+	if err := r.db.WithContext(ctx).Where("LOWER(username) = LOWER(?)", username).First(&user).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &user, nil
+}
+
+func (r *gormUserRepository) UpdateProfile(ctx context.Context, id uint, update models.ProfileUpdate) error {
+	changes := map[string]interface{}{}
+	for column, value := range map[string]*string{
+		"username":     update.Username,
+		"display_name": update.DisplayName,
+		"bio":          update.Bio,
+		"avatar_url":   update.AvatarURL,
+		"timezone":     update.Timezone,
+		"locale":       update.Locale,
+	} {
+		if value != nil {
+			changes[column] = *value
+		}
+	}
+	if update.Unlisted != nil {
+		changes["unlisted"] = *update.Unlisted
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+	if update.AvatarURL != nil {
+		changes["avatar_keys"] = ""
+		changes["avatar_thumbnails"] = "{}"
+	}
+
+	res := r.db.WithContext(ctx).Model(&models.User{ID: id}).Updates(changes)
+	if res.Error != nil {
+		return translateError(res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *gormUserRepository) UpdateEmail(ctx context.Context, id uint, email string) error {
+	res := r.db.WithContext(ctx).Model(&models.User{ID: id}).
+		Updates(map[string]interface{}{"email": email, "email_verified_at": nil})
+	if res.Error != nil {
+		return translateError(res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *gormUserRepository) SetAvatar(ctx context.Context, id uint, avatar models.Avatar) error {
+	thumbnails, err := json.Marshal(avatar.Thumbnails)
+	if err != nil {
+		return err
+	}
+	if avatar.Thumbnails == nil {
+		thumbnails = []byte("{}")
+	}
+
+	res := r.db.WithContext(ctx).Model(&models.User{ID: id}).Updates(map[string]interface{}{
+		"avatar_url":        avatar.URL,
+		"avatar_keys":       strings.Join(avatar.Keys, " "),
+		"avatar_thumbnails": string(thumbnails),
+	})
+	if res.Error != nil {
+		return translateError(res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *gormUserRepository) Search(ctx context.Context, query string, except uint, offset, limit int) ([]models.User, int64, error) {
+	// Prefixes are matched with ILIKE and similar names with the pg_trgm %
+	// operator; both can use the trigram indexes on username and display_name
+	prefix := escapeLike(query) + "%"
+	wordPrefix := "% " + prefix
+	matches := r.db.WithContext(ctx).Model(&models.User{}).
+		Where("NOT unlisted AND deleted_at IS NULL AND disabled_at IS NULL AND id <> ?", except).
+		Where("username ILIKE ? OR display_name ILIKE ? OR display_name ILIKE ? OR username % ? OR display_name % ?",
+			prefix, prefix, wordPrefix, query, query).
+		Session(&gorm.Session{})
+
+	var total int64
+	if err := matches.Count(&total).Error; err != nil {
+		return nil, 0, translateError(err)
+	}
+
+	users := []models.User{}
+	err := matches.
+		Order(clause.Expr{
+			SQL: "LOWER(username) = LOWER(?) DESC, (username ILIKE ? OR display_name ILIKE ? OR display_name ILIKE ?) DESC, " +
+				"GREATEST(similarity(username, ?), similarity(display_name, ?)) DESC, id",
+			Vars: []interface{}{query, prefix, prefix, wordPrefix, query, query},
+		}).
+		Offset(offset).Limit(limit).
+		Find(&users).Error
+	return users, total, translateError(err)
+}
+
+// escapeLike escapes the LIKE wildcards in s
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+func (r *gormUserRepository) Anonymize(ctx context.Context, id uint, at time.Time) error {
+	res := r.db.WithContext(ctx).Model(&models.User{ID: id}).Updates(map[string]interface{}{
+		"username":          DeletedUsername(id),
+		"email":             DeletedEmail(id),
+		"password":          "",
+		"role":              "user",
+		"email_verified_at": nil,
+		"totp_secret":       "",
+		"totp_enabled_at":   nil,
+		"totp_last_step":    0,
+		"display_name":      "",
+		"bio":               "",
+		"avatar_url":        "",
+		"avatar_keys":       "",
+		"avatar_thumbnails": "{}",
+		"timezone":          "",
+		"locale":            "",
+		"unlisted":          true,
+		"deleted_at":        at,
+	})
+	if res.Error != nil {
+		return translateError(res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+type gormCallRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormCallRepository) Create(ctx context.Context, call *models.Call) error {
+	return translateError(r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(call).Error; err != nil {
+			return err
+		}
+		if len(call.Tags) == 0 {
+			return nil
+		}
+		tags := make([]models.CallTag, len(call.Tags))
+		for i, tag := range call.Tags {
+			tags[i] = models.CallTag{CallID: call.ID, Tag: tag}
+		}
+		return tx.Create(&tags).Error
+	}))
+}
+
+func (r *gormCallRepository) GetByID(ctx context.Context, id uint) (*models.Call, error) {
+	var call models.Call
+	if err := r.db.WithContext(ctx).First(&call, id).Error; err != nil {
+		return nil, translateError(err)
+	}
+	calls := []models.Call{call}
+	if err := r.loadTags(ctx, calls); err != nil {
+		return nil, err
+	}
+	return &calls[0], nil
+}
+
+func (r *gormCallRepository) List(ctx context.Context, opts CallListOptions) ([]models.Call, error) {
+	query := r.db.WithContext(ctx).Model(&models.Call{})
+	if opts.Status != "" {
+		query = query.Where("status = ?", opts.Status)
+	}
+	if opts.CreatorID != 0 {
+		query = query.Where("creator_id = ?", opts.CreatorID)
+	}
+	if opts.CreatedAfter != nil {
+		query = query.Where("created_at >= ?", *opts.CreatedAfter)
+	}
+	if opts.CreatedBefore != nil {
+		query = query.Where("created_at < ?", *opts.CreatedBefore)
+	}
+	if opts.ParticipantID != 0 {
+		query = query.Where("id IN (?)",
+			r.db.Model(&models.CallParticipant{}).Select("call_id").Where("user_id = ?", opts.ParticipantID))
+	}
+	if opts.Tag != "" {
+		query = query.Where("id IN (?)",
+			r.db.Model(&models.CallTag{}).Select("call_id").Where("tag = ?", opts.Tag))
+	}
+
+	// Row comparisons keep the keyset condition in step with the ORDER BY
+	// so each page starts exactly where the previous one ended
+	switch opts.Sort {
+	case CallSortOldest:
+		if opts.After != nil {
+			query = query.Where("(created_at, id) > (?, ?)", opts.After.CreatedAt, opts.After.ID)
+		}
+		query = query.Order("created_at ASC, id ASC")
+	case CallSortTitle:
+		if opts.After != nil {
+			query = query.Where("(LOWER(title), id) > (LOWER(?), ?)", opts.After.Title, opts.After.ID)
+		}
+		query = query.Order("LOWER(title) ASC, id ASC")
+	default:
+		if opts.After != nil {
+			query = query.Where("(created_at, id) < (?, ?)", opts.After.CreatedAt, opts.After.ID)
+		}
+		query = query.Order("created_at DESC, id DESC")
+	}
+	if opts.Limit > 0 {
+		query = query.Limit(opts.Limit)
+	}
+
+	calls := []models.Call{}
+	if err := query.Find(&calls).Error; err != nil {
+		return nil, translateError(err)
+	}
+	if err := r.loadTags(ctx, calls); err != nil {
+		return nil, err
+	}
+	return calls, nil
+}
+
+// loadTags fills in the tags of calls with a single query
+func (r *gormCallRepository) loadTags(ctx context.Context, calls []models.Call) error {
+	if len(calls) == 0 {
+		return nil
+	}
+	ids := make([]uint, len(calls))
+	for i := range calls {
+		ids[i] = calls[i].ID
+	}
+
+	var tags []models.CallTag
+	if err := r.db.WithContext(ctx).Where("call_id IN ?", ids).Order("tag").Find(&tags).Error; err != nil {
+		return translateError(err)
+	}
+	byCall := make(map[uint][]string, len(calls))
+	for _, tag := range tags {
+		byCall[tag.CallID] = append(byCall[tag.CallID], tag.Tag)
+	}
+	for i := range calls {
+		calls[i].Tags = byCall[calls[i].ID]
+		if calls[i].Tags == nil {
+			calls[i].Tags = []string{}
+		}
+	}
+	return nil
+}
+
+func (r *gormCallRepository) UpdateStatus(ctx context.Context, id uint, from, to string) error {
+	res := r.db.WithContext(ctx).Model(&models.Call{}).
+		Where("id = ? AND status = ?", id, from).
+		Update("status", to)
+	if res.Error != nil {
+		return translateError(res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *gormCallRepository) ListByUser(ctx context.Context, userID uint) ([]models.Call, error) {
+	calls := []models.Call{}
+	err := r.db.WithContext(ctx).
+		Where("creator_id = ? OR id IN (?)", userID,
+			r.db.Model(&models.CallParticipant{}).Select("call_id").Where("user_id = ?", userID)).
+		Order("id DESC").
+		Find(&calls).Error
+	if err != nil {
+		return nil, translateError(err)
+	}
+	if err := r.loadTags(ctx, calls); err != nil {
+		return nil, err
+	}
+	return calls, nil
+}
+
+type gormParticipantRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormParticipantRepository) Create(ctx context.Context, participant *models.CallParticipant) error {
+	return translateError(r.db.WithContext(ctx).Create(participant).Error)
+}
+
+func (r *gormParticipantRepository) GetOpen(ctx context.Context, callID, userID uint) (*models.CallParticipant, error) {
+	var participant models.CallParticipant
+	if err := r.db.WithContext(ctx).Where("call_id = ? AND user_id = ? AND left_at IS NULL", callID, userID).First(&participant).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &participant, nil
+}
+
+func (r *gormParticipantRepository) Leave(ctx context.Context, callID, userID uint, at time.Time) error {
+	err := r.db.WithContext(ctx).Model(&models.CallParticipant{}).
+		Where("call_id = ? AND user_id = ? AND left_at IS NULL", callID, userID).
+		Updates(map[string]interface{}{"left_at": at, "updated_at": at}).Error
+	return translateError(err)
+}
+
+func (r *gormParticipantRepository) LeaveAll(ctx context.Context, callID uint, at time.Time) error {
+	err := r.db.WithContext(ctx).Model(&models.CallParticipant{}).
+		Where("call_id = ? AND left_at IS NULL", callID).
+		Updates(map[string]interface{}{"left_at": at, "updated_at": at}).Error
+	return translateError(err)
+}
+
+func (r *gormParticipantRepository) ListByUser(ctx context.Context, userID uint) ([]models.CallParticipant, error) {
+	participants := []models.CallParticipant{}
+	err := r.db.WithContext(ctx).Where("user_id = ?", userID).Order("id DESC").Find(&participants).Error
+	return participants, translateError(err)
+}
+
+func (r *gormParticipantRepository) ListByCall(ctx context.Context, callID uint) ([]models.CallParticipant, error) {
+	participants := []models.CallParticipant{}
+	err := r.db.WithContext(ctx).Where("call_id = ?", callID).Order("joined_at, id").Find(&participants).Error
+	return participants, translateError(err)
+}
+
+func (r *gormParticipantRepository) ListByUserInCalls(ctx context.Context, userID uint, callIDs []uint) ([]models.CallParticipant, error) {
+	participants := []models.CallParticipant{}
+	if len(callIDs) == 0 {
+		return participants, nil
+	}
+	err := r.db.WithContext(ctx).
+		Where("user_id = ? AND call_id IN ?", userID, callIDs).
+		Order("joined_at, id").
+		Find(&participants).Error
+	return participants, translateError(err)
+}
+
+type gormPasswordResetRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormPasswordResetRepository) Create(ctx context.Context, token *models.PasswordResetToken) error {
+	return translateError(r.db.WithContext(ctx).Create(token).Error)
+}
+
+func (r *gormPasswordResetRepository) Consume(ctx context.Context, hash string, now time.Time) (*models.PasswordResetToken, error) {
+	// A single conditional update so two concurrent redemptions cannot both succeed
+	var token models.PasswordResetToken
+	res := r.db.WithContext(ctx).Model(&token).Clauses(clause.Returning{}).
+		Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", hash, now).
+		Update("used_at", now)
+	if res.Error != nil {
+		return nil, translateError(res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return nil, ErrNotFound
+	}
+	return &token, nil
+}
+
+func (r *gormPasswordResetRepository) InvalidateForUser(ctx context.Context, userID uint, now time.Time) error {
+	err := r.db.WithContext(ctx).Model(&models.PasswordResetToken{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Update("used_at", now).Error
+	return translateError(err)
+}
+
+type gormRecoveryCodeRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormRecoveryCodeRepository) Replace(ctx context.Context, userID uint, hashes []string) error {
+	return translateError(r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		codes := make([]models.RecoveryCode, len(hashes))
+		for i, hash := range hashes {
+			codes[i] = models.RecoveryCode{UserID: userID, CodeHash: hash}
+		}
+		return tx.Create(&codes).Error
+	}))
+}
+
+func (r *gormRecoveryCodeRepository) Consume(ctx context.Context, userID uint, hash string, now time.Time) error {
+	res := r.db.WithContext(ctx).Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, hash).
+		Update("used_at", now)
+	if res.Error != nil {
+		return translateError(res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *gormRecoveryCodeRepository) CountUnused(ctx context.Context, userID uint) (int, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Count(&count).Error
+	return int(count), translateError(err)
+}
+
+func (r *gormRecoveryCodeRepository) DeleteForUser(ctx context.Context, userID uint) error {
+	return translateError(r.db.WithContext(ctx).Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error)
+}
+
+type gormIdentityRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormIdentityRepository) Create(ctx context.Context, identity *models.UserIdentity) error {
+	return translateError(r.db.WithContext(ctx).Create(identity).Error)
+}
+
+func (r *gormIdentityRepository) GetBySubject(ctx context.Context, provider, subject string) (*models.UserIdentity, error) {
+	var identity models.UserIdentity
+	err := r.db.WithContext(ctx).Where("provider = ? AND subject = ?", provider, subject).First(&identity).Error
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return &identity, nil
+}
+
+func (r *gormIdentityRepository) RecordLogin(ctx context.Context, id uint, email string, at time.Time) error {
+	res := r.db.WithContext(ctx).Model(&models.UserIdentity{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{"email": email, "last_login_at": at})
+	if res.Error != nil {
+		return translateError(res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *gormIdentityRepository) ListByUser(ctx context.Context, userID uint) ([]models.UserIdentity, error) {
+	identities := []models.UserIdentity{}
+	err := r.db.WithContext(ctx).Where("user_id = ?", userID).Order("id").Find(&identities).Error
+	return identities, translateError(err)
+}
+
+func (r *gormIdentityRepository) DeleteForUser(ctx context.Context, userID uint) error {
+	return translateError(r.db.WithContext(ctx).Where("user_id = ?", userID).Delete(&models.UserIdentity{}).Error)
+}
+
+type gormAPIKeyRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormAPIKeyRepository) Create(ctx context.Context, key *models.APIKey) error {
+	return translateError(r.db.WithContext(ctx).Create(key).Error)
+}
+
+func (r *gormAPIKeyRepository) ListByUser(ctx context.Context, userID uint) ([]models.APIKey, error) {
+	keys := []models.APIKey{}
+	err := r.db.WithContext(ctx).Where("user_id = ?", userID).Order("id DESC").Find(&keys).Error
+	return keys, translateError(err)
+}
+
+func (r *gormAPIKeyRepository) CountActive(ctx context.Context, userID uint, now time.Time) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&models.APIKey{}).
+		Where("user_id = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)", userID, now).
+		Count(&count).Error
+	return count, translateError(err)
+}
+
+func (r *gormAPIKeyRepository) GetActiveByHash(ctx context.Context, hash string, now time.Time) (*models.APIKey, error) {
+	var key models.APIKey
+	err := r.db.WithContext(ctx).
+		Where("key_hash = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)", hash, now).
+		First(&key).Error
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return &key, nil
+}
+
+func (r *gormAPIKeyRepository) RecordUse(ctx context.Context, id uint, ip string, at time.Time) error {
+	res := r.db.WithContext(ctx).Model(&models.APIKey{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{"last_used_at": at, "last_used_ip": ip})
+	if res.Error != nil {
+		return translateError(res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *gormAPIKeyRepository) Revoke(ctx context.Context, userID, id uint, now time.Time) error {
+	res := r.db.WithContext(ctx).Model(&models.APIKey{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, userID).
+		Update("revoked_at", now)
+	if res.Error != nil {
+		return translateError(res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *gormAPIKeyRepository) DeleteForUser(ctx context.Context, userID uint) error {
+	return translateError(r.db.WithContext(ctx).Where("user_id = ?", userID).Delete(&models.APIKey{}).Error)
+}
+
+type gormSessionRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormSessionRepository) Create(ctx context.Context, session *models.Session) error {
+	return translateError(r.db.WithContext(ctx).Create(session).Error)
+}
+
+func (r *gormSessionRepository) GetActive(ctx context.Context, id uint, now time.Time) (*models.Session, error) {
+	var session models.Session
+	err := r.db.WithContext(ctx).
+		Where("id = ? AND revoked_at IS NULL AND expires_at > ?", id, now).
+		First(&session).Error
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return &session, nil
+}
+
+func (r *gormSessionRepository) ListActiveByUser(ctx context.Context, userID uint, now time.Time) ([]models.Session, error) {
+	sessions := []models.Session{}
+	err := r.db.WithContext(ctx).
+		Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, now).
+		Order("last_seen_at DESC, id DESC").
+		Find(&sessions).Error
+	return sessions, translateError(err)
+}
+
+func (r *gormSessionRepository) Touch(ctx context.Context, id uint, ip string, at time.Time) error {
+	res := r.db.WithContext(ctx).Model(&models.Session{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{"ip": ip, "last_seen_at": at})
+	if res.Error != nil {
+		return translateError(res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *gormSessionRepository) Revoke(ctx context.Context, userID, id uint, now time.Time) error {
+	res := r.db.WithContext(ctx).Model(&models.Session{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL AND expires_at > ?", id, userID, now).
+		Update("revoked_at", now)
+	if res.Error != nil {
+		return translateError(res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *gormSessionRepository) RevokeAllForUser(ctx context.Context, userID uint, now time.Time) error {
+	err := r.db.WithContext(ctx).Model(&models.Session{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", now).Error
+	return translateError(err)
+}
+
+func (r *gormSessionRepository) ListByUser(ctx context.Context, userID uint) ([]models.Session, error) {
+	sessions := []models.Session{}
+	err := r.db.WithContext(ctx).Where("user_id = ?", userID).Order("id DESC").Find(&sessions).Error
+	return sessions, translateError(err)
+}
+
+func (r *gormSessionRepository) DeleteForUser(ctx context.Context, userID uint) error {
+	return translateError(r.db.WithContext(ctx).Where("user_id = ?", userID).Delete(&models.Session{}).Error)
+}
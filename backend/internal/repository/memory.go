@@ -0,0 +1,1030 @@
+package repository
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/ayush/accountability-app/backend/internal/models"
+)
+
+// NewMemoryRepositories creates repositories that keep everything in memory.
+// They enforce the same uniqueness rules as the database schema and are
+// intended for tests and local experiments.
+func NewMemoryRepositories() *Repositories {
+	participants := &memoryParticipantRepository{participants: map[uint]models.CallParticipant{}}
+	return &Repositories{
+		Users:          &memoryUserRepository{users: map[uint]models.User{}},
+		Calls:          &memoryCallRepository{calls: map[uint]models.Call{}, participants: participants},
+		Participants:   participants,
+		PasswordResets: &memoryPasswordResetRepository{tokens: map[uint]models.PasswordResetToken{}},
+		RecoveryCodes:  &memoryRecoveryCodeRepository{codes: map[uint]models.RecoveryCode{}},
+		Identities:     &memoryIdentityRepository{identities: map[uint]models.UserIdentity{}},
+		APIKeys:        &memoryAPIKeyRepository{keys: map[uint]models.APIKey{}},
+		Sessions:       &memorySessionRepository{sessions: map[uint]models.Session{}},
+	}
+}
+
+type memoryUserRepository struct {
+	mu     sync.RWMutex
+	nextID uint
+	users  map[uint]models.User
+}
+
+func (r *memoryUserRepository) Create(_ context.Context, user *models.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, existing := range r.users {
+		if strings.EqualFold(existing.Username, user.Username) || strings.EqualFold(existing.Email, user.Email) {
+			return ErrDuplicate
+		}
+	}
+
+	r.nextID++
+	user.ID = r.nextID
+	if user.Role == "" {
+		// The column defaults to user
+		user.Role = "user"
+	}
+	r.users[user.ID] = *user
+	return nil
+}
+
+func (r *memoryUserRepository) GetByID(_ context.Context, id uint) (*models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	user, ok := r.users[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &user, nil
+}
+
+func (r *memoryUserRepository) GetByIDs(_ context.Context, ids []uint) ([]models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	users := []models.User{}
+	for _, id := range ids {
+		if user, ok := r.users[id]; ok && !slices.ContainsFunc(users, func(u models.User) bool { return u.ID == id }) {
+			users = append(users, user)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	return users, nil
+}
+
+func (r *memoryUserRepository) GetByEmail(_ context.Context, email string) (*models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, user := range r.users {
+		if strings.EqualFold(user.Email, email) {
+			return &user, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *memoryUserRepository) UpdatePassword(_ context.Context, id uint, hash string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[id]
+	if !ok {
+		return ErrNotFound
+	}
+	user.Password = hash
+	r.users[id] = user
+	return nil
+}
+
+func (r *memoryUserRepository) MarkEmailVerified(_ context.Context, id uint, email string, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[id]
+	if !ok || user.Email != email {
+		return ErrNotFound
+	}
+	if user.EmailVerifiedAt == nil {
+		user.EmailVerifiedAt = &at
+		r.users[id] = user
+	}
+	return nil
+}
+
+func (r *memoryUserRepository) SetTOTP(_ context.Context, id uint, secret string, enabledAt *time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[id]
+	if !ok {
+		return ErrNotFound
+	}
+	user.TOTPSecret = secret
+	user.TOTPEnabledAt = enabledAt
+	r.users[id] = user
+	return nil
+}
+
+func (r *memoryUserRepository) AdvanceTOTPStep(_ context.Context, id uint, step int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[id]
+	if !ok || step <= user.TOTPLastStep {
+		return ErrNotFound
+	}
+	user.TOTPLastStep = step
+	r.users[id] = user
+	return nil
+}
+
+func (r *memoryUserRepository) List(_ context.Context, offset, limit int) ([]models.User, int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	users := make([]models.User, 0, len(r.users))
+	for _, user := range r.users {
+		users = append(users, user)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+
+	total := int64(len(users))
+	users = users[min(offset, len(users)):]
+	return users[:min(limit, len(users))], total, nil
+}
+
+func (r *memoryUserRepository) SetRole(_ context.Context, id uint, role string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[id]
+	if !ok {
+		return ErrNotFound
+	}
+	user.Role = role
+	r.users[id] = user
+	return nil
+}
+
+func (r *memoryUserRepository) SetDisabled(_ context.Context, id uint, disabledAt *time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[id]
+	if !ok {
+		return ErrNotFound
+	}
+	user.DisabledAt = disabledAt
+	r.users[id] = user
+	return nil
+}
+
+func (r *memoryUserRepository) GetByUsername(_ context.Context, username string) (*models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, user := range r.users {
+		if strings.EqualFold(user.Username, username) {
+			return &user, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *memoryUserRepository) UpdateProfile(_ context.Context, id uint, update models.ProfileUpdate) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if update.Username != nil {
+		for _, existing := range r.users {
+			if existing.ID != id && strings.EqualFold(existing.Username, *update.Username) {
+				return ErrDuplicate
+			}
+		}
+		user.Username = *update.Username
+	}
+	for field, value := range map[*string]*string{
+		&user.DisplayName: update.DisplayName,
+		&user.Bio:         update.Bio,
+		&user.AvatarURL:   update.AvatarURL,
+		&user.Timezone:    update.Timezone,
+		&user.Locale:      update.Locale,
+	} {
+		if value != nil {
+			*field = *value
+		}
+	}
+	if update.Unlisted != nil {
+		user.Unlisted = *update.Unlisted
+	}
+	if update.AvatarURL != nil {
+		user.AvatarKeys = ""
+		user.AvatarThumbnails = nil
+	}
+	r.users[id] = user
+	return nil
+}
+
+func (r *memoryUserRepository) UpdateEmail(_ context.Context, id uint, email string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[id]
+	if !ok {
+		return ErrNotFound
+	}
+	for _, existing := range r.users {
+		if existing.ID != id && strings.EqualFold(existing.Email, email) {
+			return ErrDuplicate
+		}
+	}
+	user.Email = email
+	user.EmailVerifiedAt = nil
+	r.users[id] = user
+	return nil
+}
+
+func (r *memoryUserRepository) SetAvatar(_ context.Context, id uint, avatar models.Avatar) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[id]
+	if !ok {
+		return ErrNotFound
+	}
+	user.AvatarURL = avatar.URL
+	user.AvatarKeys = strings.Join(avatar.Keys, " ")
+	user.AvatarThumbnails = maps.Clone(avatar.Thumbnails)
+	r.users[id] = user
+	return nil
+}
+
+func (r *memoryUserRepository) Search(_ context.Context, query string, except uint, offset, limit int) ([]models.User, int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	// Rank like the Postgres query: exact username, then prefixes, then
+	// trigram similarity
+	type match struct {
+		user  models.User
+		exact bool
+		start bool
+		score float64
+	}
+	q := strings.ToLower(query)
+	var matches []match
+	for _, user := range r.users {
+		if user.Unlisted || user.IsDeleted() || user.IsDisabled() || user.ID == except {
+			continue
+		}
+		username, displayName := strings.ToLower(user.Username), strings.ToLower(user.DisplayName)
+		m := match{
+			user:  user,
+			exact: username == q,
+			start: strings.HasPrefix(username, q) || strings.HasPrefix(displayName, q) || strings.Contains(displayName, " "+q),
+			score: max(trigramSimilarity(username, q), trigramSimilarity(displayName, q)),
+		}
+		if m.start || m.score >= trigramThreshold {
+			matches = append(matches, m)
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+		switch {
+		case a.exact != b.exact:
+			return a.exact
+		case a.start != b.start:
+			return a.start
+		case a.score != b.score:
+			return a.score > b.score
+		}
+		return a.user.ID < b.user.ID
+	})
+
+	total := int64(len(matches))
+	matches = matches[min(offset, len(matches)):]
+	matches = matches[:min(limit, len(matches))]
+	users := make([]models.User, 0, len(matches))
+	for _, m := range matches {
+		users = append(users, m.user)
+	}
+	return users, total, nil
+}
+
+// trigramThreshold is the default similarity threshold of pg_trgm's % operator
+const trigramThreshold = 0.3
+
+// trigramSimilarity mirrors pg_trgm's similarity: the share of trigrams the
+// two strings have in common, where each word is padded with two spaces in
+// front and one behind
+func trigramSimilarity(a, b string) float64 {
+	ta, tb := trigrams(a), trigrams(b)
+	if len(ta) == 0 || len(tb) == 0 {
+		return 0
+	}
+	common := 0
+	for t := range ta {
+		if tb[t] {
+			common++
+		}
+	}
+	return float64(common) / float64(len(ta)+len(tb)-common)
+}
+
+func trigrams(s string) map[string]bool {
+	set := map[string]bool{}
+	words := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, word := range words {
+		padded := []rune("  " + word + " ")
+		for i := 0; i+3 <= len(padded); i++ {
+			set[string(padded[i:i+3])] = true
+		}
+	}
+	return set
+}
+
+func (r *memoryUserRepository) Anonymize(_ context.Context, id uint, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[id]
+	if !ok {
+		return ErrNotFound
+	}
+	username, email := DeletedUsername(id), DeletedEmail(id)
+	for _, existing := range r.users {
+		if existing.ID != id && (strings.EqualFold(existing.Username, username) || existing.Email == email) {
+			return ErrDuplicate
+		}
+	}
+	r.users[id] = models.User{
+		ID:        user.ID,
+		Username:  username,
+		Email:     email,
+		Role:      "user",
+		Unlisted:  true,
+		CreatedAt: user.CreatedAt,
+		UpdatedAt: at,
+		DeletedAt: &at,
+	}
+	return nil
+}
+
+type memoryCallRepository struct {
+	mu     sync.RWMutex
+	nextID uint
+	calls  map[uint]models.Call
+
+	// participants answers which calls a user takes part in
+	participants *memoryParticipantRepository
+}
+
+func (r *memoryCallRepository) Create(_ context.Context, call *models.Call) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.nextID++
+	call.ID = r.nextID
+	stored := *call
+	stored.Tags = append([]string{}, call.Tags...)
+	r.calls[call.ID] = stored
+	return nil
+}
+
+func (r *memoryCallRepository) GetByID(_ context.Context, id uint) (*models.Call, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	call, ok := r.calls[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &call, nil
+}
+
+func (r *memoryCallRepository) List(_ context.Context, opts CallListOptions) ([]models.Call, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var less func(a, b *models.Call) bool
+	switch opts.Sort {
+	case CallSortOldest:
+		less = func(a, b *models.Call) bool {
+			if !a.CreatedAt.Equal(b.CreatedAt) {
+				return a.CreatedAt.Before(b.CreatedAt)
+			}
+			return a.ID < b.ID
+		}
+	case CallSortTitle:
+		less = func(a, b *models.Call) bool {
+			if ta, tb := strings.ToLower(a.Title), strings.ToLower(b.Title); ta != tb {
+				return ta < tb
+			}
+			return a.ID < b.ID
+		}
+	default:
+		less = func(a, b *models.Call) bool {
+			if !a.CreatedAt.Equal(b.CreatedAt) {
+				return a.CreatedAt.After(b.CreatedAt)
+			}
+			return a.ID > b.ID
+		}
+	}
+
+	var after *models.Call
+	if opts.After != nil {
+		after = &models.Call{ID: opts.After.ID, Title: opts.After.Title, CreatedAt: opts.After.CreatedAt}
+	}
+
+	calls := []models.Call{}
+	for _, call := range r.calls {
+		switch {
+		case opts.Status != "" && call.Status != opts.Status,
+			opts.CreatorID != 0 && call.CreatorID != opts.CreatorID,
+			opts.CreatedAfter != nil && call.CreatedAt.Before(*opts.CreatedAfter),
+			opts.CreatedBefore != nil && !call.CreatedAt.Before(*opts.CreatedBefore),
+			opts.ParticipantID != 0 && !r.participants.isParticipant(call.ID, opts.ParticipantID),
+			opts.Tag != "" && !slices.Contains(call.Tags, opts.Tag),
+			after != nil && !less(after, &call):
+			continue
+		}
+		calls = append(calls, call)
+	}
+	sort.Slice(calls, func(i, j int) bool { return less(&calls[i], &calls[j]) })
+	if opts.Limit > 0 && len(calls) > opts.Limit {
+		calls = calls[:opts.Limit]
+	}
+	return calls, nil
+}
+
+func (r *memoryCallRepository) UpdateStatus(_ context.Context, id uint, from, to string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	call, ok := r.calls[id]
+	if !ok || call.Status != from {
+		return ErrNotFound
+	}
+	call.Status = to
+	r.calls[id] = call
+	return nil
+}
+
+func (r *memoryCallRepository) ListByUser(_ context.Context, userID uint) ([]models.Call, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	calls := []models.Call{}
+	for _, call := range r.calls {
+		if call.CreatorID == userID || r.participants.isParticipant(call.ID, userID) {
+			calls = append(calls, call)
+		}
+	}
+	sort.Slice(calls, func(i, j int) bool { return calls[i].ID > calls[j].ID })
+	return calls, nil
+}
+
+type memoryParticipantRepository struct {
+	mu           sync.RWMutex
+	nextID       uint
+	participants map[uint]models.CallParticipant
+}
+
+func (r *memoryParticipantRepository) Create(_ context.Context, participant *models.CallParticipant) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if participant.LeftAt == nil {
+		if _, ok := r.open(participant.CallID, participant.UserID); ok {
+			return ErrDuplicate
+		}
+	}
+	r.nextID++
+	participant.ID = r.nextID
+	r.participants[participant.ID] = *participant
+	return nil
+}
+
+func (r *memoryParticipantRepository) GetOpen(_ context.Context, callID, userID uint) (*models.CallParticipant, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	participant, ok := r.open(callID, userID)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &participant, nil
+}
+
+// open returns a user's open record in a call. The caller must hold r.mu.
+func (r *memoryParticipantRepository) open(callID, userID uint) (models.CallParticipant, bool) {
+	for _, participant := range r.participants {
+		if participant.CallID == callID && participant.UserID == userID && participant.LeftAt == nil {
+			return participant, true
+		}
+	}
+	return models.CallParticipant{}, false
+}
+
+func (r *memoryParticipantRepository) Leave(_ context.Context, callID, userID uint, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, participant := range r.participants {
+		if participant.CallID == callID && participant.UserID == userID && participant.LeftAt == nil {
+			participant.LeftAt = &at
+			participant.UpdatedAt = at
+			r.participants[id] = participant
+		}
+	}
+	return nil
+}
+
+func (r *memoryParticipantRepository) LeaveAll(_ context.Context, callID uint, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, participant := range r.participants {
+		if participant.CallID == callID && participant.LeftAt == nil {
+			participant.LeftAt = &at
+			participant.UpdatedAt = at
+			r.participants[id] = participant
+		}
+	}
+	return nil
+}
+
+func (r *memoryParticipantRepository) ListByUser(_ context.Context, userID uint) ([]models.CallParticipant, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	participants := []models.CallParticipant{}
+	for _, participant := range r.participants {
+		if participant.UserID == userID {
+			participants = append(participants, participant)
+		}
+	}
+	sort.Slice(participants, func(i, j int) bool { return participants[i].ID > participants[j].ID })
+	return participants, nil
+}
+
+func (r *memoryParticipantRepository) ListByCall(_ context.Context, callID uint) ([]models.CallParticipant, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	participants := []models.CallParticipant{}
+	for _, participant := range r.participants {
+		if participant.CallID == callID {
+			participants = append(participants, participant)
+		}
+	}
+	sortByJoinTime(participants)
+	return participants, nil
+}
+
+func (r *memoryParticipantRepository) ListByUserInCalls(_ context.Context, userID uint, callIDs []uint) ([]models.CallParticipant, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	participants := []models.CallParticipant{}
+	for _, participant := range r.participants {
+		if participant.UserID == userID && slices.Contains(callIDs, participant.CallID) {
+			participants = append(participants, participant)
+		}
+	}
+	sortByJoinTime(participants)
+	return participants, nil
+}
+
+func sortByJoinTime(participants []models.CallParticipant) {
+	sort.Slice(participants, func(i, j int) bool {
+		if !participants[i].JoinedAt.Equal(participants[j].JoinedAt) {
+			return participants[i].JoinedAt.Before(participants[j].JoinedAt)
+		}
+		return participants[i].ID < participants[j].ID
+	})
+}
+
+func (r *memoryParticipantRepository) isParticipant(callID, userID uint) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, participant := range r.participants {
+		if participant.CallID == callID && participant.UserID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+type memoryPasswordResetRepository struct {
+	mu     sync.Mutex
+	nextID uint
+	tokens map[uint]models.PasswordResetToken
+}
+
+func (r *memoryPasswordResetRepository) Create(_ context.Context, token *models.PasswordResetToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, existing := range r.tokens {
+		if existing.TokenHash == token.TokenHash {
+			return ErrDuplicate
+		}
+	}
+
+	r.nextID++
+	token.ID = r.nextID
+	r.tokens[token.ID] = *token
+	return nil
+}
+
+func (r *memoryPasswordResetRepository) Consume(_ context.Context, hash string, now time.Time) (*models.PasswordResetToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, token := range r.tokens {
+		if token.TokenHash == hash && token.UsedAt == nil && now.Before(token.ExpiresAt) {
+			token.UsedAt = &now
+			r.tokens[id] = token
+			return &token, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *memoryPasswordResetRepository) InvalidateForUser(_ context.Context, userID uint, now time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, token := range r.tokens {
+		if token.UserID == userID && token.UsedAt == nil {
+			token.UsedAt = &now
+			r.tokens[id] = token
+		}
+	}
+	return nil
+}
+
+type memoryRecoveryCodeRepository struct {
+	mu     sync.Mutex
+	nextID uint
+	codes  map[uint]models.RecoveryCode
+}
+
+func (r *memoryRecoveryCodeRepository) Replace(_ context.Context, userID uint, hashes []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, code := range r.codes {
+		if code.UserID == userID {
+			delete(r.codes, id)
+		}
+	}
+	for _, hash := range hashes {
+		r.nextID++
+		r.codes[r.nextID] = models.RecoveryCode{ID: r.nextID, UserID: userID, CodeHash: hash}
+	}
+	return nil
+}
+
+func (r *memoryRecoveryCodeRepository) Consume(_ context.Context, userID uint, hash string, now time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, code := range r.codes {
+		if code.UserID == userID && code.CodeHash == hash && code.UsedAt == nil {
+			code.UsedAt = &now
+			r.codes[id] = code
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (r *memoryRecoveryCodeRepository) CountUnused(_ context.Context, userID uint) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	count := 0
+	for _, code := range r.codes {
+		if code.UserID == userID && code.UsedAt == nil {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (r *memoryRecoveryCodeRepository) DeleteForUser(_ context.Context, userID uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, code := range r.codes {
+		if code.UserID == userID {
+			delete(r.codes, id)
+		}
+	}
+	return nil
+}
+
+type memoryIdentityRepository struct {
+	mu         sync.RWMutex
+	nextID     uint
+	identities map[uint]models.UserIdentity
+}
+
+func (r *memoryIdentityRepository) Create(_ context.Context, identity *models.UserIdentity) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, existing := range r.identities {
+		if existing.Provider == identity.Provider && existing.Subject == identity.Subject {
+			return ErrDuplicate
+		}
+	}
+
+	r.nextID++
+	identity.ID = r.nextID
+	r.identities[identity.ID] = *identity
+	return nil
+}
+
+func (r *memoryIdentityRepository) GetBySubject(_ context.Context, provider, subject string) (*models.UserIdentity, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, identity := range r.identities {
+		if identity.Provider == provider && identity.Subject == subject {
+			return &identity, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *memoryIdentityRepository) RecordLogin(_ context.Context, id uint, email string, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	identity, ok := r.identities[id]
+	if !ok {
+		return ErrNotFound
+	}
+	identity.Email = email
+	identity.LastLoginAt = &at
+	r.identities[id] = identity
+	return nil
+}
+
+func (r *memoryIdentityRepository) ListByUser(_ context.Context, userID uint) ([]models.UserIdentity, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	identities := []models.UserIdentity{}
+	for _, identity := range r.identities {
+		if identity.UserID == userID {
+			identities = append(identities, identity)
+		}
+	}
+	sort.Slice(identities, func(i, j int) bool { return identities[i].ID < identities[j].ID })
+	return identities, nil
+}
+
+func (r *memoryIdentityRepository) DeleteForUser(_ context.Context, userID uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, identity := range r.identities {
+		if identity.UserID == userID {
+			delete(r.identities, id)
+		}
+	}
+	return nil
+}
+
+type memoryAPIKeyRepository struct {
+	mu     sync.RWMutex
+	nextID uint
+	keys   map[uint]models.APIKey
+}
+
+func (r *memoryAPIKeyRepository) Create(_ context.Context, key *models.APIKey) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, existing := range r.keys {
+		if existing.KeyHash == key.KeyHash {
+			return ErrDuplicate
+		}
+	}
+
+	r.nextID++
+	key.ID = r.nextID
+	r.keys[key.ID] = *key
+	return nil
+}
+
+func (r *memoryAPIKeyRepository) ListByUser(_ context.Context, userID uint) ([]models.APIKey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	keys := []models.APIKey{}
+	for _, key := range r.keys {
+		if key.UserID == userID {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID > keys[j].ID })
+	return keys, nil
+}
+
+func (r *memoryAPIKeyRepository) CountActive(_ context.Context, userID uint, now time.Time) (int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var count int64
+	for _, key := range r.keys {
+		if key.UserID == userID && key.IsActive(now) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (r *memoryAPIKeyRepository) GetActiveByHash(_ context.Context, hash string, now time.Time) (*models.APIKey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, key := range r.keys {
+		if key.KeyHash == hash && key.IsActive(now) {
+			return &key, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *memoryAPIKeyRepository) RecordUse(_ context.Context, id uint, ip string, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key, ok := r.keys[id]
+	if !ok {
+		return ErrNotFound
+	}
+	key.LastUsedAt = &at
+	key.LastUsedIP = ip
+	r.keys[id] = key
+	return nil
+}
+
+func (r *memoryAPIKeyRepository) Revoke(_ context.Context, userID, id uint, now time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key, ok := r.keys[id]
+	if !ok || key.UserID != userID || key.RevokedAt != nil {
+		return ErrNotFound
+	}
+	key.RevokedAt = &now
+	r.keys[id] = key
+	return nil
+}
+
+func (r *memoryAPIKeyRepository) DeleteForUser(_ context.Context, userID uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, key := range r.keys {
+		if key.UserID == userID {
+			delete(r.keys, id)
+		}
+	}
+	return nil
+}
+
+type memorySessionRepository struct {
+	mu       sync.RWMutex
+	nextID   uint
+	sessions map[uint]models.Session
+}
+
+func (r *memorySessionRepository) Create(_ context.Context, session *models.Session) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.nextID++
+	session.ID = r.nextID
+	r.sessions[session.ID] = *session
+	return nil
+}
+
+func (r *memorySessionRepository) GetActive(_ context.Context, id uint, now time.Time) (*models.Session, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	session, ok := r.sessions[id]
+	if !ok || !session.IsActive(now) {
+		return nil, ErrNotFound
+	}
+	return &session, nil
+}
+
+func (r *memorySessionRepository) ListActiveByUser(_ context.Context, userID uint, now time.Time) ([]models.Session, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	sessions := []models.Session{}
+	for _, session := range r.sessions {
+		if session.UserID == userID && session.IsActive(now) {
+			sessions = append(sessions, session)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		if !sessions[i].LastSeenAt.Equal(sessions[j].LastSeenAt) {
+			return sessions[i].LastSeenAt.After(sessions[j].LastSeenAt)
+		}
+		return sessions[i].ID > sessions[j].ID
+	})
+	return sessions, nil
+}
+
+func (r *memorySessionRepository) Touch(_ context.Context, id uint, ip string, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	session, ok := r.sessions[id]
+	if !ok {
+		return ErrNotFound
+	}
+	session.IP = ip
+	session.LastSeenAt = at
+	r.sessions[id] = session
+	return nil
+}
+
+func (r *memorySessionRepository) Revoke(_ context.Context, userID, id uint, now time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	session, ok := r.sessions[id]
+	if !ok || session.UserID != userID || !session.IsActive(now) {
+		return ErrNotFound
+	}
+	session.RevokedAt = &now
+	r.sessions[id] = session
+	return nil
+}
+
+func (r *memorySessionRepository) RevokeAllForUser(_ context.Context, userID uint, now time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, session := range r.sessions {
+		if session.UserID == userID && session.RevokedAt == nil {
+			session.RevokedAt = &now
+			r.sessions[id] = session
+		}
+	}
+	return nil
+}
+
+func (r *memorySessionRepository) ListByUser(_ context.Context, userID uint) ([]models.Session, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	sessions := []models.Session{}
+	for _, session := range r.sessions {
+		if session.UserID == userID {
+			sessions = append(sessions, session)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].ID > sessions[j].ID })
+	return sessions, nil
+}
+
+func (r *memorySessionRepository) DeleteForUser(_ context.Context, userID uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, session := range r.sessions {
+		if session.UserID == userID {
+			delete(r.sessions, id)
+		}
+	}
+	return nil
+}
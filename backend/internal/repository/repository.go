@@ -0,0 +1,288 @@
+// Package repository defines the persistence interfaces used by the API
+// handlers, with a GORM implementation for Postgres and an in-memory
+// implementation for tests.
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ayush/accountability-app/backend/internal/models"
+)
+
+var (
+	// ErrNotFound is returned when a record does not exist
+	ErrNotFound = errors.New("record not found")
+
+	// ErrDuplicate is returned when a record violates a uniqueness constraint
+	ErrDuplicate = errors.New("duplicate record")
+)
+
+// DeletedUsername is the username Anonymize gives a deleted account. The
+// colon is not allowed in usernames, so it cannot already be taken.
+func DeletedUsername(id uint) string {
+	return fmt.Sprintf("deleted:%d", id)
+}
+
+// DeletedEmail is the email address Anonymize gives a deleted account. The
+// colon is not allowed in the addresses users register or change to, so it
+// cannot already be taken.
+func DeletedEmail(id uint) string {
+	return fmt.Sprintf("deleted:%d@deleted.invalid", id)
+}
+
+// UserRepository stores users
+type UserRepository interface {
+	Create(ctx context.Context, user *models.User) error
+	GetByID(ctx context.Context, id uint) (*models.User, error)
+
+	// GetByIDs returns the users with the given IDs in one lookup, ordered by
+	// ID. Unknown IDs are left out.
+	GetByIDs(ctx context.Context, ids []uint) ([]models.User, error)
+
+	// GetByEmail finds a user by email, ignoring case. Addresses are stored
+	// in lower case, which the handlers take care of.
+	GetByEmail(ctx context.Context, email string) (*models.User, error)
+
+	UpdatePassword(ctx context.Context, id uint, hash string) error
+
+	// MarkEmailVerified records that the user verified email at the given
+	// time. It returns ErrNotFound if the user no longer has that address.
+	MarkEmailVerified(ctx context.Context, id uint, email string, at time.Time) error
+
+	// SetTOTP stores the user's TOTP secret and when two-factor
+	// authentication was enabled; an empty secret and nil time turn it off
+	SetTOTP(ctx context.Context, id uint, secret string, enabledAt *time.Time) error
+
+	// AdvanceTOTPStep records step as the last TOTP time step used. It
+	// returns ErrNotFound if step is not after the last one, meaning the code
+	// was already used.
+	AdvanceTOTPStep(ctx context.Context, id uint, step int64) error
+
+	// List returns a page of users ordered by ID and the total number of users
+	List(ctx context.Context, offset, limit int) ([]models.User, int64, error)
+
+	// SetRole changes the user's role
+	SetRole(ctx context.Context, id uint, role string) error
+
+	// SetDisabled disables the account at the given time, or enables it when nil
+	SetDisabled(ctx context.Context, id uint, disabledAt *time.Time) error
+
+	// GetByUsername finds a user by username, ignoring case
+	GetByUsername(ctx context.Context, username string) (*models.User, error)
+
+	// UpdateProfile applies the non-nil fields of update. It returns
+	// ErrDuplicate if the new username is taken. Setting AvatarURL forgets
+	// any uploaded avatar.
+	UpdateProfile(ctx context.Context, id uint, update models.ProfileUpdate) error
+
+	// UpdateEmail changes the user's address and marks it unverified. It
+	// returns ErrDuplicate if another account has the address, ignoring case.
+	UpdateEmail(ctx context.Context, id uint, email string) error
+
+	// SetAvatar replaces the user's avatar with an uploaded one, or removes
+	// it when avatar is the zero value
+	SetAvatar(ctx context.Context, id uint, avatar models.Avatar) error
+
+	// Search returns a page of the listed, active users other than except
+	// whose username or display name starts with or resembles query, best
+	// matches first, and the total number of matches
+	Search(ctx context.Context, query string, except uint, offset, limit int) ([]models.User, int64, error)
+
+	// Anonymize erases the user's personal data and marks the account as
+	// deleted at the given time. The row is kept so calls still refer to it.
+	Anonymize(ctx context.Context, id uint, at time.Time) error
+}
+
+// CallRepository stores video calls
+type CallRepository interface {
+	Create(ctx context.Context, call *models.Call) error
+	GetByID(ctx context.Context, id uint) (*models.Call, error)
+
+	// List returns the calls matching opts in the requested order, starting
+	// after opts.After
+	List(ctx context.Context, opts CallListOptions) ([]models.Call, error)
+
+	// UpdateStatus moves a call from one status to another. It returns
+	// ErrNotFound if the call does not exist or is not in the from status.
+	UpdateStatus(ctx context.Context, id uint, from, to string) error
+
+	// ListByUser returns the calls a user created or has joined,
+	// newest first
+	ListByUser(ctx context.Context, userID uint) ([]models.Call, error)
+}
+
+// CallSort orders call listings; every order ends with the ID so it is total
+type CallSort string
+
+const (
+	// CallSortNewest lists the most recently created calls first
+	CallSortNewest CallSort = "newest"
+	// CallSortOldest lists the earliest created calls first
+	CallSortOldest CallSort = "oldest"
+	// CallSortTitle lists calls alphabetically by title, ignoring case
+	CallSortTitle CallSort = "title"
+)
+
+// CallCursor is the position of the last call of a page in its sort order
+type CallCursor struct {
+	CreatedAt time.Time `json:"created_at"`
+	Title     string    `json:"title"`
+	ID        uint      `json:"id"`
+}
+
+// CallListOptions selects and orders calls; zero fields do not filter
+type CallListOptions struct {
+	// Status is "active" or "ended"; empty lists both
+	Status    string
+	CreatorID uint
+
+	// CreatedAfter and CreatedBefore bound the creation time, inclusive and
+	// exclusive respectively
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+
+	// ParticipantID limits the list to calls that user is taking part in
+	ParticipantID uint
+	Tag           string
+
+	Sort  CallSort
+	After *CallCursor
+	Limit int
+}
+
+// ParticipantRepository stores the times users spend in calls. Records are
+// kept after users leave so attendance can be reported.
+type ParticipantRepository interface {
+	// Create adds a record. A user has at most one open record in a call;
+	// creating a second one returns ErrDuplicate.
+	Create(ctx context.Context, participant *models.CallParticipant) error
+
+	// GetOpen returns a user's open record in a call, or ErrNotFound if they
+	// are not in it
+	GetOpen(ctx context.Context, callID, userID uint) (*models.CallParticipant, error)
+
+	// Leave sets the leave time on a user's open records in a call. Leaving
+	// a call the user is not in does nothing.
+	Leave(ctx context.Context, callID, userID uint, at time.Time) error
+
+	// LeaveAll sets the leave time on every open record in a call
+	LeaveAll(ctx context.Context, callID uint, at time.Time) error
+
+	// ListByUser returns every record of a user, newest first
+	ListByUser(ctx context.Context, userID uint) ([]models.CallParticipant, error)
+
+	// ListByCall returns every record of a call in the order users joined
+	ListByCall(ctx context.Context, callID uint) ([]models.CallParticipant, error)
+
+	// ListByUserInCalls returns a user's records in the given calls in the
+	// order they joined
+	ListByUserInCalls(ctx context.Context, userID uint, callIDs []uint) ([]models.CallParticipant, error)
+}
+
+// PasswordResetRepository stores password reset tokens by hash
+type PasswordResetRepository interface {
+	Create(ctx context.Context, token *models.PasswordResetToken) error
+
+	// Consume marks the unused, unexpired token with the given hash as used
+	// and returns it, or ErrNotFound if there is no such token
+	Consume(ctx context.Context, hash string, now time.Time) (*models.PasswordResetToken, error)
+
+	// InvalidateForUser marks every unused token of a user as used
+	InvalidateForUser(ctx context.Context, userID uint, now time.Time) error
+}
+
+// RecoveryCodeRepository stores two-factor recovery codes by hash
+type RecoveryCodeRepository interface {
+	// Replace discards the user's codes and stores new ones
+	Replace(ctx context.Context, userID uint, hashes []string) error
+
+	// Consume marks an unused code of the user as used, or returns ErrNotFound
+	Consume(ctx context.Context, userID uint, hash string, now time.Time) error
+
+	CountUnused(ctx context.Context, userID uint) (int, error)
+	DeleteForUser(ctx context.Context, userID uint) error
+}
+
+// IdentityRepository stores the links between users and OpenID Connect accounts
+type IdentityRepository interface {
+	// Create links an identity to a user, or returns ErrDuplicate if the
+	// provider account is already linked
+	Create(ctx context.Context, identity *models.UserIdentity) error
+
+	GetBySubject(ctx context.Context, provider, subject string) (*models.UserIdentity, error)
+
+	// RecordLogin stores the email the provider reported and the login time
+	RecordLogin(ctx context.Context, id uint, email string, at time.Time) error
+
+	// ListByUser returns the identities linked to a user, oldest first
+	ListByUser(ctx context.Context, userID uint) ([]models.UserIdentity, error)
+
+	DeleteForUser(ctx context.Context, userID uint) error
+}
+
+// APIKeyRepository stores API keys by hash
+type APIKeyRepository interface {
+	Create(ctx context.Context, key *models.APIKey) error
+
+	// ListByUser returns a user's keys, revoked ones included, newest first
+	ListByUser(ctx context.Context, userID uint) ([]models.APIKey, error)
+
+	// CountActive returns how many of a user's keys are neither revoked nor expired
+	CountActive(ctx context.Context, userID uint, now time.Time) (int64, error)
+
+	// GetActiveByHash returns the key with the given hash, or ErrNotFound if
+	// there is none or it is revoked or expired
+	GetActiveByHash(ctx context.Context, hash string, now time.Time) (*models.APIKey, error)
+
+	// RecordUse stores when and from which IP the key was last used
+	RecordUse(ctx context.Context, id uint, ip string, at time.Time) error
+
+	// Revoke revokes one of a user's keys, or returns ErrNotFound if the user
+	// has no such key or it is already revoked
+	Revoke(ctx context.Context, userID, id uint, now time.Time) error
+
+	DeleteForUser(ctx context.Context, userID uint) error
+}
+
+// SessionRepository stores login sessions
+type SessionRepository interface {
+	Create(ctx context.Context, session *models.Session) error
+
+	// GetActive returns the session with the given ID, or ErrNotFound if there
+	// is none or it is revoked or expired
+	GetActive(ctx context.Context, id uint, now time.Time) (*models.Session, error)
+
+	// ListActiveByUser returns a user's active sessions, most recently seen first
+	ListActiveByUser(ctx context.Context, userID uint, now time.Time) ([]models.Session, error)
+
+	// Touch records that the session was used from ip at the given time
+	Touch(ctx context.Context, id uint, ip string, at time.Time) error
+
+	// Revoke revokes one of a user's sessions, or returns ErrNotFound if the
+	// user has no such active session
+	Revoke(ctx context.Context, userID, id uint, now time.Time) error
+
+	// RevokeAllForUser revokes every session of a user
+	RevokeAllForUser(ctx context.Context, userID uint, now time.Time) error
+
+	// ListByUser returns all of a user's sessions, revoked and expired ones
+	// included, newest first
+	ListByUser(ctx context.Context, userID uint) ([]models.Session, error)
+
+	DeleteForUser(ctx context.Context, userID uint) error
+}
+
+// Repositories groups every repository the handlers depend on
+type Repositories struct {
+	Users          UserRepository
+	Calls          CallRepository
+	Participants   ParticipantRepository
+	PasswordResets PasswordResetRepository
+	RecoveryCodes  RecoveryCodeRepository
+	Identities     IdentityRepository
+	APIKeys        APIKeyRepository
+	Sessions       SessionRepository
+}
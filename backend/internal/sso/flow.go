@@ -0,0 +1,43 @@
+package sso
+
+import (
+	"time"
+
+	"github.com/ayush/accountability-app/backend/internal/auth"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// flowPurpose keys the signature on flow state so no other token is accepted as one
+const flowPurpose = "oidc_flow"
+
+// flow is the state of a login in progress. The browser keeps it in a signed
+// cookie between the redirect to the provider and the callback, so a
+// callback only completes a login that the same browser started.
+type flow struct {
+	Provider string `json:"provider"`
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	jwt.RegisteredClaims
+}
+
+func (f flow) sign(ttl time.Duration) (string, error) {
+	now := time.Now()
+	f.RegisteredClaims = jwt.RegisteredClaims{
+		ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		IssuedAt:  jwt.NewNumericDate(now),
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, f).SignedString(auth.PurposeKey(flowPurpose))
+}
+
+func parseFlow(signed string) (*flow, error) {
+	var f flow
+	token, err := jwt.ParseWithClaims(signed, &f, func(token *jwt.Token) (interface{}, error) {
+		return auth.PurposeKey(flowPurpose), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil || !token.Valid {
+		return nil, ErrInvalidState
+	}
+	return &f, nil
+}
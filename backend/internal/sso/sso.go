@@ -0,0 +1,249 @@
+// Package sso logs users in through OpenID Connect providers using the
+// authorization code flow with PKCE.
+package sso
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ayush/accountability-app/backend/internal/config"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+	"golang.org/x/sync/singleflight"
+)
+
+var (
+	// ErrUnknownProvider is returned for a provider name that is not configured
+	ErrUnknownProvider = errors.New("unknown identity provider")
+
+	// ErrInvalidState is returned when the callback does not belong to a
+	// login started by this browser, or the login took too long
+	ErrInvalidState = errors.New("invalid or expired login state")
+)
+
+// defaultScopes are requested when a provider does not list its own
+var defaultScopes = []string{oidc.ScopeOpenID, "email", "profile"}
+
+// discoveryTimeout bounds fetching a provider's metadata, independently of
+// the request that needed it
+const discoveryTimeout = 10 * time.Second
+
+// Identity is what a provider asserted about the user who logged in
+type Identity struct {
+	Provider          string
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	Name              string
+	PreferredUsername string
+}
+
+// Provider is one configured identity provider. Discovery runs on first use
+// and is retried until it succeeds, so a provider that is unreachable at
+// startup does not stop the server.
+type Provider struct {
+	Name        string
+	DisplayName string
+
+	cfg         config.OIDCProviderConfig
+	redirectURL string
+
+	// discovery lets concurrent logins share one metadata fetch
+	discovery singleflight.Group
+
+	mu       sync.Mutex
+	oauth    *oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+// Registry holds the configured providers
+type Registry struct {
+	providers []*Provider
+	stateTTL  time.Duration
+}
+
+// NewRegistry creates the providers in cfg. Logins must finish within stateTTL.
+func NewRegistry(cfg config.OIDCConfig, stateTTL time.Duration) *Registry {
+	base := strings.TrimRight(cfg.CallbackBaseURL, "/")
+	r := &Registry{stateTTL: stateTTL}
+	for _, pc := range cfg.Providers {
+		displayName := pc.DisplayName
+		if displayName == "" {
+			displayName = pc.Name
+		}
+		r.providers = append(r.providers, &Provider{
+			Name:        pc.Name,
+			DisplayName: displayName,
+			cfg:         pc,
+			redirectURL: base + "/api/auth/oidc/" + url.PathEscape(pc.Name) + "/callback",
+		})
+	}
+	return r
+}
+
+// Providers returns the configured providers in config order
+func (r *Registry) Providers() []*Provider {
+	return r.providers
+}
+
+// StateTTL returns how long a login may take at the provider
+func (r *Registry) StateTTL() time.Duration {
+	return r.stateTTL
+}
+
+// Get returns the provider with the given name
+func (r *Registry) Get(name string) (*Provider, error) {
+	for _, p := range r.providers {
+		if p.Name == name {
+			return p, nil
+		}
+	}
+	return nil, ErrUnknownProvider
+}
+
+// Start begins a login with the named provider. It returns the URL to send
+// the browser to and the signed flow state to keep in a cookie until the
+// provider redirects back.
+func (r *Registry) Start(ctx context.Context, name string) (string, string, error) {
+	p, err := r.Get(name)
+	if err != nil {
+		return "", "", err
+	}
+	oauth, _, err := p.discover(ctx)
+	if err != nil {
+		return "", "", err
+	}
+
+	f := flow{
+		Provider: p.Name,
+		State:    rand.Text(),
+		Nonce:    rand.Text(),
+		Verifier: oauth2.GenerateVerifier(),
+	}
+	signed, err := f.sign(r.stateTTL)
+	if err != nil {
+		return "", "", err
+	}
+
+	redirect := oauth.AuthCodeURL(f.State, oidc.Nonce(f.Nonce), oauth2.S256ChallengeOption(f.Verifier))
+	return redirect, signed, nil
+}
+
+// Finish completes a login from the state and code the provider sent to the
+// callback, checking them against the flow state returned by Start
+func (r *Registry) Finish(ctx context.Context, name, signedFlow, state, code string) (*Identity, error) {
+	p, err := r.Get(name)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := parseFlow(signedFlow)
+	if err != nil || f.Provider != p.Name || state == "" || f.State != state {
+		return nil, ErrInvalidState
+	}
+
+	oauth, verifier, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := oauth.Exchange(ctx, code, oauth2.VerifierOption(f.Verifier))
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange code with %s: %v", p.Name, err)
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok || rawIDToken == "" {
+		return nil, fmt.Errorf("%s did not return an ID token", p.Name)
+	}
+	idToken, err := verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ID token from %s: %v", p.Name, err)
+	}
+	if idToken.Nonce != f.Nonce {
+		return nil, fmt.Errorf("ID token from %s has the wrong nonce", p.Name)
+	}
+
+	var claims struct {
+		Email             string `json:"email"`
+		EmailVerified     bool   `json:"email_verified"`
+		Name              string `json:"name"`
+		PreferredUsername string `json:"preferred_username"`
+	}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("invalid ID token claims from %s: %v", p.Name, err)
+	}
+
+	return &Identity{
+		Provider:          p.Name,
+		Subject:           idToken.Subject,
+		Email:             claims.Email,
+		EmailVerified:     claims.EmailVerified,
+		Name:              claims.Name,
+		PreferredUsername: claims.PreferredUsername,
+	}, nil
+}
+
+// discover fetches the provider's metadata the first time it is needed.
+// Requests arriving while it is being fetched wait for that fetch, each only
+// as long as its own context allows, and only a successful result is kept.
+func (p *Provider) discover(ctx context.Context) (*oauth2.Config, *oidc.IDTokenVerifier, error) {
+	if oauth, verifier := p.discovered(); oauth != nil {
+		return oauth, verifier, nil
+	}
+
+	result := p.discovery.DoChan(p.Name, func() (interface{}, error) {
+		if oauth, _ := p.discovered(); oauth != nil {
+			return nil, nil
+		}
+
+		// The fetch is shared, so one caller giving up must not cancel it
+		fetchCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), discoveryTimeout)
+		defer cancel()
+		provider, err := oidc.NewProvider(fetchCtx, p.cfg.Issuer)
+		if err != nil {
+			return nil, fmt.Errorf("failed to discover %s: %v", p.Name, err)
+		}
+
+		scopes := p.cfg.Scopes
+		if len(scopes) == 0 {
+			scopes = defaultScopes
+		}
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.oauth = &oauth2.Config{
+			ClientID:     p.cfg.ClientID,
+			ClientSecret: p.cfg.ClientSecret,
+			Endpoint:     provider.Endpoint(),
+			RedirectURL:  p.redirectURL,
+			Scopes:       scopes,
+		}
+		p.verifier = provider.Verifier(&oidc.Config{ClientID: p.cfg.ClientID})
+		return nil, nil
+	})
+
+	select {
+	case res := <-result:
+		if res.Err != nil {
+			return nil, nil, res.Err
+		}
+	case <-ctx.Done():
+		return nil, nil, fmt.Errorf("failed to discover %s: %v", p.Name, ctx.Err())
+	}
+	oauth, verifier := p.discovered()
+	return oauth, verifier, nil
+}
+
+// discovered returns the provider's configuration, or nil before discovery
+// has succeeded
+func (p *Provider) discovered() (*oauth2.Config, *oidc.IDTokenVerifier) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.oauth, p.verifier
+}
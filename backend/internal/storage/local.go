@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// localStorage keeps objects as files below a directory
+type localStorage struct {
+	dir     string
+	baseURL string
+}
+
+// NewLocal creates a storage that writes objects below dir. The files are
+// expected to be served at baseURL, e.g. by the server's /media route.
+func NewLocal(dir, baseURL string) Storage {
+	return &localStorage{dir: dir, baseURL: baseURL}
+}
+
+func (s *localStorage) Put(_ context.Context, key string, body io.Reader, size int64, _ string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+
+	path := filepath.Join(s.dir, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create directory: %v", err)
+	}
+
+	// Write to a temporary file first so a half-written object is never
+	// served
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return fmt.Errorf("failed to create file: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	written, err := io.Copy(tmp, io.LimitReader(body, size))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write file: %v", err)
+	}
+	if written != size {
+		return fmt.Errorf("short write: got %d of %d bytes", written, size)
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return fmt.Errorf("failed to write file: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write file: %v", err)
+	}
+	return nil
+}
+
+func (s *localStorage) Delete(_ context.Context, key string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	err := os.Remove(filepath.Join(s.dir, filepath.FromSlash(key)))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to delete file: %v", err)
+	}
+	return nil
+}
+
+func (s *localStorage) URL(key string) string {
+	return publicURL(s.baseURL, key)
+}
@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+)
+
+// Object is a stored object as kept by Memory
+type Object struct {
+	Data        []byte
+	ContentType string
+}
+
+// Memory keeps objects in memory. It is meant for tests, which can inspect
+// what was stored.
+type Memory struct {
+	mu      sync.RWMutex
+	baseURL string
+	objects map[string]Object
+}
+
+// NewMemory creates an empty in-memory storage whose URLs start with baseURL
+func NewMemory(baseURL string) *Memory {
+	return &Memory{baseURL: baseURL, objects: make(map[string]Object)}
+}
+
+func (m *Memory) Put(_ context.Context, key string, body io.Reader, size int64, contentType string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if _, err := io.Copy(&buf, io.LimitReader(body, size)); err != nil {
+		return err
+	}
+	if int64(buf.Len()) != size {
+		return fmt.Errorf("short write: got %d of %d bytes", buf.Len(), size)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.objects[key] = Object{Data: buf.Bytes(), ContentType: contentType}
+	return nil
+}
+
+func (m *Memory) Delete(_ context.Context, key string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.objects, key)
+	return nil
+}
+
+func (m *Memory) URL(key string) string {
+	return publicURL(m.baseURL, key)
+}
+
+// Get returns the object stored under key
+func (m *Memory) Get(key string) (Object, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	obj, ok := m.objects[key]
+	return obj, ok
+}
+
+// Keys returns the keys of all stored objects in sorted order
+func (m *Memory) Keys() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	keys := make([]string, 0, len(m.objects))
+	for key := range m.objects {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
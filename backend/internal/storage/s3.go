@@ -0,0 +1,136 @@
+package storage
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ayush/accountability-app/backend/internal/config"
+)
+
+// s3Timeout bounds a single request to the object store
+const s3Timeout = 30 * time.Second
+
+// s3Storage keeps objects in a bucket of an S3-compatible store. Requests
+// are signed with Signature Version 4, which AWS, MinIO, Cloudflare R2 and
+// other compatible stores accept.
+type s3Storage struct {
+	client    *http.Client
+	endpoint  *url.URL
+	bucket    string
+	pathStyle bool
+	creds     credentials
+	baseURL   string
+
+	// now is replaced in tests
+	now func() time.Time
+}
+
+// NewS3 creates a storage backed by the bucket described in cfg. Objects
+// are expected to be publicly readable at baseURL.
+func NewS3(cfg config.S3Config, baseURL string) (Storage, error) {
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid S3 endpoint %q", cfg.Endpoint)
+	}
+	return &s3Storage{
+		client:    &http.Client{Timeout: s3Timeout},
+		endpoint:  endpoint,
+		bucket:    cfg.Bucket,
+		pathStyle: cfg.PathStyle,
+		creds: credentials{
+			accessKeyID:     cfg.AccessKeyID,
+			secretAccessKey: cfg.SecretAccessKey,
+			region:          cfg.Region,
+			service:         "s3",
+		},
+		baseURL: baseURL,
+		now:     time.Now,
+	}, nil
+}
+
+// objectURL addresses key either as endpoint/bucket/key (path style) or
+// bucket.endpoint/key (virtual-hosted style)
+func (s *s3Storage) objectURL(key string) *url.URL {
+	u := *s.endpoint
+	base := strings.TrimSuffix(u.Path, "/")
+	if s.pathStyle {
+		u.Path = base + "/" + s.bucket + "/" + key
+	} else {
+		u.Host = s.bucket + "." + u.Host
+		u.Path = base + "/" + key
+	}
+	u.RawQuery = ""
+	return &u
+}
+
+func (s *s3Storage) Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, s.objectURL(key).String(), io.LimitReader(body, size))
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Header.Set("X-Amz-Content-Sha256", unsignedPayload)
+	return s.do(req, unsignedPayload, http.StatusOK)
+}
+
+func (s *s3Storage) Delete(ctx context.Context, key string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, s.objectURL(key).String(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Amz-Content-Sha256", emptyPayloadHash)
+	// S3 answers 204 whether or not the object existed; some compatible
+	// stores answer 404 for missing objects
+	return s.do(req, emptyPayloadHash, http.StatusNoContent, http.StatusOK, http.StatusNotFound)
+}
+
+func (s *s3Storage) URL(key string) string {
+	return publicURL(s.baseURL, key)
+}
+
+// do signs and sends req and fails unless the response has one of the
+// expected status codes
+func (s *s3Storage) do(req *http.Request, payloadHash string, expected ...int) error {
+	s.creds.sign(req, payloadHash, s.now())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("S3 %s failed: %v", req.Method, err)
+	}
+	defer resp.Body.Close()
+
+	for _, status := range expected {
+		if resp.StatusCode == status {
+			io.Copy(io.Discard, resp.Body)
+			return nil
+		}
+	}
+
+	// Errors come as <Error><Code>...</Code><Message>...</Message></Error>
+	var s3Err struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if xml.Unmarshal(body, &s3Err) == nil && s3Err.Code != "" {
+		return fmt.Errorf("S3 %s failed with status %d: %s: %s", req.Method, resp.StatusCode, s3Err.Code, s3Err.Message)
+	}
+	return fmt.Errorf("S3 %s failed with status %d", req.Method, resp.StatusCode)
+}
@@ -0,0 +1,159 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// AWS Signature Version 4, as described at
+// https://docs.aws.amazon.com/IAM/latest/UserGuide/reference_sigv-create-signed-request.html
+
+const (
+	sigV4Algorithm  = "AWS4-HMAC-SHA256"
+	sigV4TimeFormat = "20060102T150405Z"
+
+	// unsignedPayload tells S3 not to check the body against the signature,
+	// so uploads can be streamed without hashing them first
+	unsignedPayload = "UNSIGNED-PAYLOAD"
+)
+
+// emptyPayloadHash is the SHA-256 of an empty body
+var emptyPayloadHash = hex.EncodeToString(sha256.New().Sum(nil))
+
+// credentials sign requests for one region and service
+type credentials struct {
+	accessKeyID     string
+	secretAccessKey string
+	region          string
+	service         string
+}
+
+// sign adds X-Amz-Date and an Authorization header to req. The Host header
+// and every X-Amz-* header already set are signed. payloadHash is the hex
+// SHA-256 of the body or unsignedPayload.
+func (c credentials) sign(req *http.Request, payloadHash string, now time.Time) {
+	now = now.UTC()
+	req.Header.Set("X-Amz-Date", now.Format(sigV4TimeFormat))
+
+	headers := map[string]string{"host": requestHost(req)}
+	for name, values := range req.Header {
+		name = strings.ToLower(name)
+		if strings.HasPrefix(name, "x-amz-") || name == "content-type" {
+			headers[name] = canonicalHeaderValue(values)
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		canonicalPath(req.URL),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	date := now.Format("20060102")
+	scope := date + "/" + c.region + "/" + c.service + "/aws4_request"
+	stringToSign := strings.Join([]string{
+		sigV4Algorithm,
+		now.Format(sigV4TimeFormat),
+		scope,
+		hashHex(canonicalRequest),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+c.secretAccessKey), date)
+	key = hmacSHA256(key, c.region)
+	key = hmacSHA256(key, c.service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", sigV4Algorithm+
+		" Credential="+c.accessKeyID+"/"+scope+
+		", SignedHeaders="+signedHeaders+
+		", Signature="+signature)
+}
+
+func requestHost(req *http.Request) string {
+	if req.Host != "" {
+		return req.Host
+	}
+	return req.URL.Host
+}
+
+// canonicalHeaderValue joins repeated values with commas and collapses runs
+// of spaces
+func canonicalHeaderValue(values []string) string {
+	trimmed := make([]string, len(values))
+	for i, v := range values {
+		trimmed[i] = strings.Join(strings.Fields(v), " ")
+	}
+	return strings.Join(trimmed, ",")
+}
+
+// canonicalPath URI-encodes each segment of the path once, as S3 expects
+func canonicalPath(u *url.URL) string {
+	path := u.Path
+	if path == "" {
+		return "/"
+	}
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		segments[i] = uriEncode(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+func canonicalQuery(query url.Values) string {
+	pairs := make([]string, 0, len(query))
+	for name, values := range query {
+		for _, value := range values {
+			pairs = append(pairs, uriEncode(name)+"="+uriEncode(value))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+// uriEncode percent-encodes everything except the unreserved characters of
+// RFC 3986
+func uriEncode(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' ||
+			c == '-' || c == '.' || c == '_' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			b.WriteString("%" + strings.ToUpper(hex.EncodeToString([]byte{c})))
+		}
+	}
+	return b.String()
+}
+
+func hashHex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,70 @@
+// Package storage keeps uploaded files such as avatars in a local directory
+// or an S3-compatible object store.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ayush/accountability-app/backend/internal/config"
+)
+
+// ErrInvalidKey is returned for object keys that are empty, absolute or
+// could escape their directory
+var ErrInvalidKey = errors.New("invalid object key")
+
+// Storage stores objects under slash-separated keys such as
+// "avatars/1/3fa9c2-256.png"
+type Storage interface {
+	// Put stores size bytes read from body under key, replacing any object
+	// already there
+	Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error
+
+	// Delete removes the object under key. Deleting a missing object is not
+	// an error.
+	Delete(ctx context.Context, key string) error
+
+	// URL returns the public URL of the object under key
+	URL(key string) string
+}
+
+// New returns the storage selected by storage.driver
+func New(cfg config.StorageConfig) (Storage, error) {
+	switch cfg.Driver {
+	case "local":
+		return NewLocal(cfg.Dir, cfg.PublicURL), nil
+	case "s3":
+		return NewS3(cfg.S3, cfg.PublicURL)
+	default:
+		return nil, fmt.Errorf("unknown storage driver %q", cfg.Driver)
+	}
+}
+
+// checkKey rejects keys that are not plain relative paths made of letters,
+// digits, '.', '_', '-' and '/'
+func checkKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.HasSuffix(key, "/") {
+		return ErrInvalidKey
+	}
+	for _, r := range key {
+		ok := r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' ||
+			r == '.' || r == '_' || r == '-' || r == '/'
+		if !ok {
+			return ErrInvalidKey
+		}
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return ErrInvalidKey
+		}
+	}
+	return nil
+}
+
+// publicURL joins a base URL and an object key
+func publicURL(base, key string) string {
+	return strings.TrimSuffix(base, "/") + "/" + key
+}
@@ -0,0 +1,164 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ayush/accountability-app/backend/internal/config"
+	"github.com/ayush/accountability-app/backend/internal/testutil/s3test"
+)
+
+func TestCheckKey(t *testing.T) {
+	for _, key := range []string{"avatars/1/3fa9c2-256.png", "a", "a.b/c_d-e"} {
+		if err := checkKey(key); err != nil {
+			t.Errorf("checkKey(%q) = %v, want nil", key, err)
+		}
+	}
+	for _, key := range []string{"", "/etc/passwd", "../secret", "a/../../b", "a//b", "a/", "a/./b", `a\b`, "a b", "avatars/ü.png"} {
+		if err := checkKey(key); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("checkKey(%q) = %v, want ErrInvalidKey", key, err)
+		}
+	}
+}
+
+func TestLocalStorage(t *testing.T) {
+	dir := t.TempDir()
+	store := NewLocal(dir, "http://localhost:8080/media/")
+
+	if err := store.Put(t.Context(), "avatars/1/a-64.png", strings.NewReader("png"), 3, "image/png"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "avatars", "1", "a-64.png"))
+	if err != nil || string(data) != "png" {
+		t.Fatalf("unexpected file content %q, %v", data, err)
+	}
+	if got := store.URL("avatars/1/a-64.png"); got != "http://localhost:8080/media/avatars/1/a-64.png" {
+		t.Fatalf("unexpected URL %q", got)
+	}
+
+	if err := store.Put(t.Context(), "../escape.png", strings.NewReader("png"), 3, "image/png"); !errors.Is(err, ErrInvalidKey) {
+		t.Fatalf("expected ErrInvalidKey, got %v", err)
+	}
+	if err := store.Put(t.Context(), "short.png", strings.NewReader("pn"), 3, "image/png"); err == nil {
+		t.Fatal("expected a short body to fail")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "short.png")); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected no file for a failed upload, got %v", err)
+	}
+
+	if err := store.Delete(t.Context(), "avatars/1/a-64.png"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if err := store.Delete(t.Context(), "avatars/1/a-64.png"); err != nil {
+		t.Fatalf("deleting a missing object should succeed, got %v", err)
+	}
+}
+
+// TestSignV4 checks the signer against the get-vanilla example of the AWS
+// Signature Version 4 test suite
+func TestSignV4(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/", nil)
+	creds := credentials{
+		accessKeyID:     "AKIDEXAMPLE",
+		secretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+		region:          "us-east-1",
+		service:         "service",
+	}
+	creds.sign(req, emptyPayloadHash, time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+
+	want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+		"SignedHeaders=host;x-amz-date, " +
+		"Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"
+	if got := req.Header.Get("Authorization"); got != want {
+		t.Fatalf("unexpected Authorization header\n got: %s\nwant: %s", got, want)
+	}
+}
+
+func TestS3ObjectURL(t *testing.T) {
+	cfg := config.S3Config{Endpoint: "https://s3.eu-central-1.amazonaws.com", Bucket: "media"}
+	store, _ := NewS3(cfg, "https://cdn.example.com")
+	if got := store.(*s3Storage).objectURL("avatars/1/a.png").String(); got != "https://media.s3.eu-central-1.amazonaws.com/avatars/1/a.png" {
+		t.Fatalf("unexpected virtual-hosted URL %q", got)
+	}
+
+	cfg.PathStyle = true
+	store, _ = NewS3(cfg, "https://cdn.example.com")
+	if got := store.(*s3Storage).objectURL("avatars/1/a.png").String(); got != "https://s3.eu-central-1.amazonaws.com/media/avatars/1/a.png" {
+		t.Fatalf("unexpected path-style URL %q", got)
+	}
+	if got := store.URL("avatars/1/a.png"); got != "https://cdn.example.com/avatars/1/a.png" {
+		t.Fatalf("unexpected public URL %q", got)
+	}
+}
+
+func TestS3Storage(t *testing.T) {
+	server := s3test.NewServer(t)
+	cfg := config.S3Config{
+		Endpoint:        server.URL,
+		Region:          s3test.Region,
+		Bucket:          s3test.Bucket,
+		AccessKeyID:     s3test.AccessKeyID,
+		SecretAccessKey: s3test.SecretAccessKey,
+		PathStyle:       true,
+	}
+	store, err := New(config.StorageConfig{Driver: "s3", PublicURL: server.URL + "/media", S3: cfg})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	data := bytes.Repeat([]byte{0x89, 'P', 'N', 'G'}, 1000)
+	if err := store.Put(t.Context(), "avatars/1/a-256.png", bytes.NewReader(data), int64(len(data)), "image/png"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	obj, ok := server.Object("avatars/1/a-256.png")
+	if !ok || !bytes.Equal(obj.Data, data) || obj.ContentType != "image/png" {
+		t.Fatalf("unexpected stored object %v (%d bytes), %v", obj.ContentType, len(obj.Data), ok)
+	}
+
+	resp, err := http.Get(store.URL("avatars/1/a-256.png"))
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected the fake to refuse unsigned requests, got %d", resp.StatusCode)
+	}
+
+	if err := store.Delete(t.Context(), "avatars/1/a-256.png"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if keys := server.Keys(); len(keys) != 0 {
+		t.Fatalf("expected the object to be deleted, got %v", keys)
+	}
+	if err := store.Delete(t.Context(), "avatars/1/a-256.png"); err != nil {
+		t.Fatalf("deleting a missing object should succeed, got %v", err)
+	}
+
+	t.Run("wrong secret", func(t *testing.T) {
+		bad := cfg
+		bad.SecretAccessKey = "wrong"
+		store, _ := NewS3(bad, server.URL)
+		err := store.Put(t.Context(), "a.png", strings.NewReader("x"), 1, "image/png")
+		if err == nil || !strings.Contains(err.Error(), "SignatureDoesNotMatch") {
+			t.Fatalf("expected SignatureDoesNotMatch, got %v", err)
+		}
+	})
+
+	t.Run("endpoint with a path", func(t *testing.T) {
+		u, _ := url.Parse(server.URL)
+		u.Path = "/"
+		withSlash := cfg
+		withSlash.Endpoint = u.String()
+		store, _ := NewS3(withSlash, server.URL)
+		if err := store.Put(t.Context(), "b.png", strings.NewReader("x"), 1, "image/png"); err != nil {
+			t.Fatalf("Put: %v", err)
+		}
+	})
+}
@@ -0,0 +1,234 @@
+// Package s3test runs a minimal S3-compatible object store for tests. It
+// serves path-style PUT, GET and DELETE for a single bucket and checks every
+// request's Signature Version 4 the way S3 and MinIO do.
+package s3test
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Default credentials and location of the bucket
+const (
+	AccessKeyID     = "minioadmin"
+	SecretAccessKey = "minioadmin-secret"
+	Region          = "us-east-1"
+	Bucket          = "media"
+)
+
+// maxClockSkew is how far a request's X-Amz-Date may be from the server's
+// clock, as enforced by S3
+const maxClockSkew = 15 * time.Minute
+
+// Object is a stored object
+type Object struct {
+	Data        []byte
+	ContentType string
+}
+
+// Server is a running fake object store; its URL is the S3 endpoint
+type Server struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	objects map[string]Object
+}
+
+// NewServer starts a fake object store that is closed when the test ends
+func NewServer(t *testing.T) *Server {
+	t.Helper()
+
+	s := &Server{objects: make(map[string]Object)}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Object returns the object stored under key
+func (s *Server) Object(key string) (Object, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	obj, ok := s.objects[key]
+	return obj, ok
+}
+
+// Keys returns the keys of all stored objects in sorted order
+func (s *Server) Keys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := make([]string, 0, len(s.objects))
+	for key := range s.objects {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket != Bucket {
+		writeError(w, http.StatusNotFound, "NoSuchBucket", "The specified bucket does not exist")
+		return
+	}
+	if key == "" {
+		writeError(w, http.StatusNotImplemented, "NotImplemented", "Bucket operations are not supported")
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "IncompleteBody", err.Error())
+		return
+	}
+	if code, msg := verify(r, body); code != "" {
+		writeError(w, http.StatusForbidden, code, msg)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch r.Method {
+	case http.MethodPut:
+		s.objects[key] = Object{Data: body, ContentType: r.Header.Get("Content-Type")}
+		w.WriteHeader(http.StatusOK)
+	case http.MethodGet:
+		obj, ok := s.objects[key]
+		if !ok {
+			writeError(w, http.StatusNotFound, "NoSuchKey", "The specified key does not exist")
+			return
+		}
+		w.Header().Set("Content-Type", obj.ContentType)
+		w.Write(obj.Data)
+	case http.MethodDelete:
+		delete(s.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed", "The method is not supported")
+	}
+}
+
+// verify checks the request's signature and returns an S3 error code and
+// message if it is not valid
+func verify(r *http.Request, body []byte) (string, string) {
+	auth := r.Header.Get("Authorization")
+	rest, ok := strings.CutPrefix(auth, "AWS4-HMAC-SHA256 ")
+	if !ok {
+		return "AccessDenied", "missing or unsupported Authorization header"
+	}
+	fields := map[string]string{}
+	for _, part := range strings.Split(rest, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		fields[name] = value
+	}
+
+	scope := strings.Split(fields["Credential"], "/")
+	if len(scope) != 5 || scope[0] != AccessKeyID {
+		return "InvalidAccessKeyId", "unknown access key"
+	}
+	if scope[2] != Region || scope[3] != "s3" || scope[4] != "aws4_request" {
+		return "AuthorizationHeaderMalformed", "bad credential scope " + fields["Credential"]
+	}
+
+	date, err := time.Parse("20060102T150405Z", r.Header.Get("X-Amz-Date"))
+	if err != nil || date.Format("20060102") != scope[1] {
+		return "AccessDenied", "missing or mismatched X-Amz-Date"
+	}
+	if skew := time.Since(date); skew > maxClockSkew || skew < -maxClockSkew {
+		return "RequestTimeTooSkewed", "request time too far from server time"
+	}
+
+	payloadHash := r.Header.Get("X-Amz-Content-Sha256")
+	if payloadHash == "" {
+		return "InvalidRequest", "missing X-Amz-Content-Sha256"
+	}
+	if payloadHash != "UNSIGNED-PAYLOAD" {
+		sum := sha256.Sum256(body)
+		if payloadHash != hex.EncodeToString(sum[:]) {
+			return "XAmzContentSHA256Mismatch", "body does not match X-Amz-Content-Sha256"
+		}
+	}
+
+	signed := strings.Split(fields["SignedHeaders"], ";")
+	if !slices.Contains(signed, "host") || !slices.Contains(signed, "x-amz-date") {
+		return "AccessDenied", "host and x-amz-date must be signed"
+	}
+	var headers bytes.Buffer
+	for _, name := range signed {
+		value := slices.Clone(r.Header.Values(name))
+		if name == "host" {
+			value = []string{r.Host}
+		}
+		for i := range value {
+			value[i] = strings.Join(strings.Fields(value[i]), " ")
+		}
+		fmt.Fprintf(&headers, "%s:%s\n", name, strings.Join(value, ","))
+	}
+
+	canonicalRequest := strings.Join([]string{
+		r.Method,
+		escapePath(r.URL.Path),
+		canonicalQuery(r.URL.Query()),
+		headers.String(),
+		fields["SignedHeaders"],
+		payloadHash,
+	}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + r.Header.Get("X-Amz-Date") + "\n" +
+		strings.Join(scope[1:], "/") + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := []byte("AWS4" + SecretAccessKey)
+	for _, part := range append(scope[1:], stringToSign) {
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(part))
+		key = mac.Sum(nil)
+	}
+	if !hmac.Equal([]byte(hex.EncodeToString(key)), []byte(fields["Signature"])) {
+		return "SignatureDoesNotMatch", "The request signature we calculated does not match the signature you provided"
+	}
+	return "", ""
+}
+
+func escapePath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		segments[i] = escape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+func canonicalQuery(query url.Values) string {
+	var pairs []string
+	for name, values := range query {
+		for _, value := range values {
+			pairs = append(pairs, escape(name)+"="+escape(value))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+// escape percent-encodes a path segment or query component the way SigV4
+// expects: like url.QueryEscape, but with %20 for spaces and '~' kept
+func escape(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(url.QueryEscape(s), "+", "%20"), "%7E", "~")
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<Error><Code>%s</Code><Message>%s</Message></Error>", code, message)
+}
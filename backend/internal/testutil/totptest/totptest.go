@@ -0,0 +1,27 @@
+// Package totptest generates the codes an authenticator app would show, for
+// tests of two-factor authentication.
+package totptest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+)
+
+// Code returns the TOTP code for secret at t, using the settings the server
+// enrolls authenticators with: 30 second steps, six digits and SHA-1
+func Code(t testing.TB, secret string, at time.Time) string {
+	t.Helper()
+
+	code, err := totp.GenerateCodeCustom(secret, at, totp.ValidateOpts{
+		Period:    30,
+		Digits:    otp.DigitsSix,
+		Algorithm: otp.AlgorithmSHA1,
+	})
+	if err != nil {
+		t.Fatalf("failed to generate TOTP code: %v", err)
+	}
+	return code
+}
@@ -0,0 +1,562 @@
+// Package wstest provides an end-to-end harness for WebSocket tests. It serves
+// the real gin router and WSHandler from an httptest.Server, dials gorilla
+// clients into rooms and offers assertions on broadcasts and hub state.
+package wstest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ayush/accountability-app/backend/internal/api"
+	"github.com/ayush/accountability-app/backend/internal/auth"
+	"github.com/ayush/accountability-app/backend/internal/config"
+	"github.com/ayush/accountability-app/backend/internal/mail"
+	"github.com/ayush/accountability-app/backend/internal/models"
+	"github.com/ayush/accountability-app/backend/internal/origin"
+	"github.com/ayush/accountability-app/backend/internal/ratelimit"
+	"github.com/ayush/accountability-app/backend/internal/repository"
+	"github.com/ayush/accountability-app/backend/internal/storage"
+	ws "github.com/ayush/accountability-app/backend/internal/websocket"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// DefaultOrigin is the Origin header sent by clients and allowed by the server
+const DefaultOrigin = "http://localhost:3000"
+
+// DefaultWait bounds how long assertions wait for something to happen
+const DefaultWait = 2 * time.Second
+
+// FastTimeouts are keepalive settings short enough to exercise ping/pong
+// timeouts within a test
+var FastTimeouts = ws.Timeouts{
+	Write: 500 * time.Millisecond,
+	Pong:  300 * time.Millisecond,
+	Ping:  100 * time.Millisecond,
+}
+
+// Server is a running WebSocket server backed by a real Hub
+type Server struct {
+	t       testing.TB
+	Hub     *ws.Hub
+	Handler *api.WSHandler
+	Origins *origin.Policy
+	HTTP    *httptest.Server
+	Config  *config.WebSocketConfig
+
+	// Repos are the in-memory repositories behind the API routes
+	Repos *repository.Repositories
+
+	// seeded counts the accounts created by User
+	seeded int
+}
+
+// Option configures a Server
+type Option func(*options)
+
+type options struct {
+	timeouts ws.Timeouts
+	config   *config.WebSocketConfig
+	cors     config.CORSConfig
+}
+
+// WithTimeouts sets the hub's keepalive and write deadlines
+func WithTimeouts(timeouts ws.Timeouts) Option {
+	return func(o *options) { o.timeouts = timeouts }
+}
+
+// WithConfig replaces the WebSocket configuration passed to the handler
+func WithConfig(cfg *config.WebSocketConfig) Option {
+	return func(o *options) { o.config = cfg }
+}
+
+// WithCORS replaces the origin policy, which allows only DefaultOrigin by default
+func WithCORS(cfg config.CORSConfig) Option {
+	return func(o *options) { o.cors = cfg }
+}
+
+// NewServer starts a hub and serves the production route table from
+// api.RegisterRoutes, backed by in-memory repositories, so upgrades pass
+// through the same middleware as in the server. Everything is torn down when
+// the test ends.
+func NewServer(t testing.TB, opts ...Option) *Server {
+	t.Helper()
+
+	o := &options{
+		timeouts: ws.DefaultTimeouts(),
+		config:   &config.WebSocketConfig{},
+		cors:     config.CORSConfig{AllowedOrigins: []string{DefaultOrigin}},
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	hub := ws.NewHub()
+	hub.SetTimeouts(o.timeouts)
+	go hub.Run()
+
+	origins, err := origin.NewPolicy(o.cors)
+	if err != nil {
+		t.Fatalf("invalid origin policy: %v", err)
+	}
+	repos := repository.NewMemoryRepositories()
+	handler := api.NewWSHandler(hub, o.config, origins, repos.Calls)
+	limiter := ratelimit.New(ratelimit.NewMemoryStore(), config.DefaultRateLimitConfig())
+	sessionHandler := api.NewSessionHandler(repos.Sessions, hub)
+	mailer := mail.NewLogMailer("wstest@example.com", t.TempDir())
+	verificationHandler := api.NewEmailVerificationHandler(repos.Users, mailer, "http://localhost/api/users/verify", time.Hour)
+	twoFactorHandler := api.NewTwoFactorHandler(repos.Users, repos.RecoveryCodes, limiter, sessionHandler, "Accountability App", 5*time.Minute)
+	avatarHandler := api.NewAvatarHandler(repos.Users, storage.NewMemory("http://localhost/media"), 1<<20)
+	handlers := api.Handlers{
+		Users:          api.NewUserHandler(repos.Users, limiter, verificationHandler, twoFactorHandler, sessionHandler, avatarHandler),
+		Avatars:        avatarHandler,
+		Verification:   verificationHandler,
+		TwoFactor:      twoFactorHandler,
+		PasswordResets: api.NewPasswordResetHandler(repos.Users, repos.PasswordResets, sessionHandler, mailer, "http://localhost/reset", time.Hour),
+		Sessions:       sessionHandler,
+		APIKeys:        api.NewAPIKeyHandler(repos.APIKeys, hub),
+		Calls:          api.NewVideoCallHandler(repos.Calls, repos.Participants, hub),
+		Attendance:     api.NewAttendanceHandler(repos.Calls, repos.Participants, repos.Users),
+		WebSocket:      handler,
+		// No database; /readyz is not exercised through this server
+		Health: api.NewHealthHandler(nil, hub),
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	api.RegisterRoutes(router, handlers, api.RouteDeps{Repos: repos, Limiter: limiter})
+
+	s := &Server{
+		t:       t,
+		Hub:     hub,
+		Handler: handler,
+		Origins: origins,
+		HTTP:    httptest.NewServer(router),
+		Config:  o.config,
+		Repos:   repos,
+	}
+
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), DefaultWait)
+		defer cancel()
+		hub.Shutdown(ctx)
+		s.HTTP.Close()
+	})
+
+	return s
+}
+
+// URL returns the WebSocket URL for joining a room as a user
+func (s *Server) URL(roomID string, userID uint) string {
+	u := strings.Replace(s.HTTP.URL, "http", "ws", 1) + "/api/ws"
+	q := url.Values{}
+	q.Set("room_id", roomID)
+	q.Set("user_id", strconv.FormatUint(uint64(userID), 10))
+	return u + "?" + q.Encode()
+}
+
+// User returns the account with the given ID, creating it first if needed.
+// The repository assigns IDs itself, so accounts are created in order until
+// one gets userID; tests should only refer to small IDs.
+func (s *Server) User(userID uint) *models.User {
+	s.t.Helper()
+
+	ctx := context.Background()
+	for {
+		user, err := s.Repos.Users.GetByID(ctx, userID)
+		if err == nil {
+			return user
+		}
+		if !errors.Is(err, repository.ErrNotFound) {
+			s.t.Fatalf("failed to look up user %d: %v", userID, err)
+		}
+
+		s.seeded++
+		verifiedAt := time.Now()
+		user = &models.User{
+			Username:        fmt.Sprintf("user%d", s.seeded),
+			Email:           fmt.Sprintf("user%d@example.com", s.seeded),
+			Password:        "x",
+			EmailVerifiedAt: &verifiedAt,
+		}
+		if err := s.Repos.Users.Create(ctx, user); err != nil {
+			s.t.Fatalf("failed to create user: %v", err)
+		}
+		if user.ID > userID {
+			s.t.Fatalf("user %d cannot be created, the next ID is %d", userID, user.ID)
+		}
+	}
+}
+
+// Call creates a call hosted by a user, creating the user if needed, with
+// the given status and returns the ID of its room
+func (s *Server) Call(hostID uint, status string) string {
+	s.t.Helper()
+
+	s.User(hostID)
+	call := &models.Call{Title: "wstest", CreatorID: hostID, Status: status, CreatedAt: time.Now()}
+	if err := s.Repos.Calls.Create(context.Background(), call); err != nil {
+		s.t.Fatalf("failed to create call: %v", err)
+	}
+	return strconv.FormatUint(uint64(call.ID), 10)
+}
+
+// Session starts a login session for a user, creating the user if needed,
+// and returns its ID
+func (s *Server) Session(userID uint) uint {
+	s.t.Helper()
+
+	s.User(userID)
+	now := time.Now()
+	session := &models.Session{UserID: userID, DeviceName: "wstest", CreatedAt: now, LastSeenAt: now, ExpiresAt: now.Add(auth.TokenTTL())}
+	if err := s.Repos.Sessions.Create(context.Background(), session); err != nil {
+		s.t.Fatalf("failed to create session: %v", err)
+	}
+	return session.ID
+}
+
+// Header returns the headers of an authenticated upgrade request for a user
+// in a new session
+func (s *Server) Header(userID uint) http.Header {
+	s.t.Helper()
+	return s.SessionHeader(userID, s.Session(userID))
+}
+
+// SessionHeader returns the headers of an authenticated upgrade request for
+// a user in an existing session
+func (s *Server) SessionHeader(userID, sessionID uint) http.Header {
+	s.t.Helper()
+
+	token, err := auth.GenerateToken(userID, fmt.Sprintf("user%d@example.com", userID), auth.RoleUser, sessionID)
+	if err != nil {
+		s.t.Fatalf("failed to generate token: %v", err)
+	}
+
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+token)
+	header.Set("Origin", DefaultOrigin)
+	return header
+}
+
+// Dial connects a user to a room and waits until the hub has registered it
+func (s *Server) Dial(roomID string, userID uint) *Conn {
+	s.t.Helper()
+
+	before := s.Hub.GetClientsInRoom(roomID)
+	conn := s.dial(roomID, userID, s.Header(userID), false)
+	s.WaitForClients(roomID, before+1)
+	return conn
+}
+
+// DialSession is Dial for a user in an existing session
+func (s *Server) DialSession(roomID string, userID, sessionID uint) *Conn {
+	s.t.Helper()
+
+	before := s.Hub.GetClientsInRoom(roomID)
+	conn := s.dial(roomID, userID, s.SessionHeader(userID, sessionID), false)
+	s.WaitForClients(roomID, before+1)
+	return conn
+}
+
+// DialUnresponsive connects a client that never answers server pings,
+// simulating a peer that has silently gone away
+func (s *Server) DialUnresponsive(roomID string, userID uint) *Conn {
+	s.t.Helper()
+
+	before := s.Hub.GetClientsInRoom(roomID)
+	conn := s.dial(roomID, userID, s.Header(userID), true)
+	s.WaitForClients(roomID, before+1)
+	return conn
+}
+
+// DialWithHeader connects with custom headers and does not wait for registration.
+// It fails the test if the upgrade is rejected; use Reject to test rejections.
+func (s *Server) DialWithHeader(roomID string, userID uint, header http.Header) *Conn {
+	s.t.Helper()
+	return s.dial(roomID, userID, header, false)
+}
+
+func (s *Server) dial(roomID string, userID uint, header http.Header, ignorePings bool) *Conn {
+	s.t.Helper()
+
+	raw, resp, err := websocket.DefaultDialer.Dial(s.URL(roomID, userID), header)
+	if err != nil {
+		status := 0
+		if resp != nil {
+			status = resp.StatusCode
+		}
+		s.t.Fatalf("failed to dial room %q as user %d (status %d): %v", roomID, userID, status, err)
+	}
+
+	if ignorePings {
+		raw.SetPingHandler(func(string) error { return nil })
+	}
+
+	c := newConn(s.t, raw, roomID, userID)
+	s.t.Cleanup(c.Close)
+	return c
+}
+
+// Reject dials with the given headers, expects the upgrade to fail and
+// returns the HTTP status code of the rejection
+func (s *Server) Reject(roomID string, userID uint, header http.Header) int {
+	s.t.Helper()
+
+	raw, resp, err := websocket.DefaultDialer.Dial(s.URL(roomID, userID), header)
+	if err == nil {
+		raw.Close()
+		s.t.Fatalf("expected upgrade for room %q as user %d to be rejected", roomID, userID)
+	}
+	if resp == nil {
+		s.t.Fatalf("upgrade failed without an HTTP response: %v", err)
+	}
+	return resp.StatusCode
+}
+
+// WaitForClients waits until the hub reports exactly n clients in a room
+func (s *Server) WaitForClients(roomID string, n int) {
+	s.t.Helper()
+
+	deadline := time.Now().Add(DefaultWait)
+	for {
+		got := s.Hub.GetClientsInRoom(roomID)
+		if got == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			s.t.Fatalf("expected %d clients in room %q, hub has %d", n, roomID, got)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// WaitForRoomClosed waits until the hub no longer tracks a room
+func (s *Server) WaitForRoomClosed(roomID string) {
+	s.t.Helper()
+
+	deadline := time.Now().Add(DefaultWait)
+	for {
+		open := false
+		for _, room := range s.Hub.Stats().Rooms {
+			if room.RoomID == roomID {
+				open = true
+			}
+		}
+		if !open {
+			return
+		}
+		if time.Now().After(deadline) {
+			s.t.Fatalf("expected room %q to be removed from the hub", roomID)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// WaitForJoin waits until a user has an open participant record in a call
+func (s *Server) WaitForJoin(callID, userID uint) {
+	s.t.Helper()
+
+	deadline := time.Now().Add(DefaultWait)
+	for !s.inCall(callID, userID) {
+		if time.Now().After(deadline) {
+			s.t.Fatalf("expected user %d to have joined call %d", userID, callID)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// WaitForLeave waits until none of a user's participant records in a call
+// is open, i.e. every one of them has a leave time
+func (s *Server) WaitForLeave(callID, userID uint) {
+	s.t.Helper()
+
+	deadline := time.Now().Add(DefaultWait)
+	for s.inCall(callID, userID) {
+		if time.Now().After(deadline) {
+			s.t.Fatalf("expected user %d to have left call %d", userID, callID)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// ExpectInCall asserts that a user stays in a call, with an open participant
+// record, for the given duration. It gives a leave being recorded in the
+// background time to happen before the caller looks at the records.
+func (s *Server) ExpectInCall(callID, userID uint, within time.Duration) {
+	s.t.Helper()
+
+	deadline := time.Now().Add(within)
+	for time.Now().Before(deadline) {
+		if !s.inCall(callID, userID) {
+			s.t.Fatalf("expected user %d to still be in call %d", userID, callID)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// inCall reports whether a user has an open participant record in a call
+func (s *Server) inCall(callID, userID uint) bool {
+	s.t.Helper()
+
+	_, err := s.Repos.Participants.GetOpen(context.Background(), callID, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return false
+	}
+	if err != nil {
+		s.t.Fatalf("failed to look up participant: %v", err)
+	}
+	return true
+}
+
+// Conn is a test client connected to a room. A background reader collects
+// incoming messages, which also lets gorilla answer server pings.
+type Conn struct {
+	t      testing.TB
+	Raw    *websocket.Conn
+	RoomID string
+	UserID uint
+
+	messages chan []byte
+	closed   chan error
+}
+
+func newConn(t testing.TB, raw *websocket.Conn, roomID string, userID uint) *Conn {
+	c := &Conn{
+		t:        t,
+		Raw:      raw,
+		RoomID:   roomID,
+		UserID:   userID,
+		messages: make(chan []byte, 256),
+		closed:   make(chan error, 1),
+	}
+	go c.readLoop()
+	return c
+}
+
+func (c *Conn) readLoop() {
+	for {
+		_, data, err := c.Raw.ReadMessage()
+		if err != nil {
+			c.closed <- err
+			close(c.messages)
+			return
+		}
+		c.messages <- data
+	}
+}
+
+// Send writes a message of the given type to the client's room
+func (c *Conn) Send(msgType ws.MessageType, data interface{}) {
+	c.t.Helper()
+	c.SendMessage(ws.NewMessage(msgType, data, c.RoomID, c.UserID))
+}
+
+// SendMessage writes an arbitrary message
+func (c *Conn) SendMessage(msg *ws.Message) {
+	c.t.Helper()
+
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		c.t.Fatalf("failed to marshal message: %v", err)
+	}
+	if err := c.Raw.WriteMessage(websocket.TextMessage, payload); err != nil {
+		c.t.Fatalf("user %d failed to send message: %v", c.UserID, err)
+	}
+}
+
+// Expect waits for the next message and returns it
+func (c *Conn) Expect() *ws.Message {
+	c.t.Helper()
+
+	select {
+	case data, ok := <-c.messages:
+		if !ok {
+			c.t.Fatalf("user %d connection closed while waiting for a message", c.UserID)
+		}
+		var msg ws.Message
+		if err := json.Unmarshal(data, &msg); err != nil {
+			c.t.Fatalf("user %d received invalid message %q: %v", c.UserID, data, err)
+		}
+		return &msg
+	case <-time.After(DefaultWait):
+		c.t.Fatalf("user %d in room %q received no message", c.UserID, c.RoomID)
+	}
+	return nil
+}
+
+// ExpectNone asserts that no message arrives within the given duration
+func (c *Conn) ExpectNone(within time.Duration) {
+	c.t.Helper()
+
+	select {
+	case data, ok := <-c.messages:
+		if ok {
+			c.t.Fatalf("user %d in room %q received unexpected message %s", c.UserID, c.RoomID, data)
+		}
+	case <-time.After(within):
+	}
+}
+
+// ExpectClosed waits for the server to close the connection and returns the
+// close error, which is a *websocket.CloseError when a close frame was received
+func (c *Conn) ExpectClosed() error {
+	c.t.Helper()
+
+	deadline := time.After(DefaultWait)
+	for {
+		select {
+		case _, ok := <-c.messages:
+			// Drain messages sent before the close frame
+			if !ok {
+				err := <-c.closed
+				c.closed <- err
+				return err
+			}
+		case <-deadline:
+			c.t.Fatalf("user %d connection was not closed by the server", c.UserID)
+			return nil
+		}
+	}
+}
+
+// Close closes the client connection with a normal closure
+func (c *Conn) Close() {
+	c.Raw.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""),
+		time.Now().Add(time.Second))
+	c.Raw.Close()
+}
+
+// AssertFanOut sends a chat message from sender and asserts that every
+// recipient, which should include the sender, receives it exactly once
+func AssertFanOut(t testing.TB, sender *Conn, text string, recipients ...*Conn) {
+	t.Helper()
+
+	sender.Send(ws.MessageTypeChat, text)
+	for _, r := range recipients {
+		msg := r.Expect()
+		if msg.Type != ws.MessageTypeChat || msg.Data != text || msg.UserID != sender.UserID || msg.RoomID != sender.RoomID {
+			t.Fatalf("user %d received %+v, want chat %q from user %d in room %q",
+				r.UserID, msg, text, sender.UserID, sender.RoomID)
+		}
+	}
+}
+
+// AssertIsolated asserts that none of the given clients receive anything
+// within a short window
+func AssertIsolated(t testing.TB, within time.Duration, clients ...*Conn) {
+	t.Helper()
+	for _, c := range clients {
+		c.ExpectNone(within)
+	}
+}
@@ -0,0 +1,93 @@
+package tracing
+
+import (
+	"errors"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+const gormSpanKey = "tracing:span"
+
+// GormPlugin creates a client span for every GORM operation, parented to the
+// span in the statement's context. Queries must use db.WithContext to be
+// linked to the request that issued them.
+type GormPlugin struct{}
+
+// Name implements gorm.Plugin
+func (GormPlugin) Name() string {
+	return "tracing"
+}
+
+// Initialize implements gorm.Plugin
+func (GormPlugin) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+
+	hooks := []struct {
+		operation string
+		before    func(name string, fn func(*gorm.DB)) error
+		after     func(name string, fn func(*gorm.DB)) error
+	}{
+		{"create", cb.Create().Before("gorm:create").Register, cb.Create().After("gorm:create").Register},
+		{"query", cb.Query().Before("gorm:query").Register, cb.Query().After("gorm:query").Register},
+		{"update", cb.Update().Before("gorm:update").Register, cb.Update().After("gorm:update").Register},
+		{"delete", cb.Delete().Before("gorm:delete").Register, cb.Delete().After("gorm:delete").Register},
+		{"row", cb.Row().Before("gorm:row").Register, cb.Row().After("gorm:row").Register},
+		{"raw", cb.Raw().Before("gorm:raw").Register, cb.Raw().After("gorm:raw").Register},
+	}
+
+	for _, hook := range hooks {
+		if err := hook.before("tracing:before_"+hook.operation, startSpan(hook.operation)); err != nil {
+			return err
+		}
+		if err := hook.after("tracing:after_"+hook.operation, endSpan); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func startSpan(operation string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		ctx := db.Statement.Context
+		if ctx == nil {
+			return
+		}
+
+		_, span := Tracer().Start(ctx, "db."+operation,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(
+				attribute.String("db.system.name", "postgresql"),
+				attribute.String("db.operation.name", operation),
+				attribute.String("db.collection.name", db.Statement.Table),
+			))
+		db.InstanceSet(gormSpanKey, span)
+	}
+}
+
+func endSpan(db *gorm.DB) {
+	value, ok := db.InstanceGet(gormSpanKey)
+	if !ok {
+		return
+	}
+	span, ok := value.(trace.Span)
+	if !ok {
+		return
+	}
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("db.query.text", db.Statement.SQL.String()),
+		attribute.Int64("db.response.returned_rows", db.Statement.RowsAffected),
+	)
+	if db.Statement.Table != "" {
+		span.SetAttributes(attribute.String("db.collection.name", db.Statement.Table))
+	}
+	if db.Error != nil && !errors.Is(db.Error, gorm.ErrRecordNotFound) {
+		span.RecordError(db.Error)
+		span.SetStatus(codes.Error, db.Error.Error())
+	}
+}
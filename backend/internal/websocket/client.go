@@ -1,10 +1,18 @@
 package websocket
 
 import (
+	"context"
+	"io"
+	"strconv"
 	"time"
 
 	"github.com/ayush/accountability-app/backend/internal/logger"
+	"github.com/ayush/accountability-app/backend/internal/metrics"
+	"github.com/ayush/accountability-app/backend/internal/tracing"
 	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
@@ -22,6 +30,32 @@ const (
 	maxMessageSize = 32768
 )
 
+// Timeouts controls the keepalive and write deadlines of client connections
+type Timeouts struct {
+	// Write is the time allowed to write a message to the peer
+	Write time.Duration
+
+	// Pong is the time allowed to read the next pong message from the peer
+	Pong time.Duration
+
+	// Ping is the period between pings and must be shorter than Pong
+	Ping time.Duration
+}
+
+// DefaultTimeouts returns the timeouts used in production
+func DefaultTimeouts() Timeouts {
+	return Timeouts{Write: writeWait, Pong: pongWait, Ping: pingPeriod}
+}
+
+// outboundMessage is a marshaled message queued for delivery to a client
+type outboundMessage struct {
+	msgType MessageType
+	data    []byte
+
+	// ctx carries the span of the broadcast that queued the message
+	ctx context.Context
+}
+
 // Client represents a websocket connection in the hub
 type Client struct {
 	// The websocket connection
@@ -31,26 +65,49 @@ type Client struct {
 	hub *Hub
 
 	// Buffered channel of outbound messages
-	send chan []byte
+	send chan outboundMessage
 
 	// Room ID this client belongs to
 	RoomID string
 
 	// User ID associated with this client
 	UserID uint
+
+	// Login session the client authenticated with, 0 for API keys
+	SessionID uint
+
+	// API key the client authenticated with, 0 for login sessions
+	APIKeyID uint
+
+	// Closed when the write pump exits
+	done chan struct{}
+
+	// Message rate limiter, only touched by the read pump
+	bucket tokenBucket
+
+	// Set while messages are being discarded so the client is notified once per episode
+	limited bool
+
+	// Close code and reason sent when the hub disconnects the client, set
+	// before the send channel is closed
+	closeCode   int
+	closeReason string
 }
 
 // NewClient creates a new client instance
-func NewClient(hub *Hub, conn *websocket.Conn, roomID string, userID uint) *Client {
+func NewClient(hub *Hub, conn *websocket.Conn, roomID string, userID, sessionID, apiKeyID uint) *Client {
 	logger.Info("Creating new WebSocket client",
 		zap.String("room_id", roomID),
 		zap.Uint("user_id", userID))
 	return &Client{
-		hub:    hub,
-		conn:   conn,
-		send:   make(chan []byte, 256),
-		RoomID: roomID,
-		UserID: userID,
+		hub:       hub,
+		conn:      conn,
+		send:      make(chan outboundMessage, 256),
+		RoomID:    roomID,
+		UserID:    userID,
+		SessionID: sessionID,
+		APIKeyID:  apiKeyID,
+		done:      make(chan struct{}),
 	}
 }
 
@@ -64,17 +121,21 @@ func (c *Client) ReadPump() {
 		logger.Info("Closing client read pump",
 			zap.String("room_id", c.RoomID),
 			zap.Uint("user_id", c.UserID))
-		c.hub.unregister <- c
+		c.hub.Unregister(c)
 		c.conn.Close()
 	}()
 
 	c.conn.SetReadLimit(maxMessageSize)
-	c.conn.SetReadDeadline(time.Now().Add(pongWait))
-	c.conn.SetPongHandler(func(string) error {
+	c.conn.SetReadDeadline(time.Now().Add(c.hub.timeouts.Pong))
+	c.conn.SetPongHandler(func(appData string) error {
 		logger.Debug("Received pong from client",
 			zap.String("room_id", c.RoomID),
 			zap.Uint("user_id", c.UserID))
-		c.conn.SetReadDeadline(time.Now().Add(pongWait))
+		// Pings carry their send time, which the peer echoes back in the pong
+		if sentAt, err := strconv.ParseInt(appData, 10, 64); err == nil {
+			metrics.WSPingRTT.Observe(time.Since(time.Unix(0, sentAt)).Seconds())
+		}
+		c.conn.SetReadDeadline(time.Now().Add(c.hub.timeouts.Pong))
 		return nil
 	})
 
@@ -105,35 +166,85 @@ func (c *Client) ReadPump() {
 			continue
 		}
 
-		// Ensure the message is for this room
-		if msg.RoomID != c.RoomID {
-			logger.Warn("Received message for wrong room",
-				zap.String("expected_room", c.RoomID),
-				zap.String("received_room", msg.RoomID),
-				zap.Uint("user_id", c.UserID))
+		if !c.allowMessage() {
 			continue
 		}
+		metrics.WSMessagesReceived.WithLabelValues(msg.Type.metricLabel()).Inc()
+		c.handleMessage(msg)
+	}
+}
 
-		// Set the correct UserID from the client
-		msg.UserID = c.UserID
+// allowMessage applies the hub's message rate limit, telling the client the
+// first time a message is discarded
+func (c *Client) allowMessage() bool {
+	limits := c.hub.Limits()
+	if c.bucket.allow(time.Now(), limits.MessageRate, limits.MessageBurst) {
+		c.limited = false
+		return true
+	}
 
-		// Marshal the message back to JSON
-		messageBytes, err := msg.Marshal()
-		if err != nil {
-			logger.Error("Failed to marshal message for broadcast",
-				zap.Error(err),
-				zap.String("room_id", c.RoomID),
-				zap.Uint("user_id", c.UserID))
-			continue
-		}
+	metrics.WSMessagesRateLimited.Inc()
+	if c.limited {
+		return false
+	}
+	c.limited = true
 
-		logger.Debug("Broadcasting message from client",
-			zap.String("room_id", c.RoomID),
-			zap.Uint("user_id", c.UserID),
-			zap.Int("message_size", len(messageBytes)))
+	logger.Warn("Client exceeded message rate limit",
+		zap.String("room_id", c.RoomID),
+		zap.Uint("user_id", c.UserID),
+		zap.Float64("message_rate", limits.MessageRate))
+
+	notice, err := NewMessage(MessageTypeSystem, RateLimitNotice{
+		Event:   SystemEventRateLimited,
+		Message: "sending too fast, messages are being dropped",
+	}, c.RoomID, 0).Marshal()
+	if err != nil {
+		return false
+	}
+	c.hub.sendTo(c, outboundMessage{msgType: MessageTypeSystem, data: notice})
+	return false
+}
+
+// handleMessage validates a message read from the connection and broadcasts
+// it to the room, tracing it as a continuation of any trace context the
+// sender put in the message metadata
+func (c *Client) handleMessage(msg *Message) {
+	ctx := tracing.Extract(context.Background(), msg.Metadata)
+	ctx, span := tracing.Tracer().Start(ctx, "websocket.receive",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			attribute.String("websocket.message.type", string(msg.Type)),
+			attribute.String("websocket.room_id", c.RoomID),
+			attribute.Int64("enduser.id", int64(c.UserID)),
+		))
+	defer span.End()
+
+	// Ensure the message is for this room
+	if msg.RoomID != c.RoomID {
+		logger.Warn("Received message for wrong room",
+			zap.String("expected_room", c.RoomID),
+			zap.String("received_room", msg.RoomID),
+			zap.Uint("user_id", c.UserID))
+		span.SetStatus(codes.Error, "message for wrong room")
+		return
+	}
+
+	// Set the correct UserID from the client
+	msg.UserID = c.UserID
+
+	logger.Debug("Broadcasting message from client",
+		zap.String("room_id", c.RoomID),
+		zap.Uint("user_id", c.UserID),
+		zap.String("type", string(msg.Type)))
 
-		// Broadcast the message to all clients in the same room
-		c.hub.Broadcast(c.RoomID, messageBytes)
+	// Broadcast the message to all clients in the same room
+	if err := c.hub.Broadcast(ctx, msg); err != nil {
+		logger.Error("Failed to marshal message for broadcast",
+			zap.Error(err),
+			zap.String("room_id", c.RoomID),
+			zap.Uint("user_id", c.UserID))
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
 	}
 }
 
@@ -143,71 +254,47 @@ func (c *Client) WritePump() {
 		zap.String("room_id", c.RoomID),
 		zap.Uint("user_id", c.UserID))
 
-	ticker := time.NewTicker(pingPeriod)
+	ticker := time.NewTicker(c.hub.timeouts.Ping)
 	defer func() {
 		logger.Info("Closing client write pump",
 			zap.String("room_id", c.RoomID),
 			zap.Uint("user_id", c.UserID))
 		ticker.Stop()
 		c.conn.Close()
+		close(c.done)
 	}()
 
 	for {
 		select {
 		case message, ok := <-c.send:
-			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			c.conn.SetWriteDeadline(time.Now().Add(c.hub.timeouts.Write))
 			if !ok {
 				logger.Info("Hub closed client send channel",
 					zap.String("room_id", c.RoomID),
 					zap.Uint("user_id", c.UserID))
-				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
-				return
-			}
-
-			w, err := c.conn.NextWriter(websocket.TextMessage)
-			if err != nil {
-				logger.Error("Failed to get next writer",
-					zap.Error(err),
-					zap.String("room_id", c.RoomID),
-					zap.Uint("user_id", c.UserID))
+				c.conn.WriteMessage(websocket.CloseMessage, c.closeMessage())
 				return
 			}
 
 			logger.Debug("Writing message to client",
 				zap.String("room_id", c.RoomID),
 				zap.Uint("user_id", c.UserID),
-				zap.Int("message_size", len(message)))
+				zap.Int("message_size", len(message.data)))
 
-			w.Write(message)
-
-			// Add queued messages to the current websocket message
-			n := len(c.send)
-			if n > 0 {
-				logger.Debug("Processing queued messages",
-					zap.String("room_id", c.RoomID),
-					zap.Uint("user_id", c.UserID),
-					zap.Int("queued_messages", n))
-			}
-
-			for i := 0; i < n; i++ {
-				w.Write(<-c.send)
-			}
-
-			if err := w.Close(); err != nil {
-				logger.Error("Error closing writer",
-					zap.Error(err),
-					zap.String("room_id", c.RoomID),
-					zap.Uint("user_id", c.UserID))
+			// One frame per message so every frame holds exactly one JSON document
+			if err := c.writeFrame(message); err != nil {
 				return
 			}
 
 		case <-ticker.C:
-			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			c.conn.SetWriteDeadline(time.Now().Add(c.hub.timeouts.Write))
 			logger.Debug("Sending ping to client",
 				zap.String("room_id", c.RoomID),
 				zap.Uint("user_id", c.UserID))
 
-			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+			// Send the current time so the pong handler can measure the round trip
+			ping := []byte(strconv.FormatInt(time.Now().UnixNano(), 10))
+			if err := c.conn.WriteMessage(websocket.PingMessage, ping); err != nil {
 				logger.Error("Failed to send ping",
 					zap.Error(err),
 					zap.String("room_id", c.RoomID),
@@ -217,3 +304,64 @@ func (c *Client) WritePump() {
 		}
 	}
 }
+
+// writeFrame writes a queued message as a single text frame
+func (c *Client) writeFrame(message outboundMessage) error {
+	c.conn.SetWriteDeadline(time.Now().Add(c.hub.timeouts.Write))
+	w, err := c.conn.NextWriter(websocket.TextMessage)
+	if err != nil {
+		logger.Error("Failed to get next writer",
+			zap.Error(err),
+			zap.String("room_id", c.RoomID),
+			zap.Uint("user_id", c.UserID))
+		return err
+	}
+
+	c.writeMessage(w, message)
+
+	if err := w.Close(); err != nil {
+		logger.Error("Error closing writer",
+			zap.Error(err),
+			zap.String("room_id", c.RoomID),
+			zap.Uint("user_id", c.UserID))
+		return err
+	}
+	return nil
+}
+
+// writeMessage writes a queued message to the current frame writer inside a
+// span linked to the broadcast that queued it
+func (c *Client) writeMessage(w io.Writer, message outboundMessage) {
+	ctx := message.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	_, span := tracing.Tracer().Start(ctx, "websocket.write",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			attribute.String("websocket.message.type", string(message.msgType)),
+			attribute.String("websocket.room_id", c.RoomID),
+			attribute.Int64("enduser.id", int64(c.UserID)),
+			attribute.Int("websocket.message.size", len(message.data)),
+		))
+	defer span.End()
+
+	if _, err := w.Write(message.data); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return
+	}
+	metrics.WSMessagesSent.WithLabelValues(message.msgType.metricLabel()).Inc()
+}
+
+// closeMessage returns the close frame payload sent when the hub closes the
+// client's send channel
+func (c *Client) closeMessage() []byte {
+	if c.closeCode != 0 {
+		return websocket.FormatCloseMessage(c.closeCode, c.closeReason)
+	}
+	if c.hub.IsClosing() {
+		return websocket.FormatCloseMessage(websocket.CloseGoingAway, "server restarting")
+	}
+	return []byte{}
+}
@@ -1,23 +1,65 @@
 package websocket
 
 import (
+	"context"
+	"errors"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/ayush/accountability-app/backend/internal/logger"
+	"github.com/ayush/accountability-app/backend/internal/metrics"
+	"github.com/ayush/accountability-app/backend/internal/tracing"
+	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
+// reconnectDelay is the hint sent to clients telling them how long to wait
+// before reconnecting after the server announces a restart
+const reconnectDelay = 5 * time.Second
+
+// ErrHubClosed is returned when a client is registered with a hub that is shutting down
+var ErrHubClosed = errors.New("websocket hub is shutting down")
+
 // Hub maintains the set of active clients and broadcasts messages
 type Hub struct {
 	// Registered clients by room ID
 	rooms map[string]map[*Client]bool
 
+	// Message counters by room ID, kept alongside rooms
+	stats map[string]*roomStats
+
 	// Register requests from clients
-	register chan *Client
+	register chan registration
 
 	// Unregister requests from clients
 	unregister chan *Client
 
+	// Closed when the hub starts shutting down to stop the main loop
+	stop chan struct{}
+
+	// Guards against closing the stop channel twice
+	stopOnce sync.Once
+
+	// Set once Shutdown has been called
+	closing atomic.Bool
+
+	// Set while the main loop is running
+	running atomic.Bool
+
+	// Keepalive and write deadlines applied to clients
+	timeouts Timeouts
+
+	// Room capacity and message rate limits, replaced atomically on reload
+	limits atomic.Pointer[Limits]
+
+	// Called when a user's first connection to a room is added or their last
+	// one is removed; guarded by mu
+	onPresence func(roomID string, userID uint)
+
 	// Mutex for thread-safe operations on rooms
 	mu sync.RWMutex
 }
@@ -25,19 +67,86 @@ type Hub struct {
 // NewHub creates a new Hub instance
 func NewHub() *Hub {
 	logger.Info("Creating new WebSocket hub")
-	return &Hub{
+	h := &Hub{
 		rooms:      make(map[string]map[*Client]bool),
-		register:   make(chan *Client),
+		stats:      make(map[string]*roomStats),
+		register:   make(chan registration),
 		unregister: make(chan *Client),
+		stop:       make(chan struct{}),
+		timeouts:   DefaultTimeouts(),
 	}
+	h.limits.Store(&Limits{})
+	return h
+}
+
+// registration is a request to add a client, answered on result once the
+// main loop has admitted or refused it
+type registration struct {
+	client *Client
+	result chan error
+}
+
+// SetTimeouts overrides the client keepalive and write deadlines. It must be
+// called before any client is registered.
+func (h *Hub) SetTimeouts(timeouts Timeouts) {
+	h.timeouts = timeouts
+}
+
+// SetLimits replaces the room capacity and message rate limits. Rooms already
+// above a lowered capacity keep their clients but accept no new ones.
+func (h *Hub) SetLimits(limits Limits) {
+	h.limits.Store(&limits)
+}
+
+// Limits returns the limits currently in force
+func (h *Hub) Limits() Limits {
+	return *h.limits.Load()
 }
 
-// Register adds a new client to the hub
-func (h *Hub) Register(client *Client) {
+// Register adds a new client to the hub. It returns ErrHubClosed if the hub
+// is shutting down and no longer accepts clients, and ErrRoomFull if the
+// client's room is at capacity.
+func (h *Hub) Register(client *Client) error {
 	logger.Info("Registering new client",
 		zap.String("room_id", client.RoomID),
 		zap.Uint("user_id", client.UserID))
-	h.register <- client
+
+	if h.closing.Load() {
+		return ErrHubClosed
+	}
+
+	req := registration{client: client, result: make(chan error, 1)}
+	select {
+	case h.register <- req:
+		return <-req.result
+	case <-h.stop:
+		return ErrHubClosed
+	}
+}
+
+// OnPresence sets a function to call, in a goroutine of its own, whenever a
+// user's first connection to a room is registered or their last one closes
+// or is disconnected. Calls for the same user may run in any order, so fn
+// should ask HasUser rather than assume which change it was called for.
+// Shutdown calls it once for every user it disconnects and waits for those
+// calls, since a client may never reconnect after a restart.
+func (h *Hub) OnPresence(fn func(roomID string, userID uint)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.onPresence = fn
+}
+
+// HasUser reports whether a user has any connection to a room
+func (h *Hub) HasUser(roomID string, userID uint) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return hasUser(h.rooms[roomID], userID)
+}
+
+// IsRoomFull reports whether a room has reached the configured capacity
+func (h *Hub) IsRoomFull(roomID string) bool {
+	limit := h.Limits().MaxClientsPerRoom
+	return limit > 0 && h.GetClientsInRoom(roomID) >= limit
 }
 
 // Unregister removes a client from the hub
@@ -45,52 +154,322 @@ func (h *Hub) Unregister(client *Client) {
 	logger.Info("Unregistering client",
 		zap.String("room_id", client.RoomID),
 		zap.Uint("user_id", client.UserID))
-	h.unregister <- client
+
+	select {
+	case h.unregister <- client:
+	case <-h.stop:
+		// Shutdown already detached every client
+	}
+}
+
+// IsClosing reports whether the hub has started shutting down
+func (h *Hub) IsClosing() bool {
+	return h.closing.Load()
 }
 
-// Run starts the hub's main loop
+// IsRunning reports whether the hub's main loop is processing clients
+func (h *Hub) IsRunning() bool {
+	return h.running.Load()
+}
+
+// Run starts the hub's main loop. It returns once Shutdown is called.
 func (h *Hub) Run() {
 	logger.Info("Starting WebSocket hub")
+	h.running.Store(true)
+	defer h.running.Store(false)
+
 	for {
 		select {
-		case client := <-h.register:
+		case req := <-h.register:
+			client := req.client
 			h.mu.Lock()
+			if h.closing.Load() {
+				// Shutdown raced with this registration; let the client go
+				h.mu.Unlock()
+				req.result <- ErrHubClosed
+				continue
+			}
+			if limit := h.Limits().MaxClientsPerRoom; limit > 0 && len(h.rooms[client.RoomID]) >= limit {
+				h.mu.Unlock()
+				metrics.WSJoinsRejected.Inc()
+				logger.Warn("Rejecting client, room is full",
+					zap.String("room_id", client.RoomID),
+					zap.Uint("user_id", client.UserID),
+					zap.Int("max_clients_per_room", limit))
+				req.result <- ErrRoomFull
+				continue
+			}
 			if _, ok := h.rooms[client.RoomID]; !ok {
 				logger.Info("Creating new room", zap.String("room_id", client.RoomID))
 				h.rooms[client.RoomID] = make(map[*Client]bool)
+				h.stats[client.RoomID] = newRoomStats()
+				metrics.WSRooms.Inc()
 			}
+			arrived := !hasUser(h.rooms[client.RoomID], client.UserID)
 			h.rooms[client.RoomID][client] = true
+			metrics.WSConnections.Inc()
+			if h.onPresence != nil && arrived {
+				go h.onPresence(client.RoomID, client.UserID)
+			}
 			logger.Info("Client registered successfully",
 				zap.String("room_id", client.RoomID),
 				zap.Uint("user_id", client.UserID),
 				zap.Int("total_clients_in_room", len(h.rooms[client.RoomID])))
 			h.mu.Unlock()
+			req.result <- nil
 
 		case client := <-h.unregister:
 			h.mu.Lock()
-			if _, ok := h.rooms[client.RoomID]; ok {
-				if _, ok := h.rooms[client.RoomID][client]; ok {
-					delete(h.rooms[client.RoomID], client)
-					close(client.send)
-					logger.Info("Client unregistered",
-						zap.String("room_id", client.RoomID),
-						zap.Uint("user_id", client.UserID),
-						zap.Int("remaining_clients_in_room", len(h.rooms[client.RoomID])))
-
-					// If room is empty, remove it
-					if len(h.rooms[client.RoomID]) == 0 {
-						delete(h.rooms, client.RoomID)
-						logger.Info("Removed empty room", zap.String("room_id", client.RoomID))
-					}
+			h.removeClient(client)
+			h.mu.Unlock()
+
+		case <-h.stop:
+			logger.Info("Stopping WebSocket hub")
+			return
+		}
+	}
+}
+
+// removeClient detaches a client from its room, closing its send channel and
+// removing the room once it is empty. It is a no-op for clients that were
+// already removed. The caller must hold h.mu for writing.
+func (h *Hub) removeClient(client *Client) {
+	room, ok := h.rooms[client.RoomID]
+	if !ok {
+		return
+	}
+	if _, ok := room[client]; !ok {
+		return
+	}
+
+	delete(room, client)
+	close(client.send)
+	metrics.WSConnections.Dec()
+	logger.Info("Client unregistered",
+		zap.String("room_id", client.RoomID),
+		zap.Uint("user_id", client.UserID),
+		zap.Int("remaining_clients_in_room", len(room)))
+
+	if h.onPresence != nil && !hasUser(room, client.UserID) {
+		go h.onPresence(client.RoomID, client.UserID)
+	}
+
+	// If room is empty, remove it
+	if len(room) == 0 {
+		delete(h.rooms, client.RoomID)
+		delete(h.stats, client.RoomID)
+		metrics.WSRooms.Dec()
+		logger.Info("Removed empty room", zap.String("room_id", client.RoomID))
+	}
+}
+
+// hasUser reports whether any client in room belongs to the user
+func hasUser(room map[*Client]bool, userID uint) bool {
+	for client := range room {
+		if client.UserID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// Shutdown stops the hub from accepting new clients, tells every connected
+// client that the server is restarting, and closes their connections with
+// CloseGoingAway once their send buffers have been drained. It blocks until
+// all write pumps and presence callbacks have finished or the context is done.
+func (h *Hub) Shutdown(ctx context.Context) error {
+	h.closing.Store(true)
+	h.stopOnce.Do(func() { close(h.stop) })
+
+	type member struct {
+		roomID string
+		userID uint
+	}
+
+	h.mu.Lock()
+	var clients []*Client
+	left := make(map[member]bool)
+	for roomID, room := range h.rooms {
+		notice, err := NewMessage(MessageTypeSystem, ShutdownNotice{
+			Event:            SystemEventServerRestarting,
+			Message:          "server restarting",
+			ReconnectAfterMs: reconnectDelay.Milliseconds(),
+		}, roomID, 0).Marshal()
+		if err != nil {
+			notice = nil
+		}
+
+		for client := range room {
+			if notice != nil {
+				select {
+				case client.send <- outboundMessage{msgType: MessageTypeSystem, data: notice}:
+				default:
+					metrics.WSMessagesDropped.Inc()
+					logger.Warn("Send buffer full, skipping shutdown notice",
+						zap.String("room_id", roomID),
+						zap.Uint("user_id", client.UserID))
 				}
 			}
-			h.mu.Unlock()
+			close(client.send)
+			metrics.WSConnections.Dec()
+			clients = append(clients, client)
+			left[member{roomID, client.UserID}] = true
+		}
+		delete(h.rooms, roomID)
+		delete(h.stats, roomID)
+		metrics.WSRooms.Dec()
+	}
+	onPresence := h.onPresence
+	h.mu.Unlock()
+
+	var presence sync.WaitGroup
+	if onPresence != nil {
+		for m := range left {
+			presence.Add(1)
+			go func() {
+				defer presence.Done()
+				onPresence(m.roomID, m.userID)
+			}()
+		}
+	}
+	presenceDone := make(chan struct{})
+	go func() {
+		presence.Wait()
+		close(presenceDone)
+	}()
+
+	logger.Info("Draining WebSocket clients", zap.Int("clients", len(clients)))
+
+	for _, client := range clients {
+		select {
+		case <-client.done:
+		case <-ctx.Done():
+			logger.Warn("Timed out draining WebSocket clients, closing remaining connections",
+				zap.Error(ctx.Err()))
+			for _, c := range clients {
+				c.conn.Close()
+			}
+			return ctx.Err()
 		}
 	}
+
+	select {
+	case <-presenceDone:
+	case <-ctx.Done():
+		logger.Warn("Timed out recording users leaving their rooms", zap.Error(ctx.Err()))
+		return ctx.Err()
+	}
+
+	logger.Info("WebSocket hub shut down")
+	return nil
+}
+
+// CloseRoom disconnects every client in a room, telling them why with a
+// room_closed system message and closing with CloseNormalClosure. It returns
+// the number of clients disconnected.
+func (h *Hub) CloseRoom(roomID, reason string) int {
+	return h.disconnect(func(c *Client) bool { return c.RoomID == roomID },
+		SystemEventRoomClosed, reason, websocket.CloseNormalClosure)
+}
+
+// DisconnectUser disconnects every connection a user holds, in any room,
+// closing with ClosePolicyViolation. It returns the number of clients
+// disconnected.
+func (h *Hub) DisconnectUser(userID uint, reason string) int {
+	return h.disconnect(func(c *Client) bool { return c.UserID == userID },
+		SystemEventDisconnected, reason, websocket.ClosePolicyViolation)
 }
 
-// Broadcast sends a message to all clients in a room
-func (h *Hub) Broadcast(roomID string, message []byte) {
+// DisconnectSession disconnects every connection opened with a login
+// session, closing with ClosePolicyViolation. It returns the number of
+// clients disconnected.
+func (h *Hub) DisconnectSession(sessionID uint, reason string) int {
+	if sessionID == 0 {
+		return 0
+	}
+	return h.disconnect(func(c *Client) bool { return c.SessionID == sessionID },
+		SystemEventDisconnected, reason, websocket.ClosePolicyViolation)
+}
+
+// DisconnectAPIKey disconnects every connection opened with an API key,
+// closing with ClosePolicyViolation. It returns the number of clients
+// disconnected.
+func (h *Hub) DisconnectAPIKey(apiKeyID uint, reason string) int {
+	if apiKeyID == 0 {
+		return 0
+	}
+	return h.disconnect(func(c *Client) bool { return c.APIKeyID == apiKeyID },
+		SystemEventDisconnected, reason, websocket.ClosePolicyViolation)
+}
+
+// disconnect sends a system notice to every client matching match and removes
+// it from the hub. Pending messages are flushed before the connection is
+// closed with code and reason.
+func (h *Hub) disconnect(match func(*Client) bool, event, reason string, code int) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var clients []*Client
+	for _, room := range h.rooms {
+		for client := range room {
+			if match(client) {
+				clients = append(clients, client)
+			}
+		}
+	}
+
+	for _, client := range clients {
+		notice, err := NewMessage(MessageTypeSystem, DisconnectNotice{
+			Event:   event,
+			Message: reason,
+		}, client.RoomID, 0).Marshal()
+		if err == nil {
+			select {
+			case client.send <- outboundMessage{msgType: MessageTypeSystem, data: notice}:
+			default:
+				metrics.WSMessagesDropped.Inc()
+			}
+		}
+		client.closeCode = code
+		client.closeReason = reason
+		logger.Info("Disconnecting client",
+			zap.String("room_id", client.RoomID),
+			zap.Uint("user_id", client.UserID),
+			zap.String("event", event))
+		h.removeClient(client)
+	}
+	return len(clients)
+}
+
+// Broadcast sends a message to all clients in the message's room. The trace
+// context of the broadcast span is added to the message metadata so
+// recipients can correlate it.
+func (h *Hub) Broadcast(ctx context.Context, msg *Message) error {
+	ctx, span := tracing.Tracer().Start(ctx, "websocket.broadcast",
+		trace.WithAttributes(
+			attribute.String("websocket.message.type", string(msg.Type)),
+			attribute.String("websocket.room_id", msg.RoomID),
+		))
+	defer span.End()
+
+	if msg.Metadata == nil {
+		msg.Metadata = make(map[string]string)
+	}
+	tracing.Inject(ctx, msg.Metadata)
+
+	message, err := msg.Marshal()
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+	roomID := msg.RoomID
+	outbound := outboundMessage{msgType: msg.Type, data: message, ctx: ctx}
+
+	// Clients whose send buffer is full; they are removed after the read lock
+	// is released since removal mutates the room
+	var slow []*Client
+
 	h.mu.RLock()
 	if clients, ok := h.rooms[roomID]; ok {
 		logger.Debug("Broadcasting message",
@@ -98,27 +477,60 @@ func (h *Hub) Broadcast(roomID string, message []byte) {
 			zap.Int("num_clients", len(clients)),
 			zap.Int("message_size", len(message)))
 
+		if rs, ok := h.stats[roomID]; ok {
+			rs.record(time.Now())
+		}
+
 		successfulSends := 0
 		for client := range clients {
 			select {
-			case client.send <- message:
+			case client.send <- outbound:
 				successfulSends++
 			default:
+				metrics.WSMessagesDropped.Inc()
 				logger.Warn("Failed to send message to client, removing client",
 					zap.String("room_id", roomID),
 					zap.Uint("user_id", client.UserID))
-				close(client.send)
-				delete(clients, client)
+				slow = append(slow, client)
 			}
 		}
 		logger.Debug("Broadcast complete",
 			zap.String("room_id", roomID),
 			zap.Int("successful_sends", successfulSends))
+		span.SetAttributes(
+			attribute.Int("websocket.recipients", len(clients)),
+			attribute.Int("websocket.successful_sends", successfulSends))
 	} else {
 		logger.Warn("Attempted to broadcast to non-existent room",
 			zap.String("room_id", roomID))
 	}
 	h.mu.RUnlock()
+
+	if len(slow) > 0 {
+		h.mu.Lock()
+		for _, client := range slow {
+			h.removeClient(client)
+		}
+		h.mu.Unlock()
+	}
+
+	return nil
+}
+
+// sendTo queues a message for a single client if it is still registered,
+// dropping it if the client's send buffer is full
+func (h *Hub) sendTo(client *Client, message outboundMessage) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if !h.rooms[client.RoomID][client] {
+		return
+	}
+	select {
+	case client.send <- message:
+	default:
+		metrics.WSMessagesDropped.Inc()
+	}
 }
 
 // GetClientsInRoom returns the number of clients in a room
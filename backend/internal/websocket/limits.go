@@ -0,0 +1,53 @@
+package websocket
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrRoomFull is returned when a client joins a room that is at capacity
+var ErrRoomFull = errors.New("room is full")
+
+// Limits bounds room sizes and client message rates. They can be changed
+// while the hub is running and apply to new joins and messages immediately.
+type Limits struct {
+	// MaxClientsPerRoom caps the number of clients in one room, zero means unlimited
+	MaxClientsPerRoom int
+
+	// MessageRate is the sustained number of messages per second a client may
+	// send, zero means unlimited
+	MessageRate float64
+
+	// MessageBurst is how many messages a client may send back to back before
+	// MessageRate applies
+	MessageBurst int
+}
+
+// tokenBucket limits the rate of messages read from a single client. It is
+// only used from the client's read pump and needs no locking.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// allow reports whether a message may be sent now and consumes a token if so.
+// The rate and burst are passed on every call so limit changes apply at once.
+func (b *tokenBucket) allow(now time.Time, rate float64, burst int) bool {
+	if rate <= 0 {
+		return true
+	}
+	capacity := float64(max(burst, 1))
+
+	if b.last.IsZero() {
+		b.tokens = capacity
+	} else {
+		b.tokens = min(capacity, b.tokens+now.Sub(b.last).Seconds()*rate)
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
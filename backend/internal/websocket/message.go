@@ -18,6 +18,35 @@ const (
 	MessageTypeSystem   MessageType = "system"
 )
 
+// messageTypeUnknown labels metrics for message types the server does not know
+const messageTypeUnknown = "unknown"
+
+// metricLabel returns the type as a metric label, folding any type a client
+// made up into a single "unknown" label so clients cannot create new series
+func (t MessageType) metricLabel() string {
+	switch t {
+	case MessageTypeChat, MessageTypePresence, MessageTypeSystem:
+		return string(t)
+	default:
+		return messageTypeUnknown
+	}
+}
+
+const (
+	// SystemEventServerRestarting is sent when the server is shutting down
+	SystemEventServerRestarting = "server_restarting"
+
+	// SystemEventRateLimited is sent when a client's message was discarded by the rate limit
+	SystemEventRateLimited = "rate_limited"
+
+	// SystemEventRoomClosed is sent when a moderator ends the call a room belongs to
+	SystemEventRoomClosed = "room_closed"
+
+	// SystemEventDisconnected is sent when the server disconnects a user, for
+	// example because their account was disabled
+	SystemEventDisconnected = "disconnected"
+)
+
 // Message represents a structured WebSocket message
 type Message struct {
 	Type      MessageType `json:"type"`
@@ -25,6 +54,32 @@ type Message struct {
 	RoomID    string      `json:"room_id"`
 	UserID    uint        `json:"user_id"`
 	Timestamp time.Time   `json:"timestamp"`
+
+	// Metadata carries out-of-band values such as the W3C trace context
+	// ("traceparent", "tracestate") used to trace a message end to end
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// ShutdownNotice is the payload of the system message sent to every client
+// before the server closes their connection
+type ShutdownNotice struct {
+	Event            string `json:"event"`
+	Message          string `json:"message"`
+	ReconnectAfterMs int64  `json:"reconnect_after_ms"`
+}
+
+// RateLimitNotice is the payload of the system message sent to a client whose
+// message was discarded for exceeding the message rate limit
+type RateLimitNotice struct {
+	Event   string `json:"event"`
+	Message string `json:"message"`
+}
+
+// DisconnectNotice is the payload of the system message sent to a client
+// before the server closes its connection for a reason other than a restart
+type DisconnectNotice struct {
+	Event   string `json:"event"`
+	Message string `json:"message"`
 }
 
 // NewMessage creates a new message with the current timestamp
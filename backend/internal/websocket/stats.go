@@ -0,0 +1,150 @@
+package websocket
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// rateWindowSeconds is the length of the sliding window used for message rates
+const rateWindowSeconds = 60
+
+// HubStats is a point-in-time snapshot of the hub used for diagnostics
+type HubStats struct {
+	Running      bool        `json:"running"`
+	Closing      bool        `json:"closing"`
+	TotalClients int         `json:"total_clients"`
+	Rooms        []RoomStats `json:"rooms"`
+}
+
+// RoomStats describes a single room in a HubStats snapshot
+type RoomStats struct {
+	RoomID            string        `json:"room_id"`
+	Clients           int           `json:"clients"`
+	CreatedAt         time.Time     `json:"created_at"`
+	MessagesTotal     uint64        `json:"messages_total"`
+	MessagesPerMinute uint64        `json:"messages_per_minute"`
+	ClientDetails     []ClientStats `json:"client_details"`
+}
+
+// ClientStats describes a single client in a RoomStats snapshot
+type ClientStats struct {
+	UserID          uint `json:"user_id"`
+	SendBufferDepth int  `json:"send_buffer_depth"`
+	SendBufferSize  int  `json:"send_buffer_size"`
+}
+
+// roomStats tracks message counters for a room
+type roomStats struct {
+	mu        sync.Mutex
+	createdAt time.Time
+	total     uint64
+	window    rateWindow
+}
+
+func newRoomStats() *roomStats {
+	return &roomStats{createdAt: time.Now()}
+}
+
+// record counts one message broadcast to the room
+func (s *roomStats) record(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.total++
+	s.window.add(now)
+}
+
+// snapshot returns the total message count and the count over the last minute
+func (s *roomStats) snapshot(now time.Time) (uint64, uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.total, s.window.sum(now)
+}
+
+// rateWindow counts events in one-second buckets over a sliding window
+type rateWindow struct {
+	buckets [rateWindowSeconds]uint64
+	seconds [rateWindowSeconds]int64
+}
+
+func (w *rateWindow) add(now time.Time) {
+	sec := now.Unix()
+	i := sec % rateWindowSeconds
+	if w.seconds[i] != sec {
+		w.seconds[i] = sec
+		w.buckets[i] = 0
+	}
+	w.buckets[i]++
+}
+
+func (w *rateWindow) sum(now time.Time) uint64 {
+	sec := now.Unix()
+	var total uint64
+	for i := range w.buckets {
+		if sec-w.seconds[i] < rateWindowSeconds {
+			total += w.buckets[i]
+		}
+	}
+	return total
+}
+
+// Stats returns a snapshot of all rooms, their clients and message rates
+func (h *Hub) Stats() HubStats {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	now := time.Now()
+	stats := HubStats{
+		Running: h.IsRunning(),
+		Closing: h.IsClosing(),
+		Rooms:   make([]RoomStats, 0, len(h.rooms)),
+	}
+
+	for roomID, clients := range h.rooms {
+		stats.TotalClients += len(clients)
+		stats.Rooms = append(stats.Rooms, h.roomStats(roomID, clients, now))
+	}
+
+	sort.Slice(stats.Rooms, func(i, j int) bool {
+		return stats.Rooms[i].RoomID < stats.Rooms[j].RoomID
+	})
+
+	return stats
+}
+
+// RoomStats returns a snapshot of a single room. The second result is false
+// if the room has no clients.
+func (h *Hub) RoomStats(roomID string) (RoomStats, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	clients, ok := h.rooms[roomID]
+	if !ok {
+		return RoomStats{}, false
+	}
+	return h.roomStats(roomID, clients, time.Now()), true
+}
+
+// roomStats builds the snapshot of one room. The caller must hold h.mu.
+func (h *Hub) roomStats(roomID string, clients map[*Client]bool, now time.Time) RoomStats {
+	room := RoomStats{
+		RoomID:        roomID,
+		Clients:       len(clients),
+		ClientDetails: make([]ClientStats, 0, len(clients)),
+	}
+	if rs, ok := h.stats[roomID]; ok {
+		room.CreatedAt = rs.createdAt
+		room.MessagesTotal, room.MessagesPerMinute = rs.snapshot(now)
+	}
+	for client := range clients {
+		room.ClientDetails = append(room.ClientDetails, ClientStats{
+			UserID:          client.UserID,
+			SendBufferDepth: len(client.send),
+			SendBufferSize:  cap(client.send),
+		})
+	}
+	sort.Slice(room.ClientDetails, func(i, j int) bool {
+		return room.ClientDetails[i].UserID < room.ClientDetails[j].UserID
+	})
+	return room
+}